@@ -4,6 +4,7 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -28,9 +29,15 @@ var (
 )
 
 func main() {
+	// Subcommands are dispatched before flag parsing so they can own their flags
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(runHeadless(os.Args[2:]))
+	}
+
 	// Flags
 	configPath := flag.String("config", "", "Path to configuration file")
 	projectPath := flag.String("project", ".", "Path to project to analyze")
+	resumeID := flag.String("resume", "", "Resume a saved session by ID (see /session list)")
 	showVersion := flag.Bool("version", false, "Show version")
 	showHelp := flag.Bool("help", false, "Show help")
 	flag.Parse()
@@ -52,40 +59,10 @@ func main() {
 	}
 
 	// Check API key — also allow OAuth credentials as alternative
-	oauthStore, _ := config.LoadAllOAuth()
+	oauthStore := refreshOAuthTokens(os.Stdout)
 	hasAnyOAuth := len(oauthStore) > 0
 
-	// Auto-refresh all OAuth tokens
-	for provider, creds := range oauthStore {
-		if creds != nil && creds.NeedsRefresh() && creds.RefreshToken != "" {
-			fmt.Printf("🔄 Refreshing %s OAuth token...\n", provider)
-			var newCreds *config.OAuthCredentials
-			var refreshErr error
-			switch provider {
-			case "anthropic":
-				newCreds, refreshErr = llm.RefreshOAuthToken(creds.RefreshToken)
-			case "openai":
-				newCreds, refreshErr = llm.RefreshOpenAIToken(creds.RefreshToken)
-			case "google":
-				newCreds, refreshErr = llm.RefreshGoogleToken(creds.RefreshToken)
-				if refreshErr == nil && newCreds != nil {
-					newCreds.ProjectID = creds.ProjectID // preserve projectID
-				}
-			}
-			if refreshErr != nil {
-				fmt.Printf("⚠️  %s OAuth token refresh failed: %v\n", provider, refreshErr)
-				fmt.Println("   Use /login to re-authenticate.")
-			} else if newCreds != nil {
-				oauthStore[provider] = newCreds
-				if err := config.SaveOAuth(newCreds); err != nil {
-					fmt.Printf("⚠️  Failed to persist refreshed %s token: %v\n", provider, err)
-				}
-				fmt.Printf("✅ %s OAuth token refreshed.\n", provider)
-			}
-		}
-	}
-
-	if cfg.APIKey == "" && !hasAnyOAuth {
+	if cfg.APIKey == "" && !hasAnyOAuth && cfg.NeedsAPIKey() {
 		fmt.Println("⚡ Welcome to ClosedWheelerAGI!")
 		fmt.Println("   First time setup detected.")
 		fmt.Println()
@@ -148,6 +125,14 @@ func main() {
 		log.Fatalf("❌ Failed to create agent: %v", err)
 	}
 
+	if *resumeID != "" {
+		rec, err := ag.ResumeSession(*resumeID)
+		if err != nil {
+			log.Fatalf("❌ Failed to resume session: %v", err)
+		}
+		fmt.Printf("📂 Resuming session %s: %s\n", rec.ID, rec.Title)
+	}
+
 	// Context for graceful shutdown — cancelling it forces bubbletea to exit
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -201,6 +186,43 @@ func main() {
 	os.Exit(0)
 }
 
+// refreshOAuthTokens loads all stored OAuth credentials and refreshes any that
+// are close to expiry. Progress messages are written to out.
+func refreshOAuthTokens(out io.Writer) map[string]*config.OAuthCredentials {
+	oauthStore, _ := config.LoadAllOAuth()
+
+	for provider, creds := range oauthStore {
+		if creds != nil && creds.NeedsRefresh() && creds.RefreshToken != "" {
+			fmt.Fprintf(out, "🔄 Refreshing %s OAuth token...\n", provider)
+			var newCreds *config.OAuthCredentials
+			var refreshErr error
+			switch provider {
+			case "anthropic":
+				newCreds, refreshErr = llm.RefreshOAuthToken(creds.RefreshToken)
+			case "openai":
+				newCreds, refreshErr = llm.RefreshOpenAIToken(creds.RefreshToken)
+			case "google":
+				newCreds, refreshErr = llm.RefreshGoogleToken(creds.RefreshToken)
+				if refreshErr == nil && newCreds != nil {
+					newCreds.ProjectID = creds.ProjectID // preserve projectID
+				}
+			}
+			if refreshErr != nil {
+				fmt.Fprintf(out, "⚠️  %s OAuth token refresh failed: %v\n", provider, refreshErr)
+				fmt.Fprintln(out, "   Use /login to re-authenticate.")
+			} else if newCreds != nil {
+				oauthStore[provider] = newCreds
+				if err := config.SaveOAuth(newCreds); err != nil {
+					fmt.Fprintf(out, "⚠️  Failed to persist refreshed %s token: %v\n", provider, err)
+				}
+				fmt.Fprintf(out, "✅ %s OAuth token refreshed.\n", provider)
+			}
+		}
+	}
+
+	return oauthStore
+}
+
 func printBanner() {
 	banner := `
   ╔═══════════════════════════════════════════════════════════════╗
@@ -217,12 +239,15 @@ func printBanner() {
 func printHelp() {
 	fmt.Printf("Coder AGI v%s - Intelligent coding assistant\n\n", version)
 	fmt.Println("Usage: ClosedWheeler [options]")
+	fmt.Println("       ClosedWheeler run [run options] [prompt]")
 	fmt.Println()
 	fmt.Println("Options:")
 	fmt.Println("  -project string")
 	fmt.Println("        Path to project directory (default: current directory)")
 	fmt.Println("  -config string")
 	fmt.Println("        Path to configuration file")
+	fmt.Println("  -resume string")
+	fmt.Println("        Resume a saved session by ID (see /session list)")
 	fmt.Println("  -version")
 	fmt.Println("        Show version")
 	fmt.Println("  -help")
@@ -237,4 +262,9 @@ func printHelp() {
 	fmt.Println("  ClosedWheeler")
 	fmt.Println("  ClosedWheeler -project /path/to/myproject")
 	fmt.Println("  ClosedWheeler -config ~/.agi/config.json")
+	fmt.Println("  ClosedWheeler --resume 3f2a9c1e")
+	fmt.Println("  ClosedWheeler run -prompt \"fix the failing tests\" -json")
+	fmt.Println("  cat task.md | ClosedWheeler run -json")
+	fmt.Println()
+	fmt.Println("Run 'ClosedWheeler run -help' for headless mode options.")
 }
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"ClosedWheeler/pkg/agent"
+	"ClosedWheeler/pkg/config"
+)
+
+// Exit codes for headless runs
+const (
+	exitOK          = 0
+	exitLLMFailure  = 1
+	exitToolFailure = 2
+	exitUsage       = 64
+)
+
+// runResult is the JSON document emitted by `run -json`
+type runResult struct {
+	SessionID  string                 `json:"session_id"`
+	Answer     string                 `json:"answer"`
+	ToolCalls  []agent.ToolCallRecord `json:"tool_calls"`
+	Usage      map[string]any         `json:"usage"`
+	Status     string                 `json:"status"`
+	ExitCode   int                    `json:"exit_code"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMs int64                  `json:"duration_ms"`
+}
+
+// runHeadless drives a single Agent.Chat turn without a TTY and returns the process exit code
+func runHeadless(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	configPath := fs.String("config", "", "Path to configuration file")
+	projectPath := fs.String("project", ".", "Path to project to analyze")
+	prompt := fs.String("prompt", "", "Prompt to send to the agent")
+	promptFile := fs.String("prompt-file", "", "Read the prompt from a file ('-' for stdin)")
+	jsonOutput := fs.Bool("json", false, "Print a JSON document instead of the plain answer")
+	verbose := fs.Bool("verbose", false, "Print agent status updates to stderr")
+	resumeID := fs.String("resume", "", "Continue a saved session by ID")
+	eventsPath := fs.String("events", "", "Write the agent event stream as JSONL to a file ('-' for stderr)")
+	recordPath := fs.String("record", "", "Record LLM traffic to a cassette file (secrets are redacted)")
+	replayPath := fs.String("replay", "", "Replay LLM traffic from a cassette file instead of calling the API")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: ClosedWheeler run [options] [prompt]")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Runs a single prompt to completion without the TUI.")
+		fmt.Fprintln(os.Stderr, "The prompt is taken from -prompt, -prompt-file, trailing arguments or stdin.")
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Options:")
+		fs.PrintDefaults()
+		fmt.Fprintln(os.Stderr)
+		fmt.Fprintln(os.Stderr, "Exit codes: 0 success, 1 LLM failure, 2 tool failure, 64 usage error")
+		fmt.Fprintln(os.Stderr, "A failed tool call counts as a tool failure only if no later call of the same tool succeeded.")
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+
+	input, err := readPrompt(*prompt, *promptFile, fs.Args(), os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return exitUsage
+	}
+
+	cfg, _, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return exitUsage
+	}
+
+	switch {
+	case *recordPath != "" && *replayPath != "":
+		fmt.Fprintln(os.Stderr, "❌ -record and -replay cannot be used together")
+		return exitUsage
+	case *recordPath != "":
+		cfg.Cassette, cfg.CassetteMode = *recordPath, "record"
+	case *replayPath != "":
+		cfg.Cassette, cfg.CassetteMode = *replayPath, "replay"
+	}
+
+	// Status output goes to stderr so stdout only carries the answer
+	oauthStore := refreshOAuthTokens(os.Stderr)
+	if cfg.APIKey == "" && len(oauthStore) == 0 && cfg.NeedsAPIKey() {
+		fmt.Fprintln(os.Stderr, "❌ No API key or OAuth credentials configured. Run ClosedWheeler once interactively to set up.")
+		return exitUsage
+	}
+
+	// Remote approvals need the Telegram poller, which headless runs don't start
+	cfg.Telegram.Enabled = false
+
+	absProjectPath, err := filepath.Abs(*projectPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Invalid project path: %v\n", err)
+		return exitUsage
+	}
+	if _, err := os.Stat(absProjectPath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "❌ Project path does not exist: %s\n", absProjectPath)
+		return exitUsage
+	}
+
+	appRoot, err := os.Getwd()
+	if err != nil {
+		appRoot = "."
+	}
+
+	ag, err := agent.NewAgent(cfg, absProjectPath, appRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to create agent: %v\n", err)
+		return exitLLMFailure
+	}
+	defer ag.Shutdown()
+
+	if *resumeID != "" {
+		if _, err := ag.ResumeSession(*resumeID); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to resume session: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	if *verbose {
+		ag.Subscribe(func(e agent.Event) {
+			if e.Type != agent.EventProgress {
+				if summary := e.Summary(); summary != "" {
+					fmt.Fprintln(os.Stderr, summary)
+				}
+				return
+			}
+			p := e.Progress
+			if p.Type == agent.ProgressSubAgent {
+				return
+			}
+			if p.Type == agent.ProgressPull {
+				fmt.Fprintln(os.Stderr, p.Status)
+				return
+			}
+			if p.Type == agent.ProgressBudgetExhausted {
+				fmt.Fprintf(os.Stderr, "⏸️ Budget exhausted: %s\n", p.Reason)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "🔁 Step %d: %d tool call(s), %d tokens, %s\n", p.Step, p.ToolCalls, p.Tokens, p.Elapsed.Round(time.Second))
+		})
+	}
+
+	switch *eventsPath {
+	case "":
+	case "-":
+		ag.Subscribe(agent.JSONLWriter(os.Stderr))
+	default:
+		stop, err := ag.ExportEvents(*eventsPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return exitUsage
+		}
+		defer stop()
+	}
+
+	// First signal cancels the turn, second force-exits
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-ctx.Done():
+			return
+		}
+		<-sigCh
+		os.Exit(exitLLMFailure)
+	}()
+
+	start := time.Now()
+	answer, chatErr := ag.ChatContext(ctx, input)
+
+	result := runResult{
+		SessionID:  ag.SessionID(),
+		Answer:     answer,
+		ToolCalls:  ag.GetLastToolCalls(),
+		Usage:      ag.GetUsageStats(),
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if result.ToolCalls == nil {
+		result.ToolCalls = []agent.ToolCallRecord{}
+	}
+
+	result.Status, result.ExitCode, result.Error = classifyRun(chatErr, result.ToolCalls)
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to encode result: %v\n", err)
+		}
+	} else {
+		if result.Answer != "" {
+			fmt.Println(result.Answer)
+		}
+		if result.Error != "" {
+			fmt.Fprintf(os.Stderr, "❌ %s\n", result.Error)
+		}
+	}
+
+	return result.ExitCode
+}
+
+// readPrompt resolves the prompt from, in order: -prompt, -prompt-file, positional args, stdin
+func readPrompt(prompt, promptFile string, args []string, stdin io.Reader) (string, error) {
+	if prompt == "" && promptFile != "" {
+		var data []byte
+		var err error
+		if promptFile == "-" {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(promptFile)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt file: %w", err)
+		}
+		prompt = string(data)
+	}
+
+	if prompt == "" && len(args) > 0 {
+		prompt = strings.Join(args, " ")
+	}
+
+	if prompt == "" && stdinIsPiped() {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return "", fmt.Errorf("failed to read prompt from stdin: %w", err)
+		}
+		prompt = string(data)
+	}
+
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return "", fmt.Errorf("no prompt given (use -prompt, -prompt-file, arguments or stdin)")
+	}
+	return prompt, nil
+}
+
+// stdinIsPiped reports whether stdin is a pipe or file rather than a terminal
+var stdinIsPiped = func() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// classifyRun maps the outcome of a turn to its status, exit code and error message
+func classifyRun(chatErr error, calls []agent.ToolCallRecord) (status string, exitCode int, message string) {
+	switch {
+	case errors.Is(chatErr, context.Canceled):
+		return "cancelled", exitLLMFailure, chatErr.Error()
+	case chatErr != nil:
+		return "llm_error", exitLLMFailure, chatErr.Error()
+	}
+	if failed := countUnrecoveredTools(calls); failed > 0 {
+		return "tool_error", exitToolFailure, fmt.Sprintf("%d tool call(s) failed", failed)
+	}
+	return "success", exitOK, ""
+}
+
+// countUnrecoveredTools counts failed tool calls that no later call of the
+// same tool made up for, so a model that retried successfully still succeeds
+func countUnrecoveredTools(calls []agent.ToolCallRecord) int {
+	failed := 0
+	for i, c := range calls {
+		if c.Success {
+			continue
+		}
+		recovered := false
+		for _, later := range calls[i+1:] {
+			if later.Name == c.Name && later.Success {
+				recovered = true
+				break
+			}
+		}
+		if !recovered {
+			failed++
+		}
+	}
+	return failed
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ClosedWheeler/pkg/agent"
+)
+
+func TestReadPrompt(t *testing.T) {
+	promptFile := filepath.Join(t.TempDir(), "task.md")
+	if err := os.WriteFile(promptFile, []byte("from file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		prompt     string
+		promptFile string
+		args       []string
+		stdin      string
+		piped      bool
+		expected   string
+		wantErr    bool
+	}{
+		{"Flag wins", "from flag", promptFile, []string{"from", "args"}, "from stdin", true, "from flag", false},
+		{"File before args", "", promptFile, []string{"from", "args"}, "from stdin", true, "from file", false},
+		{"File from stdin", "", "-", []string{"from", "args"}, " from stdin ", true, "from stdin", false},
+		{"Args before stdin", "", "", []string{"from", "args"}, "from stdin", true, "from args", false},
+		{"Piped stdin", "", "", nil, "from stdin\n", true, "from stdin", false},
+		{"Terminal stdin is not read", "", "", nil, "from stdin", false, "", true},
+		{"Blank prompt", "  ", "", nil, "", false, "", true},
+		{"Missing file", "", filepath.Join(t.TempDir(), "missing.md"), nil, "", false, "", true},
+	}
+
+	defer func(orig func() bool) { stdinIsPiped = orig }(stdinIsPiped)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdinIsPiped = func() bool { return tt.piped }
+			got, err := readPrompt(tt.prompt, tt.promptFile, tt.args, strings.NewReader(tt.stdin))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got prompt '%s'", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestClassifyRun(t *testing.T) {
+	ok := func(name string) agent.ToolCallRecord { return agent.ToolCallRecord{Name: name, Success: true} }
+	fail := func(name string) agent.ToolCallRecord { return agent.ToolCallRecord{Name: name, Error: "boom"} }
+
+	tests := []struct {
+		name     string
+		err      error
+		calls    []agent.ToolCallRecord
+		status   string
+		exitCode int
+	}{
+		{"Success", nil, []agent.ToolCallRecord{ok("read_file")}, "success", exitOK},
+		{"No tools", nil, nil, "success", exitOK},
+		{"Cancelled", fmt.Errorf("turn aborted: %w", context.Canceled), nil, "cancelled", exitLLMFailure},
+		{"LLM error", errors.New("API error (status 500)"), []agent.ToolCallRecord{fail("read_file")}, "llm_error", exitLLMFailure},
+		{"Unrecovered tool failure", nil, []agent.ToolCallRecord{ok("read_file"), fail("exec_command")}, "tool_error", exitToolFailure},
+		{"Recovered by a retry", nil, []agent.ToolCallRecord{fail("exec_command"), ok("exec_command")}, "success", exitOK},
+		{"Other tool does not recover", nil, []agent.ToolCallRecord{fail("exec_command"), ok("read_file")}, "tool_error", exitToolFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, exitCode, message := classifyRun(tt.err, tt.calls)
+			if status != tt.status || exitCode != tt.exitCode {
+				t.Errorf("Expected %s/%d, got %s/%d", tt.status, tt.exitCode, status, exitCode)
+			}
+			if (status == "success") != (message == "") {
+				t.Errorf("Expected an error message only on failure, got '%s'", message)
+			}
+		})
+	}
+}
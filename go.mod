@@ -7,6 +7,7 @@ require (
 	github.com/charmbracelet/bubbletea v1.2.4
 	github.com/charmbracelet/lipgloss v1.0.0
 	github.com/playwright-community/playwright-go v0.5200.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
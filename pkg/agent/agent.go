@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"ClosedWheeler/pkg/brain"
@@ -22,12 +23,14 @@ import (
 	"ClosedWheeler/pkg/memory"
 	"ClosedWheeler/pkg/permissions"
 	"ClosedWheeler/pkg/prompts"
+	"ClosedWheeler/pkg/providers"
 	"ClosedWheeler/pkg/roadmap"
 	"ClosedWheeler/pkg/security"
 	"ClosedWheeler/pkg/skills"
 	"ClosedWheeler/pkg/telegram"
 	"ClosedWheeler/pkg/tools"
 	"ClosedWheeler/pkg/tools/builtin"
+	"ClosedWheeler/pkg/traces"
 	"ClosedWheeler/pkg/utils"
 )
 
@@ -41,7 +44,8 @@ type Agent struct {
 	executor       *tools.Executor
 	editManager    *editor.Manager
 	logger         *logger.Logger
-	statusCallback func(string)
+	events         *EventBus          // Typed event stream for the TUI, Telegram, logs and exporters
+	eventLogStop   func() error       // Closes the configured JSONL event log (nil when disabled)
 	appPath        string // Application root: where .agi/ lives (config, logs, skills, memory)
 	projectPath    string // Workplace path: sandbox for agent file operations
 	tgBot          *telegram.Bot
@@ -50,6 +54,12 @@ type Agent struct {
 	skillManager   *skills.Manager
 	permManager    *permissions.Manager
 	totalUsage     llm.Usage
+	cassette       *llm.Cassette // Records or replays LLM traffic (nil when disabled)
+	mockScenario   *llm.MockScenario // Scripted replies of the mock provider (nil when unset)
+	costs          *CostLedger   // Prices every call and enforces spending budgets (shared with clones)
+	providers      *providers.ProviderManager // Configured providers: stats, and the failover chain (shared with clones)
+	failover       bool                       // Fail over to the other providers when a request fails
+	breakerStop    func()                     // Stops reporting circuit breaker transitions (nil for clones)
 	lastRateLimits llm.RateLimits
 	approvalChan   chan bool          // Channel for Telegram approvals
 	ctx            context.Context    // Context for graceful shutdown
@@ -62,6 +72,29 @@ type Agent struct {
 	lastActivity   time.Time          // Track last activity for liveness checks
 	activityMu     sync.Mutex         // Separate mutex for activity to avoid deadlocks
 	streamCallback llm.StreamingCallback // Optional callback for streaming chunks to TUI
+	sessionStore   *SessionStore         // Persists sessions to .agi/sessions (nil for clones)
+	turnToolCalls  []ToolCallRecord      // Tool calls executed during the last Chat turn
+	turnTools      func(name string) bool // Tool restriction for the current turn (nil = all)
+	planMu         sync.Mutex            // Guards plan
+	plan           *Plan                 // Plan-then-execute state (nil when no plan is active)
+	delegateMu     sync.Mutex            // Guards subAgentUsage
+	subAgentUsage  llm.Usage             // Tokens used by delegated sub-agents
+	tokens         *llm.TokenEstimator   // Prompt token estimator calibrated by provider usage
+	usageMu        sync.Mutex            // Guards contextUsage, windowModel and window
+	contextUsage   ContextUsage          // Last and projected prompt size
+	windowModel    string                // Model the cached window belongs to
+	window         int                   // Cached context window of windowModel
+	localMissing   atomic.Bool           // The active local (Ollama) model is not installed
+	systemTokens   int                   // Estimated size of the last system prompt built
+}
+
+// ToolCallRecord describes a single tool execution within a Chat turn
+type ToolCallRecord struct {
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
 }
 
 // NewAgent creates a new agent instance
@@ -73,42 +106,46 @@ func NewAgent(cfg *config.Config, projectPath string, appPath string) (*Agent, e
 	}
 	hasAnyOAuth := len(oauthStore) > 0
 
-	if cfg.APIKey == "" && !hasAnyOAuth {
+	if cfg.APIKey == "" && !hasAnyOAuth && cfg.NeedsAPIKey() {
 		return nil, fmt.Errorf("API key is required (or use /login for OAuth)")
 	}
 
-	// Initialize LLM client with provider support
-	llmClient := llm.NewClientWithProvider(cfg.APIBaseURL, cfg.APIKey, cfg.Model, cfg.Provider)
+	// Trace HTTP traffic (LLM, OAuth, Telegram) to .agi/traces when enabled
+	configureTraces(cfg, appPath, oauthStore, nil)
 
-	// Wire in OAuth credentials for the active provider
-	providerName := llmClient.ProviderName()
-	// Google Gemini uses "openai" provider but OAuth is stored as "google"
-	oauthKey := providerName
-	if strings.Contains(cfg.APIBaseURL, "googleapis.com") {
-		oauthKey = "google"
-	}
-	if creds, ok := oauthStore[oauthKey]; ok && creds != nil {
-		llmClient.SetOAuthCredentials(creds)
-	} else if creds, ok := oauthStore[providerName]; ok && creds != nil {
-		llmClient.SetOAuthCredentials(creds)
-	}
-
-	// Wire in reasoning effort from config
-	if cfg.ReasoningEffort != "" {
-		llmClient.SetReasoningEffort(cfg.ReasoningEffort)
+	// The mock provider answers from a scripted scenario
+	var scenario *llm.MockScenario
+	if cfg.MockScenario != "" {
+		path := cfg.MockScenario
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(appPath, path)
+		}
+		var err error
+		scenario, err = llm.LoadMockScenario(path)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Configure fallback models if specified
-	if len(cfg.FallbackModels) > 0 {
-		llmClient.SetFallbackModels(cfg.FallbackModels, cfg.FallbackTimeout)
+	// Record or replay LLM traffic when a cassette is configured
+	var cassette *llm.Cassette
+	if cfg.Cassette != "" {
+		path := cfg.Cassette
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(appPath, path)
+		}
+		var err error
+		cassette, err = llm.OpenCassette(path, llm.CassetteMode(cfg.CassetteMode), trafficSecrets(cfg, oauthStore, nil)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open cassette: %w", err)
+		}
 	}
 
 	// Initialize memory manager
 	memConfig := &memory.Config{
-		MaxShortTermItems:  cfg.Memory.MaxShortTermItems,
-		MaxWorkingItems:    cfg.Memory.MaxWorkingItems,
-		MaxLongTermItems:   cfg.Memory.MaxLongTermItems,
-		CompressionTrigger: cfg.Memory.CompressionTrigger,
+		MaxShortTermItems: cfg.Memory.MaxShortTermItems,
+		MaxWorkingItems:   cfg.Memory.MaxWorkingItems,
+		MaxLongTermItems:  cfg.Memory.MaxLongTermItems,
 	}
 	memManager := memory.NewManager(cfg.Memory.StoragePath, memConfig)
 	memManager.Load() // Load existing long-term memory
@@ -141,6 +178,28 @@ func NewAgent(cfg *config.Config, projectPath string, appPath string) (*Agent, e
 	// Register tools restricted to workplace
 	builtin.RegisterBuiltinTools(registry, workplacePath, appPath, auditor)
 
+	// Store oversized tool outputs in app root .agi/outputs; the model pages through them with read_output
+	executor := tools.NewExecutor(registry)
+	if cfg.ToolOutput.MaxBytes > 0 {
+		outputStore := tools.NewOutputStore(filepath.Join(appPath, ".agi", "outputs"))
+		executor.SetSpillPolicy(&tools.SpillPolicy{
+			Store:        outputStore,
+			MaxBytes:     cfg.ToolOutput.MaxBytes,
+			PreviewLines: cfg.ToolOutput.PreviewLines,
+			Exempt:       map[string]bool{"read_output": true},
+		})
+		registry.Register(builtin.ReadOutputTool(outputStore))
+		// Large searches are paged with read_output, so they need no cap
+		registry.Register(builtin.SearchCodeTool(workplacePath, auditor, 0))
+	}
+
+	// Run user-configured shell hooks around every tool call
+	hooks, err := newToolHooks(cfg.Hooks, workplacePath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hooks config: %w", err)
+	}
+	executor.SetHooks(hooks)
+
 	// Set debug level for tools if enabled
 	if cfg.DebugTools {
 		tools.SetGlobalDebugLevel(tools.DebugVerbose)
@@ -156,7 +215,7 @@ func NewAgent(cfg *config.Config, projectPath string, appPath string) (*Agent, e
 	}
 
 	// Initialize edit manager — edits happen in workplace, session metadata in app .agi/
-	editManager := editor.NewManager(workplacePath, filepath.Join(appPath, ".agi"))
+	editManager := editor.NewManager(workplacePath, filepath.Join(appPath, ".agi", "edits"))
 
 	// Initialize permissions manager
 	permManager, err := permissions.NewManager(&cfg.Permissions)
@@ -174,14 +233,15 @@ func NewAgent(cfg *config.Config, projectPath string, appPath string) (*Agent, e
 
 	ag := &Agent{
 		config:         cfg,
-		llm:            llmClient,
 		memory:         memManager,
 		project:        project,
 		tools:          registry,
-		executor:       tools.NewExecutor(registry),
+		executor:       executor,
 		editManager:    editManager,
 		logger:         l,
-		statusCallback: func(s string) {}, // Default no-op
+		events:         NewEventBus(),
+		cassette:       cassette,
+		mockScenario:   scenario,
 		appPath:        appPath,          // App root: where .agi/ lives
 		projectPath:    workplacePath,    // Workplace: sandbox for agent file operations
 		tgBot:          telegram.NewBot(cfg.Telegram.BotToken, cfg.Telegram.ChatID),
@@ -193,6 +253,8 @@ func NewAgent(cfg *config.Config, projectPath string, appPath string) (*Agent, e
 		ctx:            ctx,
 		cancel:         cancel,
 		sessionMgr:     NewSessionManager(), // Initialize session manager
+		sessionStore:   NewSessionStore(filepath.Join(appPath, ".agi", "sessions")),
+		tokens:         llm.NewTokenEstimator(),
 		brain:          brainMgr,            // Initialize brain
 		roadmap:        roadmapMgr,          // Initialize roadmap
 		healthChecker:  healthChecker,       // Initialize health checker
@@ -214,20 +276,159 @@ func NewAgent(cfg *config.Config, projectPath string, appPath string) (*Agent, e
 		l.Error("Failed to load project rules: %v", err)
 	}
 
+	// Sub-agent delegation needs the agent itself, so it is registered last
+	if err := registry.Register(ag.delegateTaskTool()); err != nil {
+		l.Error("Failed to register delegate_task: %v", err)
+	}
+
+	// Price every call, including fallbacks and background queries
+	costs, err := NewCostLedger(filepath.Join(appPath, ".agi", "costs.json"), PricingFromConfig(cfg.Costs), ag.sessionMgr.SessionID)
+	if err != nil {
+		l.Error("Failed to load cost ledger: %v", err)
+	}
+	ag.costs = costs
+
+	// Initialize LLM client with provider support
+	ag.llm = ag.newClient(oauthStore)
+
+	// Load the provider chain that failed requests fall over to
+	ag.providers = providers.NewProviderManager()
+	if providerConfig, err := providers.LoadProvidersConfig(""); err != nil {
+		l.Error("Failed to load providers: %v", err)
+	} else if pm, err := providers.InitializeFromConfig(providerConfig); err != nil {
+		l.Error("Failed to initialize providers: %v", err)
+	} else {
+		ag.providers = pm
+		// Replayed and scripted conversations must not reach real providers
+		ag.failover = providerConfig.FallbackEnabled && ag.cassette == nil && cfg.Provider != "mock"
+	}
+
+	// Report a provider failing or recovering as status lines (and so to Telegram)
+	configureBreakers(cfg.CircuitBreaker)
+	ag.breakerStop = llm.WatchBreakers(func(t llm.BreakerTransition) {
+		if t.Notable() {
+			ag.emitStatus(t.Summary())
+		}
+	})
+
+	// Mirror status lines to Telegram, and export the event stream if configured
+	ag.events.Subscribe(ag.mirrorToTelegram)
+	if cfg.EventLog != "" {
+		path := cfg.EventLog
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(appPath, path)
+		}
+		if stop, err := ag.ExportEvents(path); err != nil {
+			l.Error("Failed to open event log: %v", err)
+		} else {
+			ag.eventLogStop = stop
+		}
+	}
+
+	// Local models report their real context window and tool support
+	if ag.UsesLocalModels() {
+		ctx, cancel := context.WithTimeout(context.Background(), localModelTimeout)
+		if err := ag.prepareLocalModel(ctx); err != nil {
+			ag.logger.Warn("%v", err)
+		}
+		cancel()
+	}
+
+	// Seed the context gauge with the history loaded from disk
+	ag.refreshContextUsage()
+
 	return ag, nil
 }
 
-// SetStatusCallback sets the callback for status updates
-func (a *Agent) SetStatusCallback(cb func(string)) {
-	a.statusCallback = func(s string) {
-		a.UpdateActivity()
-		if cb != nil {
-			cb(s)
+// oauthKeyFor returns the OAuth store key for a provider. Gemini, native or
+// through the OpenAI-compatible endpoint, uses the "google" credentials and
+// the Responses API uses the "openai" ones.
+func oauthKeyFor(providerName, baseURL string) string {
+	if providerName == "gemini" || strings.Contains(baseURL, "googleapis.com") {
+		return "google"
+	}
+	if providerName == "responses" {
+		return "openai"
+	}
+	return providerName
+}
+
+// configureBreakers applies the circuit breaker settings to all providers
+func configureBreakers(cfg config.CircuitBreakerConfig) {
+	llm.ConfigureBreakers(cfg.FailureThreshold, time.Duration(cfg.CoolDownSeconds)*time.Second)
+}
+
+// clientProvider returns the provider the LLM client should use for model.
+// OpenAI models configured with "api": "responses" in model_parameters go
+// through the Responses API.
+func clientProvider(cfg *config.Config, provider, model string) string {
+	if params, ok := cfg.ModelParameters[model]; ok && params.API == "responses" {
+		if provider == "" || provider == "openai" {
+			return "responses"
 		}
-		if a.config.Telegram.Enabled && a.config.Telegram.ChatID != 0 {
-			go a.tgBot.SendMessage("📢 " + s)
+	}
+	return provider
+}
+
+// newClient creates the client for the configured provider and model, with
+// its OAuth credentials, reasoning effort and fallback models
+func (a *Agent) newClient(oauthStore map[string]*config.OAuthCredentials) *llm.Client {
+	cfg := a.config
+	c := llm.NewClientWithProvider(cfg.APIBaseURL, cfg.APIKey, cfg.Model, clientProvider(cfg, cfg.Provider, cfg.Model))
+	a.setupClient(c)
+
+	// Wire in OAuth credentials for the active provider
+	providerName := c.ProviderName()
+	if creds, ok := oauthStore[oauthKeyFor(providerName, cfg.APIBaseURL)]; ok && creds != nil {
+		c.SetOAuthCredentials(creds)
+	} else if creds, ok := oauthStore[providerName]; ok && creds != nil {
+		c.SetOAuthCredentials(creds)
+	}
+
+	if cfg.ReasoningEffort != "" {
+		c.SetReasoningEffort(cfg.ReasoningEffort)
+	}
+	if len(cfg.FallbackModels) > 0 {
+		c.SetFallbackModels(cfg.FallbackModels, cfg.FallbackTimeout)
+	}
+	return c
+}
+
+// setupClient applies what every client the agent sends with shares, the
+// failover clients included: cost accounting, the cassette, the mock
+// scenario and the provider settings from config
+func (a *Agent) setupClient(c *llm.Client) {
+	c.SetUsageHook(a.costs.Record)
+	if a.cassette != nil {
+		c.UseCassette(a.cassette)
+	}
+	if a.mockScenario != nil {
+		c.SetMockScenario(a.mockScenario)
+	}
+	c.SetSafetyThreshold(a.config.GeminiSafety)
+	c.SetResponsesStore(a.config.ResponsesStore)
+}
+
+// configureTraces points tracing at .agi/traces and redacts the current
+// credentials; call it again whenever an API key, bot token or OAuth login changes
+func configureTraces(cfg *config.Config, appPath string, oauthStore map[string]*config.OAuthCredentials, pm *providers.ProviderManager) {
+	traces.Configure(filepath.Join(appPath, ".agi", "traces"), cfg.DebugHTTP, trafficSecrets(cfg, oauthStore, pm)...)
+}
+
+// trafficSecrets lists the credentials cassettes and traces must redact
+func trafficSecrets(cfg *config.Config, oauthStore map[string]*config.OAuthCredentials, pm *providers.ProviderManager) []string {
+	secrets := []string{cfg.APIKey, cfg.Telegram.BotToken}
+	for _, creds := range oauthStore {
+		if creds != nil {
+			secrets = append(secrets, creds.AccessToken, creds.RefreshToken)
 		}
 	}
+	if pm != nil {
+		for _, p := range pm.ListProviders() {
+			secrets = append(secrets, p.APIKey)
+		}
+	}
+	return secrets
 }
 
 // SetStreamCallback sets a callback that receives each streaming chunk from the LLM.
@@ -261,12 +462,17 @@ func (a *Agent) CloneForDebate(name string) *Agent {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	return a.clone()
+}
+
+// clone builds an agent with isolated memory and session. Callers must hold a.mu
+// or otherwise be inside one of a's turns.
+func (a *Agent) clone() *Agent {
 	// Create new memory for the clone (don't persist clone memory to main file)
 	cloneMemory := memory.NewManager("", &memory.Config{
-		MaxShortTermItems:  a.config.Memory.MaxShortTermItems,
-		MaxWorkingItems:    a.config.Memory.MaxWorkingItems,
-		MaxLongTermItems:   a.config.Memory.MaxLongTermItems,
-		CompressionTrigger: a.config.Memory.CompressionTrigger,
+		MaxShortTermItems: a.config.Memory.MaxShortTermItems,
+		MaxWorkingItems:   a.config.Memory.MaxWorkingItems,
+		MaxLongTermItems:  a.config.Memory.MaxLongTermItems,
 	})
 
 	// Create new session manager
@@ -285,7 +491,7 @@ func (a *Agent) CloneForDebate(name string) *Agent {
 		executor:       a.executor,
 		editManager:    a.editManager,
 		logger:         a.logger,
-		statusCallback: func(s string) {}, // Clones have their own (or no) callback by default
+		events:         NewEventBus(), // Clones have their own (or no) subscribers
 		appPath:        a.appPath,
 		projectPath:    a.projectPath,
 		tgBot:          a.tgBot,
@@ -297,6 +503,10 @@ func (a *Agent) CloneForDebate(name string) *Agent {
 		ctx:            cloneCtx,
 		cancel:         cloneCancel,
 		sessionMgr:     cloneSessionMgr,
+		costs:          a.costs,
+		providers:      a.providers,
+		failover:       a.failover,
+		tokens:         a.tokens,
 		brain:          a.brain,
 		roadmap:        a.roadmap,
 		healthChecker:  a.healthChecker,
@@ -309,9 +519,41 @@ func (a *Agent) CloneForDebate(name string) *Agent {
 
 // Chat processes a user message and returns the response
 func (a *Agent) Chat(userMessage string) (string, error) {
+	return a.ChatContext(a.ctx, userMessage)
+}
+
+// ChatContext is like Chat but aborts in-flight LLM requests, streams and
+// tool subprocesses when ctx is cancelled. A cancelled turn is closed off in
+// memory so the next turn starts from a consistent history.
+func (a *Agent) ChatContext(ctx context.Context, userMessage string) (string, error) {
+	return a.chat(ctx, userMessage, turnOptions{})
+}
+
+// turnOptions adjusts a single chat turn
+type turnOptions struct {
+	promptContext prompts.Context       // Overrides context detection when set
+	allowTool     func(name string) bool // Restricts the tools offered and executed when set
+}
+
+// chat runs one user turn under the agent lock
+func (a *Agent) chat(ctx context.Context, userMessage string, opts turnOptions) (response string, err error) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
+	// Spending budgets pause the agent until they are raised or reset
+	if reason := a.SpendingPaused(); reason != "" {
+		a.emitStatus("💸 Agent paused: " + reason)
+		return "", fmt.Errorf("agent paused: %s", reason)
+	}
+
+	// A missing local model is pulled (or reported) before the first request
+	if err := a.ensureLocalModel(ctx); err != nil {
+		return "", err
+	}
+
+	a.turnTools = opts.allowTool
+	defer func() { a.turnTools = nil }()
+
 	// Add recovery to prevent panics from killing the whole agent
 	defer func() {
 		if r := recover(); r != nil {
@@ -322,27 +564,46 @@ func (a *Agent) Chat(userMessage string) (string, error) {
 	stats := a.sessionMgr.GetContextStats()
 	a.logger.Info("Chat started (Current Context: %d msgs)", stats.MessageCount)
 	a.UpdateActivity()
+	a.turnToolCalls = nil
 
 
 	// Age working memory at the start of each chat
 	a.memory.AgeWorkingMemory(0.05) // 5% decay per hour/interaction context
 
-	// Add user message to memory
+	// Add user message to memory and the session transcript
 	a.memory.AddMessage("user", userMessage)
+	a.sessionMgr.AddMessage(llm.Message{Role: "user", Content: userMessage})
+
+	// Persist the session however the turn ends
+	defer a.endTurn()
+
+	turnStart := time.Now()
+	a.emit(Event{Type: EventTurnStarted, Message: userMessage})
+	defer func() {
+		finished := Event{Type: EventTurnFinished, Message: response, ToolCalls: len(a.turnToolCalls), Duration: time.Since(turnStart)}
+		if err != nil {
+			finished.Error = err.Error()
+		}
+		a.emit(finished)
+	}()
 
 	// Detect context and build components
-	ctx := prompts.DetectContext(userMessage)
+	promptCtx := opts.promptContext
+	if promptCtx == "" {
+		promptCtx = prompts.DetectContext(userMessage)
+	}
 	rulesContent := a.rules.GetFormattedRules()
 	projectInfo := a.project.GetSummary()
 	historyInfo := a.getContextSummary()
 	toolsSummary := a.getToolsSummary()
 
-	systemPrompt := prompts.NewBuilder(ctx).
+	systemPrompt := prompts.NewBuilder(promptCtx).
 		WithToolsSummary(toolsSummary).
 		WithProjectInfo(projectInfo).
 		WithHistory(historyInfo).
 		WithCustomInstructions(rulesContent).
 		Build()
+	a.systemTokens = a.tokens.EstimateText(systemPrompt)
 
 	// Build messages - only include system prompt if context needs refresh
 	var messages []llm.Message
@@ -355,9 +616,17 @@ func (a *Agent) Chat(userMessage string) (string, error) {
 			Content: systemPrompt,
 		})
 		a.sessionMgr.MarkContextSent(systemPrompt, rulesContent, projectInfo)
-		a.statusCallback("🔄 Refreshing context...")
+		a.emitStatus("🔄 Refreshing context...")
 	}
 
+	// Close off the turn in memory if it gets cancelled part-way
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			a.finishCancelledTurn(needsContext)
+			err = fmt.Errorf("request cancelled: %w", ctx.Err())
+		}
+	}()
+
 	// Add conversation history
 	for _, msg := range a.memory.GetMessages() {
 		messages = append(messages, llm.Message{
@@ -366,67 +635,55 @@ func (a *Agent) Chat(userMessage string) (string, error) {
 		})
 	}
 
+	// Attach the images the user referenced with @image:
+	if refs := ImageRefs(userMessage); len(refs) > 0 && len(messages) > 0 && messages[len(messages)-1].Role == "user" {
+		last := len(messages) - 1
+		if messages[last], err = a.attachImages(messages[last], refs); err != nil {
+			return "", err
+		}
+	}
+
 	// Get tool definitions
 	toolDefs := a.getToolDefinitions()
 
-	// Send to LLM — use streaming when a callback is registered
-	var resp *llm.ChatResponse
-	var err error
-	if a.streamCallback != nil {
-		resp, err = a.llm.ChatWithStreaming(messages, toolDefs, a.config.Temperature, a.config.TopP, a.config.MaxTokens, a.streamCallback)
-	} else {
-		resp, err = a.llm.ChatWithTools(messages, toolDefs, a.config.Temperature, a.config.TopP, a.config.MaxTokens)
-	}
+	// Send to LLM
+	a.emitLLMRequest(0, messages)
+	resp, err := a.complete(ctx, messages, toolDefs, a.config.MaxTokens)
 	if err != nil {
 		return "", fmt.Errorf("LLM error: %w", err)
 	}
 
-	// Update usage and rate limits
-	a.totalUsage.PromptTokens += resp.Usage.PromptTokens
-	a.totalUsage.CompletionTokens += resp.Usage.CompletionTokens
-	a.totalUsage.TotalTokens += resp.Usage.TotalTokens
-	a.lastRateLimits = resp.RateLimits
-
-	// Update session stats
-	a.sessionMgr.UpdateTokenUsage(resp.Usage.PromptTokens)
+	a.observePrompt(messages, toolDefs, resp.Usage)
+	a.recordUsage(resp)
+	a.emitReasoning(resp)
+	budget := newBudgetTracker(BudgetFromConfig(a.config.ToolLoop))
+	budget.addUsage(resp.Usage, a.callCost(resp))
 
 	var finalResponse string
 	// Handle tool calls if present
 	if a.llm.HasToolCalls(resp) {
-		finalResponse, err = a.handleToolCalls(resp, messages, 0)
+		finalResponse, err = a.runToolLoop(ctx, resp, messages, budget)
 	} else {
 		finalResponse = a.llm.GetContent(resp)
 		// Check for truncation
 		if a.llm.GetFinishReason(resp) == "length" {
 			a.logger.Info("Chat response truncated (length), requesting continuation...")
-			continuation, contErr := a.continueResponse(messages, finalResponse)
+			continuation, contErr := a.continueResponse(ctx, messages, finalResponse)
 			if contErr == nil {
 				finalResponse += continuation
 			} else {
 				a.logger.Error("Continuation failed: %v", contErr)
 			}
 		}
-		a.memory.AddMessage("assistant", finalResponse)
+		a.addAssistantMessage(finalResponse)
 	}
 
 	if err != nil {
 		return "", err
 	}
 
-	// Check for context compression based on session stats
-	stats = a.sessionMgr.GetContextStats()
-	if stats.ShouldCompress(a.config.Memory.CompressionTrigger) {
-		a.statusCallback("🗜️ Compressing context...")
-
-		// Compress memory
-		if items := a.memory.GetItemsToCompress(); len(items) > 0 {
-			a.compressContext(items)
-		}
-
-		// Reset session to force context refresh on next interaction
-		a.sessionMgr.ResetSession()
-		a.statusCallback("✅ Context compressed and session reset")
-	}
+	// Compress history if the next prompt would crowd the context window
+	a.maybeCompress()
 
 	// Proactive Insight Extraction
 	if len(a.memory.GetMessages())%6 == 0 {
@@ -439,40 +696,129 @@ func (a *Agent) Chat(userMessage string) (string, error) {
 	return finalResponse, nil
 }
 
-// handleToolCalls executes tool calls and continues the conversation
-func (a *Agent) handleToolCalls(resp *llm.ChatResponse, messages []llm.Message, depth int) (result string, err error) {
+// complete sends one request of a turn. It streams the reply, and the
+// progress of the tool calls in it, when a stream callback is registered.
+// If the request fails it falls over to the other configured providers.
+func (a *Agent) complete(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDefinition, maxTokens *int) (*llm.ChatResponse, error) {
+	send := func(client *llm.Client) (*llm.ChatResponse, error) {
+		messages := messages
+		if !a.modelSupportsVision(client.Model()) {
+			messages = withoutImages(messages)
+		}
+		if a.streamCallback == nil {
+			return client.ChatWithToolsContext(ctx, messages, toolDefs, a.config.Temperature, a.config.TopP, maxTokens)
+		}
+		return client.ChatWithStreamingToolCallsContext(ctx, messages, toolDefs, a.config.Temperature, a.config.TopP, maxTokens, a.streamWithEvents(), a.toolCallProgress())
+	}
+	if !a.failover {
+		return send(a.llm)
+	}
+
+	return a.providers.Failover(ctx, providers.Route{
+		Client:  a.llm,
+		BaseURL: a.config.APIBaseURL,
+		Model:   a.config.Model,
+		Setup:   a.setupClient,
+		Switch: func(from, to string, err error) {
+			a.logger.Error("%s failed, failing over to %s: %v", from, to, err)
+			a.emitStatus(fmt.Sprintf("⚠️ %s failed, switching to %s...", from, to))
+		},
+	}, send)
+}
+
+// ProviderManager returns the configured providers the agent fails over to
+func (a *Agent) ProviderManager() *providers.ProviderManager {
+	return a.providers
+}
+
+// runToolLoop executes tool calls and continues the conversation until the
+// model answers without tools, the turn is cancelled, or the budget runs out
+func (a *Agent) runToolLoop(ctx context.Context, resp *llm.ChatResponse, messages []llm.Message, budget *budgetTracker) (result string, err error) {
 	// Add recovery to prevent tool panics from killing the agent
 	defer func() {
 		if r := recover(); r != nil {
-			a.logger.Error("PANIC in handleToolCalls (depth %d): %v", depth, r)
+			a.logger.Error("PANIC in tool loop (step %d): %v", budget.steps, r)
 			err = fmt.Errorf("internal panic in tool execution: %v", r)
 		}
 	}()
 
-	if depth > 50 {
-		return "", fmt.Errorf("maximum tool execution depth exceeded")
+	for a.llm.HasToolCalls(resp) {
+		step := budget.nextStep()
+		toolCalls := a.llm.GetToolCalls(resp)
+		a.emitProgress(budget.event(ProgressStep, len(toolCalls), ""))
+		if step == deepStepThreshold+1 {
+			a.logger.Info("Deep tool execution detected (step %d), continuing task...", step)
+			a.emitProgress(budget.event(ProgressDeepExecution, len(toolCalls), ""))
+		}
+
+		messages = a.executeToolStep(ctx, resp, messages)
+
+		// Stop before the follow-up request if the turn was cancelled during tool execution
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		if reason := budget.exhausted(); reason != "" {
+			a.logger.Info("Tool loop budget exhausted: %s", reason)
+			a.emitProgress(budget.event(ProgressBudgetExhausted, 0, reason))
+			return a.summarizeExhaustedTurn(ctx, messages, reason)
+		}
+		if reason := a.SpendingPaused(); reason != "" {
+			a.logger.Info("Spending budget reached: %s", reason)
+			a.emitProgress(budget.event(ProgressBudgetExhausted, 0, reason))
+			return a.stopForSpending(reason), nil
+		}
+
+		// Continue conversation with tool results
+		toolDefs := a.getToolDefinitions()
+		a.emitLLMRequest(step, messages)
+		resp, err = a.complete(ctx, messages, toolDefs, a.config.MaxTokens)
+		if err != nil {
+			a.logger.Error("LLM follow-up error: %v", err)
+			return "", err
+		}
+		a.observePrompt(messages, toolDefs, resp.Usage)
+		a.recordUsage(resp)
+		a.emitReasoning(resp)
+		budget.addUsage(resp.Usage, a.callCost(resp))
 	}
 
-	if depth > 10 {
-		a.logger.Info("Deep tool execution detected (depth %d), continuing task...", depth)
+	content := a.llm.GetContent(resp)
+	// Check for truncation in follow-up
+	if a.llm.GetFinishReason(resp) == "length" {
+		a.logger.Info("Tool follow-up truncated (length), requesting continuation...")
+		continuation, contErr := a.continueResponse(ctx, messages, content)
+		if contErr == nil {
+			content += continuation
+		}
 	}
+	a.addAssistantMessage(content)
 
+	return content, nil
+}
+
+// executeToolStep runs one round of tool calls from resp and returns messages
+// extended with the assistant tool-call message and the tool results
+func (a *Agent) executeToolStep(ctx context.Context, resp *llm.ChatResponse, messages []llm.Message) []llm.Message {
 	// Refresh activity at start of tool execution
 	a.UpdateActivity()
 
 	toolCalls := a.llm.GetToolCalls(resp)
-	a.logger.Info("Executing %d tool calls at depth %d", len(toolCalls), depth)
+	a.logger.Info("Executing %d tool calls", len(toolCalls))
 
 	// Add assistant message with tool calls
 	messages = append(messages, resp.Choices[0].Message)
 
 	// Execute tools in parallel where possible
 	type toolExecutionResult struct {
-		tc     llm.ToolCall
-		args   map[string]any
-		result tools.ToolResult
-		err    error
-		index  int
+		tc       llm.ToolCall
+		args     map[string]any
+		call     tools.PreparedCall // The call after pre hooks, as it will run
+		result   tools.ToolResult
+		err      error
+		index    int
+		duration time.Duration
+		snapshot *fileSnapshot // File state before a write, for branch edit tracking
 	}
 
 	results := make([]toolExecutionResult, len(toolCalls))
@@ -500,6 +846,32 @@ func (a *Agent) handleToolCalls(resp *llm.ChatResponse, messages []llm.Message,
 		results[i].args = args
 		results[i].index = i
 
+		if !a.toolAllowed(tc.Function.Name) {
+			results[i].result = tools.ToolResult{
+				Success: false,
+				Output:  fmt.Sprintf("Error: tool %s is not available in this mode.", tc.Function.Name),
+				Error:   "tool not available in this mode",
+			}
+			continue
+		}
+
+		// Pre hooks run first, so approval, snapshots, records and events all
+		// see the arguments the tool will actually run with
+		prepared := a.executor.Prepare(ctx, tools.ToolCall{Name: tc.Function.Name, Arguments: args})
+		results[i].call = prepared
+		if prepared.Rewritten {
+			if data, err := json.Marshal(prepared.Arguments); err == nil {
+				results[i].tc.Function.Arguments = string(data)
+			}
+			results[i].args = prepared.Arguments
+		}
+		if prepared.Blocked != nil {
+			// Nothing will run, so there is nothing to approve
+			nonSensitiveCalls = append(nonSensitiveCalls, i)
+			continue
+		}
+		results[i].snapshot = a.snapshotFileEdit(tc.Function.Name, results[i].args)
+
 		// Check if tool requires approval
 		if a.permManager.RequiresApproval(tc.Function.Name) {
 			sensitiveCalls = append(sensitiveCalls, i)
@@ -530,21 +902,22 @@ func (a *Agent) handleToolCalls(resp *llm.ChatResponse, messages []llm.Message,
 				args := results[i].args
 
 				a.logger.Info("Tool call (parallel): %s(%v)", tc.Function.Name, tc.Function.Arguments)
-				a.statusCallback(fmt.Sprintf("🔧 Executing %s...", tc.Function.Name))
+				a.emit(Event{Type: EventToolStarted, Tool: &ToolEvent{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments}})
 
-				result, err := a.executor.Execute(tools.ToolCall{
-					Name:      tc.Function.Name,
-					Arguments: args,
-				})
+				start := time.Now()
+				result, err := a.executor.ExecutePrepared(ctx, results[i].call)
+				elapsed := time.Since(start)
 
 				// Enhance errors with detailed feedback for LLM
 				if !result.Success && result.Error != "" {
 					result = tools.EnhanceToolError(tc.Function.Name, args, result)
 				}
+				a.emitToolFinished(tc, result, err, elapsed)
 
 				mu.Lock()
 				results[i].result = result
 				results[i].err = err
+				results[i].duration = elapsed
 				mu.Unlock()
 
 				if err != nil {
@@ -563,8 +936,14 @@ func (a *Agent) handleToolCalls(resp *llm.ChatResponse, messages []llm.Message,
 		tc := results[idx].tc
 		args := results[idx].args
 
+		if ctx.Err() != nil {
+			results[idx].result = tools.ToolResult{Success: false, Output: "Error: cancelled before execution."}
+			results[idx].err = ctx.Err()
+			continue
+		}
+
 		a.logger.Info("Tool call (sequential): %s(%v)", tc.Function.Name, tc.Function.Arguments)
-		a.statusCallback(fmt.Sprintf("🔧 Executing %s...", tc.Function.Name))
+		a.emit(Event{Type: EventToolStarted, Tool: &ToolEvent{ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments}})
 
 		// Request approval if Telegram enabled
 		if a.config.Telegram.Enabled {
@@ -579,10 +958,8 @@ func (a *Agent) handleToolCalls(resp *llm.ChatResponse, messages []llm.Message,
 			}
 		}
 
-		result, err := a.executor.Execute(tools.ToolCall{
-			Name:      tc.Function.Name,
-			Arguments: args,
-		})
+		start := time.Now()
+		result, err := a.executor.ExecutePrepared(ctx, results[idx].call)
 
 		// Enhance errors with detailed feedback for LLM
 		if !result.Success && result.Error != "" {
@@ -591,6 +968,8 @@ func (a *Agent) handleToolCalls(resp *llm.ChatResponse, messages []llm.Message,
 
 		results[idx].result = result
 		results[idx].err = err
+		results[idx].duration = time.Since(start)
+		a.emitToolFinished(tc, result, err, results[idx].duration)
 
 		if err != nil {
 			a.logger.Error("Tool %s execution error: %v", tc.Function.Name, err)
@@ -609,12 +988,24 @@ func (a *Agent) handleToolCalls(resp *llm.ChatResponse, messages []llm.Message,
 			result.Success = false
 		}
 
-		// Add tool result to messages
-		messages = append(messages, llm.Message{
-			Role:       "tool",
-			Content:    result.Output,
-			ToolCallID: toolCalls[i].ID,
-		})
+		record := ToolCallRecord{
+			Name:       res.tc.Function.Name,
+			Arguments:  res.tc.Function.Arguments,
+			Success:    result.Success && res.err == nil,
+			Error:      result.Error,
+			DurationMs: res.duration.Milliseconds(),
+		}
+		if record.Error == "" && res.err != nil {
+			record.Error = res.err.Error()
+		}
+		a.turnToolCalls = append(a.turnToolCalls, record)
+
+		if record.Success && res.snapshot != nil {
+			a.recordFileEdit(res.snapshot, record.Name)
+		}
+
+		// Add tool result to messages, with any images it returned
+		messages = append(messages, a.toolResultMessage(toolCalls[i].ID, result.Output, result.Images))
 
 		// Add relevant files to working memory
 		if result.Success {
@@ -627,41 +1018,150 @@ func (a *Agent) handleToolCalls(resp *llm.ChatResponse, messages []llm.Message,
 		}
 	}
 
-	// Get tool definitions for follow-up
-	toolDefs := a.getToolDefinitions()
+	return messages
+}
 
-	// Continue conversation with tool results
-	var followResp *llm.ChatResponse
-	followResp, err = a.llm.ChatWithTools(messages, toolDefs, a.config.Temperature, a.config.TopP, a.config.MaxTokens)
-	if err != nil {
-		a.logger.Error("LLM follow-up error: %v", err)
-		return "", err
+// summarizeExhaustedTurn ends a turn whose budget ran out with a summary of what
+// was done and what remains, asked of the model without tools
+func (a *Agent) summarizeExhaustedTurn(ctx context.Context, messages []llm.Message, reason string) (string, error) {
+	a.emitStatus(fmt.Sprintf("⏸️ Budget exhausted: %s. Summarizing...", reason))
+
+	summaryMessages := append(toolExchangesAsText(messages), llm.Message{
+		Role: "user",
+		Content: fmt.Sprintf("The tool budget for this request is exhausted (%s). Do not call any tools. "+
+			"Reply with a brief summary in two sections: 'Done' (what has been completed so far) "+
+			"and 'Remaining' (what still needs to be done to finish the request).", reason),
+	})
+
+	maxTokens := 1024
+	summary := ""
+	a.emitLLMRequest(0, summaryMessages)
+	resp, err := a.complete(ctx, summaryMessages, nil, &maxTokens)
+	if err == nil {
+		a.recordUsage(resp)
+		summary = a.llm.GetContent(resp)
+	} else if ctx.Err() != nil {
+		return "", ctx.Err()
+	} else {
+		a.logger.Error("Budget summary failed: %v", err)
 	}
-	resp = followResp
 
-	// Handle nested tool calls (recursive)
-	if a.llm.HasToolCalls(resp) {
-		return a.handleToolCalls(resp, messages, depth+1)
+	// Fall back to a summary built from the executed tool calls
+	if strings.TrimSpace(summary) == "" {
+		summary = a.toolCallSummary()
 	}
 
-	content := a.llm.GetContent(resp)
-	// Check for truncation in follow-up
-	if a.llm.GetFinishReason(resp) == "length" {
-		a.logger.Info("Tool follow-up truncated (length), requesting continuation...")
-		continuation, contErr := a.continueResponse(messages, content)
-		if contErr == nil {
-			content += continuation
+	content := fmt.Sprintf("%s: %s.\n\n%s", stoppedEarlyPrefix, reason, summary)
+	a.addAssistantMessage(content)
+	return content, nil
+}
+
+// stopForSpending ends a turn whose spending budget ran out. Unlike
+// summarizeExhaustedTurn it makes no further LLM call.
+func (a *Agent) stopForSpending(reason string) string {
+	a.emitStatus("💸 Agent paused: " + reason)
+	content := fmt.Sprintf("%s: %s.\n\n%s", stoppedEarlyPrefix, reason, a.toolCallSummary())
+	a.addAssistantMessage(content)
+	return content
+}
+
+// toolCallSummary lists the tool calls executed this turn as Done/Remaining sections
+func (a *Agent) toolCallSummary() string {
+	var sb strings.Builder
+	sb.WriteString("**Done**\n")
+	for _, tc := range a.turnToolCalls {
+		status := "✅"
+		if !tc.Success {
+			status = "❌"
 		}
+		sb.WriteString(fmt.Sprintf("- %s %s\n", status, tc.Name))
 	}
+	sb.WriteString("\n**Remaining**\n- Unknown; ask me to continue to pick up where I left off.\n")
+	return sb.String()
+}
+
+// emitProgress publishes a progress event
+func (a *Agent) emitProgress(event ProgressEvent) {
+	a.emit(Event{Type: EventProgress, Progress: &event})
+}
+
+// callCost returns the estimated USD cost of a response on the model that produced it
+func (a *Agent) callCost(resp *llm.ChatResponse) float64 {
+	model := resp.Model
+	if model == "" {
+		model = a.config.Model
+	}
+	return a.costs.Cost(model, resp.Usage)
+}
+
+// finishCancelledTurn records an interrupted turn so short-term memory keeps
+// alternating user/assistant messages and the model learns which tools already ran
+func (a *Agent) finishCancelledTurn(contextWasPending bool) {
+	note := "[Interrupted: the user cancelled this request before it finished.]"
+	if len(a.turnToolCalls) > 0 {
+		var names []string
+		for _, tc := range a.turnToolCalls {
+			names = append(names, tc.Name)
+		}
+		note += fmt.Sprintf(" Tools already executed: %s.", strings.Join(names, ", "))
+	}
+	a.addAssistantMessage(note)
+
+	// The provider may never have received the system prompt
+	if contextWasPending {
+		a.sessionMgr.InvalidateContext()
+	}
+
+	a.logger.Info("Chat cancelled (%d tool calls executed)", len(a.turnToolCalls))
+	a.emitStatus("🛑 Request cancelled")
+}
+
+// recordUsage accumulates token usage and rate limits from an LLM response
+func (a *Agent) recordUsage(resp *llm.ChatResponse) {
+	a.totalUsage.Add(resp.Usage)
+	a.lastRateLimits = resp.RateLimits
+
+	// Update session stats
+	a.sessionMgr.UpdateTokenUsage(resp.Usage.PromptTokens)
+	a.sessionMgr.AddUsage(resp.Usage)
+
+	usage, total, window := resp.Usage, a.totalUsage, a.GetContextUsage()
+	a.emit(Event{Type: EventUsageUpdated, Usage: &usage, TotalUsage: &total, Context: &window})
+}
+
+// addAssistantMessage records a final assistant reply in memory and the session transcript
+func (a *Agent) addAssistantMessage(content string) {
 	a.memory.AddMessage("assistant", content)
+	a.sessionMgr.AddMessage(llm.Message{Role: "assistant", Content: content})
+}
 
-	return content, nil
+// endTurn records the turn's tool calls and persists the session
+func (a *Agent) endTurn() {
+	a.sessionMgr.AddToolCalls(a.turnToolCalls)
+	a.persistSession()
+}
+
+// GetLastToolCalls returns the tool calls executed during the most recent Chat turn
+func (a *Agent) GetLastToolCalls() []ToolCallRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	calls := make([]ToolCallRecord, len(a.turnToolCalls))
+	copy(calls, a.turnToolCalls)
+	return calls
 }
 
 // getToolDefinitions returns tool definitions for the LLM
 func (a *Agent) getToolDefinitions() []llm.ToolDefinition {
 	defs := make([]llm.ToolDefinition, 0)
+	// Models that cannot call tools reject requests that define them
+	if profile, _ := llm.LookupModelProfile(a.config.Model); !profile.SupportsTools {
+		return defs
+	}
 	for _, tool := range a.tools.List() {
+		if !a.toolAllowed(tool.Name) {
+			continue
+		}
 		defs = append(defs, llm.ToolDefinition{
 			Type: "function",
 			Function: llm.FunctionSchema{
@@ -674,12 +1174,22 @@ func (a *Agent) getToolDefinitions() []llm.ToolDefinition {
 	return defs
 }
 
+// toolAllowed reports whether the current turn may use the named tool
+func (a *Agent) toolAllowed(name string) bool {
+	return a.turnTools == nil || a.turnTools(name)
+}
+
 // getToolsSummary generates a concise summary of available tools
 func (a *Agent) getToolsSummary() string {
 	var sb strings.Builder
 	sb.WriteString("You have access to the following tools (use them via function calls):\n\n")
 
-	toolsList := a.tools.List()
+	var toolsList []*tools.Tool
+	for _, tool := range a.tools.List() {
+		if a.toolAllowed(tool.Name) {
+			toolsList = append(toolsList, tool)
+		}
+	}
 
 	// Group tools by category
 	fileTools := []string{}
@@ -752,6 +1262,42 @@ func (a *Agent) getContextSummary() string {
 	return a.memory.GetContext()
 }
 
+// compressionSchema is the structured summary compressContext asks for
+var compressionSchema = llm.ResponseSchema{
+	Name:        "context_summary",
+	Description: "A compressed summary of a conversation segment",
+	Strict:      true,
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"bullets": map[string]interface{}{
+				"type":        "array",
+				"items":       map[string]interface{}{"type": "string"},
+				"description": "2-3 concise bullet points",
+			},
+		},
+		"required":             []string{"bullets"},
+		"additionalProperties": false,
+	},
+}
+
+// insightSchema is the structured answer extractInsights asks for
+var insightSchema = llm.ResponseSchema{
+	Name:        "project_insight",
+	Description: "A permanent technical decision or recurring pattern, if one was established",
+	Strict:      true,
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"found":   map[string]interface{}{"type": "boolean"},
+			"kind":    map[string]interface{}{"type": "string", "enum": []string{"decision", "pattern"}},
+			"insight": map[string]interface{}{"type": "string", "description": "A single sentence"},
+		},
+		"required":             []string{"found", "kind", "insight"},
+		"additionalProperties": false,
+	},
+}
+
 // compressContext uses LLM to compress old context
 func (a *Agent) compressContext(items []*memory.MemoryItem) {
 	var conversation strings.Builder
@@ -767,17 +1313,22 @@ Focus strictly on:
 3. Errors or obstacles encountered and how they were solved.
 
 Conversation Segment:
-%s
-
-Summary:`, conversation.String())
+%s`, conversation.String())
 
-	summary, err := a.llm.SimpleQuery(prompt, utils.FloatPtr(0.3), nil, utils.IntPtr(300))
-	if err != nil {
-		a.logger.Error("Context compression failed: %v", err)
+	var summary struct {
+		Bullets []string `json:"bullets"`
+	}
+	messages := []llm.Message{{Role: "user", Content: prompt}}
+	if err := a.llm.QueryStructuredContext(a.ctx, messages, compressionSchema, &summary, utils.FloatPtr(0.3), utils.IntPtr(400)); err != nil {
+		a.logger.Error("Context compression failed, keeping history uncompressed: %v", err)
+		return
+	}
+	if len(summary.Bullets) == 0 {
+		a.logger.Warn("Context compression returned an empty summary, keeping history uncompressed")
 		return
 	}
 
-	a.memory.CompressItems(summary)
+	a.memory.CompressItems("- " + strings.Join(summary.Bullets, "\n- "))
 	a.logger.Info("Context compressed successfully.")
 }
 
@@ -796,19 +1347,27 @@ func (a *Agent) extractInsights() {
 
 	prompt := fmt.Sprintf(`### Insight Extraction Task
 Based on the recent interaction below, identify if any permanent technical decisions or recurring project patterns were established.
-If yes, provide a single sentence starting with "Decision:" or "Pattern:". 
-If nothing significant was established, reply with "NONE".
+If yes, set found to true and describe it in a single sentence.
+If nothing significant was established, set found to false.
 
 Recent Interaction:
-%s
+%s`, chat.String())
 
-Insight:`, chat.String())
-
-	insight, err := a.llm.SimpleQuery(prompt, utils.FloatPtr(0.2), nil, utils.IntPtr(150))
-	if err != nil || strings.ToUpper(insight) == "NONE" || insight == "" {
+	var result struct {
+		Found   bool   `json:"found"`
+		Kind    string `json:"kind"`
+		Insight string `json:"insight"`
+	}
+	query := []llm.Message{{Role: "user", Content: prompt}}
+	if err := a.llm.QueryStructuredContext(a.ctx, query, insightSchema, &result, utils.FloatPtr(0.2), utils.IntPtr(200)); err != nil {
+		a.logger.Warn("Insight extraction failed: %v", err)
+		return
+	}
+	if !result.Found || strings.TrimSpace(result.Insight) == "" {
 		return
 	}
 
+	insight := fmt.Sprintf("%s: %s", strings.ToUpper(result.Kind[:1])+result.Kind[1:], strings.TrimSpace(result.Insight))
 	a.memory.AddDecision(insight, []string{"proactive-insight"})
 	a.logger.Info("Proactive insight extracted: %s", insight)
 }
@@ -858,6 +1417,18 @@ func (a *Agent) Shutdown() error {
 		a.logger.Info("Failed to close browser manager: %v", err)
 	}
 
+	// Stop reporting circuit breaker transitions
+	if a.breakerStop != nil {
+		a.breakerStop()
+	}
+
+	// Close the event log
+	if a.eventLogStop != nil {
+		if err := a.eventLogStop(); err != nil {
+			a.logger.Info("Failed to close event log: %v", err)
+		}
+	}
+
 	// Close permissions manager (closes audit log)
 	if a.permManager != nil {
 		if err := a.permManager.Close(); err != nil {
@@ -865,7 +1436,8 @@ func (a *Agent) Shutdown() error {
 		}
 	}
 
-	// Save memory state
+	// Save memory and session state
+	a.persistSession()
 	return a.Save()
 }
 
@@ -886,14 +1458,26 @@ func (a *Agent) GetFormattedRules() string {
 
 // GetUsageStats returns current token usage and rate limit information
 func (a *Agent) GetUsageStats() map[string]any {
+	schedule := a.llm.RateScheduler().Stats()
 	return map[string]any{
-		"prompt_tokens":      a.totalUsage.PromptTokens,
-		"completion_tokens":  a.totalUsage.CompletionTokens,
-		"total_tokens":       a.totalUsage.TotalTokens,
-		"remaining_requests": a.lastRateLimits.RemainingRequests,
-		"remaining_tokens":   a.lastRateLimits.RemainingTokens,
-		"reset_requests":     a.lastRateLimits.ResetRequests,
-		"reset_tokens":       a.lastRateLimits.ResetTokens,
+		"prompt_tokens":         a.totalUsage.PromptTokens,
+		"completion_tokens":     a.totalUsage.CompletionTokens,
+		"total_tokens":          a.totalUsage.TotalTokens,
+		"cached_tokens":         a.totalUsage.CachedTokens,
+		"cache_creation_tokens": a.totalUsage.CacheCreationTokens,
+		"reasoning_tokens":      a.totalUsage.ReasoningTokens,
+		"cache_hit_ratio":       a.totalUsage.CacheHitRatio(),
+		"subagent_tokens":       a.GetSubAgentUsage().TotalTokens,
+		"cost_today":            a.costs.Today().CostUSD,
+		"cost_session":          a.costs.Session().CostUSD,
+		"remaining_requests":    a.lastRateLimits.RemainingRequests,
+		"remaining_tokens":      a.lastRateLimits.RemainingTokens,
+		"reset_requests":        a.lastRateLimits.ResetRequests,
+		"reset_tokens":          a.lastRateLimits.ResetTokens,
+		"limit_requests":        schedule.RequestsPerMinute,
+		"limit_tokens":          schedule.TokensPerMinute,
+		"throttled_calls":       schedule.Throttled,
+		"throttled_time":        schedule.Waited,
 	}
 }
 
@@ -930,27 +1514,11 @@ func (a *Agent) SwitchModel(provider, baseURL, apiKey, model, reasoningEffort st
 	a.config.APIKey = apiKey
 	a.config.Model = model
 	a.config.ReasoningEffort = reasoningEffort
-	a.llm = llm.NewClientWithProvider(baseURL, apiKey, model, provider)
 
 	// Load OAuth credentials for the new provider
 	oauthStore, _ := config.LoadAllOAuth()
-	newProviderName := a.llm.ProviderName()
-	// Google Gemini uses "openai" provider but OAuth is stored as "google"
-	oauthKey := newProviderName
-	if strings.Contains(baseURL, "googleapis.com") {
-		oauthKey = "google"
-	}
-	if creds, ok := oauthStore[oauthKey]; ok && creds != nil {
-		a.llm.SetOAuthCredentials(creds)
-	} else if creds, ok := oauthStore[newProviderName]; ok && creds != nil {
-		a.llm.SetOAuthCredentials(creds)
-	}
-	if reasoningEffort != "" {
-		a.llm.SetReasoningEffort(reasoningEffort)
-	}
-	if len(a.config.FallbackModels) > 0 {
-		a.llm.SetFallbackModels(a.config.FallbackModels, a.config.FallbackTimeout)
-	}
+	configureTraces(a.config, a.appPath, oauthStore, a.providers)
+	a.llm = a.newClient(oauthStore)
 
 	if err := a.SaveConfig(); err != nil {
 		// Rollback on save failure
@@ -964,6 +1532,15 @@ func (a *Agent) SwitchModel(provider, baseURL, apiKey, model, reasoningEffort st
 	}
 
 	a.logger.Info("Model switched: provider=%s model=%s url=%s effort=%s", provider, model, baseURL, reasoningEffort)
+
+	a.localMissing.Store(false)
+	if a.UsesLocalModels() {
+		ctx, cancel := context.WithTimeout(context.Background(), localModelTimeout)
+		defer cancel()
+		if err := a.prepareLocalModel(ctx); err != nil {
+			a.logger.Warn("%v", err)
+		}
+	}
 	return nil
 }
 
@@ -995,6 +1572,7 @@ func (a *Agent) LoginOAuth(provider, authCode, verifier string) error {
 
 	// Wire into current LLM client
 	a.llm.SetOAuthCredentials(creds)
+	traces.AddSecrets(creds.AccessToken, creds.RefreshToken)
 
 	a.logger.Info("OAuth login (%s) successful, token expires in %v", provider, creds.ExpiresIn())
 	return nil
@@ -1117,6 +1695,11 @@ func (a *Agent) StartTelegram() {
 								default:
 									a.logger.Error("Approval channel full, discarding denial")
 								}
+							case "plan_approve", "plan_retry", "plan_skip", "plan_cancel":
+								if err := a.tgBot.AnswerCallbackQuery(u.CallbackQuery.ID, "OK"); err != nil {
+									a.logger.Error("Failed to answer callback query: %v", err)
+								}
+								go a.handleTelegramPlanAction(u.CallbackQuery.Data)
 							}
 						}
 						continue
@@ -1133,6 +1716,14 @@ func (a *Agent) StartTelegram() {
 						continue
 					}
 
+					// Plan mode takes a goal argument
+					if command == "/plan" || strings.HasPrefix(command, "/plan ") {
+						if u.Message.Chat.ID == a.config.Telegram.ChatID {
+							go a.handleTelegramPlan(u.Message.Text)
+						}
+						continue
+					}
+
 					// Handle Commands
 					switch command {
 					case "/start":
@@ -1155,6 +1746,8 @@ func (a *Agent) StartTelegram() {
   • /model - View current model and fallbacks
   • /model <name> - Switch to another model
 /config reload - Reload configuration from file
+/plan <goal> - Draft a plan for approval
+  • /plan - Show the current plan
 
 *Conversation:*
 Send any message without "/" to chat with the AGI!
@@ -1249,17 +1842,18 @@ The AGI has full access to the project and can execute tools as configured in pe
 
 								// Update agent configuration
 								a.config = newConfig
-
-								// Recreate LLM client with new settings
-								a.llm = llm.NewClientWithProvider(a.config.APIBaseURL, a.config.APIKey, a.config.Model, a.config.Provider)
-								// Re-attach OAuth credentials for the active provider
-								if oauthStore, _ := config.LoadAllOAuth(); oauthStore != nil {
-									if creds, ok := oauthStore[a.llm.ProviderName()]; ok && creds != nil {
-										a.llm.SetOAuthCredentials(creds)
+								configureBreakers(a.config.CircuitBreaker)
+
+								// Recreate LLM client with new settings and credentials
+								oauthStore, _ := config.LoadAllOAuth()
+								configureTraces(a.config, a.appPath, oauthStore, a.providers)
+								a.llm = a.newClient(oauthStore)
+								if a.UsesLocalModels() {
+									localCtx, cancel := context.WithTimeout(context.Background(), localModelTimeout)
+									if err := a.prepareLocalModel(localCtx); err != nil {
+										a.logger.Warn("%v", err)
 									}
-								}
-								if len(a.config.FallbackModels) > 0 {
-									a.llm.SetFallbackModels(a.config.FallbackModels, a.config.FallbackTimeout)
+									cancel()
 								}
 
 								// Update permissions manager
@@ -1380,7 +1974,7 @@ func (a *Agent) isSensitiveTool(name string) bool {
 
 // requestTelegramApproval sends an approval request and waits for a response
 func (a *Agent) requestTelegramApproval(toolName, args string) error {
-	a.statusCallback("⏳ Waiting for remote approval via Telegram...")
+	a.emitStatus("⏳ Waiting for remote approval via Telegram...")
 
 	// Escape special markdown characters in arguments
 	escapedArgs := strings.ReplaceAll(args, "`", "'")
@@ -1427,10 +2021,15 @@ func (a *Agent) requestTelegramApproval(toolName, args string) error {
 // ClearMemory clears a memory tier
 func (a *Agent) ClearMemory(tier memory.MemoryTier) {
 	a.memory.Clear(tier)
+	a.refreshContextUsage()
 }
 
 // ChatWithStreaming processes a user message with streaming response
 func (a *Agent) ChatWithStreaming(userMessage string, callback llm.StreamingCallback) (string, error) {
+	if reason := a.SpendingPaused(); reason != "" {
+		return "", fmt.Errorf("agent paused: %s", reason)
+	}
+
 	// Age working memory
 	a.memory.AgeWorkingMemory(0.05)
 
@@ -1468,30 +2067,18 @@ func (a *Agent) ChatWithStreaming(userMessage string, callback llm.StreamingCall
 	var finalResponse string
 	// Handle tool calls if present (no streaming for tool results)
 	if a.llm.HasToolCalls(resp) {
-		finalResponse, err = a.handleToolCalls(resp, messages, 0)
+		finalResponse, err = a.runToolLoop(a.ctx, resp, messages, newBudgetTracker(BudgetFromConfig(a.config.ToolLoop)))
 	} else {
 		finalResponse = a.llm.GetContent(resp)
-		a.memory.AddMessage("assistant", finalResponse)
+		a.addAssistantMessage(finalResponse)
 	}
 
 	if err != nil {
 		return "", err
 	}
 
-	// Check for context compression based on session stats
-	stats := a.sessionMgr.GetContextStats()
-	if stats.ShouldCompress(a.config.Memory.CompressionTrigger) {
-		a.statusCallback("🗜️ Compressing context...")
-
-		// Compress memory
-		if items := a.memory.GetItemsToCompress(); len(items) > 0 {
-			a.compressContext(items)
-		}
-
-		// Reset session to force context refresh on next interaction
-		a.sessionMgr.ResetSession()
-		a.statusCallback("✅ Context compressed and session reset")
-	}
+	// Compress history if the next prompt would crowd the context window
+	a.maybeCompress()
 
 	// Sync project tasks
 	a.syncProjectTasks()
@@ -1571,6 +2158,11 @@ func (a *Agent) StartHeartbeat() {
 				heartbeatCount++
 				a.logger.Info("💓 Heartbeat #%d at %s", heartbeatCount, t.Format(time.RFC3339))
 
+				if reason := a.SpendingPaused(); reason != "" {
+					a.logger.Info("Heartbeat paused: %s", reason)
+					continue
+				}
+
 				// Perform health check
 				healthStatus := a.healthChecker.Check()
 
@@ -1791,7 +2383,7 @@ func (a *Agent) SetToolExecutor(executor *tools.Executor) {
 }
 
 // continueResponse requests a continuation from the LLM when a response is truncated
-func (a *Agent) continueResponse(messages []llm.Message, currentContent string) (string, error) {
+func (a *Agent) continueResponse(ctx context.Context, messages []llm.Message, currentContent string) (string, error) {
 	var fullContinuation string
 	// Limit continuations to prevent infinite loops
 	for i := 0; i < 5; i++ {
@@ -1808,7 +2400,8 @@ func (a *Agent) continueResponse(messages []llm.Message, currentContent string)
 			Content: "Continue exactly from where you were cut off.",
 		})
 
-		resp, err := a.llm.Chat(contMessages, a.config.Temperature, a.config.TopP, a.config.MaxTokens)
+		a.emitLLMRequest(0, contMessages)
+		resp, err := a.complete(ctx, contMessages, nil, a.config.MaxTokens)
 		if err != nil {
 			return fullContinuation, err
 		}
@@ -0,0 +1,279 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/providers"
+	"ClosedWheeler/pkg/tools"
+)
+
+func TestAgent_StreamedToolLoopRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch requests.Add(1) {
+		case 1:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"read_file","arguments":"{\"path\": \"hello.txt\"}"}}]}}]}` + "\n\n" +
+				`data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}` + "\n\n" +
+				"data: [DONE]\n\n"))
+		case 2:
+			// The tool loop's next step hits a transient outage
+			http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+		default:
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte(`data: {"choices":[{"delta":{"content":"The file says hello."}}]}` + "\n\n" +
+				`data: {"choices":[{"delta":{},"finish_reason":"stop"}]}` + "\n\n" +
+				"data: [DONE]\n\n"))
+		}
+	}))
+	defer server.Close()
+
+	root := t.TempDir()
+	workplace := filepath.Join(root, "workplace")
+	if err := os.MkdirAll(workplace, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workplace, "hello.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.APIKey = "test-key"
+	cfg.APIBaseURL = server.URL
+	cfg.Provider = "openai"
+	cfg.Model = "gpt-stream-retry"
+	cfg.Memory.StoragePath = filepath.Join(root, "memory.json")
+	cfg.Permissions.EnableAuditLog = false
+
+	ag, err := NewAgent(cfg, root, root)
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	defer ag.Shutdown()
+
+	var streamed strings.Builder
+	ag.SetStreamCallback(func(chunk string, done bool) {
+		streamed.WriteString(chunk)
+	})
+
+	answer, err := ag.Chat("What does hello.txt say?")
+	if err != nil {
+		t.Fatalf("Expected the 503 to be retried, got %v", err)
+	}
+	if answer != "The file says hello." {
+		t.Errorf("Expected the answer after the retry, got '%s'", answer)
+	}
+	if streamed.String() != "The file says hello." {
+		t.Errorf("Expected the answer streamed once, got '%s'", streamed.String())
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("Expected 3 requests, got %d", got)
+	}
+
+	calls := ag.GetLastToolCalls()
+	if len(calls) != 1 || calls[0].Name != "read_file" || !calls[0].Success {
+		t.Errorf("Expected one successful read_file call, got %+v", calls)
+	}
+}
+
+// newMockAgent creates an agent in root that answers from a mock provider scenario
+func newMockAgent(t *testing.T, root, scenario string, tweak func(*config.Config)) *Agent {
+	t.Helper()
+	scenarioPath := filepath.Join(root, "scenario.json")
+	if err := os.WriteFile(scenarioPath, []byte(scenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.APIKey = ""
+	cfg.Provider = "mock"
+	cfg.Model = "mock-model"
+	cfg.MockScenario = scenarioPath
+	cfg.Memory.StoragePath = filepath.Join(root, "memory.json")
+	cfg.Permissions.EnableAuditLog = false
+	if tweak != nil {
+		tweak(cfg)
+	}
+
+	ag, err := NewAgent(cfg, root, root)
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	t.Cleanup(func() { ag.Shutdown() })
+	return ag
+}
+
+func TestAgent_PreHookRewritesRecordedCall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test use sh")
+	}
+
+	root := t.TempDir()
+	workplace := filepath.Join(root, "workplace")
+	if err := os.MkdirAll(workplace, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workplace, "final.txt"), []byte("final\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scenario := `{"rules": [{"responses": [
+		{"tool_calls": [{"name": "read_file", "arguments": {"path": "draft.txt"}}]},
+		{"text": "Read it."}
+	]}]}`
+	ag := newMockAgent(t, root, scenario, func(cfg *config.Config) {
+		cfg.Hooks.PreToolUse = []config.HookConfig{
+			{Tool: "read_file", Command: `echo '{"arguments":{"path":"final.txt"}}'`},
+		}
+	})
+
+	var started, finished string
+	ag.Subscribe(func(e Event) {
+		switch e.Type {
+		case EventToolStarted:
+			started = e.Tool.Arguments
+		case EventToolFinished:
+			finished = e.Tool.Output
+		}
+	})
+
+	if _, err := ag.Chat("Read the draft"); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	calls := ag.GetLastToolCalls()
+	if len(calls) != 1 || !calls[0].Success || !strings.Contains(calls[0].Arguments, "final.txt") {
+		t.Fatalf("Expected the rewritten call to be recorded, got %+v", calls)
+	}
+	if !strings.Contains(started, "final.txt") || !strings.Contains(finished, "final") {
+		t.Errorf("Expected events for the rewritten call, got started %q and output %q", started, finished)
+	}
+}
+
+func TestAgent_ChatContextCancellation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the tool case runs sleep")
+	}
+
+	tests := []struct {
+		name     string
+		scenario string
+		cancelOn EventType // Cancel once this event arrives
+		tools    int       // Tool calls recorded before the cancellation
+	}{
+		{
+			name:     "Stream",
+			scenario: `{"chunk_size": 4, "chunk_delay_ms": 200, "rules": [{"responses": [{"text": "partial answer that never finishes"}]}]}`,
+			cancelOn: EventStreamDelta,
+		},
+		{
+			name: "Tool",
+			scenario: `{"rules": [{"responses": [
+				{"tool_calls": [{"name": "exec_command", "arguments": {"command": "sleep 10"}}]},
+				{"text": "partial answer after the tool"}
+			]}]}`,
+			cancelOn: EventToolStarted,
+			tools:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ag := newMockAgent(t, t.TempDir(), tt.scenario, nil)
+			ag.SetStreamCallback(func(chunk string, done bool) {})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ag.Subscribe(func(e Event) {
+				if e.Type == tt.cancelOn {
+					time.AfterFunc(50*time.Millisecond, cancel)
+				}
+			})
+
+			start := time.Now()
+			answer, err := ag.ChatContext(ctx, "Start something slow")
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Expected context.Canceled, got %v (answer '%s')", err, answer)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Expected the turn to stop promptly, took %s", elapsed)
+			}
+
+			messages := ag.memory.GetMessages()
+			if len(messages) != 2 || messages[1]["role"] != "assistant" || !strings.HasPrefix(messages[1]["content"], "[Interrupted") {
+				t.Fatalf("Expected the user message and an interruption note, got %v", messages)
+			}
+			if strings.Contains(messages[1]["content"], "partial") {
+				t.Errorf("Expected no partial answer in memory, got '%s'", messages[1]["content"])
+			}
+			if calls := ag.GetLastToolCalls(); len(calls) != tt.tools {
+				t.Errorf("Expected %d tool calls recorded, got %+v", tt.tools, calls)
+			}
+		})
+	}
+}
+
+func TestAgent_SearchCodeLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int
+		capped   bool
+	}{
+		{"Spilling disabled keeps the cap", 0, true},
+		{"Spilling enabled returns every match", 16 * 1024, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			workplace := filepath.Join(root, "workplace")
+			if err := os.MkdirAll(workplace, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(workplace, "matches.txt"), []byte(strings.Repeat("needle\n", 80)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			ag := newMockAgent(t, root, `{"rules": []}`, func(cfg *config.Config) {
+				cfg.ToolOutput.MaxBytes = tt.maxBytes
+			})
+
+			result, err := ag.executor.Execute(tools.ToolCall{Name: "search_code", Arguments: map[string]any{"query": "needle", "file_pattern": "*.txt"}})
+			if err != nil || !result.Success {
+				t.Fatalf("Expected search_code to succeed, got %+v (%v)", result, err)
+			}
+
+			lines := strings.Count(result.Output, "\n") + 1
+			if tt.capped && (lines != 51 || !strings.Contains(result.Output, "showing first 50 of 80")) {
+				t.Errorf("Expected 50 matches and a note, got %d lines", lines)
+			}
+			if !tt.capped && (lines != 80 || !strings.Contains(result.Output, "matches.txt:80:")) {
+				t.Errorf("Expected all 80 matches, got %d lines", lines)
+			}
+		})
+	}
+}
+
+func TestTrafficSecrets_IncludesFallbackProviders(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.APIKey = "primary-key-123"
+	pm := providers.NewProviderManager()
+	pm.AddProvider(&providers.Provider{ID: "backup", Name: "Backup", Type: providers.ProviderCustom, Model: "m", APIKey: "fallback-key-123"})
+
+	secrets := strings.Join(trafficSecrets(cfg, nil, pm), " ")
+	for _, key := range []string{"primary-key-123", "fallback-key-123"} {
+		if !strings.Contains(secrets, key) {
+			t.Errorf("Expected %s in the redacted secrets, got %q", key, secrets)
+		}
+	}
+}
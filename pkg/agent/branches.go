@@ -0,0 +1,236 @@
+// Package agent provides conversation branching with per-branch file edits
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"ClosedWheeler/pkg/editor"
+	"ClosedWheeler/pkg/llm"
+)
+
+// fileSnapshot captures a file's state before a file-writing tool runs
+type fileSnapshot struct {
+	path     string // As given to the tool
+	fullPath string
+	existed  bool
+	content  string
+}
+
+// snapshotFileEdit records the current state of the file a tool call is about to
+// write, or returns nil if the call doesn't write files
+func (a *Agent) snapshotFileEdit(toolName string, args map[string]any) *fileSnapshot {
+	if a.sessionStore == nil || toolName != "write_file" {
+		return nil // Clones share the edit manager but don't own a session
+	}
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return nil
+	}
+
+	snap := &fileSnapshot{path: path, fullPath: filepath.Join(a.projectPath, path)}
+	if data, err := os.ReadFile(snap.fullPath); err == nil {
+		snap.existed = true
+		snap.content = string(data)
+	}
+	return snap
+}
+
+// recordFileEdit records a completed file write against the current branch
+func (a *Agent) recordFileEdit(snap *fileSnapshot, toolName string) {
+	data, err := os.ReadFile(snap.fullPath)
+	if err != nil {
+		a.logger.Error("Failed to read %s after %s: %v", snap.path, toolName, err)
+		return
+	}
+
+	operation := "create"
+	if snap.existed {
+		operation = "modify"
+	}
+
+	sessionID := a.SessionID()
+	a.editManager.OpenSession(sessionID, "Conversation "+sessionID)
+	a.editManager.RecordApplied(editor.EditRecord{
+		FilePath:    snap.fullPath,
+		Operation:   operation,
+		OldContent:  snap.content,
+		NewContent:  string(data),
+		Description: fmt.Sprintf("%s %s", toolName, snap.path),
+		Turn:        len(a.sessionMgr.GetMessages()),
+	})
+	if err := a.editManager.SaveSession(sessionID); err != nil {
+		a.logger.Error("Failed to save edits for session %s: %v", sessionID, err)
+	}
+}
+
+// ForkSession starts a new branch sharing the first index messages of the active
+// session's transcript (1-based, as listed by GetSessionMessages). Forking at a
+// user message branches just before it, so the question can be asked differently.
+// File edits the active branch made after the fork point are rolled back.
+func (a *Agent) ForkSession(index int, name string) (*SessionRecord, []string, error) {
+	if a.sessionStore == nil {
+		return nil, nil, fmt.Errorf("session persistence is not available")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	parent := a.sessionMgr.Snapshot()
+	if index < 1 || index > len(parent.Messages) {
+		return nil, nil, fmt.Errorf("message index must be between 1 and %d", len(parent.Messages))
+	}
+	keep := index
+	if parent.Messages[keep-1].Role == "user" {
+		keep--
+	}
+	if keep == 0 {
+		return nil, nil, fmt.Errorf("nothing to fork before the first message; use /clear for a fresh start")
+	}
+
+	// Keep the branch we're leaving
+	a.persistSession()
+
+	now := time.Now()
+	child := &SessionRecord{
+		ID:        generateSessionID(),
+		Title:     sessionTitle(parent.Messages),
+		Model:     a.config.Model,
+		Provider:  a.llm.ProviderName(),
+		ParentID:  parent.ID,
+		ForkIndex: keep,
+		Branch:    name,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Messages:  append([]llm.Message(nil), parent.Messages[:keep]...),
+	}
+	child.ShortTerm = child.Messages
+
+	// The branch inherits the edits made before the fork point
+	a.editManager.OpenSession(parent.ID, "Conversation "+parent.ID)
+	if _, err := a.editManager.ForkSession(child.ID, "Branch of "+parent.ID, func(e editor.EditRecord) bool {
+		return e.Turn < keep
+	}); err != nil {
+		return nil, nil, err
+	}
+	restored, err := a.switchEdits(child.ID)
+	if err != nil {
+		return nil, restored, err
+	}
+
+	if err := a.sessionStore.Save(child); err != nil {
+		return nil, restored, err
+	}
+	a.activateSession(child)
+	a.logger.Info("Forked session %s from %s at message %d", child.ID, parent.ID, keep)
+
+	return child, restored, nil
+}
+
+// ListBranches returns the stored sessions in the active session's branch tree
+func (a *Agent) ListBranches() ([]SessionSummary, error) {
+	if a.sessionStore == nil {
+		return nil, fmt.Errorf("session persistence is not available")
+	}
+
+	sessions, err := a.sessionStore.List()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]SessionSummary, len(sessions))
+	for _, s := range sessions {
+		byID[s.ID] = s
+	}
+
+	root := branchRoot(a.SessionID(), byID)
+	var branches []SessionSummary
+	for _, s := range sessions {
+		if branchRoot(s.ID, byID) == root {
+			branches = append(branches, s)
+		}
+	}
+	return branches, nil
+}
+
+// SwitchBranch moves to another branch of the active conversation, restoring its
+// transcript and the files it edited. id may be a unique prefix.
+func (a *Agent) SwitchBranch(id string) (*SessionRecord, []string, error) {
+	branches, err := a.ListBranches()
+	if err != nil {
+		return nil, nil, err
+	}
+	fullID, err := a.sessionStore.Resolve(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inTree := false
+	for _, b := range branches {
+		if b.ID == fullID {
+			inTree = true
+			break
+		}
+	}
+	if !inTree {
+		return nil, nil, fmt.Errorf("session %s is not a branch of this conversation (use /session resume)", fullID)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if fullID == a.sessionMgr.SessionID() {
+		return nil, nil, fmt.Errorf("already on branch %s", fullID)
+	}
+	rec, err := a.sessionStore.Load(fullID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a.persistSession()
+
+	restored, err := a.switchEdits(rec.ID)
+	if err != nil {
+		return nil, restored, err
+	}
+	a.activateSession(rec)
+	a.logger.Info("Switched to branch %s (%d files restored)", rec.ID, len(restored))
+
+	return rec, restored, nil
+}
+
+// switchEdits moves the edit manager from the active session to target,
+// rewriting files as needed, and saves both edit histories
+func (a *Agent) switchEdits(target string) ([]string, error) {
+	current := a.sessionMgr.SessionID()
+	a.editManager.OpenSession(current, "Conversation "+current)
+
+	paths, err := a.editManager.SwitchSession(target)
+	if err != nil {
+		a.logger.Error("Failed to restore files for %s: %v", target, err)
+		return paths, fmt.Errorf("failed to restore files: %w", err)
+	}
+
+	for _, id := range []string{current, target} {
+		if err := a.editManager.SaveSession(id); err != nil {
+			a.logger.Error("Failed to save edits for session %s: %v", id, err)
+		}
+	}
+	return paths, nil
+}
+
+// branchRoot follows parent links to the first session of a branch tree
+func branchRoot(id string, byID map[string]SessionSummary) string {
+	seen := make(map[string]bool)
+	for !seen[id] {
+		seen[id] = true
+		s, ok := byID[id]
+		if !ok || s.ParentID == "" {
+			return id
+		}
+		id = s.ParentID
+	}
+	return id
+}
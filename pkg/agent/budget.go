@@ -0,0 +1,160 @@
+// Package agent provides the step budget for the tool loop
+package agent
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/llm"
+)
+
+// deepStepThreshold is the step after which the loop reports deep execution
+const deepStepThreshold = 10
+
+// stoppedEarlyPrefix starts the reply of a turn whose budget ran out
+const stoppedEarlyPrefix = "⏸️ Stopped early"
+
+// StepBudget limits how much work a single Chat turn may do. Zero disables a limit.
+type StepBudget struct {
+	MaxSteps    int
+	MaxTokens   int
+	MaxDuration time.Duration
+	MaxSpend    float64 // USD
+}
+
+// BudgetFromConfig converts the tool loop config into a StepBudget
+func BudgetFromConfig(cfg config.ToolLoopConfig) StepBudget {
+	return StepBudget{
+		MaxSteps:    cfg.MaxSteps,
+		MaxTokens:   cfg.MaxTokens,
+		MaxDuration: time.Duration(cfg.MaxDurationSeconds) * time.Second,
+		MaxSpend:    cfg.MaxSpendUSD,
+	}
+}
+
+// ProgressEventType identifies a tool loop progress event
+type ProgressEventType string
+
+const (
+	ProgressStep            ProgressEventType = "step"             // A tool-call round is starting
+	ProgressDeepExecution   ProgressEventType = "deep_execution"   // The turn passed deepStepThreshold steps
+	ProgressBudgetExhausted ProgressEventType = "budget_exhausted" // A limit was reached; the turn is wrapping up
+	ProgressSubAgent        ProgressEventType = "sub_agent"        // A delegated sub-agent changed state
+	ProgressPull            ProgressEventType = "pull"             // A local model download advanced
+)
+
+// ProgressEvent reports tool loop progress against the turn's budget
+type ProgressEvent struct {
+	Type      ProgressEventType `json:"type"`
+	Step      int               `json:"step"`
+	ToolCalls int               `json:"tool_calls"` // Tool calls requested in this step
+	Tokens    int               `json:"tokens"`
+	Spend     float64           `json:"spend_usd"`
+	Elapsed   time.Duration     `json:"elapsed"`
+	Budget    StepBudget        `json:"budget"`
+	Reason    string            `json:"reason,omitempty"`    // Set for ProgressBudgetExhausted
+	SubAgent  *SubAgentProgress `json:"sub_agent,omitempty"` // Set for ProgressSubAgent
+	Status    string            `json:"status,omitempty"`    // Set for ProgressPull
+}
+
+// budgetTracker accumulates usage for one turn and checks it against a StepBudget
+type budgetTracker struct {
+	budget StepBudget
+	start  time.Time
+	steps  int
+	tokens int
+	spend  float64
+}
+
+func newBudgetTracker(budget StepBudget) *budgetTracker {
+	return &budgetTracker{
+		budget: budget,
+		start:  time.Now(),
+	}
+}
+
+// addUsage records the usage and cost of one LLM call
+func (t *budgetTracker) addUsage(usage llm.Usage, cost float64) {
+	tokens := usage.TotalTokens
+	if tokens == 0 {
+		tokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	t.tokens += tokens
+	t.spend += cost
+}
+
+// nextStep advances the step counter and returns the new step number
+func (t *budgetTracker) nextStep() int {
+	t.steps++
+	return t.steps
+}
+
+// exhausted returns a human-readable reason if any limit has been reached
+func (t *budgetTracker) exhausted() string {
+	b := t.budget
+	switch {
+	case b.MaxSteps > 0 && t.steps >= b.MaxSteps:
+		return fmt.Sprintf("step limit reached (%d/%d)", t.steps, b.MaxSteps)
+	case b.MaxTokens > 0 && t.tokens >= b.MaxTokens:
+		return fmt.Sprintf("token limit reached (%d/%d)", t.tokens, b.MaxTokens)
+	case b.MaxDuration > 0 && time.Since(t.start) >= b.MaxDuration:
+		return fmt.Sprintf("time limit reached (%s/%s)", time.Since(t.start).Round(time.Second), b.MaxDuration)
+	case b.MaxSpend > 0 && t.spend >= b.MaxSpend:
+		return fmt.Sprintf("spend limit reached ($%.4f/$%.4f)", t.spend, b.MaxSpend)
+	}
+	return ""
+}
+
+// event builds a progress event from the tracker's current state
+func (t *budgetTracker) event(eventType ProgressEventType, toolCalls int, reason string) ProgressEvent {
+	return ProgressEvent{
+		Type:      eventType,
+		Step:      t.steps,
+		ToolCalls: toolCalls,
+		Tokens:    t.tokens,
+		Spend:     t.spend,
+		Elapsed:   time.Since(t.start),
+		Budget:    t.budget,
+		Reason:    reason,
+	}
+}
+
+// maxSummaryToolResult caps each tool result replayed to the budget summary
+const maxSummaryToolResult = 2000
+
+// toolExchangesAsText rewrites tool calls and results as plain text so the
+// budget summary can be asked without tool definitions; Anthropic rejects
+// tool_use and tool_result blocks in a request that defines no tools
+func toolExchangesAsText(messages []llm.Message) []llm.Message {
+	callNames := make(map[string]string)
+	out := make([]llm.Message, 0, len(messages))
+	for _, msg := range messages {
+		switch {
+		case msg.Role == "assistant" && len(msg.ToolCalls) > 0:
+			var sb strings.Builder
+			sb.WriteString(msg.Content)
+			for _, tc := range msg.ToolCalls {
+				callNames[tc.ID] = tc.Function.Name
+				if sb.Len() > 0 {
+					sb.WriteString("\n")
+				}
+				sb.WriteString(fmt.Sprintf("[Called %s(%s)]", tc.Function.Name, tc.Function.Arguments))
+			}
+			out = append(out, llm.Message{Role: "assistant", Content: sb.String()})
+		case msg.Role == "tool":
+			name := callNames[msg.ToolCallID]
+			if name == "" {
+				name = "tool"
+			}
+			out = append(out, llm.Message{
+				Role:    "user",
+				Content: fmt.Sprintf("[Result of %s]\n%s", name, truncateAgentContent(msg.Content, maxSummaryToolResult)),
+			})
+		default:
+			out = append(out, msg)
+		}
+	}
+	return out
+}
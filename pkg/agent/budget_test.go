@@ -0,0 +1,103 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+)
+
+func TestBudgetTracker_Exhausted(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   StepBudget
+		steps    int
+		tokens   int
+		spend    float64
+		started  time.Duration // how long ago the turn started
+		expected string        // substring of the reason, "" for not exhausted
+	}{
+		{"No limits", StepBudget{}, 100, 1_000_000, 50, time.Hour, ""},
+		{"Under step limit", StepBudget{MaxSteps: 5}, 4, 0, 0, 0, ""},
+		{"Step limit", StepBudget{MaxSteps: 5}, 5, 0, 0, 0, "step limit"},
+		{"Token limit", StepBudget{MaxTokens: 1000}, 1, 1200, 0, 0, "token limit"},
+		{"Time limit", StepBudget{MaxDuration: time.Minute}, 1, 0, 0, 2 * time.Minute, "time limit"},
+		{"Spend limit", StepBudget{MaxSpend: 0.10}, 1, 0, 0.25, 0, "spend limit"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newBudgetTracker(tt.budget)
+			tracker.start = time.Now().Add(-tt.started)
+			tracker.steps = tt.steps
+			tracker.tokens = tt.tokens
+			tracker.spend = tt.spend
+
+			reason := tracker.exhausted()
+			if tt.expected == "" && reason != "" {
+				t.Errorf("Expected budget not exhausted, got '%s'", reason)
+			}
+			if tt.expected != "" && !strings.Contains(reason, tt.expected) {
+				t.Errorf("Expected reason containing '%s', got '%s'", tt.expected, reason)
+			}
+		})
+	}
+}
+
+func TestBudgetTracker_AddUsage(t *testing.T) {
+	tracker := newBudgetTracker(StepBudget{})
+
+	tracker.addUsage(llm.Usage{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150}, 0.01)
+	// Providers that omit total_tokens still count
+	tracker.addUsage(llm.Usage{PromptTokens: 30, CompletionTokens: 20}, 0.02)
+
+	if tracker.tokens != 200 {
+		t.Errorf("Expected 200 tokens, got %d", tracker.tokens)
+	}
+	if tracker.spend < 0.0299 || tracker.spend > 0.0301 {
+		t.Errorf("Expected spend 0.03, got %f", tracker.spend)
+	}
+}
+
+func TestBudgetTracker_Event(t *testing.T) {
+	tracker := newBudgetTracker(StepBudget{MaxSteps: 3})
+	tracker.nextStep()
+	tracker.nextStep()
+
+	event := tracker.event(ProgressStep, 4, "")
+	if event.Step != 2 {
+		t.Errorf("Expected step 2, got %d", event.Step)
+	}
+	if event.ToolCalls != 4 {
+		t.Errorf("Expected 4 tool calls, got %d", event.ToolCalls)
+	}
+	if event.Budget.MaxSteps != 3 {
+		t.Errorf("Expected budget max steps 3, got %d", event.Budget.MaxSteps)
+	}
+}
+
+func TestToolExchangesAsText_AnthropicRequest(t *testing.T) {
+	messages := []llm.Message{
+		{Role: "user", Content: "Fix the build"},
+		{Role: "assistant", Content: "Looking.", ToolCalls: []llm.ToolCall{
+			{ID: "toolu_1", Type: "function", Function: llm.FunctionCall{Name: "read_file", Arguments: `{"path":"main.go"}`}},
+		}},
+		{Role: "tool", ToolCallID: "toolu_1", Content: "package main"},
+		{Role: "user", Content: "Summarize what was done."},
+	}
+
+	body, err := llm.DetectProvider("anthropic", "claude-sonnet-4", "").BuildRequestBody("claude-sonnet-4", toolExchangesAsText(messages), nil, nil, nil, nil, false)
+	if err != nil {
+		t.Fatalf("Failed to build request: %v", err)
+	}
+	request := string(body)
+	if strings.Contains(request, "tool_use") || strings.Contains(request, "tool_result") {
+		t.Errorf("Expected no tool blocks in a request without tools, got %s", request)
+	}
+	for _, want := range []string{`[Called read_file({\"path\":\"main.go\"})]`, `[Result of read_file]\npackage main`} {
+		if !strings.Contains(request, want) {
+			t.Errorf("Expected %s in the request, got %s", want, request)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package agent provides context window accounting and compression triggers
+package agent
+
+import (
+	"ClosedWheeler/pkg/llm"
+)
+
+// ContextUsage describes how full the active model's context window is
+type ContextUsage struct {
+	PromptTokens  int     `json:"prompt_tokens"`   // Prompt size of the last request
+	CachedTokens  int     `json:"cached_tokens"`   // Prompt tokens of the last request read from the provider's cache
+	Exact         bool    `json:"exact"`           // PromptTokens was reported by the provider
+	Projected     int     `json:"projected"`       // Estimated prompt size of the next request
+	Window        int     `json:"window"`          // Context window of the active model
+	CharsPerToken float64 `json:"chars_per_token"` // Calibrated estimator ratio
+}
+
+// Fraction returns the projected share of the context window in use
+func (u ContextUsage) Fraction() float64 {
+	if u.Window <= 0 {
+		return 0
+	}
+	return float64(u.Projected) / float64(u.Window)
+}
+
+// GetContextUsage returns the latest context window usage without blocking on a turn
+func (a *Agent) GetContextUsage() ContextUsage {
+	a.usageMu.Lock()
+	defer a.usageMu.Unlock()
+
+	usage := a.contextUsage
+	usage.Window = a.contextWindowLocked()
+	usage.CharsPerToken = a.tokens.CharsPerToken()
+	return usage
+}
+
+// contextWindowLocked resolves the context window of the active model: a
+// per-model override, else the known profile capped by max_context_size, else
+// max_context_size. Callers must hold usageMu.
+func (a *Agent) contextWindowLocked() int {
+	model := a.config.Model
+	if model == a.windowModel && a.window > 0 {
+		return a.window
+	}
+
+	window := a.config.MaxContextSize
+	if params, ok := a.config.ModelParameters[model]; ok && params.ContextWindow > 0 {
+		window = params.ContextWindow
+	} else if profile, known := llm.LookupModelProfile(model); known || window <= 0 {
+		if window <= 0 || profile.ContextWindow < window {
+			window = profile.ContextWindow
+		}
+	}
+
+	a.windowModel = model
+	a.window = window
+	return window
+}
+
+// observePrompt records the size of a request that was just answered. Provider
+// usage is exact and calibrates the local estimator; without it the prompt is estimated.
+func (a *Agent) observePrompt(messages []llm.Message, toolDefs []llm.ToolDefinition, usage llm.Usage) {
+	exact := usage.PromptTokens > 0
+	tokens := usage.PromptTokens
+	if exact {
+		a.tokens.Observe(llm.PromptChars(messages, toolDefs), len(messages), usage.PromptTokens)
+	} else {
+		tokens = a.tokens.EstimatePrompt(messages, toolDefs)
+	}
+
+	a.usageMu.Lock()
+	a.contextUsage.PromptTokens = tokens
+	a.contextUsage.CachedTokens = usage.CachedTokens
+	a.contextUsage.Exact = exact
+	a.usageMu.Unlock()
+}
+
+// refreshContextUsage projects the prompt size of the next request: short-term
+// history, tool schemas and the system prompt if it has to be sent again
+func (a *Agent) refreshContextUsage() ContextUsage {
+	var messages []llm.Message
+	for _, msg := range a.memory.GetMessages() {
+		messages = append(messages, llm.Message{Role: msg["role"], Content: msg["content"]})
+	}
+
+	projected := a.tokens.EstimatePrompt(messages, a.getToolDefinitions())
+	if !a.sessionMgr.GetContextStats().ContextSent {
+		projected += a.systemTokens
+	}
+
+	a.usageMu.Lock()
+	a.contextUsage.Projected = projected
+	a.usageMu.Unlock()
+
+	return a.GetContextUsage()
+}
+
+// maybeCompress compresses old history once the projected prompt crosses the
+// configured fraction of the context window
+func (a *Agent) maybeCompress() {
+	usage := a.refreshContextUsage()
+	threshold := a.config.Memory.CompressionThreshold
+	if threshold <= 0 || usage.Window <= 0 || usage.Fraction() < threshold {
+		return
+	}
+
+	a.logger.Info("Context at %.0f%% of window (%d/%d tokens), compressing", usage.Fraction()*100, usage.Projected, usage.Window)
+	a.emit(Event{Type: EventCompression, Compression: &CompressionEvent{Phase: "started", Before: usage.Projected, Window: usage.Window}})
+
+	// Compress memory
+	if items := a.memory.GetItemsToCompress(); len(items) > 0 {
+		a.compressContext(items)
+	}
+
+	// Reset session to force context refresh on next interaction
+	a.sessionMgr.ResetSession()
+	after := a.refreshContextUsage()
+	a.emit(Event{Type: EventCompression, Compression: &CompressionEvent{
+		Phase:  "finished",
+		Before: usage.Projected,
+		After:  after.Projected,
+		Window: after.Window,
+	}})
+}
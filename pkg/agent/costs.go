@@ -0,0 +1,285 @@
+// Package agent provides spending accounting and budgets for LLM calls
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/llm"
+)
+
+// costRetention is how long daily and session spend is kept in the ledger
+const costRetention = 90 * 24 * time.Hour
+
+// dayFormat keys daily spend by local date
+const dayFormat = "2006-01-02"
+
+// ModelCost is the usage and spend of one model
+type ModelCost struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
+	CostUSD          float64 `json:"cost_usd"`
+	Unpriced         bool    `json:"unpriced,omitempty"` // No pricing is known for the model
+}
+
+// CostSummary is the spend of a day or a session, broken down by model
+type CostSummary struct {
+	CostUSD float64               `json:"cost_usd"`
+	Calls   int                   `json:"calls"`
+	Models  map[string]*ModelCost `json:"models"`
+	Updated time.Time             `json:"updated"`
+}
+
+// DailyCost is the spend of one day
+type DailyCost struct {
+	Date string
+	CostSummary
+}
+
+// add records one call
+func (s *CostSummary) add(model string, usage llm.Usage, cost float64, priced bool, now time.Time) {
+	if s.Models == nil {
+		s.Models = make(map[string]*ModelCost)
+	}
+	m, ok := s.Models[model]
+	if !ok {
+		m = &ModelCost{}
+		s.Models[model] = m
+	}
+	m.Calls++
+	m.PromptTokens += usage.PromptTokens
+	m.CompletionTokens += usage.CompletionTokens
+	m.CachedTokens += usage.CachedTokens
+	m.CacheWriteTokens += usage.CacheCreationTokens
+	m.CostUSD += cost
+	m.Unpriced = !priced
+
+	s.Calls++
+	s.CostUSD += cost
+	s.Updated = now
+}
+
+// copy returns a deep copy that is safe to hand out
+func (s *CostSummary) copy() CostSummary {
+	if s == nil {
+		return CostSummary{Models: map[string]*ModelCost{}}
+	}
+	out := *s
+	out.Models = make(map[string]*ModelCost, len(s.Models))
+	for name, m := range s.Models {
+		mc := *m
+		out.Models[name] = &mc
+	}
+	return out
+}
+
+// costFile is the on-disk form of the ledger
+type costFile struct {
+	Days     map[string]*CostSummary `json:"days"`     // Keyed by local date
+	Sessions map[string]*CostSummary `json:"sessions"` // Keyed by session ID
+}
+
+// CostLedger prices LLM calls and persists spend per day and per session.
+// It is safe for concurrent use; sub-agents and debate clones share their
+// parent's ledger so all spend counts against the same budgets.
+type CostLedger struct {
+	mu        sync.Mutex
+	path      string
+	pricing   llm.PricingTable
+	sessionID func() string
+	data      costFile
+	now       func() time.Time
+}
+
+// NewCostLedger loads the ledger at path (typically .agi/costs.json). Calls
+// are attributed to the session reported by sessionID.
+func NewCostLedger(path string, pricing llm.PricingTable, sessionID func() string) (*CostLedger, error) {
+	l := &CostLedger{
+		path:      path,
+		pricing:   pricing,
+		sessionID: sessionID,
+		data: costFile{
+			Days:     make(map[string]*CostSummary),
+			Sessions: make(map[string]*CostSummary),
+		},
+		now: time.Now,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return l, nil
+		}
+		return l, fmt.Errorf("failed to read cost ledger: %w", err)
+	}
+	var file costFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return l, fmt.Errorf("failed to parse cost ledger: %w", err)
+	}
+	for day, s := range file.Days {
+		l.data.Days[day] = s
+	}
+	for id, s := range file.Sessions {
+		l.data.Sessions[id] = s
+	}
+	return l, nil
+}
+
+// PricingFromConfig returns the built-in prices with the configured overrides applied
+func PricingFromConfig(cfg config.CostsConfig) llm.PricingTable {
+	overrides := make(llm.PricingTable, len(cfg.Pricing))
+	for model, p := range cfg.Pricing {
+		overrides[model] = llm.ModelPricing{
+			InputPerMillion:       p.InputPerMillion,
+			OutputPerMillion:      p.OutputPerMillion,
+			CachedInputPerMillion: p.CachedInputPerMillion,
+			CacheWritePerMillion:  p.CacheWritePerMillion,
+		}
+	}
+	return llm.KnownPricing.WithOverrides(overrides)
+}
+
+// Cost returns the USD cost of usage on model, or 0 if the model is unpriced
+func (l *CostLedger) Cost(model string, usage llm.Usage) float64 {
+	pricing, ok := l.pricing.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return pricing.Cost(usage)
+}
+
+// Record prices one call and adds it to today's and the current session's
+// spend. It has the signature of an llm.UsageHook.
+func (l *CostLedger) Record(model string, usage llm.Usage) {
+	pricing, priced := l.pricing.Lookup(model)
+	cost := pricing.Cost(usage)
+	session := l.sessionID()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	day := now.Format(dayFormat)
+	if l.data.Days[day] == nil {
+		l.data.Days[day] = &CostSummary{}
+	}
+	l.data.Days[day].add(model, usage, cost, priced, now)
+
+	if session != "" {
+		if l.data.Sessions[session] == nil {
+			l.data.Sessions[session] = &CostSummary{}
+		}
+		l.data.Sessions[session].add(model, usage, cost, priced, now)
+	}
+
+	l.prune(now)
+	l.save() // A failed write is retried on the next call
+}
+
+// Today returns today's spend
+func (l *CostLedger) Today() CostSummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.data.Days[l.now().Format(dayFormat)].copy()
+}
+
+// Session returns the current session's spend
+func (l *CostLedger) Session() CostSummary {
+	id := l.sessionID()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.data.Sessions[id].copy()
+}
+
+// RecentDays returns the spend of up to n most recent days with activity, newest first
+func (l *CostLedger) RecentDays(n int) []DailyCost {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	days := make([]string, 0, len(l.data.Days))
+	for day := range l.data.Days {
+		days = append(days, day)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(days)))
+	if len(days) > n {
+		days = days[:n]
+	}
+
+	out := make([]DailyCost, 0, len(days))
+	for _, day := range days {
+		out = append(out, DailyCost{Date: day, CostSummary: l.data.Days[day].copy()})
+	}
+	return out
+}
+
+// prune drops days and sessions older than costRetention. Callers must hold l.mu.
+func (l *CostLedger) prune(now time.Time) {
+	cutoff := now.Add(-costRetention)
+	for day := range l.data.Days {
+		if t, err := time.ParseInLocation(dayFormat, day, now.Location()); err == nil && t.Before(cutoff) {
+			delete(l.data.Days, day)
+		}
+	}
+	for id, s := range l.data.Sessions {
+		if s.Updated.Before(cutoff) {
+			delete(l.data.Sessions, id)
+		}
+	}
+}
+
+// save writes the ledger to disk. Callers must hold l.mu.
+func (l *CostLedger) save() error {
+	if l.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cost ledger directory: %w", err)
+	}
+	data, err := json.MarshalIndent(l.data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cost ledger: %w", err)
+	}
+
+	// Write to a temp file first so a crash mid-write can't corrupt the ledger
+	tmp := l.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cost ledger: %w", err)
+	}
+	return os.Rename(tmp, l.path)
+}
+
+// GetCosts returns today's and the current session's spend
+func (a *Agent) GetCosts() (today, session CostSummary) {
+	return a.costs.Today(), a.costs.Session()
+}
+
+// GetRecentCosts returns the spend of up to n most recent days, newest first
+func (a *Agent) GetRecentCosts(n int) []DailyCost {
+	return a.costs.RecentDays(n)
+}
+
+// SpendingPaused returns why the agent is paused because a daily or session
+// budget has been reached, or ""
+func (a *Agent) SpendingPaused() string {
+	budget := a.config.Costs
+	if budget.DailyBudgetUSD > 0 {
+		if spent := a.costs.Today().CostUSD; spent >= budget.DailyBudgetUSD {
+			return fmt.Sprintf("daily budget reached ($%.2f/$%.2f)", spent, budget.DailyBudgetUSD)
+		}
+	}
+	if budget.SessionBudgetUSD > 0 {
+		if spent := a.costs.Session().CostUSD; spent >= budget.SessionBudgetUSD {
+			return fmt.Sprintf("session budget reached ($%.2f/$%.2f)", spent, budget.SessionBudgetUSD)
+		}
+	}
+	return ""
+}
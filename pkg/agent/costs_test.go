@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+)
+
+func TestCostLedger_RecordAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "costs.json")
+	pricing := llm.PricingTable{"test-model": {InputPerMillion: 1, OutputPerMillion: 2}}
+	session := "session-a"
+
+	ledger, err := NewCostLedger(path, pricing, func() string { return session })
+	if err != nil {
+		t.Fatalf("Failed to create ledger: %v", err)
+	}
+
+	ledger.Record("test-model", llm.Usage{PromptTokens: 1_000_000, CompletionTokens: 500_000})
+	ledger.Record("mystery-model", llm.Usage{PromptTokens: 100})
+	session = "session-b"
+	ledger.Record("test-model", llm.Usage{PromptTokens: 1_000_000})
+
+	if got := ledger.Today(); math.Abs(got.CostUSD-3) > 1e-9 || got.Calls != 3 {
+		t.Errorf("Expected $3 over 3 calls today, got $%f over %d", got.CostUSD, got.Calls)
+	}
+	if got := ledger.Session(); math.Abs(got.CostUSD-1) > 1e-9 {
+		t.Errorf("Expected $1 in session-b, got $%f", got.CostUSD)
+	}
+	if !ledger.Today().Models["mystery-model"].Unpriced {
+		t.Error("Expected mystery-model to be marked unpriced")
+	}
+
+	// Spend survives a restart
+	session = "session-a"
+	reloaded, err := NewCostLedger(path, pricing, func() string { return session })
+	if err != nil {
+		t.Fatalf("Failed to reload ledger: %v", err)
+	}
+	if got := reloaded.Session(); math.Abs(got.CostUSD-2) > 1e-9 || got.Calls != 2 {
+		t.Errorf("Expected $2 over 2 calls in session-a, got $%f over %d", got.CostUSD, got.Calls)
+	}
+}
+
+func TestCostLedger_Prune(t *testing.T) {
+	ledger, _ := NewCostLedger("", llm.PricingTable{}, func() string { return "s" })
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	ledger.now = func() time.Time { return start }
+	ledger.Record("m", llm.Usage{PromptTokens: 1})
+
+	ledger.now = func() time.Time { return start.Add(costRetention + 48*time.Hour) }
+	ledger.Record("m", llm.Usage{PromptTokens: 1})
+
+	if days := ledger.RecentDays(10); len(days) != 1 {
+		t.Errorf("Expected old days to be pruned, got %d days", len(days))
+	}
+}
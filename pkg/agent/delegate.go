@@ -0,0 +1,249 @@
+// Package agent provides sub-agent delegation through the delegate_task tool
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+	"ClosedWheeler/pkg/tools"
+)
+
+const (
+	maxSubAgents       = 5    // Sub-agents one delegate_task call may start
+	subAgentResultSize = 4000 // Hard cap on each condensed result, in bytes
+)
+
+// SubAgentProgress reports the state of one delegated sub-agent
+type SubAgentProgress struct {
+	ID       int    `json:"id"`
+	Task     string `json:"task"`
+	State    string `json:"state"` // "running", "done" or "failed"
+	Step     int    `json:"step"`
+	Tokens   int    `json:"tokens"`
+	Activity string `json:"activity,omitempty"` // Latest status line
+}
+
+// SubAgentResult is what one sub-agent hands back to its parent
+type SubAgentResult struct {
+	ID         int       `json:"id"`
+	Task       string    `json:"task"`
+	Success    bool      `json:"success"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+	ToolCalls  int       `json:"tool_calls"`
+	Usage      llm.Usage `json:"usage"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// delegateTaskTool lets the model hand focused tasks to concurrent sub-agents
+// and get back only their condensed results
+func (a *Agent) delegateTaskTool() *tools.Tool {
+	return &tools.Tool{
+		Name: "delegate_task",
+		Description: "Delegate focused tasks to sub-agents that run concurrently with their own context. " +
+			"Each returns only a condensed result, keeping long explorations out of your context. " +
+			"Use for independent research such as surveying a package or finding all callers of a function.",
+		Parameters: &tools.JSONSchema{
+			Type: "object",
+			Properties: map[string]tools.Property{
+				"tasks": {
+					Type:        "array",
+					Description: fmt.Sprintf("Self-contained instructions, one per sub-agent (max %d)", maxSubAgents),
+					Items:       &tools.Property{Type: "string"},
+				},
+				"mode": {
+					Type:        "string",
+					Enum:        []string{"read_only", "full"},
+					Description: "Tools the sub-agents get: read_only (default) or full (all tools that need no approval)",
+				},
+				"tools": {
+					Type:        "array",
+					Description: "Explicit tool names to allow instead of a mode (optional)",
+					Items:       &tools.Property{Type: "string"},
+				},
+			},
+			Required: []string{"tasks"},
+		},
+		Handler: func(args map[string]any) (tools.ToolResult, error) {
+			return a.delegateTasks(a.ctx, args)
+		},
+		ContextHandler: a.delegateTasks,
+	}
+}
+
+// delegateTasks runs the delegate_task tool
+func (a *Agent) delegateTasks(ctx context.Context, args map[string]any) (tools.ToolResult, error) {
+	tasks := stringList(args["tasks"])
+	if len(tasks) == 0 {
+		return tools.ToolResult{Success: false, Error: "tasks must contain at least one instruction"}, nil
+	}
+	if len(tasks) > maxSubAgents {
+		return tools.ToolResult{Success: false, Error: fmt.Sprintf("at most %d tasks can be delegated at once", maxSubAgents)}, nil
+	}
+
+	mode, _ := args["mode"].(string)
+	allow := a.subAgentTools(mode, stringList(args["tools"]))
+
+	a.logger.Info("Delegating %d task(s) to sub-agents", len(tasks))
+	a.emitStatus(fmt.Sprintf("🤖 Delegating %d task(s) to sub-agents...", len(tasks)))
+
+	results := make([]SubAgentResult, len(tasks))
+	var wg sync.WaitGroup
+	for i, task := range tasks {
+		wg.Add(1)
+		go func(id int, task string) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					a.logger.Error("PANIC in sub-agent %d: %v", id, r)
+					results[id-1] = SubAgentResult{ID: id, Task: task, Error: fmt.Sprintf("internal panic: %v", r)}
+				}
+			}()
+			results[id-1] = a.runSubAgent(ctx, id, task, allow)
+		}(i+1, task)
+	}
+	wg.Wait()
+
+	var out strings.Builder
+	success := false
+	var usage llm.Usage
+	for _, res := range results {
+		status := "✅ done"
+		if !res.Success {
+			status = "❌ failed: " + res.Error
+		} else {
+			success = true
+		}
+		out.WriteString(fmt.Sprintf("## Sub-agent %d: %s\n", res.ID, res.Task))
+		out.WriteString(fmt.Sprintf("Status: %s (%d tool calls, %d tokens, %.1fs)\n\n",
+			status, res.ToolCalls, res.Usage.TotalTokens, float64(res.DurationMs)/1000))
+		if res.Result != "" {
+			out.WriteString(res.Result + "\n\n")
+		}
+		usage.PromptTokens += res.Usage.PromptTokens
+		usage.CompletionTokens += res.Usage.CompletionTokens
+		usage.TotalTokens += res.Usage.TotalTokens
+	}
+
+	a.delegateMu.Lock()
+	a.subAgentUsage.PromptTokens += usage.PromptTokens
+	a.subAgentUsage.CompletionTokens += usage.CompletionTokens
+	a.subAgentUsage.TotalTokens += usage.TotalTokens
+	a.delegateMu.Unlock()
+
+	result := tools.ToolResult{
+		Success: success,
+		Output:  strings.TrimSpace(out.String()),
+		Data:    map[string]any{"sub_agents": results},
+	}
+	if !success {
+		result.Error = "all sub-agents failed"
+	}
+	return result, nil
+}
+
+// runSubAgent runs one task on a fresh clone and condenses its answer
+func (a *Agent) runSubAgent(ctx context.Context, id int, task string, allow func(string) bool) SubAgentResult {
+	start := time.Now()
+	sub := a.clone()
+	defer sub.cancel()
+
+	progress := SubAgentProgress{ID: id, Task: task, State: "running"}
+	var progressMu sync.Mutex
+	report := func(update func(p *SubAgentProgress)) {
+		progressMu.Lock()
+		update(&progress)
+		snapshot := progress
+		progressMu.Unlock()
+		a.emitProgress(ProgressEvent{Type: ProgressSubAgent, SubAgent: &snapshot})
+	}
+
+	sub.Subscribe(func(e Event) {
+		if e.Type == EventProgress {
+			report(func(p *SubAgentProgress) {
+				p.Step = e.Progress.Step
+				p.Tokens = e.Progress.Tokens
+			})
+		} else if summary := e.Summary(); summary != "" {
+			report(func(p *SubAgentProgress) { p.Activity = summary })
+		}
+	})
+	report(func(p *SubAgentProgress) {})
+
+	prompt := fmt.Sprintf(`You are a sub-agent working for another agent. Complete this task:
+
+%s
+
+Work independently with the tools you have. When you are done, reply with a condensed result for the other agent: the answer and key findings, relevant file paths and line numbers, and anything left unresolved. Keep it under 300 words and leave out your exploration steps.`, task)
+
+	response, err := sub.chat(ctx, prompt, turnOptions{allowTool: allow})
+
+	res := SubAgentResult{
+		ID:         id,
+		Task:       task,
+		Success:    err == nil,
+		Result:     truncateAgentContent(strings.TrimSpace(response), subAgentResultSize),
+		ToolCalls:  len(sub.turnToolCalls),
+		Usage:      sub.totalUsage,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	report(func(p *SubAgentProgress) {
+		p.State = "done"
+		if err != nil {
+			p.State = "failed"
+			p.Activity = err.Error()
+		}
+		p.Tokens = res.Usage.TotalTokens
+	})
+	a.logger.Info("Sub-agent %d finished in %s (success: %v, %d tokens)", id, time.Since(start).Round(time.Millisecond), res.Success, res.Usage.TotalTokens)
+	return res
+}
+
+// subAgentTools returns the tool filter for sub-agents. Sub-agents never get
+// delegate_task (no recursive delegation) or tools that need approval.
+func (a *Agent) subAgentTools(mode string, names []string) func(string) bool {
+	explicit := make(map[string]bool, len(names))
+	for _, name := range names {
+		explicit[name] = true
+	}
+
+	return func(name string) bool {
+		if name == "delegate_task" || a.permManager.RequiresApproval(name) {
+			return false
+		}
+		if len(explicit) > 0 {
+			return explicit[name]
+		}
+		if mode == "full" {
+			return true
+		}
+		return readOnlyTools[name]
+	}
+}
+
+// GetSubAgentUsage returns the tokens used by all delegated sub-agents
+func (a *Agent) GetSubAgentUsage() llm.Usage {
+	a.delegateMu.Lock()
+	defer a.delegateMu.Unlock()
+	return a.subAgentUsage
+}
+
+// stringList converts a JSON array argument to strings, skipping blanks
+func stringList(v any) []string {
+	raw, _ := v.([]any)
+	var out []string
+	for _, item := range raw {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			out = append(out, strings.TrimSpace(s))
+		}
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/tools"
+)
+
+// delegateScenario answers sub-agent prompts by the task they carry
+var delegateScenario = fmt.Sprintf(`{"rules": [
+	{"match": "survey the loader", "responses": [{"text": %q}]},
+	{"match": "delegate further", "responses": [
+		{"tool_calls": [{"name": "delegate_task", "arguments": {"tasks": ["nested"]}}]},
+		{"text": "Nested: {{tool_result}}"}
+	]}
+]}`, strings.Repeat("finding ", 1000))
+
+// newDelegateAgent creates a mock agent whose non-sensitive tools need no approval
+func newDelegateAgent(t *testing.T, scenario string) *Agent {
+	return newMockAgent(t, t.TempDir(), scenario, func(cfg *config.Config) {
+		cfg.Permissions.AutoApproveNonSensitive = true
+	})
+}
+
+// subAgentResults returns the per sub-agent results of a delegate_task call
+func subAgentResults(result tools.ToolResult) []SubAgentResult {
+	data, _ := result.Data.(map[string]any)
+	results, _ := data["sub_agents"].([]SubAgentResult)
+	return results
+}
+
+func TestDelegateTasks_Validation(t *testing.T) {
+	ag := newDelegateAgent(t, delegateScenario)
+
+	tests := []struct {
+		name     string
+		tasks    []any
+		expected string
+	}{
+		{"No tasks", []any{}, "at least one"},
+		{"Blank tasks", []any{" ", ""}, "at least one"},
+		{"Too many tasks", []any{"1", "2", "3", "4", "5", "6"}, "at most 5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ag.delegateTasks(context.Background(), map[string]any{"tasks": tt.tasks})
+			if err != nil {
+				t.Fatalf("Expected a tool error, got %v", err)
+			}
+			if result.Success || !strings.Contains(result.Error, tt.expected) {
+				t.Errorf("Expected failure containing %q, got %+v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSubAgentTools(t *testing.T) {
+	ag := newDelegateAgent(t, delegateScenario)
+
+	tests := []struct {
+		name     string
+		mode     string
+		names    []string
+		tool     string
+		expected bool
+	}{
+		{"Read-only by default", "", nil, "read_file", true},
+		{"Read-only hides writes", "read_only", nil, "edit_file", false},
+		{"Full mode", "full", nil, "edit_file", true},
+		{"Full mode keeps approval tools out", "full", nil, "exec_command", false},
+		{"No recursion in full mode", "full", nil, "delegate_task", false},
+		{"Explicit list", "", []string{"git_log"}, "git_log", true},
+		{"Explicit list only", "", []string{"git_log"}, "read_file", false},
+		{"No recursion when listed", "", []string{"delegate_task"}, "delegate_task", false},
+		{"No approval tools when listed", "", []string{"write_file"}, "write_file", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ag.subAgentTools(tt.mode, tt.names)(tt.tool); got != tt.expected {
+				t.Errorf("Expected %s allowed: %v, got %v", tt.tool, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDelegateTasks_SubAgents(t *testing.T) {
+	ag := newDelegateAgent(t, delegateScenario)
+
+	result, err := ag.delegateTasks(context.Background(), map[string]any{
+		"tasks": []any{"survey the loader", "delegate further"},
+		"mode":  "full",
+	})
+	if err != nil || !result.Success {
+		t.Fatalf("Expected the delegation to succeed, got %+v (%v)", result, err)
+	}
+
+	results := subAgentResults(result)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 sub-agent results, got %+v", result.Data)
+	}
+
+	survey := results[0]
+	if !survey.Success || !strings.HasSuffix(survey.Result, "... (truncated)") {
+		t.Errorf("Expected the long answer to be condensed, got %q", survey.Result)
+	}
+	if len(survey.Result) > subAgentResultSize+len("\n... (truncated)") {
+		t.Errorf("Expected at most %d bytes, got %d", subAgentResultSize, len(survey.Result))
+	}
+
+	nested := results[1]
+	if nested.ToolCalls != 1 || !strings.Contains(nested.Result, "not available in this mode") {
+		t.Errorf("Expected the nested delegate_task to be refused, got %+v", nested)
+	}
+
+	if usage := ag.GetSubAgentUsage(); usage.TotalTokens == 0 || usage.TotalTokens != survey.Usage.TotalTokens+nested.Usage.TotalTokens {
+		t.Errorf("Expected the sub-agents' usage to be added up, got %+v", usage)
+	}
+	if len(ag.memory.GetMessages()) != 0 {
+		t.Errorf("Expected sub-agents to leave the parent's history alone")
+	}
+}
+
+func TestDelegateTasks_Cancellation(t *testing.T) {
+	ag := newDelegateAgent(t, `{"latency_ms": 10000, "rules": [{"responses": [{"text": "too late"}]}]}`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	result, err := ag.delegateTasks(ctx, map[string]any{"tasks": []any{"wait forever", "wait as well"}})
+	if err != nil {
+		t.Fatalf("Expected a tool result, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected cancellation to stop the sub-agents, took %s", elapsed)
+	}
+	if result.Success {
+		t.Errorf("Expected cancelled sub-agents to fail, got %+v", result)
+	}
+	results := subAgentResults(result)
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 sub-agent results, got %+v", result.Data)
+	}
+	for _, res := range results {
+		if !strings.Contains(res.Error, "canceled") {
+			t.Errorf("Expected sub-agent %d to report the cancellation, got %q", res.ID, res.Error)
+		}
+	}
+}
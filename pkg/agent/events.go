@@ -0,0 +1,300 @@
+// Package agent provides the typed event stream agents report progress through
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+	"ClosedWheeler/pkg/tools"
+)
+
+// eventOutputSize caps the tool output carried by ToolFinished events
+const eventOutputSize = 500
+
+// toolCallDeltaInterval throttles the ToolCallDelta events of one tool call
+const toolCallDeltaInterval = 250 * time.Millisecond
+
+// EventType identifies an agent event
+type EventType string
+
+const (
+	EventTurnStarted   EventType = "turn_started"    // A user message started a turn
+	EventLLMRequest    EventType = "llm_request"     // A request is being sent to the model
+	EventStreamDelta   EventType = "stream_delta"    // A chunk of streamed model output
+	EventToolCallDelta EventType = "tool_call_delta" // The model is still generating a tool call's arguments
+	EventToolStarted   EventType = "tool_started"    // A tool call is starting
+	EventToolFinished  EventType = "tool_finished"   // A tool call returned
+	EventCompression   EventType = "compression"     // History compression started or finished
+	EventUsageUpdated  EventType = "usage_updated"   // A model response reported token usage
+	EventTurnFinished  EventType = "turn_finished"   // The turn ended (successfully or not)
+	EventStatus        EventType = "status"          // Free-form status line
+	EventProgress      EventType = "progress"        // Tool loop progress against the budget, sub-agents and model pulls
+	EventReasoning     EventType = "reasoning"       // A reasoning summary reported by the model
+)
+
+// Event is one entry in an agent's event stream. Type says which of the
+// optional fields are set.
+type Event struct {
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id,omitempty"`
+
+	Message string `json:"message,omitempty"` // Status text, the user message (TurnStarted), the reply (TurnFinished), the summary (Reasoning) or the progress (ToolCallDelta)
+	Error   string `json:"error,omitempty"`   // TurnFinished: why the turn failed
+
+	Model    string `json:"model,omitempty"`    // LLMRequest
+	Step     int    `json:"step,omitempty"`     // LLMRequest: tool loop step, 0 outside the tool loop
+	Messages int    `json:"messages,omitempty"` // LLMRequest: messages sent
+
+	Delta string `json:"delta,omitempty"` // StreamDelta
+
+	Tool        *ToolEvent        `json:"tool,omitempty"`        // ToolCallDelta, ToolStarted, ToolFinished
+	Compression *CompressionEvent `json:"compression,omitempty"` // Compression
+	Progress    *ProgressEvent    `json:"progress,omitempty"`    // Progress
+
+	Usage      *llm.Usage    `json:"usage,omitempty"`       // UsageUpdated: this call
+	TotalUsage *llm.Usage    `json:"total_usage,omitempty"` // UsageUpdated: all calls so far
+	Context    *ContextUsage `json:"context,omitempty"`     // UsageUpdated: context window usage
+
+	ToolCalls int           `json:"tool_calls,omitempty"` // TurnFinished
+	Duration  time.Duration `json:"duration,omitempty"`   // TurnFinished
+}
+
+// ToolEvent describes one tool call
+type ToolEvent struct {
+	ID         string `json:"id,omitempty"`
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments,omitempty"`
+	Success    bool   `json:"success"`
+	Output     string `json:"output,omitempty"` // Truncated
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"duration_ms,omitempty"`
+	Received   int    `json:"received,omitempty"` // ToolCallDelta: argument bytes generated so far
+}
+
+// CompressionEvent describes a history compression
+type CompressionEvent struct {
+	Phase  string `json:"phase"`  // "started" or "finished"
+	Before int    `json:"before"` // Projected prompt tokens before compressing
+	After  int    `json:"after,omitempty"`
+	Window int    `json:"window"`
+}
+
+// Summary renders the event as a one-line status for people, or "" for
+// events that are not worth showing on their own
+func (e Event) Summary() string {
+	switch e.Type {
+	case EventStatus:
+		return e.Message
+	case EventToolStarted:
+		return fmt.Sprintf("🔧 Executing %s...", e.Tool.Name)
+	case EventCompression:
+		if e.Compression.Phase == "started" {
+			return "🗜️ Compressing context..."
+		}
+		return "✅ Context compressed and session reset"
+	}
+	return ""
+}
+
+// EventBus fans events out to any number of subscribers. Subscribers run
+// synchronously in the publishing goroutine and should return quickly.
+type EventBus struct {
+	mu   sync.RWMutex
+	subs map[int]func(Event)
+	next int
+}
+
+// NewEventBus creates an event bus without subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[int]func(Event))}
+}
+
+// Subscribe registers fn for every event and returns a function that removes it
+func (b *EventBus) Subscribe(fn func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.next
+	b.next++
+	b.subs[id] = fn
+
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+// Publish delivers an event to all subscribers. A panicking subscriber does not
+// affect the others.
+func (b *EventBus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	subs := make([]func(Event), 0, len(b.subs))
+	for _, fn := range b.subs {
+		subs = append(subs, fn)
+	}
+	b.mu.RUnlock()
+
+	for _, fn := range subs {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("[ERROR] event subscriber panicked on %s: %v", e.Type, r)
+				}
+			}()
+			fn(e)
+		}()
+	}
+}
+
+// JSONLWriter returns a subscriber that writes each event to w as one JSON line
+func JSONLWriter(w io.Writer) func(Event) {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(e)
+	}
+}
+
+// Subscribe registers fn for the agent's events and returns a function that removes it
+func (a *Agent) Subscribe(fn func(Event)) func() {
+	return a.events.Subscribe(fn)
+}
+
+// ExportEvents appends the agent's event stream to a JSONL file until the
+// returned function is called
+func (a *Agent) ExportEvents(path string) (func() error, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create event log directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+
+	unsubscribe := a.events.Subscribe(JSONLWriter(f))
+	return func() error {
+		unsubscribe()
+		return f.Close()
+	}, nil
+}
+
+// emit publishes an event stamped with the current session
+func (a *Agent) emit(e Event) {
+	a.UpdateActivity()
+	if e.SessionID == "" {
+		e.SessionID = a.sessionMgr.SessionID()
+	}
+	a.events.Publish(e)
+}
+
+// emitStatus publishes a free-form status line
+func (a *Agent) emitStatus(message string) {
+	a.emit(Event{Type: EventStatus, Message: message})
+}
+
+// emitLLMRequest publishes that a request with messages is being sent
+func (a *Agent) emitLLMRequest(step int, messages []llm.Message) {
+	a.emit(Event{Type: EventLLMRequest, Model: a.config.Model, Step: step, Messages: len(messages)})
+}
+
+// emitReasoning publishes the reasoning summary of a response, if it has one
+func (a *Agent) emitReasoning(resp *llm.ChatResponse) {
+	if resp.Reasoning != "" {
+		a.emit(Event{Type: EventReasoning, Message: resp.Reasoning})
+	}
+}
+
+// streamWithEvents wraps the stream callback so chunks are also published as StreamDelta events
+func (a *Agent) streamWithEvents() llm.StreamingCallback {
+	cb := a.streamCallback
+	return func(chunk string, done bool) {
+		if chunk != "" {
+			a.emit(Event{Type: EventStreamDelta, Delta: chunk})
+		}
+		cb(chunk, done)
+	}
+}
+
+// toolCallProgress returns a callback that publishes ToolCallDelta events
+// while the model generates tool call arguments: when a call starts and then
+// at most every toolCallDeltaInterval
+func (a *Agent) toolCallProgress() llm.ToolCallCallback {
+	last, lastTime := -1, time.Time{}
+	return func(delta llm.ToolCallDelta) {
+		if delta.Index == last && time.Since(lastTime) < toolCallDeltaInterval {
+			return
+		}
+		last, lastTime = delta.Index, time.Now()
+		a.emit(Event{
+			Type:    EventToolCallDelta,
+			Message: describeToolProgress(delta.Name, delta.Arguments),
+			Tool:    &ToolEvent{ID: delta.ID, Name: delta.Name, Received: len(delta.Arguments)},
+		})
+	}
+}
+
+// toolPathPattern finds the path argument in incomplete tool call JSON
+var toolPathPattern = regexp.MustCompile(`"(?:path|file_path|filename)"\s*:\s*"((?:[^"\\]|\\.)*)"`)
+
+// describeToolProgress renders a status line for a tool call whose arguments
+// (a JSON prefix) are still being generated
+func describeToolProgress(name, partialArgs string) string {
+	size := tools.FormatBytes(len(partialArgs))
+	path := ""
+	if m := toolPathPattern.FindStringSubmatch(partialArgs); m != nil {
+		if err := json.Unmarshal([]byte(`"`+m[1]+`"`), &path); err != nil {
+			path = m[1]
+		}
+	}
+
+	switch {
+	case name == "write_file" && path != "":
+		return fmt.Sprintf("✍️ Writing file %s (%s so far)", path, size)
+	case path != "":
+		return fmt.Sprintf("🔧 Preparing %s for %s (%s so far)", name, path, size)
+	}
+	return fmt.Sprintf("🔧 Preparing %s (%s so far)", name, size)
+}
+
+// emitToolFinished publishes the outcome of a tool call
+func (a *Agent) emitToolFinished(tc llm.ToolCall, result tools.ToolResult, err error, elapsed time.Duration) {
+	event := &ToolEvent{
+		ID:         tc.ID,
+		Name:       tc.Function.Name,
+		Arguments:  tc.Function.Arguments,
+		Success:    err == nil && result.Success,
+		Output:     truncateAgentContent(result.Output, eventOutputSize),
+		Error:      result.Error,
+		DurationMs: elapsed.Milliseconds(),
+	}
+	if event.Error == "" && err != nil {
+		event.Error = err.Error()
+	}
+	a.emit(Event{Type: EventToolFinished, Tool: event})
+}
+
+// mirrorToTelegram sends status lines to the Telegram chat when it is enabled
+func (a *Agent) mirrorToTelegram(e Event) {
+	if !a.config.Telegram.Enabled || a.config.Telegram.ChatID == 0 {
+		return
+	}
+	if summary := e.Summary(); summary != "" {
+		go a.tgBot.SendMessage("📢 " + summary)
+	}
+}
@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEventBus_Subscribers(t *testing.T) {
+	bus := NewEventBus()
+
+	var first, second []EventType
+	unsubscribe := bus.Subscribe(func(e Event) { first = append(first, e.Type) })
+	bus.Subscribe(func(e Event) { panic("bad subscriber") })
+	bus.Subscribe(func(e Event) { second = append(second, e.Type) })
+
+	bus.Publish(Event{Type: EventTurnStarted})
+	unsubscribe()
+	bus.Publish(Event{Type: EventTurnFinished})
+
+	if len(first) != 1 || first[0] != EventTurnStarted {
+		t.Errorf("Expected first subscriber to get only turn_started, got %v", first)
+	}
+	if len(second) != 2 {
+		t.Errorf("Expected second subscriber to get 2 events despite a panicking subscriber, got %v", second)
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	var buf bytes.Buffer
+	bus := NewEventBus()
+	bus.Subscribe(JSONLWriter(&buf))
+
+	bus.Publish(Event{Type: EventToolFinished, Tool: &ToolEvent{Name: "read_file", Success: true}})
+	bus.Publish(Event{Type: EventStatus, Message: "🔄 Refreshing context..."})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+
+	var e Event
+	if err := json.Unmarshal([]byte(lines[0]), &e); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if e.Type != EventToolFinished || e.Tool == nil || e.Tool.Name != "read_file" {
+		t.Errorf("Expected tool_finished for read_file, got %+v", e)
+	}
+	if e.Time.IsZero() {
+		t.Error("Expected event time to be set")
+	}
+}
+
+func TestDescribeToolProgress(t *testing.T) {
+	tests := []struct {
+		name string
+		tool string
+		args string
+		want string
+	}{
+		{"Path not streamed yet", "write_file", `{"pa`, "🔧 Preparing write_file (4 bytes so far)"},
+		{"Writing a file", "write_file", `{"path":"pkg/foo.go","content":"` + strings.Repeat("x", 2330), "✍️ Writing file pkg/foo.go (2.3 KB so far)"},
+		{"Escaped path", "write_file", `{"path":"dir\\a.go","con`, `✍️ Writing file dir\a.go (24 bytes so far)`},
+		{"Other tool", "exec_command", `{"command":"go test`, "🔧 Preparing exec_command (19 bytes so far)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := describeToolProgress(tt.tool, tt.args); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
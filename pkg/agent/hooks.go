@@ -0,0 +1,32 @@
+// Package agent provides the wiring of configured tool hooks
+package agent
+
+import (
+	"time"
+
+	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/tools"
+)
+
+// newToolHooks compiles the configured hooks, which run in the project
+// directory. It returns nil when no hooks are configured.
+func newToolHooks(cfg config.HooksConfig, projectPath string) (*tools.Hooks, error) {
+	if len(cfg.PreToolUse) == 0 && len(cfg.PostToolUse) == 0 {
+		return nil, nil
+	}
+	return tools.NewHooks(toolHooks(cfg.PreToolUse), toolHooks(cfg.PostToolUse), projectPath)
+}
+
+func toolHooks(hooks []config.HookConfig) []tools.Hook {
+	out := make([]tools.Hook, 0, len(hooks))
+	for _, h := range hooks {
+		out = append(out, tools.Hook{
+			Tool:    h.Tool,
+			Args:    h.Args,
+			Command: h.Command,
+			Timeout: time.Duration(h.Timeout) * time.Second,
+			OnError: h.OnError,
+		})
+	}
+	return out
+}
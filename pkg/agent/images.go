@@ -0,0 +1,140 @@
+// Package agent provides image attachments for vision models
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"ClosedWheeler/pkg/llm"
+)
+
+// imageRefPattern matches @image:path and @image:"path with spaces"
+var imageRefPattern = regexp.MustCompile(`@image:(?:"([^"]+)"|(\S+))`)
+
+// ImageRefs returns the image files a message references with @image:
+func ImageRefs(message string) []string {
+	var paths []string
+	for _, match := range imageRefPattern.FindAllStringSubmatch(message, -1) {
+		path := match[1]
+		if path == "" {
+			path = match[2]
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// imageOmittedNote replaces images sent to a model that cannot see them
+const imageOmittedNote = "(Image not shown: the current model does not accept images.)"
+
+// SupportsVision reports whether the active model accepts images
+func (a *Agent) SupportsVision() bool {
+	return a.modelSupportsVision(a.config.Model)
+}
+
+// modelSupportsVision reports whether model accepts images, from its
+// model_parameters override or else its profile
+func (a *Agent) modelSupportsVision(model string) bool {
+	if params, ok := a.config.ModelParameters[model]; ok && params.Vision != nil {
+		return *params.Vision
+	}
+	profile, _ := llm.LookupModelProfile(model)
+	return profile.SupportsVision
+}
+
+// withoutImages replaces the images in messages with a note, for a model that
+// cannot see them: images attached before a /model switch or a failover to a
+// text-only provider would otherwise make the request fail
+func withoutImages(messages []llm.Message) []llm.Message {
+	var out []llm.Message
+	for i, msg := range messages {
+		if !msg.HasImages() {
+			if out != nil {
+				out = append(out, msg)
+			}
+			continue
+		}
+		if out == nil {
+			out = append(make([]llm.Message, 0, len(messages)), messages[:i]...)
+		}
+		msg.Parts = nil
+		msg.Content = strings.TrimSpace(msg.Content + "\n" + imageOmittedNote)
+		out = append(out, msg)
+	}
+	if out == nil {
+		return messages
+	}
+	return out
+}
+
+// resolveImagePath resolves a user-supplied image path: relative paths are
+// looked up in the workplace first, then in the working directory
+func (a *Agent) resolveImagePath(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	if candidate := filepath.Join(a.projectPath, path); fileExists(candidate) {
+		return candidate
+	}
+	return path
+}
+
+// attachImages loads the images a user message references into it
+func (a *Agent) attachImages(msg llm.Message, refs []string) (llm.Message, error) {
+	if !a.SupportsVision() {
+		return msg, fmt.Errorf("model %s does not accept images (set \"vision\": true in model_parameters if it does)", a.config.Model)
+	}
+	images := make([]llm.ContentPart, 0, len(refs))
+	for _, ref := range refs {
+		image, err := llm.LoadImage(a.resolveImagePath(ref))
+		if err != nil {
+			return msg, fmt.Errorf("failed to attach %s: %w", ref, err)
+		}
+		images = append(images, image)
+	}
+	return llm.NewImageMessage(msg.Role, msg.Content, images...), nil
+}
+
+// toolResultMessage builds the message for a tool result, attaching the
+// images it returned when the model can see them
+func (a *Agent) toolResultMessage(callID string, output string, imagePaths []string) llm.Message {
+	msg := llm.Message{Role: "tool", Content: output, ToolCallID: callID}
+	if len(imagePaths) == 0 {
+		return msg
+	}
+	if !a.SupportsVision() {
+		msg.Content += "\n" + imageOmittedNote
+		return msg
+	}
+
+	var images []llm.ContentPart
+	for _, path := range imagePaths {
+		image, err := llm.LoadImage(path)
+		if err != nil {
+			a.logger.Warn("Failed to attach tool image %s: %v", path, err)
+			msg.Content += fmt.Sprintf("\n(Image %s could not be attached: %v)", filepath.Base(path), err)
+			continue
+		}
+		images = append(images, image)
+	}
+	if len(images) == 0 {
+		return msg
+	}
+	withImages := llm.NewImageMessage("tool", msg.Content, images...)
+	withImages.ToolCallID = callID
+	return withImages
+}
+
+// fileExists reports whether path names an existing file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/llm"
+)
+
+func TestAgent_CompleteDropsImagesForTextModels(t *testing.T) {
+	tests := []struct {
+		name       string
+		vision     bool
+		wantImages bool
+	}{
+		{"Vision model gets the image", true, true},
+		{"Text model gets a note", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := io.ReadAll(r.Body)
+				body = string(data)
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}]}`))
+			}))
+			defer server.Close()
+
+			root := t.TempDir()
+			cfg := config.DefaultConfig()
+			cfg.APIKey = "test-key"
+			cfg.APIBaseURL = server.URL
+			cfg.Provider = "openai"
+			cfg.Model = "gpt-images"
+			vision := tt.vision
+			cfg.ModelParameters = map[string]config.ModelParams{"gpt-images": {Vision: &vision}}
+			cfg.Memory.StoragePath = filepath.Join(root, "memory.json")
+			cfg.Permissions.EnableAuditLog = false
+
+			ag, err := NewAgent(cfg, root, root)
+			if err != nil {
+				t.Fatalf("Failed to create agent: %v", err)
+			}
+			defer ag.Shutdown()
+
+			image := llm.ContentPart{Type: "image", MediaType: "image/png", Data: "iVBORw0KGgo="}
+			messages := []llm.Message{llm.NewImageMessage("user", "What is in this picture?", image)}
+			if _, err := ag.complete(context.Background(), messages, nil, nil); err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+
+			if got := strings.Contains(body, "image_url"); got != tt.wantImages {
+				t.Errorf("Expected image sent: %v, got request %s", tt.wantImages, body)
+			}
+			if !tt.wantImages && !strings.Contains(body, "Image not shown") {
+				t.Errorf("Expected a note in place of the image, got %s", body)
+			}
+			if !messages[0].HasImages() {
+				t.Errorf("Expected the caller's messages to keep their images")
+			}
+		})
+	}
+}
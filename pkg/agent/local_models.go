@@ -0,0 +1,113 @@
+// Package agent provides the agent side of local models: install checks, auto-pull and model profiles
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+)
+
+// localModelTimeout bounds metadata requests to the local model server
+const localModelTimeout = 10 * time.Second
+
+// UsesLocalModels reports whether the active provider is a local Ollama server
+func (a *Agent) UsesLocalModels() bool {
+	return a.llm.ProviderName() == "ollama"
+}
+
+// prepareLocalModel reads the active model's real context length and tool
+// support from the server into its profile, and sets the keep-alive and the
+// context size the model is loaded with. A missing model is remembered so
+// the next turn can pull it.
+func (a *Agent) prepareLocalModel(ctx context.Context) error {
+	if !a.UsesLocalModels() {
+		return nil
+	}
+	ollama := a.config.Ollama
+	a.llm.SetOllamaOptions(ollama.KeepAlive, ollama.NumCtx)
+
+	info, err := llm.ShowOllamaModel(ctx, a.config.APIBaseURL, a.config.Model)
+	a.localMissing.Store(errors.Is(err, llm.ErrOllamaModelNotFound))
+	if err != nil {
+		return fmt.Errorf("failed to inspect local model %s: %w", a.config.Model, err)
+	}
+	llm.RegisterModelProfile(info.Profile())
+
+	// Recompute the window from the new profile; unless overridden, the model
+	// is loaded with exactly the context the agent will fill
+	a.usageMu.Lock()
+	a.window = 0
+	numCtx := a.contextWindowLocked()
+	a.usageMu.Unlock()
+	if ollama.NumCtx > 0 {
+		numCtx = ollama.NumCtx
+	}
+	a.llm.SetOllamaOptions(ollama.KeepAlive, numCtx)
+
+	a.logger.Info("Local model %s: context %d (loaded with %d), tools=%v", a.config.Model, info.ContextLength, numCtx, info.Supports("tools"))
+	return nil
+}
+
+// ensureLocalModel pulls the active local model before a turn if it is not
+// installed and auto_pull is enabled
+func (a *Agent) ensureLocalModel(ctx context.Context) error {
+	if !a.localMissing.Load() {
+		return nil
+	}
+	model := a.config.Model
+	if !a.config.Ollama.AutoPull {
+		return fmt.Errorf("local model %s is not installed (use /pull %s or enable ollama.auto_pull)", model, model)
+	}
+	return a.PullModel(ctx, model)
+}
+
+// ListLocalModels returns the models installed on the Ollama server
+func (a *Agent) ListLocalModels(ctx context.Context) ([]llm.OllamaModel, error) {
+	ctx, cancel := context.WithTimeout(ctx, localModelTimeout)
+	defer cancel()
+	return llm.ListOllamaModels(ctx, a.config.APIBaseURL)
+}
+
+// PullModel downloads a model to the Ollama server, publishing progress as
+// progress events and the outcome as a status. Pulling the active model also
+// refreshes its profile.
+func (a *Agent) PullModel(ctx context.Context, model string) error {
+	lastStatus, lastPercent := "", -1
+	err := llm.PullOllamaModel(ctx, a.config.APIBaseURL, model, func(p llm.OllamaPullProgress) {
+		percent := -1
+		if p.Total > 0 {
+			percent = int(p.Completed * 100 / p.Total)
+		}
+		// Layers report many small increments; only publish visible changes
+		if p.Status == lastStatus && percent == lastPercent {
+			return
+		}
+		lastStatus, lastPercent = p.Status, percent
+		a.emitProgress(ProgressEvent{Type: ProgressPull, Status: formatPullProgress(model, p)})
+	})
+	if err != nil {
+		a.emitStatus(fmt.Sprintf("❌ Pull of %s failed", model))
+		return fmt.Errorf("failed to pull %s: %w", model, err)
+	}
+
+	a.emitStatus(fmt.Sprintf("✅ Pulled %s", model))
+	a.logger.Info("Pulled local model %s", model)
+	if model == a.config.Model {
+		ctx, cancel := context.WithTimeout(ctx, localModelTimeout)
+		defer cancel()
+		return a.prepareLocalModel(ctx)
+	}
+	return nil
+}
+
+// formatPullProgress renders a pull progress report as a status line
+func formatPullProgress(model string, p llm.OllamaPullProgress) string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("⬇️ Pulling %s: %s", model, p.Status)
+	}
+	const gb = 1024 * 1024 * 1024
+	return fmt.Sprintf("⬇️ Pulling %s: %d%% (%.2f / %.2f GB)", model, p.Completed*100/p.Total, float64(p.Completed)/gb, float64(p.Total)/gb)
+}
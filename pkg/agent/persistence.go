@@ -0,0 +1,117 @@
+// Package agent provides session persistence and resume for the Agent
+package agent
+
+import (
+	"fmt"
+
+	"ClosedWheeler/pkg/llm"
+	"ClosedWheeler/pkg/memory"
+)
+
+// persistSession writes the current session to the session store
+func (a *Agent) persistSession() {
+	if a.sessionStore == nil {
+		return
+	}
+
+	rec := a.sessionMgr.Snapshot()
+	if len(rec.Messages) == 0 {
+		return // Nothing worth resuming yet
+	}
+
+	rec.Title = sessionTitle(rec.Messages)
+	rec.Model = a.config.Model
+	rec.Provider = a.llm.ProviderName()
+	for _, msg := range a.memory.GetMessages() {
+		rec.ShortTerm = append(rec.ShortTerm, llm.Message{Role: msg["role"], Content: msg["content"]})
+	}
+
+	if err := a.sessionStore.Save(rec); err != nil {
+		a.logger.Error("Failed to persist session %s: %v", rec.ID, err)
+	}
+}
+
+// SessionID returns the ID of the active conversation session
+func (a *Agent) SessionID() string {
+	return a.sessionMgr.SessionID()
+}
+
+// GetSessionMessages returns the active session's user/assistant transcript
+func (a *Agent) GetSessionMessages() []llm.Message {
+	return a.sessionMgr.GetMessages()
+}
+
+// ListSessions returns stored sessions, most recent first
+func (a *Agent) ListSessions() ([]SessionSummary, error) {
+	if a.sessionStore == nil {
+		return nil, fmt.Errorf("session persistence is not available")
+	}
+	return a.sessionStore.List()
+}
+
+// ResumeSession saves the active session and replaces it with a stored one.
+// id may be a unique prefix of the session ID.
+func (a *Agent) ResumeSession(id string) (*SessionRecord, error) {
+	if a.sessionStore == nil {
+		return nil, fmt.Errorf("session persistence is not available")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	fullID, err := a.sessionStore.Resolve(id)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := a.sessionStore.Load(fullID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the session we're leaving
+	a.persistSession()
+
+	a.activateSession(rec)
+
+	if rec.Model != "" && rec.Model != a.config.Model {
+		a.logger.Info("Resumed session %s was recorded with model %s (current: %s)", rec.ID, rec.Model, a.config.Model)
+	}
+	a.logger.Info("Resumed session %s (%d messages)", rec.ID, len(rec.Messages))
+
+	return rec, nil
+}
+
+// activateSession makes rec the active session and loads what the model
+// should see into short-term memory
+func (a *Agent) activateSession(rec *SessionRecord) {
+	a.sessionMgr.Restore(rec)
+
+	shortTerm := rec.ShortTerm
+	if len(shortTerm) == 0 {
+		shortTerm = rec.Messages
+	}
+	messages := make([]map[string]string, 0, len(shortTerm))
+	for _, msg := range shortTerm {
+		messages = append(messages, map[string]string{"role": msg.Role, "content": msg.Content})
+	}
+	a.memory.ReplaceMessages(messages)
+	a.memory.Clear(memory.WorkingMem)
+	a.refreshContextUsage()
+}
+
+// DeleteSession removes a stored session. The active session cannot be deleted.
+// id may be a unique prefix of the session ID; the full ID is returned.
+func (a *Agent) DeleteSession(id string) (string, error) {
+	if a.sessionStore == nil {
+		return "", fmt.Errorf("session persistence is not available")
+	}
+
+	fullID, err := a.sessionStore.Resolve(id)
+	if err != nil {
+		return "", err
+	}
+	if fullID == a.SessionID() {
+		return "", fmt.Errorf("cannot delete the active session")
+	}
+	return fullID, a.sessionStore.Delete(fullID)
+}
@@ -0,0 +1,495 @@
+// Package agent provides plan-then-execute mode with an approval gate
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ClosedWheeler/pkg/prompts"
+	"ClosedWheeler/pkg/telegram"
+	"ClosedWheeler/pkg/tools"
+	"ClosedWheeler/pkg/tools/builtin"
+)
+
+// PlanStatus is the lifecycle state of a plan
+type PlanStatus string
+
+const (
+	PlanDraft   PlanStatus = "draft"   // Written, waiting for approval
+	PlanRunning PlanStatus = "running" // Executing step by step
+	PlanPaused  PlanStatus = "paused"  // Stopped at a failed step, waiting for a decision
+	PlanDone    PlanStatus = "done"    // All steps done or skipped
+)
+
+// stepFailedMarker is how the model reports that it could not complete a step
+const stepFailedMarker = "STEP FAILED:"
+
+// Plan is a numbered plan kept in the plan section of task.md
+type Plan struct {
+	Goal       string
+	Steps      []builtin.PlanItem
+	Status     PlanStatus
+	FailedStep int    // Step that paused execution (0 if none)
+	FailReason string // Why it paused
+}
+
+// readOnlyTools are the tools that neither write files nor run commands
+var readOnlyTools = map[string]bool{
+	"read_file":           true,
+	"list_files":          true,
+	"search_code":         true,
+	"get_code_outline":    true,
+	"get_project_metrics": true,
+	"get_system_info":     true,
+	"git_status":          true,
+	"git_diff":            true,
+	"git_log":             true,
+	"read_output":         true,
+}
+
+// planningTool reports whether the model may use a tool while planning: the
+// read-only tools plus manage_tasks to write the plan
+func planningTool(name string) bool {
+	return readOnlyTools[name] || name == "manage_tasks"
+}
+
+// CreatePlan asks the model for a numbered plan for goal using read-only tools.
+// The plan is written to task.md and waits for approval.
+func (a *Agent) CreatePlan(ctx context.Context, goal string) (*Plan, error) {
+	a.planMu.Lock()
+	if a.plan != nil && a.plan.Status == PlanRunning {
+		a.planMu.Unlock()
+		return nil, fmt.Errorf("a plan is already running")
+	}
+	a.planMu.Unlock()
+
+	a.emitStatus("🧭 Planning...")
+	prompt := fmt.Sprintf(`Create a step-by-step plan for this goal: %s
+
+Investigate the project with the available read-only tools as needed, then call manage_tasks once with action "plan", the goal, and the ordered list of steps. Each step should be one concrete, verifiable unit of work.
+Do not modify files or run commands now; the plan will be executed after it is approved.
+Finish with a short summary of the plan.`, goal)
+
+	if _, err := a.chat(ctx, prompt, turnOptions{
+		promptContext: prompts.ContextPlanning,
+		allowTool:     planningTool,
+	}); err != nil {
+		return nil, err
+	}
+
+	plan, err := a.loadPlan()
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.Steps) == 0 {
+		return nil, fmt.Errorf("the model did not write a plan to task.md")
+	}
+	plan.Status = PlanDraft
+
+	a.planMu.Lock()
+	a.plan = plan
+	a.planMu.Unlock()
+
+	a.logger.Info("Plan drafted with %d steps: %s", len(plan.Steps), plan.Goal)
+	a.notifyPlan(plan)
+	return a.GetPlan(), nil
+}
+
+// GetPlan returns a copy of the active plan, or nil
+func (a *Agent) GetPlan() *Plan {
+	a.planMu.Lock()
+	defer a.planMu.Unlock()
+
+	if a.plan == nil {
+		return nil
+	}
+	return a.copyPlanLocked()
+}
+
+// CancelPlan drops the active plan. task.md is left as it is.
+func (a *Agent) CancelPlan() error {
+	a.planMu.Lock()
+	defer a.planMu.Unlock()
+
+	if a.plan == nil {
+		return fmt.Errorf("no active plan")
+	}
+	if a.plan.Status == PlanRunning {
+		return fmt.Errorf("the plan is running; stop the current request first")
+	}
+	a.plan = nil
+	return nil
+}
+
+// EditPlanStep replaces the text of a step in a draft plan
+func (a *Agent) EditPlanStep(number int, text string) (*Plan, error) {
+	return a.editDraft(func(steps []string) ([]string, error) {
+		if number < 1 || number > len(steps) {
+			return nil, fmt.Errorf("step must be between 1 and %d", len(steps))
+		}
+		steps[number-1] = text
+		return steps, nil
+	})
+}
+
+// AddPlanStep appends a step to a draft plan
+func (a *Agent) AddPlanStep(text string) (*Plan, error) {
+	return a.editDraft(func(steps []string) ([]string, error) {
+		return append(steps, text), nil
+	})
+}
+
+// RemovePlanStep deletes a step from a draft plan
+func (a *Agent) RemovePlanStep(number int) (*Plan, error) {
+	return a.editDraft(func(steps []string) ([]string, error) {
+		if number < 1 || number > len(steps) {
+			return nil, fmt.Errorf("step must be between 1 and %d", len(steps))
+		}
+		if len(steps) == 1 {
+			return nil, fmt.Errorf("a plan needs at least one step")
+		}
+		return append(steps[:number-1], steps[number:]...), nil
+	})
+}
+
+// editDraft rewrites the plan section of task.md through manage_tasks
+func (a *Agent) editDraft(edit func(steps []string) ([]string, error)) (*Plan, error) {
+	a.planMu.Lock()
+	defer a.planMu.Unlock()
+
+	if a.plan == nil || a.plan.Status != PlanDraft {
+		return nil, fmt.Errorf("only a draft plan can be edited (edit task.md directly to change a paused plan)")
+	}
+
+	// Start from task.md so edits made there by hand are kept
+	current, err := a.loadPlan()
+	if err != nil {
+		return nil, err
+	}
+	steps := make([]string, 0, len(current.Steps))
+	for _, step := range current.Steps {
+		steps = append(steps, step.Text)
+	}
+	if steps, err = edit(steps); err != nil {
+		return nil, err
+	}
+
+	rawSteps := make([]any, len(steps))
+	for i, step := range steps {
+		rawSteps[i] = step
+	}
+	if err := a.runTaskTool(map[string]any{"action": "plan", "goal": current.Goal, "steps": rawSteps}); err != nil {
+		return nil, err
+	}
+
+	updated, err := a.loadPlan()
+	if err != nil {
+		return nil, err
+	}
+	updated.Status = PlanDraft
+	a.plan = updated
+	return a.copyPlanLocked(), nil
+}
+
+// ExecutePlan runs an approved (draft) or paused plan step by step. Each step is
+// marked in progress, executed as a normal turn with all tools and marked done.
+// Execution pauses at the first failed step; calling ExecutePlan again retries it,
+// SkipPlanStep skips it. Edits to task.md made while paused are picked up on resume.
+func (a *Agent) ExecutePlan(ctx context.Context) (*Plan, error) {
+	a.planMu.Lock()
+	if a.plan == nil {
+		// Pick up a plan left in task.md, e.g. by an earlier run
+		if plan, err := a.loadPlan(); err == nil && len(plan.Steps) > 0 {
+			plan.Status = PlanDraft
+			a.plan = plan
+		}
+	}
+	if a.plan == nil {
+		a.planMu.Unlock()
+		return nil, fmt.Errorf("no active plan")
+	}
+	if a.plan.Status != PlanDraft && a.plan.Status != PlanPaused {
+		status := a.plan.Status
+		a.planMu.Unlock()
+		return nil, fmt.Errorf("plan is %s", status)
+	}
+	goal := a.plan.Goal
+	a.plan.Status = PlanRunning
+	a.plan.FailedStep = 0
+	a.plan.FailReason = ""
+	a.planMu.Unlock()
+
+	plan, err := a.loadPlan()
+	if err != nil {
+		a.pausePlan(0, err.Error())
+		return a.GetPlan(), err
+	}
+	if plan.Goal == "" {
+		plan.Goal = goal
+	}
+	plan.Status = PlanRunning
+	a.setPlan(plan)
+
+	for _, step := range plan.Steps {
+		if step.Done() {
+			continue
+		}
+
+		a.emitStatus(fmt.Sprintf("📋 Step %d/%d: %s", step.Number, len(plan.Steps), step.Text))
+		if err := a.markPlanStep(step.Number, "in_progress"); err != nil {
+			a.pausePlan(step.Number, err.Error())
+			return a.GetPlan(), nil
+		}
+		a.updatePlanMark(step.Number, "/")
+
+		prompt := fmt.Sprintf(`Execute step %d of the approved plan for: %s
+
+Step %d: %s
+
+Do only this step; the remaining steps will follow. If you cannot complete it, stop and reply with a line starting with "%s" followed by the reason.`,
+			step.Number, plan.Goal, step.Number, step.Text, stepFailedMarker)
+
+		response, err := a.ChatContext(ctx, prompt)
+		if reason := stepFailure(response, err); reason != "" {
+			a.logger.Error("Plan step %d failed: %s", step.Number, reason)
+			a.pausePlan(step.Number, reason)
+			return a.GetPlan(), nil
+		}
+
+		if err := a.markPlanStep(step.Number, "done"); err != nil {
+			a.pausePlan(step.Number, err.Error())
+			return a.GetPlan(), nil
+		}
+		a.updatePlanMark(step.Number, "x")
+	}
+
+	a.planMu.Lock()
+	a.plan.Status = PlanDone
+	a.planMu.Unlock()
+
+	a.emitStatus("✅ Plan complete")
+	a.logger.Info("Plan complete: %s", plan.Goal)
+	a.notifyPlan(a.GetPlan())
+	return a.GetPlan(), nil
+}
+
+// SkipPlanStep marks the step a paused plan stopped at as skipped
+func (a *Agent) SkipPlanStep() (*Plan, error) {
+	a.planMu.Lock()
+	if a.plan == nil || a.plan.Status != PlanPaused || a.plan.FailedStep == 0 {
+		a.planMu.Unlock()
+		return nil, fmt.Errorf("no paused plan step to skip")
+	}
+	number := a.plan.FailedStep
+	a.planMu.Unlock()
+
+	if err := a.markPlanStep(number, "skipped"); err != nil {
+		return nil, err
+	}
+	a.updatePlanMark(number, "-")
+	return a.GetPlan(), nil
+}
+
+// stepFailure returns why a plan step failed, or "" if it succeeded
+func stepFailure(response string, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if strings.HasPrefix(response, stoppedEarlyPrefix) {
+		return "tool budget exhausted"
+	}
+	if idx := strings.Index(response, stepFailedMarker); idx >= 0 {
+		reason := strings.TrimSpace(response[idx+len(stepFailedMarker):])
+		if line, _, found := strings.Cut(reason, "\n"); found {
+			reason = line
+		}
+		if reason == "" {
+			reason = "the model reported a failure"
+		}
+		return reason
+	}
+	return ""
+}
+
+// loadPlan reads the plan section of task.md
+func (a *Agent) loadPlan() (*Plan, error) {
+	content, err := os.ReadFile(filepath.Join(a.projectPath, "task.md"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Plan{}, nil
+		}
+		return nil, fmt.Errorf("failed to read task.md: %w", err)
+	}
+
+	goal, steps := builtin.ParsePlan(string(content))
+	return &Plan{Goal: goal, Steps: steps}, nil
+}
+
+// markPlanStep sets a step's checkbox in task.md through manage_tasks
+func (a *Agent) markPlanStep(number int, status string) error {
+	return a.runTaskTool(map[string]any{"action": "update", "step": float64(number), "status": status})
+}
+
+func (a *Agent) runTaskTool(args map[string]any) error {
+	result, err := a.executor.Execute(tools.ToolCall{Name: "manage_tasks", Arguments: args})
+	if err != nil {
+		return fmt.Errorf("manage_tasks failed: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("manage_tasks failed: %s", result.Error)
+	}
+	return nil
+}
+
+func (a *Agent) setPlan(plan *Plan) {
+	a.planMu.Lock()
+	defer a.planMu.Unlock()
+	a.plan = plan
+}
+
+func (a *Agent) updatePlanMark(number int, mark string) {
+	a.planMu.Lock()
+	defer a.planMu.Unlock()
+
+	if a.plan == nil {
+		return
+	}
+	for i := range a.plan.Steps {
+		if a.plan.Steps[i].Number == number {
+			a.plan.Steps[i].Mark = mark
+		}
+	}
+}
+
+func (a *Agent) pausePlan(step int, reason string) {
+	a.planMu.Lock()
+	if a.plan != nil {
+		a.plan.Status = PlanPaused
+		a.plan.FailedStep = step
+		a.plan.FailReason = reason
+		if step > 0 {
+			for i := range a.plan.Steps {
+				if a.plan.Steps[i].Number == step {
+					a.plan.Steps[i].Mark = "/"
+				}
+			}
+		}
+	}
+	a.planMu.Unlock()
+
+	a.emitStatus(fmt.Sprintf("⏸️ Plan paused at step %d: %s", step, reason))
+	a.notifyPlan(a.GetPlan())
+}
+
+func (a *Agent) copyPlanLocked() *Plan {
+	plan := *a.plan
+	plan.Steps = append([]builtin.PlanItem(nil), a.plan.Steps...)
+	return &plan
+}
+
+// FormatPlan renders a plan as a checklist with its status
+func FormatPlan(plan *Plan) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("🧭 Plan: %s\n\n", plan.Goal))
+	for _, step := range plan.Steps {
+		icon := "⬜"
+		switch step.Mark {
+		case "/":
+			icon = "🔄"
+			if plan.Status == PlanPaused && step.Number == plan.FailedStep {
+				icon = "❌"
+			}
+		case "x":
+			icon = "✅"
+		case "-":
+			icon = "⏭️"
+		}
+		sb.WriteString(fmt.Sprintf("%s %d. %s\n", icon, step.Number, step.Text))
+	}
+
+	switch plan.Status {
+	case PlanDraft:
+		sb.WriteString("\nStatus: waiting for approval")
+	case PlanRunning:
+		sb.WriteString("\nStatus: running")
+	case PlanPaused:
+		sb.WriteString(fmt.Sprintf("\nStatus: paused at step %d: %s", plan.FailedStep, plan.FailReason))
+	case PlanDone:
+		sb.WriteString("\nStatus: complete")
+	}
+	return sb.String()
+}
+
+// notifyPlan sends the plan to Telegram with buttons for the next decision
+func (a *Agent) notifyPlan(plan *Plan) {
+	if plan == nil || !a.config.Telegram.Enabled || a.config.Telegram.ChatID == 0 {
+		return
+	}
+
+	var buttons [][]telegram.InlineButton
+	switch plan.Status {
+	case PlanDraft:
+		buttons = [][]telegram.InlineButton{{
+			{Text: "✅ Approve", CallbackData: "plan_approve"},
+			{Text: "❌ Cancel", CallbackData: "plan_cancel"},
+		}}
+	case PlanPaused:
+		buttons = [][]telegram.InlineButton{{
+			{Text: "🔁 Retry", CallbackData: "plan_retry"},
+			{Text: "⏭️ Skip", CallbackData: "plan_skip"},
+			{Text: "❌ Cancel", CallbackData: "plan_cancel"},
+		}}
+	}
+
+	msg := truncateAgentContent(FormatPlan(plan), 3500)
+	var err error
+	if buttons != nil {
+		err = a.tgBot.SendMessageWithButtons(a.config.Telegram.ChatID, msg, buttons)
+	} else {
+		err = a.tgBot.SendMessage(msg)
+	}
+	if err != nil {
+		a.logger.Error("Failed to send plan to Telegram: %v", err)
+	}
+}
+
+// handleTelegramPlanAction handles the plan buttons sent by notifyPlan
+func (a *Agent) handleTelegramPlanAction(action string) {
+	var err error
+	switch action {
+	case "plan_approve", "plan_retry":
+		_, err = a.ExecutePlan(a.ctx)
+	case "plan_skip":
+		if _, err = a.SkipPlanStep(); err == nil {
+			_, err = a.ExecutePlan(a.ctx)
+		}
+	case "plan_cancel":
+		if err = a.CancelPlan(); err == nil {
+			a.tgBot.SendMessage("🗑️ Plan cancelled.")
+		}
+	}
+	if err != nil {
+		a.tgBot.SendMessage(fmt.Sprintf("❌ *Plan:* %v", err))
+	}
+}
+
+// handleTelegramPlan handles "/plan" and "/plan <goal>" sent over Telegram
+func (a *Agent) handleTelegramPlan(text string) {
+	goal := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text), "/plan"))
+	if goal == "" {
+		if plan := a.GetPlan(); plan != nil {
+			a.notifyPlan(plan)
+		} else {
+			a.tgBot.SendMessage("📋 No active plan. Use `/plan <goal>` to create one.")
+		}
+		return
+	}
+
+	a.tgBot.SendMessage("🧭 _Planning..._")
+	if _, err := a.CreatePlan(a.ctx, goal); err != nil {
+		a.tgBot.SendMessage(fmt.Sprintf("❌ *Planning failed:* %v", err))
+	}
+}
@@ -0,0 +1,222 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ClosedWheeler/pkg/config"
+)
+
+// replayCassette answers with a read_file tool call and then a final reply
+const replayCassette = `{
+  "version": 1,
+  "interactions": [
+    {
+      "request": {"method": "POST", "url": "http://llm.invalid/v1/chat/completions"},
+      "response": {"status": 200, "body": {
+        "id": "1", "model": "gpt-4o-mini",
+        "choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "tool_calls": [
+          {"id": "call_1", "type": "function", "function": {"name": "read_file", "arguments": "{\"path\": \"hello.txt\"}"}}
+        ]}}],
+        "usage": {"prompt_tokens": 900, "completion_tokens": 20, "total_tokens": 920}
+      }}
+    },
+    {
+      "request": {"method": "POST", "url": "http://llm.invalid/v1/chat/completions"},
+      "response": {"status": 200, "body": {
+        "id": "2", "model": "gpt-4o-mini",
+        "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "The file says hello."}}],
+        "usage": {"prompt_tokens": 950, "completion_tokens": 8, "total_tokens": 958}
+      }}
+    }
+  ]
+}`
+
+// compressionCassette answers one turn and then the compression summary
+const compressionCassette = `{
+  "version": 1,
+  "interactions": [
+    {
+      "request": {"method": "POST", "url": "http://llm.invalid/v1/chat/completions"},
+      "response": {"status": 200, "body": {
+        "id": "1", "model": "gpt-4o-mini",
+        "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Done, the cache is in place."}}],
+        "usage": {"prompt_tokens": 700, "completion_tokens": 9, "total_tokens": 709}
+      }}
+    },
+    {
+      "request": {"method": "POST", "url": "http://llm.invalid/v1/chat/completions"},
+      "response": {"status": 200, "body": {
+        "id": "2", "model": "gpt-4o-mini",
+        "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "{\"bullets\": [\"Chose an LRU cache for lookups\", \"Fixed the nil map panic in the loader\"]}"}}],
+        "usage": {"prompt_tokens": 300, "completion_tokens": 20, "total_tokens": 320}
+      }}
+    }
+  ]
+}`
+
+// debateCassette answers one turn for each side of a debate
+const debateCassette = `{
+  "version": 1,
+  "interactions": [
+    {
+      "request": {"method": "POST", "url": "http://llm.invalid/v1/chat/completions"},
+      "response": {"status": 200, "body": {
+        "id": "1", "model": "gpt-4o-mini",
+        "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Tabs keep files smaller."}}],
+        "usage": {"prompt_tokens": 500, "completion_tokens": 6, "total_tokens": 506}
+      }}
+    },
+    {
+      "request": {"method": "POST", "url": "http://llm.invalid/v1/chat/completions"},
+      "response": {"status": 200, "body": {
+        "id": "2", "model": "gpt-4o-mini",
+        "choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Spaces render the same everywhere."}}],
+        "usage": {"prompt_tokens": 520, "completion_tokens": 6, "total_tokens": 526}
+      }}
+    }
+  ]
+}`
+
+// newReplayAgent creates an agent in root that answers from the given cassette
+func newReplayAgent(t *testing.T, root, cassette string, tweak func(*config.Config)) *Agent {
+	t.Helper()
+	cassettePath := filepath.Join(root, "chat.cassette.json")
+	if err := os.WriteFile(cassettePath, []byte(cassette), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.APIKey = ""
+	cfg.APIBaseURL = "http://llm.invalid/v1"
+	cfg.Provider = "openai"
+	cfg.Model = "gpt-4o-mini"
+	cfg.Memory.StoragePath = filepath.Join(root, "memory.json")
+	cfg.Permissions.EnableAuditLog = false
+	cfg.Cassette = cassettePath
+	cfg.CassetteMode = "replay"
+	if tweak != nil {
+		tweak(cfg)
+	}
+
+	ag, err := NewAgent(cfg, root, root)
+	if err != nil {
+		t.Fatalf("Failed to create agent: %v", err)
+	}
+	t.Cleanup(func() { ag.Shutdown() })
+	return ag
+}
+
+func TestAgent_ChatReplay(t *testing.T) {
+	root := t.TempDir()
+	workplace := filepath.Join(root, "workplace")
+	if err := os.MkdirAll(workplace, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(workplace, "hello.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ag := newReplayAgent(t, root, replayCassette, nil)
+
+	answer, err := ag.Chat("What does hello.txt say?")
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if answer != "The file says hello." {
+		t.Errorf("Expected the recorded answer, got '%s'", answer)
+	}
+
+	calls := ag.GetLastToolCalls()
+	if len(calls) != 1 || calls[0].Name != "read_file" || !calls[0].Success {
+		t.Errorf("Expected one successful read_file call, got %+v", calls)
+	}
+	if remaining := ag.cassette.Remaining(); remaining != 0 {
+		t.Errorf("Expected every recorded response to be used, %d remain", remaining)
+	}
+	if usage := ag.GetUsageStats(); usage["total_tokens"] != 920+958 {
+		t.Errorf("Expected usage from both responses, got %v", usage["total_tokens"])
+	}
+}
+
+func TestAgent_CompressionReplay(t *testing.T) {
+	ag := newReplayAgent(t, t.TempDir(), compressionCassette, func(cfg *config.Config) {
+		cfg.Memory.CompressionThreshold = 0.01
+		cfg.ModelParameters = map[string]config.ModelParams{"gpt-4o-mini": {ContextWindow: 1000}}
+	})
+
+	// Earlier turns that the compression should fold into a summary
+	for i := 0; i < 3; i++ {
+		ag.memory.AddMessage("user", fmt.Sprintf("Question %d about the loader", i))
+		ag.memory.AddMessage("assistant", fmt.Sprintf("Answer %d about the loader", i))
+	}
+
+	var phases []string
+	ag.Subscribe(func(e Event) {
+		if e.Type == EventCompression {
+			phases = append(phases, e.Compression.Phase)
+		}
+	})
+
+	answer, err := ag.Chat("Add a cache to the loader")
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if answer != "Done, the cache is in place." {
+		t.Errorf("Expected the recorded answer, got '%s'", answer)
+	}
+	if len(phases) != 2 || phases[0] != "started" || phases[1] != "finished" {
+		t.Errorf("Expected compression to start and finish, got %v", phases)
+	}
+
+	if got := len(ag.memory.GetMessages()); got != 5 {
+		t.Errorf("Expected 5 messages kept after compression, got %d", got)
+	}
+	if context := ag.memory.GetContext(); !strings.Contains(context, "Chose an LRU cache for lookups") {
+		t.Errorf("Expected the recorded summary in memory, got '%s'", context)
+	}
+	if remaining := ag.cassette.Remaining(); remaining != 0 {
+		t.Errorf("Expected every recorded response to be used, %d remain", remaining)
+	}
+}
+
+func TestAgent_DebateReplay(t *testing.T) {
+	ag := newReplayAgent(t, t.TempDir(), debateCassette, nil)
+
+	agentA := ag.CloneForDebate("Agent A")
+	agentB := ag.CloneForDebate("Agent B")
+	defer agentA.Shutdown()
+	defer agentB.Shutdown()
+
+	opening, err := agentA.Chat("Debate: tabs or spaces?")
+	if err != nil {
+		t.Fatalf("Agent A failed: %v", err)
+	}
+	if opening != "Tabs keep files smaller." {
+		t.Errorf("Expected Agent A's recorded answer, got '%s'", opening)
+	}
+
+	rebuttal, err := agentB.Chat(opening)
+	if err != nil {
+		t.Fatalf("Agent B failed: %v", err)
+	}
+	if rebuttal != "Spaces render the same everywhere." {
+		t.Errorf("Expected Agent B's recorded answer, got '%s'", rebuttal)
+	}
+
+	// Each side keeps its own history and the main agent's stays untouched
+	if a, b := len(agentA.memory.GetMessages()), len(agentB.memory.GetMessages()); a != 2 || b != 2 {
+		t.Errorf("Expected 2 messages per side, got %d and %d", a, b)
+	}
+	if got := len(ag.memory.GetMessages()); got != 0 {
+		t.Errorf("Expected the main agent's history untouched, got %d messages", got)
+	}
+	if remaining := ag.cassette.Remaining(); remaining != 0 {
+		t.Errorf("Expected every recorded response to be used, %d remain", remaining)
+	}
+	if a, b := agentA.GetUsageStats()["total_tokens"], agentB.GetUsageStats()["total_tokens"]; a != 506 || b != 526 {
+		t.Errorf("Expected each side's recorded usage, got %v and %v", a, b)
+	}
+}
@@ -13,11 +13,18 @@ import (
 // Session tracks conversation state to optimize context usage
 type Session struct {
 	ID                string
+	ParentID          string // Session this one was forked from, if any
+	ForkIndex         int    // Number of parent messages shared at the fork point
+	Branch            string // Optional branch name
 	SystemPromptHash  string // Hash of system prompt to detect changes
 	RulesHash         string // Hash of rules to detect changes
 	ProjectHash       string // Hash of project info to detect changes
 	Messages          []llm.Message
-	ContextSent       bool      // True if initial context was sent
+	ToolCalls         []ToolCallRecord
+	Usage             llm.Usage
+	ContextSent       bool // True if initial context was sent
+	ContextStart      int  // Index in Messages where the current context window starts
+	CreatedAt         time.Time
 	LastActivity      time.Time
 	TotalPromptTokens int
 	TotalCompletions  int
@@ -43,6 +50,7 @@ func newSession() *Session {
 		ID:           generateSessionID(),
 		Messages:     make([]llm.Message, 0),
 		ContextSent:  false,
+		CreatedAt:    time.Now(),
 		LastActivity: time.Now(),
 	}
 }
@@ -95,6 +103,15 @@ func (sm *SessionManager) MarkContextSent(systemPrompt, rules, projectInfo strin
 	s.LastActivity = time.Now()
 }
 
+// InvalidateContext forces the full context to be resent on the next interaction
+// (used when a turn is aborted before the provider is known to have seen it)
+func (sm *SessionManager) InvalidateContext() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.currentSession.ContextSent = false
+}
+
 // AddMessage adds a message to session history
 // Prevents memory leaks by limiting message history to maxMessages
 func (sm *SessionManager) AddMessage(msg llm.Message) {
@@ -109,7 +126,12 @@ func (sm *SessionManager) AddMessage(msg llm.Message) {
 	// Trim old messages if limit exceeded
 	if len(s.Messages) > maxMessages {
 		// Keep only the most recent messages
-		s.Messages = s.Messages[len(s.Messages)-maxMessages:]
+		trimmed := len(s.Messages) - maxMessages
+		s.Messages = s.Messages[trimmed:]
+		s.ContextStart -= trimmed
+		if s.ContextStart < 0 {
+			s.ContextStart = 0
+		}
 	}
 
 	s.LastActivity = time.Now()
@@ -135,6 +157,30 @@ func (sm *SessionManager) UpdateTokenUsage(promptTokens int) {
 	sm.currentSession.TotalCompletions++
 }
 
+// AddUsage accumulates the full token usage of an LLM call into the session
+func (sm *SessionManager) AddUsage(usage llm.Usage) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.currentSession.Usage.Add(usage)
+}
+
+// AddToolCalls appends executed tool calls to the session history
+func (sm *SessionManager) AddToolCalls(calls []ToolCallRecord) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.currentSession.ToolCalls = append(sm.currentSession.ToolCalls, calls...)
+}
+
+// SessionID returns the current session's ID
+func (sm *SessionManager) SessionID() string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.currentSession.ID
+}
+
 // GetContextStats returns context usage statistics
 func (sm *SessionManager) GetContextStats() ContextStats {
 	sm.mu.RLock()
@@ -142,7 +188,7 @@ func (sm *SessionManager) GetContextStats() ContextStats {
 
 	s := sm.currentSession
 	return ContextStats{
-		MessageCount:      len(s.Messages),
+		MessageCount:      len(s.Messages) - s.ContextStart,
 		TotalPromptTokens: s.TotalPromptTokens,
 		ContextSent:       s.ContextSent,
 		SessionAge:        time.Since(s.LastActivity),
@@ -150,12 +196,65 @@ func (sm *SessionManager) GetContextStats() ContextStats {
 	}
 }
 
-// ResetSession creates a new session (used after compression)
+// ResetSession starts a fresh context window (used after compression).
+// The session keeps its ID and history so it can still be persisted and resumed.
 func (sm *SessionManager) ResetSession() {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	sm.currentSession = newSession()
+	s := sm.currentSession
+	s.ContextStart = len(s.Messages)
+	s.ContextSent = false
+	s.SystemPromptHash = ""
+	s.RulesHash = ""
+	s.ProjectHash = ""
+	s.TotalPromptTokens = 0
+	s.TotalCompletions = 0
+	s.LastActivity = time.Now()
+}
+
+// Snapshot returns a persistable copy of the current session
+func (sm *SessionManager) Snapshot() *SessionRecord {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	s := sm.currentSession
+	rec := &SessionRecord{
+		ID:        s.ID,
+		ParentID:  s.ParentID,
+		ForkIndex: s.ForkIndex,
+		Branch:    s.Branch,
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.LastActivity,
+		Messages:  make([]llm.Message, len(s.Messages)),
+		ToolCalls: make([]ToolCallRecord, len(s.ToolCalls)),
+		Usage:     s.Usage,
+	}
+	copy(rec.Messages, s.Messages)
+	copy(rec.ToolCalls, s.ToolCalls)
+	return rec
+}
+
+// Restore replaces the current session with a persisted one. The context is
+// marked as unsent so the next interaction re-sends the system prompt.
+func (sm *SessionManager) Restore(rec *SessionRecord) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	s := newSession()
+	s.ID = rec.ID
+	s.ParentID = rec.ParentID
+	s.ForkIndex = rec.ForkIndex
+	s.Branch = rec.Branch
+	s.CreatedAt = rec.CreatedAt
+	s.Messages = append(s.Messages, rec.Messages...)
+	s.ToolCalls = append(s.ToolCalls, rec.ToolCalls...)
+	s.Usage = rec.Usage
+	s.ContextStart = len(s.Messages) - len(rec.ShortTerm)
+	if s.ContextStart < 0 {
+		s.ContextStart = 0
+	}
+	sm.currentSession = s
 }
 
 // CompressSession prepares session for compression
@@ -176,6 +275,7 @@ func (sm *SessionManager) CompressSession(keepLast int) []llm.Message {
 
 	// Mark context as needing refresh (since we compressed history)
 	s.ContextSent = false
+	s.ContextStart = 0
 
 	return toCompress
 }
@@ -188,16 +288,3 @@ type ContextStats struct {
 	SessionAge        time.Duration
 	CompletionCount   int
 }
-
-// EstimateContextSize estimates context size in tokens (rough estimate)
-func (cs *ContextStats) EstimateContextSize() int {
-	// Rough estimate: average 4 chars per token
-	// This is a heuristic - actual tokenization varies
-	avgTokensPerMessage := 100 // Conservative estimate
-	return cs.MessageCount * avgTokensPerMessage
-}
-
-// ShouldCompress determines if context should be compressed
-func (cs *ContextStats) ShouldCompress(threshold int) bool {
-	return cs.MessageCount > threshold
-}
@@ -0,0 +1,212 @@
+// Package agent provides on-disk persistence for conversation sessions
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+)
+
+// SessionRecord is the on-disk form of a conversation session
+type SessionRecord struct {
+	ID        string           `json:"id"`
+	Title     string           `json:"title"`
+	Model     string           `json:"model"`
+	Provider  string           `json:"provider,omitempty"`
+	ParentID  string           `json:"parent_id,omitempty"`  // Session this branch was forked from
+	ForkIndex int              `json:"fork_index,omitempty"` // Number of parent messages shared
+	Branch    string           `json:"branch,omitempty"`     // Optional branch name
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Messages  []llm.Message    `json:"messages"`   // Full user/assistant transcript
+	ShortTerm []llm.Message    `json:"short_term"` // What the model currently sees (after compression)
+	ToolCalls []ToolCallRecord `json:"tool_calls"`
+	Usage     llm.Usage        `json:"usage"`
+}
+
+// SessionSummary is a lightweight listing entry for a stored session
+type SessionSummary struct {
+	ID           string
+	Title        string
+	Model        string
+	ParentID     string
+	ForkIndex    int
+	Branch       string
+	MessageCount int
+	UpdatedAt    time.Time
+}
+
+// SessionStore persists sessions as JSON files in a directory
+type SessionStore struct {
+	dir string
+}
+
+// NewSessionStore creates a store rooted at dir (typically .agi/sessions)
+func NewSessionStore(dir string) *SessionStore {
+	return &SessionStore{dir: dir}
+}
+
+// Dir returns the directory sessions are stored in
+func (s *SessionStore) Dir() string {
+	return s.dir
+}
+
+// Save writes a session record, replacing any previous version
+func (s *SessionStore) Save(rec *SessionRecord) error {
+	if err := validateSessionID(rec.ID); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	// Write to a temp file first so a crash mid-write can't corrupt the session
+	path := s.path(rec.ID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load reads a session record by ID
+func (s *SessionStore) Load(id string) (*SessionRecord, error) {
+	if err := validateSessionID(id); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session not found: %s", id)
+		}
+		return nil, err
+	}
+
+	var rec SessionRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", id, err)
+	}
+	return &rec, nil
+}
+
+// Delete removes a stored session
+func (s *SessionStore) Delete(id string) error {
+	if err := validateSessionID(id); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(id)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("session not found: %s", id)
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns all stored sessions, most recently updated first
+func (s *SessionStore) List() ([]SessionSummary, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var summaries []SessionSummary
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		rec, err := s.Load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			continue // Skip unreadable files rather than failing the whole listing
+		}
+		summaries = append(summaries, SessionSummary{
+			ID:           rec.ID,
+			Title:        rec.Title,
+			Model:        rec.Model,
+			ParentID:     rec.ParentID,
+			ForkIndex:    rec.ForkIndex,
+			Branch:       rec.Branch,
+			MessageCount: len(rec.Messages),
+			UpdatedAt:    rec.UpdatedAt,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+	return summaries, nil
+}
+
+// Resolve expands a unique ID prefix to a full session ID
+func (s *SessionStore) Resolve(prefix string) (string, error) {
+	summaries, err := s.List()
+	if err != nil {
+		return "", err
+	}
+
+	var matches []string
+	for _, sum := range summaries {
+		if sum.ID == prefix {
+			return sum.ID, nil
+		}
+		if strings.HasPrefix(sum.ID, prefix) {
+			matches = append(matches, sum.ID)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("session not found: %s", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("ambiguous session prefix %q matches %d sessions", prefix, len(matches))
+	}
+}
+
+func (s *SessionStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// validateSessionID rejects IDs that could escape the sessions directory
+func validateSessionID(id string) error {
+	if id == "" {
+		return fmt.Errorf("session ID is required")
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return fmt.Errorf("invalid session ID: %q", id)
+		}
+	}
+	return nil
+}
+
+// sessionTitle derives a short title from the first user message
+func sessionTitle(messages []llm.Message) string {
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		title := []rune(strings.Join(strings.Fields(msg.Content), " "))
+		if len(title) > 60 {
+			return string(title[:57]) + "..."
+		}
+		return string(title)
+	}
+	return "(empty session)"
+}
@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+)
+
+func TestSessionStore_SaveLoadList(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+
+	older := &SessionRecord{
+		ID:        "aaaa1111",
+		Title:     "older",
+		UpdatedAt: time.Now().Add(-time.Hour),
+		Messages:  []llm.Message{{Role: "user", Content: "hi"}},
+	}
+	newer := &SessionRecord{
+		ID:        "bbbb2222",
+		Title:     "newer",
+		UpdatedAt: time.Now(),
+		Messages:  []llm.Message{{Role: "user", Content: "hello"}, {Role: "assistant", Content: "hey"}},
+		ToolCalls: []ToolCallRecord{{Name: "read_file", Success: true}},
+		Usage:     llm.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}
+	for _, rec := range []*SessionRecord{older, newer} {
+		if err := store.Save(rec); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	loaded, err := store.Load("bbbb2222")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(loaded.Messages) != 2 || len(loaded.ToolCalls) != 1 || loaded.Usage.TotalTokens != 15 {
+		t.Errorf("Expected round-tripped record, got %+v", loaded)
+	}
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("Expected 2 sessions, got %d", len(list))
+	}
+	if list[0].ID != "bbbb2222" {
+		t.Errorf("Expected most recent session first, got '%s'", list[0].ID)
+	}
+}
+
+func TestSessionStore_ResolveAndDelete(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+	for _, id := range []string{"abc123", "abd456"} {
+		if err := store.Save(&SessionRecord{ID: id}); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		prefix  string
+		want    string
+		wantErr bool
+	}{
+		{"abc", "abc123", false},
+		{"abd456", "abd456", false},
+		{"ab", "", true}, // ambiguous
+		{"zz", "", true}, // missing
+	}
+	for _, tt := range tests {
+		got, err := store.Resolve(tt.prefix)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Resolve(%q): expected error %v, got %v", tt.prefix, tt.wantErr, err)
+		}
+		if got != tt.want {
+			t.Errorf("Resolve(%q): expected '%s', got '%s'", tt.prefix, tt.want, got)
+		}
+	}
+
+	if err := store.Delete("abc123"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Load("abc123"); err == nil {
+		t.Error("Expected error loading deleted session")
+	}
+}
+
+func TestSessionStore_RejectsPathTraversal(t *testing.T) {
+	store := NewSessionStore(t.TempDir())
+
+	for _, id := range []string{"", "../config", "a/b", "x.y"} {
+		if err := store.Save(&SessionRecord{ID: id}); err == nil {
+			t.Errorf("Expected invalid ID %q to be rejected", id)
+		}
+	}
+}
+
+func TestSessionManager_ResetKeepsIdentity(t *testing.T) {
+	sm := NewSessionManager()
+	id := sm.SessionID()
+
+	sm.AddMessage(llm.Message{Role: "user", Content: "one"})
+	sm.AddMessage(llm.Message{Role: "assistant", Content: "two"})
+	sm.ResetSession()
+	sm.AddMessage(llm.Message{Role: "user", Content: "three"})
+
+	if sm.SessionID() != id {
+		t.Errorf("Expected session ID '%s' to survive reset, got '%s'", id, sm.SessionID())
+	}
+	if stats := sm.GetContextStats(); stats.MessageCount != 1 {
+		t.Errorf("Expected 1 message in the context window, got %d", stats.MessageCount)
+	}
+	if rec := sm.Snapshot(); len(rec.Messages) != 3 {
+		t.Errorf("Expected full transcript of 3 messages, got %d", len(rec.Messages))
+	}
+}
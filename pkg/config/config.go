@@ -18,8 +18,10 @@ type Config struct {
 	APIBaseURL string `json:"api_base_url"`
 	APIKey     string `json:"api_key"`
 	Model      string `json:"model"`
-	Provider        string `json:"provider,omitempty"`         // "openai", "anthropic", or "" for auto-detect
+	Provider        string `json:"provider,omitempty"`         // "openai", "responses", "anthropic", "gemini", "ollama", "mock", or "" for auto-detect
 	ReasoningEffort string `json:"reasoning_effort,omitempty"` // "low", "medium", "high", "xhigh" for reasoning models
+	GeminiSafety    string `json:"gemini_safety,omitempty"`    // Gemini safety threshold for all harm categories, e.g. "BLOCK_ONLY_HIGH", "BLOCK_NONE"
+	ResponsesStore  bool   `json:"responses_store,omitempty"`  // Responses API: store responses server-side and chain them with previous_response_id
 
 	// Fallback configuration
 	FallbackModels  []string `json:"fallback_models,omitempty"`
@@ -38,6 +40,11 @@ type Config struct {
 	PermissionsDoc string `json:"// permissions_settings,omitempty"`
 	MemoryDoc      string `json:"// memory_settings,omitempty"`
 	HeartbeatDoc   string `json:"// heartbeat_settings,omitempty"`
+	ToolLoopDoc    string `json:"// tool_loop_settings,omitempty"`
+	ToolOutputDoc  string `json:"// tool_output_settings,omitempty"`
+	CostsDoc       string `json:"// costs_settings,omitempty"`
+	OllamaDoc      string `json:"// ollama_settings,omitempty"`
+	BreakerDoc     string `json:"// circuit_breaker_settings,omitempty"`
 
 	// LLM behavior settings
 	MaxTokens      *int     `json:"max_tokens,omitempty"`
@@ -48,6 +55,21 @@ type Config struct {
 	// Memory settings
 	Memory MemoryConfig `json:"memory"`
 
+	// Tool loop budget (per user message)
+	ToolLoop ToolLoopConfig `json:"tool_loop"`
+
+	// Large tool outputs are stored on disk and previewed
+	ToolOutput ToolOutputConfig `json:"tool_output"`
+
+	// Spending budgets and model price overrides
+	Costs CostsConfig `json:"costs"`
+
+	// Local model server settings (provider "ollama")
+	Ollama OllamaConfig `json:"ollama"`
+
+	// Stop sending requests to providers that keep failing
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker"`
+
 	// Improvement settings
 	MinConfidenceScore float64 `json:"min_confidence_score"`
 	MaxFilesPerBatch   int     `json:"max_files_per_batch"`
@@ -73,11 +95,23 @@ type Config struct {
 	// Permissions settings
 	Permissions PermissionsConfig `json:"permissions"`
 
+	// Shell hooks run around tool calls
+	Hooks HooksConfig `json:"hooks"`
+
 	// Heartbeat settings
 	HeartbeatInterval int `json:"heartbeat_interval"` // Seconds between heartbeat checks
 
 	// Debug settings
-	DebugTools bool `json:"debug_tools"` // Enable detailed tool execution debugging
+	DebugTools bool   `json:"debug_tools"`         // Enable detailed tool execution debugging
+	EventLog   string `json:"event_log,omitempty"` // Append the agent event stream to this JSONL file (relative to the app root)
+	DebugHTTP  bool   `json:"debug_http"`          // Record redacted HTTP traffic (LLM, OAuth, Telegram) to .agi/traces
+
+	// Record LLM traffic to a cassette file, or replay one without network access
+	Cassette     string `json:"cassette,omitempty"`      // Cassette path (relative to the app root)
+	CassetteMode string `json:"cassette_mode,omitempty"` // "record" or "replay"
+
+	// Scripted answers for the "mock" provider (JSON scenario file, relative to the app root)
+	MockScenario string `json:"mock_scenario,omitempty"`
 
 	// Browser settings
 	Browser BrowserConfig `json:"browser"`
@@ -99,15 +133,82 @@ type ModelParams struct {
 	TopP          float64 `json:"top_p"`
 	MaxTokens     int     `json:"max_tokens"`
 	ContextWindow int     `json:"context_window"`
+	API           string  `json:"api,omitempty"`    // "responses" sends this OpenAI model through the Responses API
+	Vision        *bool   `json:"vision,omitempty"` // Overrides whether the model accepts images
 }
 
 // MemoryConfig holds memory system configuration
 type MemoryConfig struct {
-	MaxShortTermItems  int    `json:"max_short_term_items"`
-	MaxWorkingItems    int    `json:"max_working_items"`
-	MaxLongTermItems   int    `json:"max_long_term_items"`
-	CompressionTrigger int    `json:"compression_trigger"`
-	StoragePath        string `json:"storage_path"`
+	MaxShortTermItems int    `json:"max_short_term_items"`
+	MaxWorkingItems   int    `json:"max_working_items"`
+	MaxLongTermItems  int    `json:"max_long_term_items"`
+	StoragePath       string `json:"storage_path"`
+
+	// CompressionThreshold compresses history once the projected prompt
+	// reaches this fraction of the model's context window (0 disables)
+	CompressionThreshold float64 `json:"compression_threshold"`
+}
+
+// ToolLoopConfig limits how much work a single turn may do. Zero disables a limit.
+type ToolLoopConfig struct {
+	MaxSteps           int     `json:"max_steps"`            // Tool-call rounds before stopping
+	MaxTokens          int     `json:"max_tokens"`           // Total prompt+completion tokens
+	MaxDurationSeconds int     `json:"max_duration_seconds"` // Wall-clock time
+	MaxSpendUSD        float64 `json:"max_spend_usd"`        // Estimated cost
+}
+
+// ToolOutputConfig controls when tool outputs are stored in .agi/outputs
+// instead of being sent to the model whole
+type ToolOutputConfig struct {
+	MaxBytes     int `json:"max_bytes"`     // Outputs larger than this are stored (0 disables)
+	PreviewLines int `json:"preview_lines"` // Lines shown from each end of a stored output
+}
+
+// CostsConfig holds spending budgets and price overrides. Zero disables a budget.
+type CostsConfig struct {
+	DailyBudgetUSD   float64                  `json:"daily_budget_usd"`   // Pause the agent once today's spend reaches this
+	SessionBudgetUSD float64                  `json:"session_budget_usd"` // Pause the agent once the session's spend reaches this
+	Pricing          map[string]PricingConfig `json:"pricing,omitempty"`  // Keyed by model name prefix; overrides built-in prices
+}
+
+// PricingConfig holds USD prices per million tokens for a model
+type PricingConfig struct {
+	InputPerMillion       float64 `json:"input_per_million"`
+	OutputPerMillion      float64 `json:"output_per_million"`
+	CachedInputPerMillion float64 `json:"cached_input_per_million,omitempty"` // 0 bills cached tokens as input
+	CacheWritePerMillion  float64 `json:"cache_write_per_million,omitempty"`  // 0 bills cache writes as input
+}
+
+// OllamaConfig holds settings for local models served by Ollama
+type OllamaConfig struct {
+	KeepAlive string `json:"keep_alive,omitempty"` // How long the model stays loaded, e.g. "10m", "-1" (forever); empty keeps the server default
+	NumCtx    int    `json:"num_ctx,omitempty"`    // Context size to load the model with; 0 uses the effective context window
+	AutoPull  bool   `json:"auto_pull"`            // Download the model on first use if it is not installed
+}
+
+// CircuitBreakerConfig holds the per-provider circuit breaker settings
+type CircuitBreakerConfig struct {
+	FailureThreshold int `json:"failure_threshold"` // Consecutive failures (network errors, timeouts, 5xx) that open the breaker; 0 disables it
+	CoolDownSeconds  int `json:"cool_down_seconds"` // Seconds an open breaker waits before probing the provider again
+}
+
+// HooksConfig holds shell hooks run before and after tool calls
+type HooksConfig struct {
+	PreToolUse  []HookConfig `json:"pre_tool_use,omitempty"`
+	PostToolUse []HookConfig `json:"post_tool_use,omitempty"`
+}
+
+// HookConfig is one shell hook. It receives the call as JSON on stdin.
+// A pre hook vetoes the call by exiting with code 2 or printing
+// {"decision":"block","reason":"..."}, and can print {"arguments":{...}} to
+// rewrite them. A pre hook that fails or times out blocks the call unless
+// on_error is "allow". Output of a post hook is appended to the tool result.
+type HookConfig struct {
+	Tool    string            `json:"tool"`               // Tool name or glob such as "git_*"; empty or "*" matches all
+	Args    map[string]string `json:"args,omitempty"`     // Regular expressions the named arguments must match
+	Command string            `json:"command"`            // Shell command, run in the project directory
+	Timeout int               `json:"timeout,omitempty"`  // Seconds (default 30)
+	OnError string            `json:"on_error,omitempty"` // Pre hooks: "block" (default) or "allow" when the hook itself fails
 }
 
 // UIConfig holds UI configuration
@@ -180,13 +281,32 @@ func DefaultConfig() *Config {
 		PermissionsDoc: "Tool execution and security permissions",
 		MemoryDoc:      "Tiered memory limits and context compression logic",
 		HeartbeatDoc:   "Internal tick interval for self-correction (seconds)",
+		ToolLoopDoc:    "Per-turn budget for tool execution; 0 disables a limit",
+		ToolOutputDoc:  "Outputs over max_bytes are stored in .agi/outputs; the model gets a preview and a read_output handle",
+		CostsDoc:       "Spending budgets in USD (0 disables) and per-model price overrides; spend is kept in .agi/costs.json",
+		OllamaDoc:      "Local models (provider 'ollama'): keep-alive, context size and pulling missing models",
+		BreakerDoc:     "Pause requests to a provider after consecutive failures and probe it until it answers again",
 
 		Memory: MemoryConfig{
-			MaxShortTermItems:  20,
-			MaxWorkingItems:    50,
-			MaxLongTermItems:   100,
-			CompressionTrigger: 15,
-			StoragePath:        ".agi/memory.json",
+			MaxShortTermItems:    20,
+			MaxWorkingItems:      50,
+			MaxLongTermItems:     100,
+			StoragePath:          ".agi/memory.json",
+			CompressionThreshold: 0.75,
+		},
+
+		ToolLoop: ToolLoopConfig{
+			MaxSteps: 50,
+		},
+
+		ToolOutput: ToolOutputConfig{
+			MaxBytes:     16 * 1024,
+			PreviewLines: 40,
+		},
+
+		CircuitBreaker: CircuitBreakerConfig{
+			FailureThreshold: 3,
+			CoolDownSeconds:  30,
 		},
 
 		MinConfidenceScore: 0.7,
@@ -253,6 +373,13 @@ func DefaultConfig() *Config {
 	return cfg
 }
 
+// NeedsAPIKey reports whether the configuration needs an API key or OAuth
+// login. The mock and local Ollama providers and cassette replay work offline.
+func (c *Config) NeedsAPIKey() bool {
+	replaying := c.Cassette != "" && c.CassetteMode == "replay"
+	return c.Provider != "mock" && c.Provider != "ollama" && !replaying
+}
+
 // GetConfigPaths returns a prioritized list of configuration file paths
 func GetConfigPaths(cliPath string) []string {
 	var paths []string
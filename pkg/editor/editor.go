@@ -39,6 +39,7 @@ type EditRecord struct {
 	Timestamp   time.Time `json:"timestamp"`
 	Applied     bool      `json:"applied"`
 	Description string    `json:"description"`
+	Turn        int       `json:"turn,omitempty"` // Conversation position the edit was made at
 }
 
 // Manager manages edit sessions
@@ -88,6 +89,34 @@ func (m *Manager) StartSession(description string) *Session {
 	return session
 }
 
+// OpenSession makes the session with the given ID current, loading it from disk
+// or creating it if needed. Files on disk are not touched.
+func (m *Manager) OpenSession(id, description string) *Session {
+	if m.current != nil && m.current.ID == id {
+		return m.current
+	}
+
+	session, exists := m.sessions[id]
+	if !exists {
+		loaded, err := m.LoadSession(id)
+		if err == nil {
+			session = loaded
+		} else {
+			session = &Session{
+				ID:          id,
+				StartedAt:   time.Now(),
+				Description: description,
+				Edits:       make([]EditRecord, 0),
+				Status:      StatusActive,
+			}
+			m.sessions[id] = session
+		}
+	}
+
+	m.current = session
+	return session
+}
+
 // CurrentSession returns the current active session
 func (m *Manager) CurrentSession() *Session {
 	return m.current
@@ -114,6 +143,107 @@ func (m *Manager) RecordEdit(filePath, operation, oldContent, newContent, descri
 	return &edit
 }
 
+// RecordApplied records an edit that has already been written to disk
+func (m *Manager) RecordApplied(edit EditRecord) *EditRecord {
+	if m.current == nil {
+		m.StartSession("Auto-session")
+	}
+
+	edit.ID = fmt.Sprintf("edit_%d", time.Now().UnixNano())
+	edit.Timestamp = time.Now()
+	edit.Applied = true
+
+	m.current.Edits = append(m.current.Edits, edit)
+	return &m.current.Edits[len(m.current.Edits)-1]
+}
+
+// ForkSession creates a new session holding the current session's edits for which
+// keep returns true. The new session is not made current.
+func (m *Manager) ForkSession(newID, description string, keep func(EditRecord) bool) (*Session, error) {
+	if m.current == nil {
+		return nil, fmt.Errorf("no active session")
+	}
+
+	session := &Session{
+		ID:          newID,
+		StartedAt:   time.Now(),
+		Description: description,
+		Edits:       make([]EditRecord, 0),
+		Status:      StatusActive,
+		Checkpoint:  m.current.Checkpoint,
+	}
+	for _, edit := range m.current.Edits {
+		if keep(edit) {
+			session.Edits = append(session.Edits, edit)
+		}
+	}
+
+	m.sessions[newID] = session
+	return session, nil
+}
+
+// SwitchSession makes another session current and brings the files on disk in
+// line with it: edits the two sessions share are left alone, the current
+// session's remaining edits are rolled back and the target's are re-applied.
+// It returns the paths that were touched.
+func (m *Manager) SwitchSession(id string) ([]string, error) {
+	target, exists := m.sessions[id]
+	if !exists {
+		loaded, err := m.LoadSession(id)
+		if err != nil {
+			return nil, fmt.Errorf("edit session not found: %s", id)
+		}
+		target = loaded
+	}
+
+	if m.current == nil || m.current == target {
+		m.current = target
+		return nil, nil
+	}
+
+	// Length of the edit history both sessions have in common
+	shared := 0
+	for shared < len(m.current.Edits) && shared < len(target.Edits) &&
+		m.current.Edits[shared].ID == target.Edits[shared].ID {
+		// Shared edits are on disk exactly as far as the current session says
+		target.Edits[shared].Applied = m.current.Edits[shared].Applied
+		shared++
+	}
+
+	touched := make(map[string]bool)
+	var paths []string
+	touch := func(path string) {
+		if !touched[path] {
+			touched[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	// Rollback in reverse order
+	for i := len(m.current.Edits) - 1; i >= shared; i-- {
+		edit := &m.current.Edits[i]
+		if edit.Applied {
+			if err := m.rollbackFileEdit(edit); err != nil {
+				return paths, fmt.Errorf("failed to rollback edit %s: %w", edit.ID, err)
+			}
+			edit.Applied = false
+			touch(edit.FilePath)
+		}
+	}
+
+	for i := shared; i < len(target.Edits); i++ {
+		edit := &target.Edits[i]
+		if err := m.applyFileEdit(edit); err != nil {
+			return paths, fmt.Errorf("failed to apply edit %s: %w", edit.ID, err)
+		}
+		edit.Applied = true
+		touch(edit.FilePath)
+	}
+
+	m.current = target
+	return paths, nil
+}
+
 // ApplyEdit applies a single edit
 func (m *Manager) ApplyEdit(editID string) error {
 	if m.current == nil {
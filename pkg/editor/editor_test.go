@@ -0,0 +1,66 @@
+package editor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManager_SwitchSessionRestoresFiles(t *testing.T) {
+	root := t.TempDir()
+	m := NewManager(root, t.TempDir())
+	file := filepath.Join(root, "main.go")
+
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	read := func() string {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+
+	// Parent branch creates the file, then modifies it
+	m.OpenSession("parent", "")
+	write("v1")
+	m.RecordApplied(EditRecord{FilePath: file, Operation: "create", NewContent: "v1", Turn: 1})
+	write("v2")
+	m.RecordApplied(EditRecord{FilePath: file, Operation: "modify", OldContent: "v1", NewContent: "v2", Turn: 3})
+
+	// Fork after the first edit
+	if _, err := m.ForkSession("child", "", func(e EditRecord) bool { return e.Turn < 2 }); err != nil {
+		t.Fatalf("ForkSession failed: %v", err)
+	}
+	if _, err := m.SwitchSession("child"); err != nil {
+		t.Fatalf("SwitchSession failed: %v", err)
+	}
+	if got := read(); got != "v1" {
+		t.Errorf("Expected 'v1' on child branch, got '%s'", got)
+	}
+
+	// Child makes its own change
+	write("v3")
+	m.RecordApplied(EditRecord{FilePath: file, Operation: "modify", OldContent: "v1", NewContent: "v3", Turn: 3})
+
+	paths, err := m.SwitchSession("parent")
+	if err != nil {
+		t.Fatalf("SwitchSession failed: %v", err)
+	}
+	if got := read(); got != "v2" {
+		t.Errorf("Expected 'v2' on parent branch, got '%s'", got)
+	}
+	if len(paths) != 1 || paths[0] != file {
+		t.Errorf("Expected only %s to be touched, got %v", file, paths)
+	}
+
+	if _, err := m.SwitchSession("child"); err != nil {
+		t.Fatalf("SwitchSession failed: %v", err)
+	}
+	if got := read(); got != "v3" {
+		t.Errorf("Expected 'v3' back on child branch, got '%s'", got)
+	}
+}
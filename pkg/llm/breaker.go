@@ -0,0 +1,355 @@
+// Package llm provides circuit breakers that stop requests to failing providers
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Breaker defaults, used until ConfigureBreakers is called
+const (
+	defaultBreakerThreshold = 3
+	defaultBreakerCoolDown  = 30 * time.Second
+	breakerProbeTimeout     = 15 * time.Second
+)
+
+// ErrCircuitOpen is returned without sending a request while a breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitState is the state of a circuit breaker
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // Requests flow normally
+	CircuitOpen     CircuitState = "open"      // Requests fail fast until the cool-down ends
+	CircuitHalfOpen CircuitState = "half-open" // One trial request decides whether to close again
+)
+
+// BreakerTransition reports a change of a breaker's state
+type BreakerTransition struct {
+	Name   string // Base URL and model
+	Model  string
+	From   CircuitState
+	To     CircuitState
+	Reason string // The error that opened the breaker, or what closed it
+	Time   time.Time
+}
+
+// Summary renders the transition as a one-line status for people
+func (t BreakerTransition) Summary() string {
+	switch t.To {
+	case CircuitOpen:
+		return fmt.Sprintf("🔌 %s is failing, pausing requests to it: %s", t.Model, t.Reason)
+	case CircuitHalfOpen:
+		return fmt.Sprintf("🔍 Probing %s...", t.Model)
+	}
+	return fmt.Sprintf("✅ %s is back (%s)", t.Model, t.Reason)
+}
+
+// Notable reports whether people should hear of the transition: a provider
+// starting to fail or coming back. The probe cycles of an open breaker
+// (open ↔ half-open) only go to the log and the stats.
+func (t BreakerTransition) Notable() bool {
+	return (t.From == CircuitClosed && t.To == CircuitOpen) || t.To == CircuitClosed
+}
+
+// BreakerStats is a snapshot of a breaker
+type BreakerStats struct {
+	Name      string
+	Model     string
+	State     CircuitState
+	Failures  int       // Consecutive failed requests
+	Trips     int       // Times the breaker opened
+	LastError string    // Error of the last failed request
+	RetryAt   time.Time // When an open breaker is tried again
+}
+
+// CircuitBreaker stops requests to a provider and model after consecutive
+// failures (network errors, timeouts and 5xx responses). After a cool-down a
+// single trial request (a background probe when the client provides one)
+// decides whether to close it again or keep it open for another cool-down.
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	name      string
+	model     string
+	state     CircuitState
+	failures  int
+	trips     int
+	lastError string
+	openedAt  time.Time
+	trial     bool                            // A half-open trial request is in flight
+	probe     func(ctx context.Context) error // Background availability check; nil lets a real request be the trial
+	probing   bool
+
+	now func() time.Time
+}
+
+var (
+	breakersMu       sync.Mutex
+	breakers         = make(map[string]*CircuitBreaker)
+	breakerThreshold = defaultBreakerThreshold
+	breakerCoolDown  = defaultBreakerCoolDown
+	breakerWatchers  = make(map[int]func(BreakerTransition))
+	nextWatcher      int
+)
+
+// BreakerFor returns the breaker shared by all clients of a model at an API base URL
+func BreakerFor(baseURL, model string) *CircuitBreaker {
+	key := strings.TrimRight(strings.ToLower(baseURL), "/") + " " + strings.ToLower(model)
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[key]
+	if !ok {
+		b = &CircuitBreaker{name: key, model: model, state: CircuitClosed, now: time.Now}
+		breakers[key] = b
+	}
+	return b
+}
+
+// ConfigureBreakers sets how many consecutive failures open a breaker (0
+// disables breakers) and how long an open breaker waits before a trial
+func ConfigureBreakers(failureThreshold int, coolDown time.Duration) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	breakerThreshold = failureThreshold
+	if coolDown > 0 {
+		breakerCoolDown = coolDown
+	}
+}
+
+// breakerSettings returns the configured threshold and cool-down
+func breakerSettings() (int, time.Duration) {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	return breakerThreshold, breakerCoolDown
+}
+
+// WatchBreakers registers fn for every state change of any breaker and
+// returns a function that removes it
+func WatchBreakers(fn func(BreakerTransition)) func() {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	id := nextWatcher
+	nextWatcher++
+	breakerWatchers[id] = fn
+	return func() {
+		breakersMu.Lock()
+		delete(breakerWatchers, id)
+		breakersMu.Unlock()
+	}
+}
+
+// AllBreakerStats returns a snapshot of every breaker that has seen a failure
+func AllBreakerStats() []BreakerStats {
+	breakersMu.Lock()
+	list := make([]*CircuitBreaker, 0, len(breakers))
+	for _, b := range breakers {
+		list = append(list, b)
+	}
+	breakersMu.Unlock()
+
+	var stats []BreakerStats
+	for _, b := range list {
+		if s := b.Stats(); s.Trips > 0 || s.Failures > 0 {
+			stats = append(stats, s)
+		}
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// SetProbe sets the background check that closes the breaker once the
+// provider answers again
+func (b *CircuitBreaker) SetProbe(probe func(ctx context.Context) error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probe = probe
+}
+
+// Allow returns ErrCircuitOpen if a request must not be sent now. An allowed
+// request must be followed by Succeeded, Failed or Abandoned.
+func (b *CircuitBreaker) Allow() error {
+	threshold, coolDown := breakerSettings()
+	if threshold <= 0 {
+		return nil // Breakers are disabled
+	}
+	b.mu.Lock()
+	switch b.state {
+	case CircuitClosed:
+		b.mu.Unlock()
+		return nil
+	case CircuitOpen:
+		if b.probe != nil || b.now().Sub(b.openedAt) < coolDown {
+			retry := b.openedAt.Add(coolDown).Sub(b.now()).Round(time.Second)
+			b.mu.Unlock()
+			return fmt.Errorf("%w for %s (retrying in %s): %s", ErrCircuitOpen, b.model, max(retry, 0), b.lastError)
+		}
+		b.trial = true
+		t := b.transition(CircuitHalfOpen, "cool-down over")
+		b.mu.Unlock()
+		notifyBreakers(t)
+		return nil
+	default: // Half-open
+		if b.trial {
+			b.mu.Unlock()
+			return fmt.Errorf("%w for %s (trial in progress): %s", ErrCircuitOpen, b.model, b.lastError)
+		}
+		b.trial = true
+		b.mu.Unlock()
+		return nil
+	}
+}
+
+// Succeeded records that the provider answered
+func (b *CircuitBreaker) Succeeded() {
+	b.mu.Lock()
+	b.failures = 0
+	b.trial = false
+	if b.state == CircuitClosed {
+		b.mu.Unlock()
+		return
+	}
+	t := b.transition(CircuitClosed, "request succeeded")
+	b.mu.Unlock()
+	notifyBreakers(t)
+}
+
+// Failed records that the provider did not answer; enough consecutive
+// failures, or a failed trial, open the breaker
+func (b *CircuitBreaker) Failed(err error) {
+	threshold, _ := breakerSettings()
+	b.mu.Lock()
+	b.failures++
+	b.trial = false
+	b.lastError = truncateError([]byte(strings.TrimSpace(err.Error())))
+	if b.state == CircuitOpen || (b.state == CircuitClosed && (threshold <= 0 || b.failures < threshold)) {
+		b.mu.Unlock()
+		return
+	}
+	t := b.open()
+	b.mu.Unlock()
+	notifyBreakers(t)
+}
+
+// Abandoned records that an allowed request was cancelled before the
+// provider answered, so it says nothing about the provider
+func (b *CircuitBreaker) Abandoned() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
+
+// Stats returns a snapshot of the breaker
+func (b *CircuitBreaker) Stats() BreakerStats {
+	_, coolDown := breakerSettings()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerStats{Name: b.name, Model: b.model, State: b.state, Failures: b.failures, Trips: b.trips, LastError: b.lastError}
+	if b.state == CircuitOpen {
+		s.RetryAt = b.openedAt.Add(coolDown)
+	}
+	return s
+}
+
+// open moves the breaker to open and starts the background probe. The caller holds b.mu.
+func (b *CircuitBreaker) open() BreakerTransition {
+	b.trips++
+	b.openedAt = b.now()
+	t := b.transition(CircuitOpen, b.lastError)
+	if b.probe != nil && !b.probing {
+		b.probing = true
+		go b.runProbes()
+	}
+	return t
+}
+
+// runProbes checks the provider after each cool-down until it answers
+func (b *CircuitBreaker) runProbes() {
+	for {
+		_, coolDown := breakerSettings()
+		b.mu.Lock()
+		wait := b.openedAt.Add(coolDown).Sub(b.now())
+		b.mu.Unlock()
+		time.Sleep(wait)
+
+		b.mu.Lock()
+		if b.state != CircuitOpen {
+			b.probing = false
+			b.mu.Unlock()
+			return
+		}
+		probe := b.probe
+		b.trial = true
+		t := b.transition(CircuitHalfOpen, "probing")
+		b.mu.Unlock()
+		notifyBreakers(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), breakerProbeTimeout)
+		err := probe(ctx)
+		cancel()
+
+		b.mu.Lock()
+		b.trial = false
+		if err == nil {
+			b.failures = 0
+			b.probing = false
+			t = b.transition(CircuitClosed, "probe succeeded")
+			b.mu.Unlock()
+			notifyBreakers(t)
+			return
+		}
+		b.lastError = truncateError([]byte(strings.TrimSpace(err.Error())))
+		b.openedAt = b.now()
+		t = b.transition(CircuitOpen, b.lastError)
+		b.mu.Unlock()
+		notifyBreakers(t)
+	}
+}
+
+// transition changes the state and describes the change. The caller holds b.mu.
+func (b *CircuitBreaker) transition(to CircuitState, reason string) BreakerTransition {
+	t := BreakerTransition{Name: b.name, Model: b.model, From: b.state, To: to, Reason: reason, Time: b.now()}
+	b.state = to
+	return t
+}
+
+// notifyBreakers logs a transition and passes it to the watchers
+func notifyBreakers(t BreakerTransition) {
+	log.Printf("[INFO] Circuit breaker %s: %s -> %s (%s)", t.Name, t.From, t.To, t.Reason)
+	breakersMu.Lock()
+	watchers := make([]func(BreakerTransition), 0, len(breakerWatchers))
+	for _, fn := range breakerWatchers {
+		watchers = append(watchers, fn)
+	}
+	breakersMu.Unlock()
+	for _, fn := range watchers {
+		fn(t)
+	}
+}
+
+// providerFault reports whether a response status says the provider is
+// unavailable rather than the request being bad
+func providerFault(status int) bool {
+	return status >= 500
+}
+
+// unavailableError marks a request that failed because of the provider
+// (unreachable, 5xx) rather than the request; its message is the cause's
+type unavailableError struct{ error }
+
+func (e unavailableError) Unwrap() error { return e.error }
+
+// IsProviderFault reports whether err means the provider could not answer:
+// it was unreachable, failed with a 5xx or is paused by its circuit breaker.
+// Another provider may answer such a request, while a bad request or bad
+// credentials would fail anywhere.
+func IsProviderFault(err error) bool {
+	var unavailable unavailableError
+	return errors.Is(err, ErrCircuitOpen) || errors.As(err, &unavailable)
+}
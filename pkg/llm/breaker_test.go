@@ -0,0 +1,224 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/utils"
+)
+
+func TestCircuitBreaker_Transitions(t *testing.T) {
+	ConfigureBreakers(2, time.Minute)
+	defer ConfigureBreakers(defaultBreakerThreshold, defaultBreakerCoolDown)
+
+	now := time.Now()
+	b := BreakerFor("http://breaker.test/v1", "model-a")
+	b.now = func() time.Time { return now }
+
+	var states []CircuitState
+	var notable int
+	stop := WatchBreakers(func(tr BreakerTransition) {
+		if tr.Name == b.name {
+			states = append(states, tr.To)
+			if tr.Notable() {
+				notable++
+			}
+		}
+	})
+	defer stop()
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		allowed bool
+		outcome string // "fail", "ok", "abandon" or "" for a rejected request
+		state   CircuitState
+	}{
+		{"first failure keeps it closed", 0, true, "fail", CircuitClosed},
+		{"threshold opens it", 0, true, "fail", CircuitOpen},
+		{"open rejects during cool-down", 30 * time.Second, false, "", CircuitOpen},
+		{"cool-down allows one trial", 31 * time.Second, true, "abandon", CircuitHalfOpen},
+		{"abandoned trial frees the slot", 0, true, "fail", CircuitOpen},
+		{"failed trial restarts the cool-down", 30 * time.Second, false, "", CircuitOpen},
+		{"successful trial closes it", 31 * time.Second, true, "ok", CircuitClosed},
+		{"closed allows again", 0, true, "ok", CircuitClosed},
+	}
+	for _, step := range steps {
+		now = now.Add(step.advance)
+		err := b.Allow()
+		if step.allowed != (err == nil) {
+			t.Fatalf("%s: expected allowed=%v, got %v", step.name, step.allowed, err)
+		}
+		if err != nil && !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("%s: expected ErrCircuitOpen, got %v", step.name, err)
+		}
+		if step.outcome == "abandon" {
+			if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("%s: expected a second trial to be rejected, got %v", step.name, err)
+			}
+		}
+		switch step.outcome {
+		case "fail":
+			b.Failed(errors.New("API error (status 503)"))
+		case "ok":
+			b.Succeeded()
+		case "abandon":
+			b.Abandoned()
+		}
+		if got := b.Stats().State; got != step.state {
+			t.Fatalf("%s: expected state %s, got %s", step.name, step.state, got)
+		}
+	}
+
+	if stats := b.Stats(); stats.Trips != 2 || stats.Failures != 0 {
+		t.Errorf("Expected 2 trips and no pending failures, got %+v", stats)
+	}
+	want := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(states) != len(want) {
+		t.Fatalf("Expected transitions %v, got %v", want, states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Errorf("Expected transitions %v, got %v", want, states)
+			break
+		}
+	}
+	// Only the first opening and the recovery are worth telling people
+	if notable != 2 {
+		t.Errorf("Expected 2 notable transitions, got %d", notable)
+	}
+}
+
+// skipRetryDelays makes failed requests retry at once; the returned func restores the delays
+func skipRetryDelays() func() {
+	defaultRetryConfig = func() utils.RetryConfig {
+		config := utils.DefaultRetryConfig()
+		config.InitialDelay = 0
+		return config
+	}
+	return func() { defaultRetryConfig = utils.DefaultRetryConfig }
+}
+
+func TestCircuitBreaker_ProbesUntilRecovered(t *testing.T) {
+	ConfigureBreakers(2, 100*time.Millisecond)
+	defer ConfigureBreakers(defaultBreakerThreshold, defaultBreakerCoolDown)
+
+	var up atomic.Bool
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if !up.Load() {
+			http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}]}`))
+	}))
+	defer server.Close()
+
+	closed := make(chan struct{}, 1)
+	stop := WatchBreakers(func(tr BreakerTransition) {
+		if tr.Model == "gpt-breaker" && tr.To == CircuitClosed {
+			closed <- struct{}{}
+		}
+	})
+	defer stop()
+
+	defer skipRetryDelays()()
+
+	client := NewClientWithProvider(server.URL, "key", "gpt-breaker", "openai")
+	messages := []Message{{Role: "user", Content: "hi"}}
+	for i := 0; i < 2; i++ {
+		if _, err := client.ChatWithStreamingContext(context.Background(), messages, nil, nil, nil, nil, nil); err == nil {
+			t.Fatal("Expected the failing provider to return an error")
+		}
+	}
+
+	sent := hits.Load()
+	_, err := client.ChatWithStreamingContext(context.Background(), messages, nil, nil, nil, nil, nil)
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("Expected ErrCircuitOpen after 2 failures, got %v", err)
+	}
+	if got := hits.Load(); got != sent {
+		t.Errorf("Expected the open breaker to send nothing, got %d more requests", got-sent)
+	}
+
+	up.Store(true)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the probe to close the breaker, stats %+v", BreakerFor(server.URL, "gpt-breaker").Stats())
+	}
+	if _, err := client.ChatWithStreamingContext(context.Background(), messages, nil, nil, nil, nil, nil); err != nil {
+		t.Errorf("Expected requests to flow after recovery, got %v", err)
+	}
+}
+
+func TestIsProviderFault(t *testing.T) {
+	defer skipRetryDelays()()
+
+	tests := []struct {
+		name     string
+		status   int
+		expected bool
+	}{
+		{"Overloaded", http.StatusServiceUnavailable, true},
+		{"Server error", http.StatusInternalServerError, true},
+		{"Bad request", http.StatusBadRequest, false},
+		{"Bad credentials", http.StatusUnauthorized, false},
+		{"Too large", http.StatusRequestEntityTooLarge, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, `{"error":{"message":"failed"}}`, tt.status)
+			}))
+			defer server.Close()
+
+			client := NewClientWithProvider(server.URL, "key", "gpt-fault", "openai")
+			messages := []Message{{Role: "user", Content: "hi"}}
+			if _, err := client.ChatWithToolsContext(context.Background(), messages, nil, nil, nil, nil); IsProviderFault(err) != tt.expected {
+				t.Errorf("Expected IsProviderFault %v for a plain request, got %v (%v)", tt.expected, !tt.expected, err)
+			}
+			if _, err := client.ChatWithStreamingContext(context.Background(), messages, nil, nil, nil, nil, nil); IsProviderFault(err) != tt.expected {
+				t.Errorf("Expected IsProviderFault %v for a streamed request, got %v (%v)", tt.expected, !tt.expected, err)
+			}
+		})
+	}
+
+	if !IsProviderFault(fmt.Errorf("wrapped: %w", ErrCircuitOpen)) {
+		t.Errorf("Expected an open circuit to be a provider fault")
+	}
+}
+
+func TestClientProbe_UsesOAuthLogin(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if authorization != "Bearer at-probe" {
+			http.Error(w, `{"error":{"message":"invalid x-api-key"}}`, http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"p"}],"stop_reason":"max_tokens"}`))
+	}))
+	defer server.Close()
+
+	client := NewClientWithProvider(server.URL, "", "claude-sonnet-4", "anthropic")
+	client.SetOAuthCredentials(&config.OAuthCredentials{Provider: "anthropic", AccessToken: "at-probe", ExpiresAt: time.Now().Add(time.Hour).UnixMilli()})
+
+	if err := client.probe("claude-sonnet-4")(context.Background()); err != nil {
+		t.Errorf("Expected the probe to succeed, got %v", err)
+	}
+	if authorization != "Bearer at-probe" {
+		t.Errorf("Expected the probe to authenticate with the OAuth login, got %q", authorization)
+	}
+}
@@ -0,0 +1,349 @@
+// Package llm provides record/replay cassettes for LLM HTTP traffic
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"ClosedWheeler/pkg/utils"
+)
+
+// CassetteMode selects whether a cassette records live traffic or replays it
+type CassetteMode string
+
+const (
+	CassetteRecord CassetteMode = "record" // Forward requests and save the exchanges
+	CassetteReplay CassetteMode = "replay" // Serve saved exchanges without network access
+)
+
+// Interaction is one recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request as sent to the provider, with secrets redacted
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"` // JSON bodies
+	Text    string            `json:"text,omitempty"` // Any other body
+}
+
+// RecordedResponse is a provider response. SSE streams are kept verbatim in Text.
+type RecordedResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Text    string            `json:"text,omitempty"`
+}
+
+// Cassette is an http.RoundTripper that records provider traffic to a JSON
+// file or replays it deterministically. Replay serves the first unused
+// interaction whose request body matches exactly, falling back to the next
+// unused interaction for the same method and URL, so prompts that embed
+// timestamps still replay in recording order.
+type Cassette struct {
+	mu           sync.Mutex
+	path         string
+	mode         CassetteMode
+	secrets      []string
+	next         http.RoundTripper
+	interactions []Interaction
+	used         []bool
+}
+
+// cassetteFile is the on-disk form of a cassette
+type cassetteFile struct {
+	Version      int           `json:"version"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// NewRecordingCassette creates a cassette that records to path, replacing any
+// existing file. secrets are literal values (API keys, tokens) to redact in
+// addition to the well-known credential formats.
+func NewRecordingCassette(path string, secrets ...string) *Cassette {
+	return &Cassette{
+		path:    path,
+		mode:    CassetteRecord,
+		secrets: secrets,
+		next:    http.DefaultTransport,
+	}
+}
+
+// LoadCassette reads a recorded cassette for replay
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return &Cassette{
+		path:         path,
+		mode:         CassetteReplay,
+		interactions: file.Interactions,
+		used:         make([]bool, len(file.Interactions)),
+	}, nil
+}
+
+// OpenCassette opens path in the given mode ("record" or "replay")
+func OpenCassette(path string, mode CassetteMode, secrets ...string) (*Cassette, error) {
+	switch mode {
+	case CassetteRecord:
+		return NewRecordingCassette(path, secrets...), nil
+	case CassetteReplay:
+		return LoadCassette(path)
+	}
+	return nil, fmt.Errorf("unknown cassette mode %q (use record or replay)", mode)
+}
+
+// Mode returns whether the cassette records or replays
+func (c *Cassette) Mode() CassetteMode {
+	return c.mode
+}
+
+// Path returns the cassette file
+func (c *Cassette) Path() string {
+	return c.path
+}
+
+// Interactions returns a copy of the recorded interactions
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// Remaining returns how many recorded interactions have not been replayed
+func (c *Cassette) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, used := range c.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// RoundTrip implements http.RoundTripper, recording through the default transport
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	return c.roundTrip(req, c.next)
+}
+
+// cassetteTransport sends one client's requests through a cassette that
+// several clients may share, recording through that client's own transport
+type cassetteTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.cassette.roundTrip(req, t.next)
+}
+
+// through returns a transport that records or replays with the cassette and
+// sends recorded requests on with next
+func (c *Cassette) through(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = c.next
+	}
+	return cassetteTransport{cassette: c, next: next}
+}
+
+// roundTrip records or replays one request; recorded requests go out through next
+func (c *Cassette) roundTrip(req *http.Request, next http.RoundTripper) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	recorded := c.recordRequest(req, body)
+
+	if c.mode == CassetteReplay {
+		return c.replay(req, recorded)
+	}
+
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &recordingBody{
+		ReadCloser: resp.Body,
+		done: func(data []byte) {
+			c.append(Interaction{Request: recorded, Response: c.recordResponse(resp, data)})
+		},
+	}
+	return resp, nil
+}
+
+// replay serves the recorded response for a request
+func (c *Cassette) replay(req *http.Request, recorded RecordedRequest) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	match := -1
+	for i, in := range c.interactions {
+		if c.used[i] || in.Request.Method != recorded.Method || in.Request.URL != recorded.URL {
+			continue
+		}
+		if bytes.Equal(compactJSON(in.Request.Body), compactJSON(recorded.Body)) && in.Request.Text == recorded.Text {
+			match = i
+			break
+		}
+		if match < 0 {
+			match = i
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("cassette %s has no unused response for %s %s", filepath.Base(c.path), recorded.Method, recorded.URL)
+	}
+	c.used[match] = true
+
+	recordedResp := c.interactions[match].Response
+	data := []byte(recordedResp.Text)
+	if len(recordedResp.Body) > 0 {
+		data = recordedResp.Body
+	}
+	header := make(http.Header, len(recordedResp.Headers))
+	for name, value := range recordedResp.Headers {
+		header.Set(name, value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recordedResp.Status, http.StatusText(recordedResp.Status)),
+		StatusCode:    recordedResp.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}, nil
+}
+
+// append adds a finished interaction and saves the cassette
+func (c *Cassette) append(in Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, in)
+	c.used = append(c.used, true)
+	c.save() // A failed write is retried with the next interaction
+}
+
+// save writes the cassette to disk. Callers must hold c.mu.
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(cassetteFile{Version: 1, Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create cassette directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// recordRequest captures a request with secrets redacted
+func (c *Cassette) recordRequest(req *http.Request, body []byte) RecordedRequest {
+	rec := RecordedRequest{
+		Method:  req.Method,
+		URL:     utils.RedactURL(req.URL.String(), c.secrets...),
+		Headers: c.recordHeaders(req.Header),
+	}
+	rec.Body, rec.Text = c.recordBody(body)
+	return rec
+}
+
+// recordResponse captures a response with secrets redacted
+func (c *Cassette) recordResponse(resp *http.Response, body []byte) RecordedResponse {
+	rec := RecordedResponse{
+		Status:  resp.StatusCode,
+		Headers: c.recordHeaders(resp.Header),
+	}
+	rec.Body, rec.Text = c.recordBody(body)
+	return rec
+}
+
+// recordHeaders keeps the headers that matter for replay, dropping credentials
+func (c *Cassette) recordHeaders(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(h))
+	for name := range h {
+		if utils.IsSensitiveHeader(name) {
+			continue
+		}
+		out[http.CanonicalHeaderKey(name)] = utils.RedactSecrets(h.Get(name), c.secrets...)
+	}
+	return out
+}
+
+// recordBody redacts a body and stores JSON inline for readable cassettes
+func (c *Cassette) recordBody(body []byte) (json.RawMessage, string) {
+	if len(body) == 0 {
+		return nil, ""
+	}
+	redacted := utils.RedactSecrets(string(body), c.secrets...)
+	if json.Valid([]byte(redacted)) {
+		return json.RawMessage(redacted), ""
+	}
+	return nil, redacted
+}
+
+// compactJSON normalises JSON for comparison
+func compactJSON(data json.RawMessage) []byte {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return data
+	}
+	return buf.Bytes()
+}
+
+// recordingBody tees a response body and hands the full content to done
+// once it has been read to EOF or closed, so SSE streams are captured as the
+// provider parser consumes them
+type recordingBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	done func([]byte)
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) finish() {
+	b.once.Do(func() { b.done(b.buf.Bytes()) })
+}
@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCassette_RecordAndReplay(t *testing.T) {
+	const apiKey = "sk-test-0123456789abcdefghij"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hel\"}}]}\n\n")
+			fmt.Fprint(w, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n")
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","model":"gpt-4o-mini","choices":[{"index":0,"message":{"role":"assistant","content":"Pong"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}`)
+	}))
+
+	path := filepath.Join(t.TempDir(), "session.cassette.json")
+	recorder := NewClientWithProvider(server.URL, apiKey, "gpt-4o-mini", "openai")
+	recorder.UseCassette(NewRecordingCassette(path, apiKey))
+
+	answer, err := recorder.SimpleQuery("Ping "+apiKey, nil, nil, nil)
+	if err != nil || answer != "Pong" {
+		t.Fatalf("Expected Pong while recording, got %q (%v)", answer, err)
+	}
+	if _, err := recorder.SimpleQueryStreaming("Stream", nil, nil, nil, nil); err != nil {
+		t.Fatalf("Streaming while recording failed: %v", err)
+	}
+	server.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read cassette: %v", err)
+	}
+	if strings.Contains(string(data), apiKey) {
+		t.Error("Expected the API key to be redacted from the cassette")
+	}
+	if strings.Contains(string(data), "Authorization") {
+		t.Error("Expected the Authorization header not to be recorded")
+	}
+
+	// Replay with no server and no key
+	cassette, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("Failed to load cassette: %v", err)
+	}
+	if len(cassette.Interactions()) != 2 {
+		t.Fatalf("Expected 2 interactions, got %d", len(cassette.Interactions()))
+	}
+	player := NewClientWithProvider(server.URL, "", "gpt-4o-mini", "openai")
+	player.UseCassette(cassette)
+
+	var streamed strings.Builder
+	content, err := player.SimpleQueryStreaming("Stream", nil, nil, nil, func(chunk string, done bool) {
+		streamed.WriteString(chunk)
+	})
+	if err != nil || content != "Hello" || streamed.String() != "Hello" {
+		t.Errorf("Expected replayed stream Hello, got %q / %q (%v)", content, streamed.String(), err)
+	}
+	resp, err := player.Chat([]Message{{Role: "user", Content: "Ping"}}, nil, nil, nil)
+	if err != nil || player.GetContent(resp) != "Pong" || resp.Usage.TotalTokens != 6 {
+		t.Errorf("Expected replayed Pong with usage, got %+v (%v)", resp, err)
+	}
+	if cassette.Remaining() != 0 {
+		t.Errorf("Expected all interactions to be used, %d remain", cassette.Remaining())
+	}
+}
+
+func TestCassette_SharedByClients(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"index":0,"message":{"role":"assistant","content":"Pong"},"finish_reason":"stop"}]}`)
+	}))
+	defer server.Close()
+
+	// Failover clients attach the cassette while another client is mid-request
+	cassette := NewRecordingCassette(filepath.Join(t.TempDir(), "shared.cassette.json"))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client := NewClientWithProvider(server.URL, "key", fmt.Sprintf("model-%d", i), "openai")
+			client.UseCassette(cassette)
+			client.UseCassette(cassette)
+			if answer, err := client.SimpleQuery("Ping", nil, nil, nil); err != nil || answer != "Pong" {
+				t.Errorf("Expected Pong, got %q (%v)", answer, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := len(cassette.Interactions()); got != 4 {
+		t.Errorf("Expected each request recorded once, got %d interactions", got)
+	}
+}
@@ -3,6 +3,7 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/traces"
 	"ClosedWheeler/pkg/utils"
 )
 
@@ -22,14 +24,24 @@ type Client struct {
 	fallbackModels  []string
 	fallbackTimeout time.Duration
 	httpClient      *http.Client
+	usageHook       UsageHook
+	cassette        *Cassette
 }
 
+// UsageHook is called after every successful request with the model that
+// actually answered (which may be a fallback) and the usage it reported
+type UsageHook func(model string, usage Usage)
+
 // Message represents a chat message
 type Message struct {
 	Role       string     `json:"role"`
 	Content    string     `json:"content,omitempty"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+
+	// Parts, when set, is multimodal content (text and images) for providers
+	// that support it; Content then holds just the text
+	Parts []ContentPart `json:"-"`
 }
 
 // ToolCall represents a function call from the LLM
@@ -69,6 +81,13 @@ type ChatRequest struct {
 	MaxTokens       *int             `json:"max_tokens,omitempty"`
 	Stream          bool             `json:"stream,omitempty"`
 	ReasoningEffort string           `json:"reasoning_effort,omitempty"`
+	ResponseFormat  *ResponseFormat  `json:"response_format,omitempty"`
+	StreamOptions   *StreamOptions   `json:"stream_options,omitempty"`
+}
+
+// StreamOptions asks for extras in a streamed Chat Completions response
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"` // Send the usage in a final chunk
 }
 
 // ChatResponse represents a chat completion response
@@ -80,6 +99,7 @@ type ChatResponse struct {
 	Choices    []Choice   `json:"choices"`
 	Usage      Usage      `json:"usage"`
 	RateLimits RateLimits `json:"-"`
+	Reasoning  string     `json:"-"` // Reasoning summary, for providers that report one
 }
 
 // Choice represents a response choice
@@ -91,13 +111,18 @@ type Choice struct {
 
 // Usage represents token usage
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	TotalTokens         int `json:"total_tokens"`
+	CachedTokens        int `json:"cached_tokens,omitempty"`         // Prompt tokens read from the provider's cache (included in PromptTokens)
+	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"` // Prompt tokens written to the provider's cache (included in PromptTokens)
+	ReasoningTokens     int `json:"reasoning_tokens,omitempty"`      // Completion tokens spent on reasoning (included in CompletionTokens)
 }
 
 // RateLimits represents API rate limit information from headers
 type RateLimits struct {
+	LimitRequests     int       `json:"limit_requests,omitempty"` // Requests per minute; 0 if not reported
+	LimitTokens       int       `json:"limit_tokens,omitempty"`   // Tokens per minute; 0 if not reported
 	RemainingRequests int       `json:"remaining_requests"`
 	RemainingTokens   int       `json:"remaining_tokens"`
 	ResetRequests     time.Time `json:"reset_requests"`
@@ -112,7 +137,7 @@ func NewClient(baseURL, apiKey, model string) *Client {
 // NewClientWithProvider creates a new LLM client with an explicit provider name.
 // An empty providerName triggers auto-detection based on model name and API key.
 func NewClientWithProvider(baseURL, apiKey, model, providerName string) *Client {
-	return &Client{
+	c := &Client{
 		baseURL:         baseURL,
 		apiKey:          apiKey,
 		model:           model,
@@ -123,6 +148,23 @@ func NewClientWithProvider(baseURL, apiKey, model, providerName string) *Client
 			Timeout: 120 * time.Second,
 		},
 	}
+	// The mock provider serves its own requests
+	var transport http.RoundTripper
+	if mock, ok := c.provider.(*MockProvider); ok {
+		transport = mock
+	}
+	c.httpClient.Transport = traces.Transport("llm", transport)
+	return c
+}
+
+// RateScheduler returns the scheduler that paces requests to the client's model
+func (c *Client) RateScheduler() *RateScheduler {
+	return SchedulerFor(c.baseURL, c.model)
+}
+
+// Model returns the model the client sends requests to.
+func (c *Client) Model() string {
+	return c.model
 }
 
 // ProviderName returns the name of the active provider.
@@ -138,14 +180,106 @@ func (c *Client) SetFallbackModels(models []string, timeoutSeconds int) {
 	}
 }
 
+// SetUsageHook registers fn to observe the usage of every request, including
+// fallbacks, streams and simple queries. Pass nil to remove it.
+func (c *Client) SetUsageHook(fn UsageHook) {
+	c.usageHook = fn
+}
+
+// UseCassette routes all requests through a recording or replaying cassette
+func (c *Client) UseCassette(cassette *Cassette) {
+	next := c.httpClient.Transport
+	if current, ok := next.(cassetteTransport); ok {
+		next = current.next // Switching cassettes must not record twice
+	}
+	c.cassette = cassette
+	c.httpClient.Transport = cassette.through(next)
+}
+
+// endpoint returns the request URL for model
+func (c *Client) endpoint(model string, stream bool) string {
+	return providerEndpoint(c.provider, c.baseURL, model, stream)
+}
+
+// providerEndpoint returns the request URL of provider for model
+func providerEndpoint(provider Provider, baseURL, model string, stream bool) string {
+	if p, ok := provider.(ModelEndpointer); ok {
+		return p.ModelEndpoint(baseURL, model, stream)
+	}
+	return provider.Endpoint(baseURL)
+}
+
+// breaker returns the circuit breaker of model, letting it probe through this
+// client. Cassettes replay requests in order, so they get no probes.
+func (c *Client) breaker(model string) *CircuitBreaker {
+	b := BreakerFor(c.baseURL, model)
+	if c.cassette == nil {
+		b.SetProbe(c.probe(model))
+	}
+	return b
+}
+
+// probe returns a cheap availability check of model: a one-token request
+// from a fresh provider, so it leaves the client's provider state alone. The
+// fresh provider gets the client's OAuth login, which decides the headers and,
+// for Gemini Code Assist, the endpoint. Any answer other than a server error
+// means the provider is reachable again.
+func (c *Client) probe(model string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		provider := DetectProvider(c.provider.Name(), model, c.apiKey)
+		if creds := c.GetOAuthCredentials(); creds != nil {
+			setProviderOAuth(provider, creds)
+		}
+		maxTokens := 1
+		body, err := provider.BuildRequestBody(model, []Message{{Role: "user", Content: "ping"}}, nil, nil, nil, &maxTokens, false)
+		if err != nil {
+			return fmt.Errorf("failed to marshal probe: %w", err)
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", providerEndpoint(provider, c.baseURL, model, false), bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("failed to create probe: %w", err)
+		}
+		provider.SetHeaders(req, c.apiKey)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("probe failed: %w", err)
+		}
+		resp.Body.Close()
+		if providerFault(resp.StatusCode) {
+			return fmt.Errorf("probe failed (status %d)", resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// reportUsage passes a response's usage to the usage hook
+func (c *Client) reportUsage(model string, resp *ChatResponse) {
+	if resp.Model == "" {
+		resp.Model = model
+	}
+	if c.usageHook != nil {
+		c.usageHook(model, resp.Usage)
+	}
+}
+
 // SetOAuthCredentials sets OAuth credentials on the underlying provider.
 // Supports both Anthropic and OpenAI providers.
 func (c *Client) SetOAuthCredentials(creds *config.OAuthCredentials) {
-	switch p := c.provider.(type) {
+	setProviderOAuth(c.provider, creds)
+}
+
+// setProviderOAuth sets OAuth credentials on providers that support them
+func setProviderOAuth(provider Provider, creds *config.OAuthCredentials) {
+	switch p := provider.(type) {
 	case *AnthropicProvider:
 		p.SetOAuth(creds)
 	case *OpenAIProvider:
 		p.SetOAuth(creds)
+	case *ResponsesProvider:
+		p.SetOAuth(creds)
+	case *GeminiProvider:
+		p.SetOAuth(creds)
 	}
 }
 
@@ -156,6 +290,10 @@ func (c *Client) GetOAuthCredentials() *config.OAuthCredentials {
 		return p.GetOAuth()
 	case *OpenAIProvider:
 		return p.GetOAuth()
+	case *ResponsesProvider:
+		return p.GetOAuth()
+	case *GeminiProvider:
+		return p.GetOAuth()
 	}
 	return nil
 }
@@ -165,8 +303,45 @@ func (c *Client) SetReasoningEffort(effort string) {
 	switch p := c.provider.(type) {
 	case *OpenAIProvider:
 		p.SetReasoningEffort(effort)
+	case *ResponsesProvider:
+		p.SetReasoningEffort(effort)
 	case *AnthropicProvider:
 		p.SetReasoningEffort(effort)
+	case *GeminiProvider:
+		p.SetReasoningEffort(effort)
+	}
+}
+
+// SetMockScenario sets the scenario the mock provider answers from.
+// It is a no-op for other providers.
+func (c *Client) SetMockScenario(scenario *MockScenario) {
+	if p, ok := c.provider.(*MockProvider); ok {
+		p.SetScenario(scenario)
+	}
+}
+
+// SetSafetyThreshold sets the Gemini safety threshold for all harm categories.
+// It is a no-op for other providers.
+func (c *Client) SetSafetyThreshold(threshold string) {
+	if p, ok := c.provider.(*GeminiProvider); ok {
+		p.SetSafetyThreshold(threshold)
+	}
+}
+
+// SetOllamaOptions sets the keep-alive and context size (num_ctx) a local
+// Ollama model is loaded with. It is a no-op for other providers.
+func (c *Client) SetOllamaOptions(keepAlive string, numCtx int) {
+	if p, ok := c.provider.(*OllamaProvider); ok {
+		p.SetKeepAlive(keepAlive)
+		p.SetContextLength(numCtx)
+	}
+}
+
+// SetResponsesStore enables server-side storage and previous_response_id
+// chaining for the Responses API. It is a no-op for other providers.
+func (c *Client) SetResponsesStore(store bool) {
+	if p, ok := c.provider.(*ResponsesProvider); ok {
+		p.SetStore(store)
 	}
 }
 
@@ -175,8 +350,12 @@ func (c *Client) GetReasoningEffort() string {
 	switch p := c.provider.(type) {
 	case *OpenAIProvider:
 		return p.GetReasoningEffort()
+	case *ResponsesProvider:
+		return p.GetReasoningEffort()
 	case *AnthropicProvider:
 		return p.GetReasoningEffort()
+	case *GeminiProvider:
+		return p.GetReasoningEffort()
 	}
 	return ""
 }
@@ -189,6 +368,10 @@ func (c *Client) RefreshOAuthIfNeeded() {
 		p.RefreshIfNeeded()
 	case *OpenAIProvider:
 		p.RefreshIfNeeded()
+	case *ResponsesProvider:
+		p.RefreshIfNeeded()
+	case *GeminiProvider:
+		p.RefreshIfNeeded()
 	}
 }
 
@@ -199,22 +382,30 @@ func (c *Client) Chat(messages []Message, temperature *float64, topP *float64, m
 
 // ChatWithTools sends a chat completion request with function calling
 func (c *Client) ChatWithTools(messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int) (*ChatResponse, error) {
+	return c.ChatWithToolsContext(context.Background(), messages, tools, temperature, topP, maxTokens)
+}
+
+// ChatWithToolsContext is like ChatWithTools but aborts the request when ctx is cancelled
+func (c *Client) ChatWithToolsContext(ctx context.Context, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int) (*ChatResponse, error) {
 	// If we have fallback models, use timeout for primary model
 	if len(c.fallbackModels) > 0 {
-		return c.chatWithFallback(messages, tools, temperature, topP, maxTokens)
+		return c.chatWithFallback(ctx, messages, tools, temperature, topP, maxTokens)
 	}
 
 	// No fallback configured, use normal flow
-	return c.chatWithModel(c.model, messages, tools, temperature, topP, maxTokens, 0)
+	return c.chatWithModel(ctx, c.model, messages, tools, temperature, topP, maxTokens, 0)
 }
 
 // chatWithFallback attempts primary model with timeout, then fallback models
-func (c *Client) chatWithFallback(messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int) (*ChatResponse, error) {
+func (c *Client) chatWithFallback(ctx context.Context, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int) (*ChatResponse, error) {
 	// Try primary model with timeout
-	resp, err := c.chatWithModel(c.model, messages, tools, temperature, topP, maxTokens, c.fallbackTimeout)
+	resp, err := c.chatWithModel(ctx, c.model, messages, tools, temperature, topP, maxTokens, c.fallbackTimeout)
 	if err == nil {
 		return resp, nil
 	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 
 	log.Printf("[INFO] Primary model %s failed or timed out: %v. Trying fallback models...", c.model, err)
 
@@ -223,11 +414,14 @@ func (c *Client) chatWithFallback(messages []Message, tools []ToolDefinition, te
 		log.Printf("[INFO] Attempting fallback model %d/%d: %s", i+1, len(c.fallbackModels), fallbackModel)
 
 		// Use same timeout for fallback models
-		resp, fallbackErr := c.chatWithModel(fallbackModel, messages, tools, temperature, topP, maxTokens, c.fallbackTimeout)
+		resp, fallbackErr := c.chatWithModel(ctx, fallbackModel, messages, tools, temperature, topP, maxTokens, c.fallbackTimeout)
 		if fallbackErr == nil {
 			log.Printf("[INFO] Fallback model %s succeeded!", fallbackModel)
 			return resp, nil
 		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 
 		log.Printf("[WARN] Fallback model %s failed: %v", fallbackModel, fallbackErr)
 	}
@@ -237,7 +431,7 @@ func (c *Client) chatWithFallback(messages []Message, tools []ToolDefinition, te
 }
 
 // chatWithModel attempts to chat with a specific model, with optional timeout
-func (c *Client) chatWithModel(model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, timeout time.Duration) (*ChatResponse, error) {
+func (c *Client) chatWithModel(ctx context.Context, model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, timeout time.Duration) (*ChatResponse, error) {
 	// Refresh OAuth token before the request (no-op if not using OAuth)
 	c.RefreshOAuthIfNeeded()
 
@@ -245,18 +439,34 @@ func (c *Client) chatWithModel(model string, messages []Message, tools []ToolDef
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
+	return c.send(ctx, model, jsonData, timeout)
+}
 
+// send posts a built request body for model, retrying transient failures
+func (c *Client) send(ctx context.Context, model string, jsonData []byte, timeout time.Duration) (*ChatResponse, error) {
 	// Create a temporary HTTP client with custom timeout if specified
 	httpClient := c.httpClient
 	if timeout > 0 {
 		httpClient = &http.Client{
-			Timeout: timeout,
+			Timeout:   timeout,
+			Transport: c.httpClient.Transport,
 		}
 	}
 
+	breaker := c.breaker(model)
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+
 	var chatResp *ChatResponse
+	scheduler := SchedulerFor(c.baseURL, model)
+	reserved := estimateRequestTokens(jsonData)
+	fault := false // The last attempt failed because the provider is unavailable
 	operation := func() error {
-		req, err := http.NewRequest("POST", c.provider.Endpoint(c.baseURL), bytes.NewBuffer(jsonData))
+		if _, err := scheduler.Wait(ctx, reserved); err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint(model, false), bytes.NewBuffer(jsonData))
 		if err != nil {
 			return fmt.Errorf("failed to create request: %w", err)
 		}
@@ -265,15 +475,21 @@ func (c *Client) chatWithModel(model string, messages []Message, tools []ToolDef
 
 		resp, err := httpClient.Do(req)
 		if err != nil {
+			fault = true
 			return fmt.Errorf("failed to send request: %w", err)
 		}
 		defer resp.Body.Close()
 
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
+			fault = true
 			return fmt.Errorf("failed to read response: %w", err)
 		}
+		fault = providerFault(resp.StatusCode)
 
+		if resp.StatusCode == http.StatusTooManyRequests {
+			scheduler.Backoff(retryAfter(resp.Header, time.Now()))
+		}
 		if resp.StatusCode != http.StatusOK {
 			apiErr := fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
 			if utils.IsRetryableError(resp.StatusCode) {
@@ -290,18 +506,42 @@ func (c *Client) chatWithModel(model string, messages []Message, tools []ToolDef
 
 		// Parse rate limits from headers
 		chatResp.RateLimits = c.provider.ParseRateLimits(resp.Header)
+		scheduler.Settle(chatResp.RateLimits, reserved, chatResp.Usage.TotalTokens)
 
 		return nil
 	}
 
-	retryConfig := utils.DefaultRetryConfig()
-	if err := utils.ExecuteWithRetry(operation, retryConfig); err != nil {
+	if err := utils.ExecuteWithRetryContext(ctx, operation, c.retryConfig()); err != nil {
+		switch {
+		case ctx.Err() != nil:
+			breaker.Abandoned()
+		case fault:
+			breaker.Failed(err)
+			return nil, unavailableError{err}
+		default:
+			breaker.Succeeded()
+		}
 		return nil, err
 	}
+	breaker.Succeeded()
 
+	c.reportUsage(model, chatResp)
 	return chatResp, nil
 }
 
+// defaultRetryConfig is the retry policy of requests; tests shorten its delays
+var defaultRetryConfig = utils.DefaultRetryConfig
+
+// retryConfig returns how the client retries a failed request
+func (c *Client) retryConfig() utils.RetryConfig {
+	config := defaultRetryConfig()
+	if c.cassette != nil && c.cassette.Mode() == CassetteReplay {
+		// Recorded retries are replayed in order; waiting between them only slows tests down
+		config.InitialDelay = 0
+	}
+	return config
+}
+
 // SimpleQuery sends a simple chat query (no tools)
 func (c *Client) SimpleQuery(prompt string, temperature *float64, topP *float64, maxTokens *int) (string, error) {
 	messages := []Message{
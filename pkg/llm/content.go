@@ -0,0 +1,228 @@
+// Package llm provides multimodal message content
+package llm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// MaxImageBytes is the largest image a message can carry; providers reject
+// bigger ones
+const MaxImageBytes = 5 * 1024 * 1024
+
+// imageMediaTypes are the image formats every vision provider accepts
+var imageMediaTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// ContentPart is one part of a multimodal message: text or an image
+type ContentPart struct {
+	Type      string // "text" or "image"
+	Text      string
+	MediaType string // Image MIME type, e.g. "image/png"
+	Data      string // Base64-encoded image
+}
+
+// TextPart returns a text content part
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart returns an image content part holding data
+func ImagePart(mediaType string, data []byte) ContentPart {
+	return ContentPart{Type: "image", MediaType: mediaType, Data: base64.StdEncoding.EncodeToString(data)}
+}
+
+// ImagePartFromBase64 returns an image content part from base64 data, which
+// may also be a data URL ("data:image/png;base64,...")
+func ImagePartFromBase64(mediaType, data string) (ContentPart, error) {
+	if strings.HasPrefix(data, "data:") {
+		header, payload, ok := strings.Cut(strings.TrimPrefix(data, "data:"), ",")
+		if !ok || !strings.HasSuffix(header, ";base64") {
+			return ContentPart{}, fmt.Errorf("unsupported image data URL")
+		}
+		mediaType, data = strings.TrimSuffix(header, ";base64"), payload
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("invalid base64 image: %w", err)
+	}
+	return newImagePart(mediaType, raw)
+}
+
+// LoadImage reads an image file into a content part, detecting its format
+func LoadImage(path string) (ContentPart, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	if info.Size() > MaxImageBytes {
+		return ContentPart{}, fmt.Errorf("image %s is too large (%.1f MB, max %d MB)", path, float64(info.Size())/(1024*1024), MaxImageBytes/(1024*1024))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContentPart{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	return newImagePart("", data)
+}
+
+// newImagePart validates image data, detecting the media type when it is empty
+func newImagePart(mediaType string, data []byte) (ContentPart, error) {
+	if len(data) > MaxImageBytes {
+		return ContentPart{}, fmt.Errorf("image is too large (%.1f MB, max %d MB)", float64(len(data))/(1024*1024), MaxImageBytes/(1024*1024))
+	}
+	if mediaType == "" {
+		mediaType = http.DetectContentType(data)
+	}
+	if !imageMediaTypes[mediaType] {
+		return ContentPart{}, fmt.Errorf("unsupported image type %s (use PNG, JPEG, GIF or WebP)", mediaType)
+	}
+	return ImagePart(mediaType, data), nil
+}
+
+// NewImageMessage returns a message with text followed by images. Content
+// keeps the text for providers that only send text.
+func NewImageMessage(role, text string, images ...ContentPart) Message {
+	parts := make([]ContentPart, 0, len(images)+1)
+	if text != "" {
+		parts = append(parts, TextPart(text))
+	}
+	parts = append(parts, images...)
+	return Message{Role: role, Content: text, Parts: parts}
+}
+
+// HasImages reports whether the message carries any image
+func (m Message) HasImages() bool {
+	for _, part := range m.Parts {
+		if part.Type == "image" {
+			return true
+		}
+	}
+	return false
+}
+
+// dataURL returns an image part as a data URL
+func (p ContentPart) dataURL() string {
+	return "data:" + p.MediaType + ";base64," + p.Data
+}
+
+// --- OpenAI wire format ---
+
+type openAIContentPart struct {
+	Type     string          `json:"type"` // "text" or "image_url"
+	Text     string          `json:"text,omitempty"`
+	ImageURL *openAIImageURL `json:"image_url,omitempty"`
+}
+
+type openAIImageURL struct {
+	URL string `json:"url"`
+}
+
+// wireMessage is Message without its JSON methods
+type wireMessage Message
+
+// MarshalJSON writes the OpenAI wire format: content is a string, or an
+// array of text and image_url parts when the message has parts.
+func (m Message) MarshalJSON() ([]byte, error) {
+	if len(m.Parts) == 0 {
+		return json.Marshal(wireMessage(m))
+	}
+	parts := make([]openAIContentPart, 0, len(m.Parts))
+	for _, part := range m.Parts {
+		if part.Type == "image" {
+			parts = append(parts, openAIContentPart{Type: "image_url", ImageURL: &openAIImageURL{URL: part.dataURL()}})
+		} else {
+			parts = append(parts, openAIContentPart{Type: "text", Text: part.Text})
+		}
+	}
+	return json.Marshal(struct {
+		wireMessage
+		Content []openAIContentPart `json:"content"`
+	}{wireMessage(m), parts})
+}
+
+// UnmarshalJSON reads string or part-array content. Content is set to the
+// text of all parts.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	var wire struct {
+		wireMessage
+		Content json.RawMessage `json:"content,omitempty"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*m = Message(wire.wireMessage)
+	if len(wire.Content) == 0 || string(wire.Content) == "null" {
+		return nil
+	}
+	if wire.Content[0] == '"' {
+		return json.Unmarshal(wire.Content, &m.Content)
+	}
+
+	var parts []openAIContentPart
+	if err := json.Unmarshal(wire.Content, &parts); err != nil {
+		return fmt.Errorf("invalid message content: %w", err)
+	}
+	var text []string
+	for _, part := range parts {
+		switch {
+		case part.Type == "text":
+			m.Parts = append(m.Parts, TextPart(part.Text))
+			text = append(text, part.Text)
+		case part.Type == "image_url" && part.ImageURL != nil && strings.HasPrefix(part.ImageURL.URL, "data:"):
+			image, err := ImagePartFromBase64("", part.ImageURL.URL)
+			if err != nil {
+				return err
+			}
+			m.Parts = append(m.Parts, image)
+		}
+	}
+	m.Content = strings.Join(text, "\n")
+	return nil
+}
+
+// moveToolImages moves images out of tool results, which the Chat Completions
+// API only accepts as text, into a user message after the batch of results
+func moveToolImages(messages []Message) []Message {
+	found := false
+	for _, msg := range messages {
+		if msg.Role == "tool" && msg.HasImages() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return messages
+	}
+
+	result := make([]Message, 0, len(messages)+1)
+	var images []ContentPart
+	flush := func() {
+		if len(images) > 0 {
+			result = append(result, NewImageMessage("user", "Images returned by the tool calls above:", images...))
+			images = nil
+		}
+	}
+	for _, msg := range messages {
+		if msg.Role != "tool" {
+			flush()
+		} else if msg.HasImages() {
+			for _, part := range msg.Parts {
+				if part.Type == "image" {
+					images = append(images, part)
+				}
+			}
+			msg.Parts = nil
+		}
+		result = append(result, msg)
+	}
+	flush()
+	return result
+}
@@ -0,0 +1,142 @@
+package llm
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngHeader is enough of a PNG file for content type detection
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestLoadImage(t *testing.T) {
+	dir := t.TempDir()
+	png := filepath.Join(dir, "shot.png")
+	text := filepath.Join(dir, "notes.txt")
+	os.WriteFile(png, pngHeader, 0644)
+	os.WriteFile(text, []byte("not an image"), 0644)
+
+	image, err := LoadImage(png)
+	if err != nil || image.Type != "image" || image.MediaType != "image/png" {
+		t.Fatalf("Expected a PNG image part, got %+v (%v)", image, err)
+	}
+	if _, err := LoadImage(text); err == nil || !strings.Contains(err.Error(), "unsupported image type") {
+		t.Errorf("Expected an unsupported type error, got %v", err)
+	}
+	if _, err := ImagePartFromBase64("", image.dataURL()); err != nil {
+		t.Errorf("Expected a data URL to round-trip, got %v", err)
+	}
+}
+
+func TestMessage_ImageWireFormat(t *testing.T) {
+	image := ImagePart("image/png", pngHeader)
+	msg := NewImageMessage("user", "What is on screen?", image)
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	want := `{"role":"user","content":[{"type":"text","text":"What is on screen?"},{"type":"image_url","image_url":{"url":"data:image/png;base64,` + image.Data + `"}}]}`
+	if string(data) != want {
+		t.Errorf("Unexpected wire format:\n%s", data)
+	}
+
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Content != "What is on screen?" || !decoded.HasImages() || decoded.Parts[1].Data != image.Data {
+		t.Errorf("Expected the parts back, got %+v", decoded)
+	}
+
+	plain, _ := json.Marshal(Message{Role: "user", Content: "hi"})
+	if string(plain) != `{"role":"user","content":"hi"}` {
+		t.Errorf("Expected plain messages to keep string content, got %s", plain)
+	}
+}
+
+func TestProviders_ToolResultImages(t *testing.T) {
+	toolResult := NewImageMessage("tool", "Screenshot saved", ImagePart("image/png", pngHeader))
+	toolResult.ToolCallID = "call_1"
+	messages := []Message{
+		{Role: "user", Content: "Look at the page"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "browser_screenshot", Arguments: "{}"}}}},
+		toolResult,
+	}
+
+	// OpenAI only takes text tool results; the image follows in a user message
+	body, err := (&OpenAIProvider{}).BuildRequestBody("gpt-4o", messages, nil, nil, nil, nil, false)
+	if err != nil {
+		t.Fatalf("OpenAI build failed: %v", err)
+	}
+	var openai ChatRequest
+	json.Unmarshal(body, &openai)
+	if len(openai.Messages) != 4 || openai.Messages[2].Content != "Screenshot saved" || openai.Messages[2].HasImages() || !openai.Messages[3].HasImages() {
+		t.Errorf("Expected a text tool result followed by an image message, got %+v", openai.Messages)
+	}
+
+	// Anthropic takes image blocks inside the tool result
+	body, err = (&AnthropicProvider{}).BuildRequestBody("claude-sonnet-4", messages, nil, nil, nil, nil, false)
+	if err != nil {
+		t.Fatalf("Anthropic build failed: %v", err)
+	}
+	var anthropic struct {
+		Messages []struct {
+			Content []struct {
+				Type    string `json:"type"`
+				Content []struct {
+					Type   string `json:"type"`
+					Source struct {
+						MediaType string `json:"media_type"`
+					} `json:"source"`
+				} `json:"content"`
+			} `json:"content"`
+		} `json:"messages"`
+	}
+	json.Unmarshal(body, &anthropic)
+	result := anthropic.Messages[2].Content[0]
+	if result.Type != "tool_result" || len(result.Content) != 2 || result.Content[1].Type != "image" || result.Content[1].Source.MediaType != "image/png" {
+		t.Errorf("Expected a tool result with an image block, got %+v", result)
+	}
+}
+
+func TestProviders_NativeImageFormats(t *testing.T) {
+	image := ImagePart("image/png", pngHeader)
+	toolResult := NewImageMessage("tool", "Screenshot saved", image)
+	toolResult.ToolCallID = "call_1"
+	conversations := map[string][]Message{
+		"user image": {NewImageMessage("user", "What is on screen?", image)},
+		"tool image": {
+			{Role: "user", Content: "Look at the page"},
+			{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "browser_screenshot", Arguments: "{}"}}}},
+			toolResult,
+		},
+	}
+
+	tests := []struct {
+		name     string
+		provider Provider
+		model    string
+		expected string
+	}{
+		{"Gemini", &GeminiProvider{}, "gemini-2.5-flash", `"inlineData":{"mimeType":"image/png","data":"` + image.Data + `"}`},
+		{"Responses", &ResponsesProvider{}, "gpt-4.1", `{"type":"input_image","image_url":"data:image/png;base64,` + image.Data + `"}`},
+		{"Ollama", &OllamaProvider{}, "llava", `"images":["` + image.Data + `"]`},
+	}
+
+	for _, tt := range tests {
+		for name, messages := range conversations {
+			t.Run(tt.name+" "+name, func(t *testing.T) {
+				body, err := tt.provider.BuildRequestBody(tt.model, messages, nil, nil, nil, nil, false)
+				if err != nil {
+					t.Fatalf("Build failed: %v", err)
+				}
+				if !strings.Contains(string(body), tt.expected) {
+					t.Errorf("Expected %s in the request, got %s", tt.expected, body)
+				}
+			})
+		}
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"strings"
 	"time"
 )
 
@@ -25,6 +24,34 @@ type ModelSelfConfig struct {
 	Warnings            []string `json:"warnings,omitempty"`
 }
 
+// modelSelfConfigSchema is the JSON Schema of ModelSelfConfig
+var modelSelfConfigSchema = ResponseSchema{
+	Name:        "model_self_config",
+	Description: "Your optimal configuration as an AI agent assistant",
+	Strict:      true,
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"model_name":              map[string]interface{}{"type": "string"},
+			"context_window":          map[string]interface{}{"type": "integer"},
+			"recommended_temperature": map[string]interface{}{"type": "number"},
+			"recommended_top_p":       map[string]interface{}{"type": "number"},
+			"recommended_max_tokens":  map[string]interface{}{"type": "integer"},
+			"supports_temperature":    map[string]interface{}{"type": "boolean"},
+			"supports_top_p":          map[string]interface{}{"type": "boolean"},
+			"supports_max_tokens":     map[string]interface{}{"type": "boolean"},
+			"best_for_agent_work":     map[string]interface{}{"type": "boolean"},
+			"reasoning":               map[string]interface{}{"type": "string"},
+			"warnings":                map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+		"required": []string{
+			"model_name", "context_window", "recommended_temperature", "recommended_top_p", "recommended_max_tokens",
+			"supports_temperature", "supports_top_p", "supports_max_tokens", "best_for_agent_work", "reasoning", "warnings",
+		},
+		"additionalProperties": false,
+	},
+}
+
 // InterviewPrompt is the question asked to models for self-configuration
 const InterviewPrompt = `You are being configured as an AI agent assistant. Please analyze your own capabilities and provide optimal configuration parameters.
 
@@ -76,23 +103,16 @@ func (c *Client) InterviewModel(ctx context.Context) (*ModelSelfConfig, error) {
 	temp := float64(0.3) // Low temp for structured output
 	maxTok := int(2000)  // Enough for JSON response
 
-	resp, err := c.chatWithModel(c.model, messages, nil, &temp, nil, &maxTok, 30*time.Second)
-	if err != nil {
-		return nil, fmt.Errorf("interview failed: %w", err)
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 90*time.Second)
+		defer cancel()
 	}
 
-	content := c.GetContent(resp)
-	log.Printf("[DEBUG] Model response length: %d chars", len(content))
-
-	// Clean response - remove markdown code blocks if present
-	content = cleanJSONResponse(content)
-
-	// Parse JSON
 	var config ModelSelfConfig
-	if err := json.Unmarshal([]byte(content), &config); err != nil {
-		log.Printf("[ERROR] Failed to parse model response as JSON")
-		log.Printf("[DEBUG] Response: %s", content)
-		return nil, fmt.Errorf("model returned invalid JSON: %w", err)
+	if err := c.QueryStructuredContext(ctx, messages, modelSelfConfigSchema, &config, &temp, &maxTok); err != nil {
+		log.Printf("[ERROR] Interview of %s failed: %v", c.model, err)
+		return nil, fmt.Errorf("interview failed: %w", err)
 	}
 
 	// Validate and apply safety limits
@@ -147,26 +167,6 @@ func InterviewMultipleModels(baseURL, apiKey, providerName string, modelIDs []st
 	return configs, errors
 }
 
-// cleanJSONResponse removes markdown code blocks and whitespace
-func cleanJSONResponse(content string) string {
-	// Remove markdown code blocks
-	content = strings.TrimSpace(content)
-	content = strings.TrimPrefix(content, "```json")
-	content = strings.TrimPrefix(content, "```")
-	content = strings.TrimSuffix(content, "```")
-	content = strings.TrimSpace(content)
-
-	// Find JSON object boundaries
-	start := strings.Index(content, "{")
-	end := strings.LastIndex(content, "}")
-
-	if start != -1 && end != -1 && end > start {
-		content = content[start : end+1]
-	}
-
-	return content
-}
-
 // validateAndAdjustConfig applies safety limits and validation
 func validateAndAdjustConfig(config ModelSelfConfig) ModelSelfConfig {
 	// Validate context window (min 1000, max 2M)
@@ -5,6 +5,7 @@ import (
 	"context"
 	"log"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -14,6 +15,8 @@ type ModelProfile struct {
 	SupportsTemp    bool
 	SupportsTopP    bool
 	SupportsMaxTok  bool
+	SupportsTools   bool // Model can call tools; tool definitions are not sent otherwise
+	SupportsVision  bool // Model accepts images; the agent replaces them with a note otherwise
 	DefaultTemp     *float64
 	DefaultTopP     *float64
 	DefaultMaxTok   *int
@@ -30,6 +33,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(0.9),
 		DefaultMaxTok:   intPtr(8192),
@@ -42,6 +47,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(0.9),
 		DefaultMaxTok:   intPtr(4096),
@@ -54,6 +61,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(0.9),
 		DefaultMaxTok:   intPtr(4096),
@@ -66,6 +75,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(0.9),
 		DefaultMaxTok:   intPtr(4096),
@@ -78,6 +89,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(0.9),
 		DefaultMaxTok:   intPtr(4096),
@@ -86,12 +99,14 @@ var KnownProfiles = map[string]ModelProfile{
 		RecommendedTopP: float64Ptr(0.9),
 	},
 
-	// OpenAI models
+	// OpenAI models (the gpt-4 profile also covers its multimodal successors, e.g. gpt-4.1)
 	"gpt-4": {
 		Name:            "gpt-4",
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(1.0),
 		DefaultMaxTok:   intPtr(4096),
@@ -104,6 +119,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(1.0),
 		DefaultMaxTok:   intPtr(4096),
@@ -116,6 +133,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(1.0),
 		DefaultMaxTok:   intPtr(4096),
@@ -128,6 +147,7 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
 		DefaultTemp:     float64Ptr(1.0),
 		DefaultTopP:     float64Ptr(1.0),
 		DefaultMaxTok:   intPtr(4096),
@@ -142,6 +162,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(0.9),
 		DefaultTopP:     float64Ptr(1.0),
 		DefaultMaxTok:   intPtr(2048),
@@ -154,6 +176,8 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
+		SupportsVision:  true,
 		DefaultTemp:     float64Ptr(0.9),
 		DefaultTopP:     float64Ptr(1.0),
 		DefaultMaxTok:   intPtr(2048),
@@ -168,6 +192,7 @@ var KnownProfiles = map[string]ModelProfile{
 		SupportsTemp:    true,
 		SupportsTopP:    true,
 		SupportsMaxTok:  true,
+		SupportsTools:   true,
 		DefaultTemp:     float64Ptr(0.7),
 		DefaultTopP:     float64Ptr(0.9),
 		DefaultMaxTok:   intPtr(4096),
@@ -177,51 +202,82 @@ var KnownProfiles = map[string]ModelProfile{
 	},
 }
 
+// discoveredProfiles holds profiles read from model servers at runtime
+var (
+	discoveredMu       sync.RWMutex
+	discoveredProfiles = make(map[string]ModelProfile)
+)
+
+// RegisterModelProfile adds a profile discovered at runtime, such as a local
+// model's real context window. It takes precedence over the built-in profiles.
+func RegisterModelProfile(profile ModelProfile) {
+	discoveredMu.Lock()
+	defer discoveredMu.Unlock()
+	discoveredProfiles[strings.ToLower(profile.Name)] = profile
+}
+
 // GetModelProfile retrieves profile for a model (matches partial names)
 func GetModelProfile(modelName string) ModelProfile {
+	profile, ok := LookupModelProfile(modelName)
+	if !ok {
+		log.Printf("[WARN] Unknown model '%s', using default profile", modelName)
+	}
+	return profile
+}
+
+// LookupModelProfile is like GetModelProfile but reports whether the model is
+// known instead of logging, returning the default profile for unknown models
+func LookupModelProfile(modelName string) (ModelProfile, bool) {
 	lowerModel := strings.ToLower(modelName)
 
+	// Profiles discovered from the model server are authoritative
+	discoveredMu.RLock()
+	profile, ok := discoveredProfiles[lowerModel]
+	discoveredMu.RUnlock()
+	if ok {
+		return profile, true
+	}
+
 	// Exact match first
 	if profile, ok := KnownProfiles[lowerModel]; ok {
-		return profile
+		return profile, true
 	}
 
 	// Partial match (e.g., "claude-sonnet-4.5" matches "claude-sonnet-4")
 	for key, profile := range KnownProfiles {
 		if strings.Contains(lowerModel, key) {
-			return profile
+			return profile, true
 		}
 	}
 
 	// Check by model family
 	if strings.Contains(lowerModel, "claude") {
 		if strings.Contains(lowerModel, "opus") {
-			return KnownProfiles["claude-opus-4"]
+			return KnownProfiles["claude-opus-4"], true
 		}
 		if strings.Contains(lowerModel, "sonnet") {
-			return KnownProfiles["claude-sonnet-4"]
+			return KnownProfiles["claude-sonnet-4"], true
 		}
 		if strings.Contains(lowerModel, "haiku") {
-			return KnownProfiles["claude-haiku-4"]
+			return KnownProfiles["claude-haiku-4"], true
 		}
 	}
 
 	if strings.Contains(lowerModel, "gpt") {
 		if strings.Contains(lowerModel, "gpt-4") {
-			return KnownProfiles["gpt-4"]
+			return KnownProfiles["gpt-4"], true
 		}
 		if strings.Contains(lowerModel, "gpt-3.5") {
-			return KnownProfiles["gpt-3.5-turbo"]
+			return KnownProfiles["gpt-3.5-turbo"], true
 		}
 	}
 
 	if strings.Contains(lowerModel, "gemini") {
-		return KnownProfiles["gemini-pro"]
+		return KnownProfiles["gemini-pro"], true
 	}
 
 	// Unknown model - return default
-	log.Printf("[WARN] Unknown model '%s', using default profile", modelName)
-	return KnownProfiles["default"]
+	return KnownProfiles["default"], false
 }
 
 // DetectModelCapabilities tests what parameters a model accepts
@@ -231,6 +287,7 @@ func (c *Client) DetectModelCapabilities(ctx context.Context) (*ModelProfile, er
 	profile := ModelProfile{
 		Name:          c.model,
 		ContextWindow: 8000, // Conservative default
+		SupportsTools: true, // Not probed
 	}
 
 	// Test message
@@ -242,7 +299,7 @@ func (c *Client) DetectModelCapabilities(ctx context.Context) (*ModelProfile, er
 	// Test 1: Temperature support
 	log.Printf("[INFO] Testing temperature support...")
 	temp := float64(0.7)
-	_, err := c.chatWithModel(c.model, testMessages, nil, &temp, nil, nil, 10*time.Second)
+	_, err := c.chatWithModel(context.Background(), c.model, testMessages, nil, &temp, nil, nil, 10*time.Second)
 	if err == nil {
 		profile.SupportsTemp = true
 		profile.DefaultTemp = &temp
@@ -261,7 +318,7 @@ func (c *Client) DetectModelCapabilities(ctx context.Context) (*ModelProfile, er
 	if profile.SupportsTemp {
 		tempPtr = &tempForTest
 	}
-	_, err = c.chatWithModel(c.model, testMessages, nil, tempPtr, &topP, nil, 10*time.Second)
+	_, err = c.chatWithModel(context.Background(), c.model, testMessages, nil, tempPtr, &topP, nil, 10*time.Second)
 	if err == nil {
 		profile.SupportsTopP = true
 		profile.DefaultTopP = &topP
@@ -275,7 +332,7 @@ func (c *Client) DetectModelCapabilities(ctx context.Context) (*ModelProfile, er
 	// Test 3: MaxTokens support
 	log.Printf("[INFO] Testing max_tokens support...")
 	maxTok := int(100)
-	_, err = c.chatWithModel(c.model, testMessages, nil, tempPtr, nil, &maxTok, 10*time.Second)
+	_, err = c.chatWithModel(context.Background(), c.model, testMessages, nil, tempPtr, nil, &maxTok, 10*time.Second)
 	if err == nil {
 		profile.SupportsMaxTok = true
 		profile.DefaultMaxTok = &maxTok
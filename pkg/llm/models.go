@@ -2,11 +2,14 @@
 package llm
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"time"
+
+	"ClosedWheeler/pkg/traces"
 )
 
 // ModelInfo represents information about an available model
@@ -36,8 +39,18 @@ var AnthropicKnownModels = []ModelInfo{
 	{ID: "claude-3-opus-20240229", Object: "model", OwnedBy: "anthropic"},
 }
 
+// GeminiKnownModels is a hardcoded list of Gemini models for the native
+// provider, whose model listing uses a different format.
+var GeminiKnownModels = []ModelInfo{
+	{ID: "gemini-3-pro-preview", Object: "model", OwnedBy: "google"},
+	{ID: "gemini-3-flash-preview", Object: "model", OwnedBy: "google"},
+	{ID: "gemini-2.5-pro", Object: "model", OwnedBy: "google"},
+	{ID: "gemini-2.5-flash", Object: "model", OwnedBy: "google"},
+	{ID: "gemini-2.5-flash-lite", Object: "model", OwnedBy: "google"},
+}
+
 // ListModels fetches available models from the API.
-// For providers that don't support model listing (Anthropic), returns a hardcoded list.
+// For providers that don't support model listing (Anthropic, Gemini), returns a hardcoded list.
 func ListModels(baseURL, apiKey string) ([]ModelInfo, error) {
 	return ListModelsWithProvider(baseURL, apiKey, "")
 }
@@ -46,12 +59,30 @@ func ListModels(baseURL, apiKey string) ([]ModelInfo, error) {
 func ListModelsWithProvider(baseURL, apiKey, providerName string) ([]ModelInfo, error) {
 	provider := DetectProvider(providerName, "", apiKey)
 
+	if _, ok := provider.(*OllamaProvider); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		local, err := ListOllamaModels(ctx, baseURL)
+		if err != nil {
+			return nil, err
+		}
+		models := make([]ModelInfo, 0, len(local))
+		for _, m := range local {
+			models = append(models, ModelInfo{ID: m.Name, Object: "model", Created: m.ModifiedAt.Unix(), OwnedBy: "ollama"})
+		}
+		return models, nil
+	}
+
 	if !provider.SupportsModelListing() {
+		if _, ok := provider.(*GeminiProvider); ok {
+			return GeminiKnownModels, nil
+		}
 		return AnthropicKnownModels, nil
 	}
 
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout:   10 * time.Second,
+		Transport: traces.Transport("llm", nil),
 	}
 
 	url := baseURL + "/models"
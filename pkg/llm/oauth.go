@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/traces"
 )
 
 // OAuth constants — exact same values as opencode-anthropic-auth plugin.
@@ -25,7 +26,7 @@ const (
 )
 
 // oauthHTTPClient has a sensible timeout so token calls don't hang forever.
-var oauthHTTPClient = &http.Client{Timeout: 15 * time.Second}
+var oauthHTTPClient = &http.Client{Timeout: 15 * time.Second, Transport: traces.Transport("oauth", nil)}
 
 // OAuthTokenResponse is the JSON response from the token endpoint.
 type OAuthTokenResponse struct {
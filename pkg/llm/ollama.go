@@ -0,0 +1,245 @@
+// Package llm provides calls to the native Ollama API: listing, inspecting and pulling models
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/traces"
+)
+
+// ollamaDefaultBaseURL is where a local Ollama server listens by default
+const ollamaDefaultBaseURL = "http://localhost:11434"
+
+// ErrOllamaModelNotFound is returned when the server does not have a model
+var ErrOllamaModelNotFound = errors.New("model not installed")
+
+// ollamaHTTPClient has no timeout: pulls can take many minutes, so callers
+// bound requests with their context instead
+var ollamaHTTPClient = &http.Client{Transport: traces.Transport("ollama", nil)}
+
+// OllamaBaseURL maps a configured base URL to the native API root. The
+// OpenAI-compatible /v1 suffix is dropped and the OpenAI default is replaced
+// by the local server.
+func OllamaBaseURL(baseURL string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if baseURL == "" || strings.Contains(baseURL, "api.openai.com") {
+		return ollamaDefaultBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/v1")
+}
+
+// OllamaModel is an installed model as listed by /api/tags
+type OllamaModel struct {
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modified_at"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+// OllamaModelInfo is what /api/show reports about a model
+type OllamaModelInfo struct {
+	Name          string
+	ContextLength int      // Trained context length of the model
+	Capabilities  []string // e.g. "completion", "tools", "vision", "thinking"
+	Family        string
+	ParameterSize string
+	Quantization  string
+	template      string
+}
+
+// Supports reports whether the model has a capability. Servers that predate
+// capability reporting are checked for a tool-calling chat template.
+func (i *OllamaModelInfo) Supports(capability string) bool {
+	if len(i.Capabilities) == 0 && capability == "tools" {
+		return strings.Contains(i.template, ".Tools")
+	}
+	for _, c := range i.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Profile returns a model profile with the model's real context window and
+// tool support, for RegisterModelProfile
+func (i *OllamaModelInfo) Profile() ModelProfile {
+	profile := KnownProfiles["default"]
+	profile.Name = i.Name
+	if i.ContextLength > 0 {
+		profile.ContextWindow = i.ContextLength
+	}
+	profile.SupportsTools = i.Supports("tools")
+	profile.SupportsVision = i.Supports("vision")
+	return profile
+}
+
+// OllamaPullProgress is one progress report of a model pull
+type OllamaPullProgress struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ListOllamaModels returns the models installed on the server, sorted by name
+func ListOllamaModels(ctx context.Context, baseURL string) ([]OllamaModel, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", OllamaBaseURL(baseURL)+"/api/tags", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	body, err := ollamaDo(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags struct {
+		Models []OllamaModel `json:"models"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %w", err)
+	}
+	sort.Slice(tags.Models, func(i, j int) bool { return tags.Models[i].Name < tags.Models[j].Name })
+	return tags.Models, nil
+}
+
+// ShowOllamaModel reads a model's context length and capabilities. It returns
+// an error wrapping ErrOllamaModelNotFound if the model is not installed.
+func ShowOllamaModel(ctx context.Context, baseURL, model string) (*OllamaModelInfo, error) {
+	reqBody, _ := json.Marshal(map[string]string{"model": model})
+	req, err := http.NewRequestWithContext(ctx, "POST", OllamaBaseURL(baseURL)+"/api/show", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	body, err := ollamaDo(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var show struct {
+		Template     string         `json:"template"`
+		Capabilities []string       `json:"capabilities"`
+		ModelInfo    map[string]any `json:"model_info"`
+		Details      struct {
+			Family            string `json:"family"`
+			ParameterSize     string `json:"parameter_size"`
+			QuantizationLevel string `json:"quantization_level"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(body, &show); err != nil {
+		return nil, fmt.Errorf("failed to parse model info: %w", err)
+	}
+
+	info := &OllamaModelInfo{
+		Name:          model,
+		Capabilities:  show.Capabilities,
+		Family:        show.Details.Family,
+		ParameterSize: show.Details.ParameterSize,
+		Quantization:  show.Details.QuantizationLevel,
+		template:      show.Template,
+	}
+	// The context length is keyed by architecture, e.g. "llama.context_length"
+	arch, _ := show.ModelInfo["general.architecture"].(string)
+	if n, ok := show.ModelInfo[arch+".context_length"].(float64); ok {
+		info.ContextLength = int(n)
+	}
+	return info, nil
+}
+
+// PullOllamaModel downloads a model, reporting progress as the server streams it
+func PullOllamaModel(ctx context.Context, baseURL, model string, progress func(OllamaPullProgress)) error {
+	reqBody, _ := json.Marshal(map[string]any{"model": model, "stream": true})
+	req, err := http.NewRequestWithContext(ctx, "POST", OllamaBaseURL(baseURL)+"/api/pull", bytes.NewReader(reqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ollamaHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Ollama: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("pull failed (status %d): %s", resp.StatusCode, ollamaErrorMessage(body))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	success := false
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var p OllamaPullProgress
+		if err := json.Unmarshal(line, &p); err != nil {
+			continue
+		}
+		if p.Error != "" {
+			return fmt.Errorf("pull failed: %s", p.Error)
+		}
+		if p.Status == "success" {
+			success = true
+		}
+		if progress != nil {
+			progress(p)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("pull interrupted: %w", err)
+	}
+	if !success {
+		return fmt.Errorf("pull of %s ended before completing", model)
+	}
+	return nil
+}
+
+// ollamaDo sends a management request and returns the body of a 200 response
+func ollamaDo(req *http.Request) ([]byte, error) {
+	resp, err := ollamaHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrOllamaModelNotFound, ollamaErrorMessage(body))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Ollama API error (status %d): %s", resp.StatusCode, ollamaErrorMessage(body))
+	}
+	return body, nil
+}
+
+// ollamaErrorMessage extracts the message of an {"error": "..."} body
+func ollamaErrorMessage(body []byte) string {
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error != "" {
+		return e.Error
+	}
+	return truncateError(body)
+}
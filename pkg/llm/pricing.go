@@ -0,0 +1,116 @@
+// Package llm provides per-model token pricing for cost estimates
+package llm
+
+import "strings"
+
+// ModelPricing holds USD prices per million tokens
+type ModelPricing struct {
+	InputPerMillion       float64
+	OutputPerMillion      float64
+	CachedInputPerMillion float64 // Prompt tokens read from the provider's cache; 0 bills them as input
+	CacheWritePerMillion  float64 // Prompt tokens written to the provider's cache; 0 bills them as input
+}
+
+// PricingTable maps lowercase model name prefixes to prices
+type PricingTable map[string]ModelPricing
+
+// KnownPricing contains list prices for common models, keyed by model name prefix
+var KnownPricing = PricingTable{
+	// Claude models
+	"claude-opus-4-6":   {InputPerMillion: 5.00, OutputPerMillion: 25.00, CachedInputPerMillion: 0.50, CacheWritePerMillion: 6.25},
+	"claude-opus-4-5":   {InputPerMillion: 5.00, OutputPerMillion: 25.00, CachedInputPerMillion: 0.50, CacheWritePerMillion: 6.25},
+	"claude-opus-4":     {InputPerMillion: 15.00, OutputPerMillion: 75.00, CachedInputPerMillion: 1.50, CacheWritePerMillion: 18.75},
+	"claude-sonnet-4":   {InputPerMillion: 3.00, OutputPerMillion: 15.00, CachedInputPerMillion: 0.30, CacheWritePerMillion: 3.75},
+	"claude-3-5-sonnet": {InputPerMillion: 3.00, OutputPerMillion: 15.00, CachedInputPerMillion: 0.30, CacheWritePerMillion: 3.75},
+	"claude-haiku-4":    {InputPerMillion: 1.00, OutputPerMillion: 5.00, CachedInputPerMillion: 0.10, CacheWritePerMillion: 1.25},
+	"claude-3-5-haiku":  {InputPerMillion: 0.80, OutputPerMillion: 4.00, CachedInputPerMillion: 0.08, CacheWritePerMillion: 1.00},
+
+	// OpenAI models
+	"gpt-5":         {InputPerMillion: 1.25, OutputPerMillion: 10.00, CachedInputPerMillion: 0.125},
+	"gpt-5-mini":    {InputPerMillion: 0.25, OutputPerMillion: 2.00, CachedInputPerMillion: 0.025},
+	"gpt-4.1":       {InputPerMillion: 2.00, OutputPerMillion: 8.00, CachedInputPerMillion: 0.50},
+	"gpt-4.1-mini":  {InputPerMillion: 0.40, OutputPerMillion: 1.60, CachedInputPerMillion: 0.10},
+	"gpt-4o":        {InputPerMillion: 2.50, OutputPerMillion: 10.00, CachedInputPerMillion: 1.25},
+	"gpt-4o-mini":   {InputPerMillion: 0.15, OutputPerMillion: 0.60, CachedInputPerMillion: 0.075},
+	"gpt-4-turbo":   {InputPerMillion: 10.00, OutputPerMillion: 30.00},
+	"gpt-4":         {InputPerMillion: 30.00, OutputPerMillion: 60.00},
+	"gpt-3.5-turbo": {InputPerMillion: 0.50, OutputPerMillion: 1.50},
+	"o3":            {InputPerMillion: 2.00, OutputPerMillion: 8.00, CachedInputPerMillion: 0.50},
+	"o4-mini":       {InputPerMillion: 1.10, OutputPerMillion: 4.40, CachedInputPerMillion: 0.275},
+
+	// Gemini models
+	"gemini-2.5-pro":   {InputPerMillion: 1.25, OutputPerMillion: 10.00, CachedInputPerMillion: 0.31},
+	"gemini-2.5-flash": {InputPerMillion: 0.30, OutputPerMillion: 2.50, CachedInputPerMillion: 0.075},
+}
+
+// WithOverrides returns a copy of the table with overrides added or replacing
+// existing entries. Override keys are matched case-insensitively.
+func (t PricingTable) WithOverrides(overrides PricingTable) PricingTable {
+	merged := make(PricingTable, len(t)+len(overrides))
+	for key, pricing := range t {
+		merged[key] = pricing
+	}
+	for key, pricing := range overrides {
+		merged[strings.ToLower(key)] = pricing
+	}
+	return merged
+}
+
+// Lookup returns pricing for a model, using the longest matching prefix so
+// "gpt-4o-mini-2024-07-18" resolves to "gpt-4o-mini", not "gpt-4"
+func (t PricingTable) Lookup(modelName string) (ModelPricing, bool) {
+	lowerModel := strings.ToLower(modelName)
+	// Strip vendor prefixes such as "openai/" or "anthropic/"
+	if idx := strings.LastIndex(lowerModel, "/"); idx >= 0 {
+		lowerModel = lowerModel[idx+1:]
+	}
+
+	bestKey := ""
+	for key := range t {
+		if strings.HasPrefix(lowerModel, key) && len(key) > len(bestKey) {
+			bestKey = key
+		}
+	}
+	if bestKey == "" {
+		return ModelPricing{}, false
+	}
+	return t[bestKey], true
+}
+
+// GetModelPricing returns the list price of a model from KnownPricing
+func GetModelPricing(modelName string) (ModelPricing, bool) {
+	return KnownPricing.Lookup(modelName)
+}
+
+// Cost returns the USD cost of the given usage
+func (p ModelPricing) Cost(usage Usage) float64 {
+	cached := usage.CachedTokens
+	if cached > usage.PromptTokens {
+		cached = usage.PromptTokens
+	}
+	written := usage.CacheCreationTokens
+	if written > usage.PromptTokens-cached {
+		written = usage.PromptTokens - cached
+	}
+	cachedRate := p.CachedInputPerMillion
+	if cachedRate == 0 {
+		cachedRate = p.InputPerMillion
+	}
+	writeRate := p.CacheWritePerMillion
+	if writeRate == 0 {
+		writeRate = p.InputPerMillion
+	}
+	return float64(usage.PromptTokens-cached-written)*p.InputPerMillion/1_000_000 +
+		float64(cached)*cachedRate/1_000_000 +
+		float64(written)*writeRate/1_000_000 +
+		float64(usage.CompletionTokens)*p.OutputPerMillion/1_000_000
+}
+
+// EstimateCost returns the USD cost of usage for a model, or 0 if the model is unpriced
+func EstimateCost(modelName string, usage Usage) float64 {
+	pricing, ok := GetModelPricing(modelName)
+	if !ok {
+		return 0
+	}
+	return pricing.Cost(usage)
+}
@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"math"
+	"testing"
+)
+
+func TestModelPricing_Cost(t *testing.T) {
+	pricing := ModelPricing{InputPerMillion: 2, OutputPerMillion: 8, CachedInputPerMillion: 0.5, CacheWritePerMillion: 2.5}
+
+	tests := []struct {
+		name     string
+		pricing  ModelPricing
+		usage    Usage
+		expected float64
+	}{
+		{"Uncached", pricing, Usage{PromptTokens: 1_000_000, CompletionTokens: 500_000}, 6},
+		{"Cached", pricing, Usage{PromptTokens: 1_000_000, CachedTokens: 600_000}, 0.8 + 0.3},
+		{"No cached rate", ModelPricing{InputPerMillion: 2}, Usage{PromptTokens: 1_000_000, CachedTokens: 600_000}, 2},
+		{"Cache write", pricing, Usage{PromptTokens: 1_000_000, CachedTokens: 600_000, CacheCreationTokens: 200_000}, 0.4 + 0.3 + 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.pricing.Cost(tt.usage); math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("Expected $%f, got $%f", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestPricingTable_Lookup(t *testing.T) {
+	table := KnownPricing.WithOverrides(PricingTable{
+		"My-Local":    {InputPerMillion: 0.1},
+		"gpt-4o-mini": {InputPerMillion: 9},
+	})
+
+	tests := []struct {
+		model    string
+		found    bool
+		expected float64
+	}{
+		{"gpt-4o-mini-2024-07-18", true, 9},
+		{"openai/gpt-4o-2024-08-06", true, 2.5},
+		{"my-local-7b", true, 0.1},
+		{"unknown-model", false, 0},
+	}
+
+	for _, tt := range tests {
+		pricing, ok := table.Lookup(tt.model)
+		if ok != tt.found || pricing.InputPerMillion != tt.expected {
+			t.Errorf("%s: expected (%v, %v), got (%v, %v)", tt.model, tt.expected, tt.found, pricing.InputPerMillion, ok)
+		}
+	}
+
+	if KnownPricing["gpt-4o-mini"].InputPerMillion != 0.15 {
+		t.Error("Expected overrides to leave KnownPricing unchanged")
+	}
+}
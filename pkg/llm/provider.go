@@ -39,6 +39,19 @@ type Provider interface {
 	SupportsModelListing() bool
 }
 
+// ModelEndpointer is implemented by providers whose URL names the model and
+// differs for streaming requests (e.g. Gemini). The client prefers it over
+// Endpoint.
+type ModelEndpointer interface {
+	ModelEndpoint(baseURL, model string, stream bool) string
+}
+
+// ToolCallStreamer is implemented by providers that stream tool call
+// arguments in pieces and can report them while the call is generated
+type ToolCallStreamer interface {
+	ParseSSEStreamWithToolCalls(body io.Reader, callback StreamingCallback, onToolCall ToolCallCallback) (*ChatResponse, error)
+}
+
 // IsSetupToken returns true if the API key looks like an Anthropic setup/OAuth
 // token (sk-ant-oat01-*) which cannot be used directly with the Messages API.
 func IsSetupToken(apiKey string) bool {
@@ -66,6 +79,14 @@ func DetectProvider(providerName, modelName, apiKey string) Provider {
 		return &AnthropicProvider{}
 	case "openai":
 		return &OpenAIProvider{}
+	case "responses":
+		return &ResponsesProvider{}
+	case "gemini", "google":
+		return &GeminiProvider{}
+	case "ollama":
+		return &OllamaProvider{}
+	case "mock":
+		return NewMockProvider(nil)
 	}
 
 	// Auto-detect by model name
@@ -73,6 +94,9 @@ func DetectProvider(providerName, modelName, apiKey string) Provider {
 	if strings.HasPrefix(lowerModel, "claude") {
 		return &AnthropicProvider{}
 	}
+	if strings.HasPrefix(lowerModel, "gemini") {
+		return &GeminiProvider{}
+	}
 
 	// Auto-detect by API key prefix
 	if strings.HasPrefix(apiKey, "sk-ant-") {
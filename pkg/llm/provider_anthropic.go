@@ -13,10 +13,15 @@ import (
 	"time"
 
 	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/traces"
 )
 
 const anthropicAPIVersion = "2023-06-01"
 const anthropicDefaultMaxTokens = 4096
+
+// anthropicMaxCacheBreakpoints is how many cache_control markers a request may carry
+const anthropicMaxCacheBreakpoints = 4
+
 const claudeCodeSystemPrefix = "You are Claude Code, Anthropic's official CLI for Claude."
 const claudeCodeVersion = "2.1.2"
 
@@ -107,6 +112,7 @@ func (p *AnthropicProvider) RefreshIfNeeded() {
 	p.mu.Lock()
 	p.oauth = newCreds
 	p.mu.Unlock()
+	traces.AddSecrets(newCreds.AccessToken, newCreds.RefreshToken)
 
 	if err := config.SaveOAuth(newCreds); err != nil {
 		log.Printf("[WARN] Failed to save refreshed OAuth credentials: %v", err)
@@ -152,11 +158,17 @@ type anthropicRequest struct {
 	Temperature *float64               `json:"temperature,omitempty"`
 	TopP        *float64               `json:"top_p,omitempty"`
 	Tools       []anthropicTool        `json:"tools,omitempty"`
+	ToolChoice  *anthropicToolChoice   `json:"tool_choice,omitempty"`
 	Stream      bool                   `json:"stream,omitempty"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
 	Thinking    *anthropicThinking     `json:"thinking,omitempty"`
 }
 
+type anthropicToolChoice struct {
+	Type string `json:"type"` // "auto", "any" or "tool"
+	Name string `json:"name,omitempty"`
+}
+
 type anthropicThinking struct {
 	Type         string `json:"type"`
 	BudgetTokens int    `json:"budget_tokens"`
@@ -178,27 +190,43 @@ type anthropicMessage struct {
 }
 
 type anthropicTextBlock struct {
-	Type string `json:"type"` // "text"
-	Text string `json:"text"`
+	Type         string                 `json:"type"` // "text"
+	Text         string                 `json:"text"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
 }
 
 type anthropicToolUseBlock struct {
-	Type  string      `json:"type"` // "tool_use"
-	ID    string      `json:"id"`
-	Name  string      `json:"name"`
-	Input interface{} `json:"input"`
+	Type         string                 `json:"type"` // "tool_use"
+	ID           string                 `json:"id"`
+	Name         string                 `json:"name"`
+	Input        interface{}            `json:"input"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
 }
 
 type anthropicToolResultBlock struct {
-	Type      string `json:"type"` // "tool_result"
-	ToolUseID string `json:"tool_use_id"`
-	Content   string `json:"content"`
+	Type         string                 `json:"type"` // "tool_result"
+	ToolUseID    string                 `json:"tool_use_id"`
+	Content      interface{}            `json:"content"` // Text, or text and image blocks
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicImageBlock struct {
+	Type         string                 `json:"type"` // "image"
+	Source       anthropicImageSource   `json:"source"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
+}
+
+type anthropicImageSource struct {
+	Type      string `json:"type"` // "base64"
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
 }
 
 type anthropicTool struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	InputSchema interface{} `json:"input_schema"`
+	Name         string                 `json:"name"`
+	Description  string                 `json:"description"`
+	InputSchema  interface{}            `json:"input_schema"`
+	CacheControl *anthropicCacheControl `json:"cache_control,omitempty"`
 }
 
 // --- Anthropic response types ---
@@ -223,8 +251,23 @@ type anthropicContentItem struct {
 }
 
 type anthropicUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
+	InputTokens              int `json:"input_tokens"` // Uncached input only
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// toUsage converts Anthropic usage, which counts cached input separately, to
+// canonical usage where PromptTokens covers all input
+func (u anthropicUsage) toUsage() Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return Usage{
+		PromptTokens:        prompt,
+		CompletionTokens:    u.OutputTokens,
+		TotalTokens:         prompt + u.OutputTokens,
+		CachedTokens:        u.CacheReadInputTokens,
+		CacheCreationTokens: u.CacheCreationInputTokens,
+	}
 }
 
 type anthropicError struct {
@@ -265,9 +308,7 @@ type anthropicSSEMessageDelta struct {
 	Delta struct {
 		StopReason string `json:"stop_reason"`
 	} `json:"delta"`
-	Usage struct {
-		OutputTokens int `json:"output_tokens"`
-	} `json:"usage"`
+	Usage anthropicUsage `json:"usage"`
 }
 
 // --- Provider interface implementation ---
@@ -308,6 +349,22 @@ func fromOAuthToolName(name string, tools []ToolDefinition) string {
 }
 
 func (p *AnthropicProvider) BuildRequestBody(model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, stream bool) ([]byte, error) {
+	return json.Marshal(p.buildRequest(model, messages, tools, temperature, topP, maxTokens, stream, true))
+}
+
+// BuildStructuredRequestBody forces a call to a tool whose input schema is
+// the requested one, so the reply arrives as the call's arguments
+func (p *AnthropicProvider) BuildStructuredRequestBody(model string, messages []Message, schema ResponseSchema, temperature *float64, maxTokens *int) ([]byte, error) {
+	tool := ToolDefinition{Type: "function", Function: FunctionSchema{Name: schema.Name, Description: schema.Description, Parameters: schema.Schema}}
+	// Extended thinking cannot be combined with a forced tool choice
+	req := p.buildRequest(model, messages, []ToolDefinition{tool}, temperature, nil, maxTokens, false, false)
+	req.ToolChoice = &anthropicToolChoice{Type: "tool", Name: req.Tools[0].Name}
+	return json.Marshal(req)
+}
+
+// buildRequest converts a canonical request to Anthropic's format. thinking
+// allows extended thinking when a reasoning effort is set.
+func (p *AnthropicProvider) buildRequest(model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, stream bool, thinking bool) anthropicRequest {
 	oauthActive := p.isOAuthActive()
 
 	// Extract and concatenate system messages
@@ -333,27 +390,19 @@ func (p *AnthropicProvider) BuildRequestBody(model string, messages []Message, t
 		mt = *maxTokens
 	}
 
-	// Build system field: array format for OAuth (with cache_control), string otherwise
-	var systemField interface{}
+	// Build system field as blocks so the last one can carry a cache breakpoint
+	var systemBlocks []anthropicSystemBlock
 	if oauthActive {
 		// OAuth: must include Claude Code identity as first system block
-		blocks := []anthropicSystemBlock{
-			{
-				Type: "text",
-				Text: claudeCodeSystemPrefix,
-				CacheControl: &anthropicCacheControl{Type: "ephemeral"},
-			},
-		}
-		if systemPrompt != "" {
-			blocks = append(blocks, anthropicSystemBlock{
-				Type: "text",
-				Text: systemPrompt,
-				CacheControl: &anthropicCacheControl{Type: "ephemeral"},
-			})
-		}
-		systemField = blocks
-	} else if systemPrompt != "" {
-		systemField = systemPrompt
+		systemBlocks = append(systemBlocks, anthropicSystemBlock{Type: "text", Text: claudeCodeSystemPrefix})
+	}
+	if systemPrompt != "" {
+		systemBlocks = append(systemBlocks, anthropicSystemBlock{Type: "text", Text: systemPrompt})
+	}
+	var systemField interface{}
+	if len(systemBlocks) > 0 {
+		systemBlocks[len(systemBlocks)-1].CacheControl = &anthropicCacheControl{Type: "ephemeral"}
+		systemField = systemBlocks
 	}
 
 	req := anthropicRequest{
@@ -367,7 +416,7 @@ func (p *AnthropicProvider) BuildRequestBody(model string, messages []Message, t
 	}
 
 	// Extended thinking: add thinking config if effort is set (matches opencode logic)
-	if p.reasoningEffort != "" && p.reasoningEffort != "off" {
+	if thinking && p.reasoningEffort != "" && p.reasoningEffort != "off" {
 		if budget, ok := anthropicThinkingBudgets[p.reasoningEffort]; ok {
 			// maxTokens = base + thinkingBudget, capped at model max (128K for Claude)
 			const modelMaxTokens = 128000
@@ -411,9 +460,55 @@ func (p *AnthropicProvider) BuildRequestBody(model string, messages []Message, t
 				InputSchema: t.Function.Parameters,
 			})
 		}
+		// Tools come first in the cached prefix; cache them on their own so
+		// a changed system prompt does not invalidate them
+		req.Tools[len(req.Tools)-1].CacheControl = &anthropicCacheControl{Type: "ephemeral"}
 	}
 
-	return json.Marshal(req)
+	// Rolling history breakpoints: the most recent user turns get the
+	// markers left of anthropicMaxCacheBreakpoints after the tools and system
+	// prompt (up to four without either), so each request reads the prefix
+	// the previous one wrote
+	breakpoints := anthropicMaxCacheBreakpoints
+	if len(req.Tools) > 0 {
+		breakpoints--
+	}
+	if systemField != nil {
+		breakpoints--
+	}
+	for i := len(req.Messages) - 1; i >= 0 && breakpoints > 0; i-- {
+		if req.Messages[i].Role == "user" && markCacheBreakpoint(req.Messages[i].Content) {
+			breakpoints--
+		}
+	}
+
+	return req
+}
+
+// markCacheBreakpoint sets cache_control on the last block of a message's
+// content, reporting whether it could
+func markCacheBreakpoint(content []interface{}) bool {
+	if len(content) == 0 {
+		return false
+	}
+	ephemeral := &anthropicCacheControl{Type: "ephemeral"}
+	switch block := content[len(content)-1].(type) {
+	case anthropicTextBlock:
+		block.CacheControl = ephemeral
+		content[len(content)-1] = block
+	case anthropicToolUseBlock:
+		block.CacheControl = ephemeral
+		content[len(content)-1] = block
+	case anthropicToolResultBlock:
+		block.CacheControl = ephemeral
+		content[len(content)-1] = block
+	case anthropicImageBlock:
+		block.CacheControl = ephemeral
+		content[len(content)-1] = block
+	default:
+		return false
+	}
+	return true
 }
 
 // convertToAnthropicMessages translates canonical messages to Anthropic format,
@@ -447,11 +542,19 @@ func convertToAnthropicMessages(messages []Message) []anthropicMessage {
 
 		case msg.Role == "tool":
 			// Tool result -> user message with tool_result content block
-			content = append(content, anthropicToolResultBlock{
+			block := anthropicToolResultBlock{
 				Type:      "tool_result",
 				ToolUseID: msg.ToolCallID,
 				Content:   msg.Content,
-			})
+			}
+			if len(msg.Parts) > 0 {
+				block.Content = anthropicContentBlocks(msg.Parts)
+			}
+			content = append(content, block)
+
+		case len(msg.Parts) > 0:
+			// Multimodal message -> text and image content blocks
+			content = anthropicContentBlocks(msg.Parts)
 
 		default:
 			// Regular text message
@@ -484,6 +587,22 @@ func convertToAnthropicMessages(messages []Message) []anthropicMessage {
 	return result
 }
 
+// anthropicContentBlocks converts content parts to text and image blocks
+func anthropicContentBlocks(parts []ContentPart) []interface{} {
+	blocks := make([]interface{}, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "image" {
+			blocks = append(blocks, anthropicImageBlock{
+				Type:   "image",
+				Source: anthropicImageSource{Type: "base64", MediaType: part.MediaType, Data: part.Data},
+			})
+		} else if part.Text != "" {
+			blocks = append(blocks, anthropicTextBlock{Type: "text", Text: part.Text})
+		}
+	}
+	return blocks
+}
+
 func (p *AnthropicProvider) ParseResponseBody(body []byte) (*ChatResponse, error) {
 	// Check top-level "type" field to distinguish error from success
 	var resp anthropicResponse
@@ -557,11 +676,7 @@ func (p *AnthropicProvider) convertResponse(resp *anthropicResponse) *ChatRespon
 				FinishReason: finishReason,
 			},
 		},
-		Usage: Usage{
-			PromptTokens:     resp.Usage.InputTokens,
-			CompletionTokens: resp.Usage.OutputTokens,
-			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
-		},
+		Usage: resp.Usage.toUsage(),
 	}
 }
 
@@ -583,6 +698,12 @@ func mapStopReason(stopReason string) string {
 func (p *AnthropicProvider) ParseRateLimits(h http.Header) RateLimits {
 	rl := RateLimits{}
 	// Anthropic uses anthropic-ratelimit-* headers
+	if v, err := strconv.Atoi(h.Get("anthropic-ratelimit-requests-limit")); err == nil {
+		rl.LimitRequests = v
+	}
+	if v, err := strconv.Atoi(h.Get("anthropic-ratelimit-tokens-limit")); err == nil {
+		rl.LimitTokens = v
+	}
 	if v := h.Get("anthropic-ratelimit-requests-remaining"); v != "" {
 		if val, err := strconv.Atoi(v); err == nil {
 			rl.RemainingRequests = val
@@ -607,6 +728,12 @@ func (p *AnthropicProvider) ParseRateLimits(h http.Header) RateLimits {
 }
 
 func (p *AnthropicProvider) ParseSSEStream(body io.Reader, callback StreamingCallback) (*ChatResponse, error) {
+	return p.ParseSSEStreamWithToolCalls(body, callback, nil)
+}
+
+// ParseSSEStreamWithToolCalls is like ParseSSEStream and also reports each
+// input_json_delta of a tool_use block to onToolCall
+func (p *AnthropicProvider) ParseSSEStreamWithToolCalls(body io.Reader, callback StreamingCallback, onToolCall ToolCallCallback) (*ChatResponse, error) {
 	oauthActive := p.isOAuthActive()
 	p.mu.Lock()
 	tools := p.lastTools
@@ -617,7 +744,7 @@ func (p *AnthropicProvider) ParseSSEStream(body io.Reader, callback StreamingCal
 	var toolCalls []ToolCall
 	blockToToolIndex := make(map[int]int) // maps Anthropic block index -> toolCalls slice index
 	var messageID, model string
-	var inputTokens, outputTokens int
+	var usage anthropicUsage
 	var stopReason string
 
 	for {
@@ -670,7 +797,7 @@ func (p *AnthropicProvider) ParseSSEStream(body io.Reader, callback StreamingCal
 				}
 				messageID = evt.Message.ID
 				model = evt.Message.Model
-				inputTokens = evt.Message.Usage.InputTokens
+				usage = evt.Message.Usage
 
 			case "content_block_start":
 				var evt anthropicSSEContentBlockStart
@@ -709,7 +836,11 @@ func (p *AnthropicProvider) ParseSSEStream(body io.Reader, callback StreamingCal
 				case "input_json_delta":
 					// Accumulate tool call arguments using block index mapping
 					if idx, ok := blockToToolIndex[evt.Index]; ok && idx < len(toolCalls) {
-						toolCalls[idx].Function.Arguments += evt.Delta.PartialJSON
+						tc := &toolCalls[idx]
+						tc.Function.Arguments += evt.Delta.PartialJSON
+						if onToolCall != nil {
+							onToolCall(ToolCallDelta{Index: idx, ID: tc.ID, Name: tc.Function.Name, Arguments: tc.Function.Arguments})
+						}
 					}
 				}
 
@@ -723,7 +854,7 @@ func (p *AnthropicProvider) ParseSSEStream(body io.Reader, callback StreamingCal
 					continue
 				}
 				stopReason = evt.Delta.StopReason
-				outputTokens = evt.Usage.OutputTokens
+				usage.OutputTokens = evt.Usage.OutputTokens
 
 			case "message_stop":
 				if callback != nil {
@@ -764,11 +895,7 @@ func (p *AnthropicProvider) ParseSSEStream(body io.Reader, callback StreamingCal
 				FinishReason: finishReason,
 			},
 		},
-		Usage: Usage{
-			PromptTokens:     inputTokens,
-			CompletionTokens: outputTokens,
-			TotalTokens:      inputTokens + outputTokens,
-		},
+		Usage: usage.toUsage(),
 	}, nil
 }
 
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicProvider_CacheBreakpoints(t *testing.T) {
+	tools := []ToolDefinition{
+		{Type: "function", Function: FunctionSchema{Name: "read_file", Parameters: map[string]any{"type": "object"}}},
+		{Type: "function", Function: FunctionSchema{Name: "list_files", Parameters: map[string]any{"type": "object"}}},
+	}
+	messages := []Message{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "ok"},
+		{Role: "user", Content: "second"},
+		{Role: "assistant", ToolCalls: []ToolCall{{ID: "call_1", Type: "function", Function: FunctionCall{Name: "read_file", Arguments: "{}"}}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "contents"},
+	}
+
+	tests := []struct {
+		name     string
+		tools    []ToolDefinition
+		messages []Message
+		expected []string
+	}{
+		{"tools, system and two user turns", tools, messages, []string{"tool:list_files", "system", "message:2", "message:4"}},
+		{"no tools leaves room for history", nil, messages, []string{"system", "message:0", "message:2", "message:4"}},
+		{"single turn", nil, messages[:2], []string{"system", "message:0"}},
+	}
+
+	for _, tt := range tests {
+		body, err := (&AnthropicProvider{}).BuildRequestBody("claude-sonnet-4", tt.messages, tt.tools, nil, nil, nil, false)
+		if err != nil {
+			t.Fatalf("%s: build failed: %v", tt.name, err)
+		}
+		var req struct {
+			System []struct {
+				CacheControl *anthropicCacheControl `json:"cache_control"`
+			} `json:"system"`
+			Tools []struct {
+				Name         string                 `json:"name"`
+				CacheControl *anthropicCacheControl `json:"cache_control"`
+			} `json:"tools"`
+			Messages []struct {
+				Content []struct {
+					CacheControl *anthropicCacheControl `json:"cache_control"`
+				} `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("%s: unmarshal failed: %v", tt.name, err)
+		}
+
+		var got []string
+		for _, tool := range req.Tools {
+			if tool.CacheControl != nil {
+				got = append(got, "tool:"+tool.Name)
+			}
+		}
+		for _, block := range req.System {
+			if block.CacheControl != nil {
+				got = append(got, "system")
+			}
+		}
+		for i, msg := range req.Messages {
+			for j, block := range msg.Content {
+				if block.CacheControl != nil {
+					if j != len(msg.Content)-1 {
+						t.Errorf("%s: expected the breakpoint on the last block of message %d", tt.name, i)
+					}
+					got = append(got, fmt.Sprintf("message:%d", i))
+				}
+			}
+		}
+		if len(got) > anthropicMaxCacheBreakpoints || strings.Join(got, ",") != strings.Join(tt.expected, ",") {
+			t.Errorf("%s: expected breakpoints %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestAnthropicProvider_CacheUsage(t *testing.T) {
+	p := &AnthropicProvider{}
+	want := Usage{PromptTokens: 1300, CompletionTokens: 50, TotalTokens: 1350, CachedTokens: 1000, CacheCreationTokens: 200}
+
+	resp, err := p.ParseResponseBody([]byte(`{"id":"msg_1","type":"message","role":"assistant","content":[{"type":"text","text":"hi"}],
+		"stop_reason":"end_turn","usage":{"input_tokens":100,"output_tokens":50,"cache_creation_input_tokens":200,"cache_read_input_tokens":1000}}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if resp.Usage != want {
+		t.Errorf("Expected usage %+v, got %+v", want, resp.Usage)
+	}
+
+	stream := "event: message_start\n" +
+		`data: {"type":"message_start","message":{"id":"msg_2","usage":{"input_tokens":100,"output_tokens":1,"cache_creation_input_tokens":200,"cache_read_input_tokens":1000}}}` + "\n\n" +
+		"event: content_block_delta\n" +
+		`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hi"}}` + "\n\n" +
+		"event: message_delta\n" +
+		`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":50}}` + "\n\n"
+	resp, err = p.ParseSSEStream(strings.NewReader(stream), nil)
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if resp.Usage != want || resp.Usage.CacheHitRatio() < 0.76 {
+		t.Errorf("Expected streamed usage %+v, got %+v", want, resp.Usage)
+	}
+}
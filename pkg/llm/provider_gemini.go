@@ -0,0 +1,704 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/traces"
+)
+
+// geminiDefaultBaseURL is the Generative Language API used with API keys
+const geminiDefaultBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+// geminiToolCallPrefix marks tool call IDs generated for Gemini function calls,
+// which carry no IDs of their own
+const geminiToolCallPrefix = "call_gemini_"
+
+// geminiThinkingBudgets maps effort levels to thinkingBudget tokens.
+var geminiThinkingBudgets = map[string]int{
+	"minimal": 512,
+	"low":     2048,
+	"medium":  8192,
+	"high":    16384,
+	"xhigh":   24576,
+}
+
+// geminiHarmCategories are the categories a safety threshold applies to.
+var geminiHarmCategories = []string{
+	"HARM_CATEGORY_HARASSMENT",
+	"HARM_CATEGORY_HATE_SPEECH",
+	"HARM_CATEGORY_SEXUALLY_EXPLICIT",
+	"HARM_CATEGORY_DANGEROUS_CONTENT",
+}
+
+// geminiUnsupportedSchemaKeys are JSON Schema keywords the Gemini function
+// declaration schema rejects.
+var geminiUnsupportedSchemaKeys = []string{"$schema", "$id", "additionalProperties", "examples"}
+
+// GeminiProvider implements the Provider interface for the native Gemini
+// generateContent API. With an API key it talks to the Generative Language
+// API; with Google OAuth credentials that carry a Cloud Code Assist project it
+// talks to the Code Assist endpoint, which wraps the same request format.
+type GeminiProvider struct {
+	mu              sync.Mutex
+	oauth           *config.OAuthCredentials
+	reasoningEffort string            // Mapped to a thinking budget
+	safetyThreshold string            // e.g. "BLOCK_ONLY_HIGH"; empty keeps the API defaults
+	signatures      map[string]string // Thought signatures of recent function calls, by tool call ID
+	signatureOrder  []string          // Tool call IDs in signatures, oldest first
+	callSeq         int
+}
+
+func (p *GeminiProvider) Name() string { return "gemini" }
+
+// SetOAuth sets Google OAuth credentials.
+func (p *GeminiProvider) SetOAuth(creds *config.OAuthCredentials) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.oauth = creds
+}
+
+// GetOAuth returns the current OAuth credentials.
+func (p *GeminiProvider) GetOAuth() *config.OAuthCredentials {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.oauth
+}
+
+// SetReasoningEffort sets the reasoning effort level.
+func (p *GeminiProvider) SetReasoningEffort(effort string) { p.reasoningEffort = effort }
+
+// GetReasoningEffort returns the current reasoning effort level.
+func (p *GeminiProvider) GetReasoningEffort() string { return p.reasoningEffort }
+
+// SetSafetyThreshold applies threshold (e.g. "BLOCK_NONE", "BLOCK_ONLY_HIGH")
+// to every harm category. An empty threshold keeps the API defaults.
+func (p *GeminiProvider) SetSafetyThreshold(threshold string) {
+	p.safetyThreshold = strings.ToUpper(strings.TrimSpace(threshold))
+}
+
+// RefreshIfNeeded refreshes the Google OAuth token if it's close to expiry.
+func (p *GeminiProvider) RefreshIfNeeded() {
+	p.mu.Lock()
+	oauth := p.oauth
+	p.mu.Unlock()
+
+	if oauth == nil || oauth.RefreshToken == "" || !oauth.NeedsRefresh() {
+		return
+	}
+	newCreds, err := RefreshGoogleToken(oauth.RefreshToken)
+	if err != nil {
+		log.Printf("[WARN] Google OAuth token refresh failed: %v, using existing token", err)
+		return
+	}
+	newCreds.ProjectID = oauth.ProjectID // preserve projectID
+
+	p.mu.Lock()
+	p.oauth = newCreds
+	p.mu.Unlock()
+	traces.AddSecrets(newCreds.AccessToken, newCreds.RefreshToken)
+
+	if err := config.SaveOAuth(newCreds); err != nil {
+		log.Printf("[WARN] Failed to save refreshed OAuth credentials: %v", err)
+	}
+}
+
+// codeAssistProject returns the Code Assist project when OAuth is active, or ""
+func (p *GeminiProvider) codeAssistProject() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth == nil || p.oauth.AccessToken == "" || p.oauth.IsExpired() {
+		return ""
+	}
+	return p.oauth.ProjectID
+}
+
+// Endpoint returns the non-streaming endpoint of the default model. Requests
+// go through ModelEndpoint, since the Gemini URL names the model.
+func (p *GeminiProvider) Endpoint(baseURL string) string {
+	return p.ModelEndpoint(baseURL, "gemini-2.5-flash", false)
+}
+
+// ModelEndpoint returns the generateContent or streamGenerateContent URL for model.
+func (p *GeminiProvider) ModelEndpoint(baseURL, model string, stream bool) string {
+	method := "generateContent"
+	if stream {
+		method = "streamGenerateContent?alt=sse"
+	}
+	if p.codeAssistProject() != "" {
+		return GoogleCodeAssistAPI + "/v1internal:" + method
+	}
+	return geminiBaseURL(baseURL) + "/models/" + strings.TrimPrefix(model, "models/") + ":" + method
+}
+
+// geminiBaseURL maps the configured base URL to the native API. The OpenAI
+// default and the OpenAI-compatible shim URL are replaced so that switching a
+// gemini-* model to this provider keeps working.
+func geminiBaseURL(baseURL string) string {
+	baseURL = strings.TrimRight(baseURL, "/")
+	if baseURL == "" || strings.Contains(baseURL, "api.openai.com") {
+		return geminiDefaultBaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/openai")
+}
+
+func (p *GeminiProvider) SetHeaders(req *http.Request, apiKey string) {
+	req.Header.Set("Content-Type", "application/json")
+
+	p.mu.Lock()
+	oauth := p.oauth
+	p.mu.Unlock()
+
+	if oauth != nil && oauth.AccessToken != "" && !oauth.IsExpired() {
+		req.Header.Set("Authorization", "Bearer "+oauth.AccessToken)
+		if oauth.ProjectID != "" {
+			req.Header.Set("x-goog-user-project", oauth.ProjectID)
+		}
+		return
+	}
+	req.Header.Set("x-goog-api-key", apiKey)
+}
+
+// --- Gemini request types ---
+
+type geminiRequest struct {
+	Contents          []geminiContent         `json:"contents"`
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool            `json:"tools,omitempty"`
+	ToolConfig        *geminiToolConfig       `json:"toolConfig,omitempty"`
+	SafetySettings    []geminiSafetySetting   `json:"safetySettings,omitempty"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+// geminiCodeAssistRequest wraps a request for the Code Assist endpoint
+type geminiCodeAssistRequest struct {
+	Model   string        `json:"model"`
+	Project string        `json:"project"`
+	Request geminiRequest `json:"request"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"` // "user" or "model"
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+	InlineData       *geminiInlineData       `json:"inlineData,omitempty"`
+}
+
+type geminiInlineData struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"` // Base64
+}
+
+type geminiFunctionCall struct {
+	Name string         `json:"name"`
+	Args map[string]any `json:"args"`
+}
+
+type geminiFunctionResponse struct {
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type geminiFunctionDeclaration struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type geminiToolConfig struct {
+	FunctionCallingConfig struct {
+		Mode string `json:"mode"`
+	} `json:"functionCallingConfig"`
+}
+
+type geminiSafetySetting struct {
+	Category  string `json:"category"`
+	Threshold string `json:"threshold"`
+}
+
+type geminiGenerationConfig struct {
+	Temperature     *float64              `json:"temperature,omitempty"`
+	TopP            *float64              `json:"topP,omitempty"`
+	MaxOutputTokens *int                  `json:"maxOutputTokens,omitempty"`
+	ThinkingConfig  *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+type geminiThinkingConfig struct {
+	ThinkingBudget int `json:"thinkingBudget"`
+}
+
+// --- Gemini response types ---
+
+type geminiResponse struct {
+	Candidates     []geminiCandidate     `json:"candidates"`
+	UsageMetadata  *geminiUsageMetadata  `json:"usageMetadata,omitempty"`
+	PromptFeedback *geminiPromptFeedback `json:"promptFeedback,omitempty"`
+	ModelVersion   string                `json:"modelVersion,omitempty"`
+	ResponseID     string                `json:"responseId,omitempty"`
+	Error          *geminiError          `json:"error,omitempty"`
+}
+
+// geminiCodeAssistResponse wraps a response from the Code Assist endpoint
+type geminiCodeAssistResponse struct {
+	Response *geminiResponse `json:"response"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason,omitempty"`
+}
+
+type geminiUsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+}
+
+type geminiPromptFeedback struct {
+	BlockReason string `json:"blockReason,omitempty"`
+}
+
+type geminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// --- Provider interface implementation ---
+
+func (p *GeminiProvider) BuildRequestBody(model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, stream bool) ([]byte, error) {
+	// Extract and concatenate system messages into the system instruction
+	var systemParts []string
+	var chatMessages []Message
+	for _, msg := range messages {
+		if msg.Role == "system" {
+			if msg.Content != "" {
+				systemParts = append(systemParts, msg.Content)
+			}
+		} else {
+			chatMessages = append(chatMessages, msg)
+		}
+	}
+
+	req := geminiRequest{Contents: p.convertToGeminiContents(chatMessages)}
+	if len(systemParts) > 0 {
+		req.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: strings.Join(systemParts, "\n\n")}}}
+	}
+
+	if len(tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, 0, len(tools))
+		for _, t := range tools {
+			decls = append(decls, geminiFunctionDeclaration{
+				Name:        t.Function.Name,
+				Description: t.Function.Description,
+				Parameters:  geminiSchema(t.Function.Parameters),
+			})
+		}
+		req.Tools = []geminiTool{{FunctionDeclarations: decls}}
+		req.ToolConfig = &geminiToolConfig{}
+		req.ToolConfig.FunctionCallingConfig.Mode = "AUTO"
+	}
+
+	if p.safetyThreshold != "" {
+		for _, category := range geminiHarmCategories {
+			req.SafetySettings = append(req.SafetySettings, geminiSafetySetting{Category: category, Threshold: p.safetyThreshold})
+		}
+	}
+
+	gen := geminiGenerationConfig{Temperature: temperature, TopP: topP, MaxOutputTokens: maxTokens}
+	if budget, ok := geminiThinkingBudgets[p.reasoningEffort]; ok {
+		gen.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: budget}
+	}
+	if gen != (geminiGenerationConfig{}) {
+		req.GenerationConfig = &gen
+	}
+
+	if project := p.codeAssistProject(); project != "" {
+		return json.Marshal(geminiCodeAssistRequest{Model: strings.TrimPrefix(model, "models/"), Project: project, Request: req})
+	}
+	return json.Marshal(req)
+}
+
+// convertToGeminiContents translates canonical messages to Gemini contents:
+// assistant messages become "model" turns with functionCall parts, tool
+// results become functionResponse parts named after the call they answer, and
+// consecutive same-role turns are merged.
+func (p *GeminiProvider) convertToGeminiContents(messages []Message) []geminiContent {
+	callNames := make(map[string]string)
+	var contents []geminiContent
+
+	for _, msg := range messages {
+		var role string
+		var parts []geminiPart
+
+		switch msg.Role {
+		case "assistant":
+			role = "model"
+			if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				callNames[tc.ID] = tc.Function.Name
+				args := map[string]any{}
+				if tc.Function.Arguments != "" {
+					if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+						log.Printf("[WARN] Failed to parse tool call arguments for %s: %v", tc.Function.Name, err)
+					}
+				}
+				part := geminiPart{FunctionCall: &geminiFunctionCall{Name: tc.Function.Name, Args: args}}
+				part.ThoughtSignature = p.signature(tc.ID)
+				parts = append(parts, part)
+			}
+		case "tool":
+			role = "user"
+			name := callNames[msg.ToolCallID]
+			if name == "" {
+				name = "unknown"
+			}
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+				Name:     name,
+				Response: geminiToolResult(msg.Content),
+			}})
+			// Images the tool returned follow its result
+			for _, part := range msg.Parts {
+				if part.Type == "image" {
+					parts = append(parts, geminiImagePart(part))
+				}
+			}
+		default:
+			role = "user"
+			if len(msg.Parts) > 0 {
+				for _, part := range msg.Parts {
+					if part.Type == "image" {
+						parts = append(parts, geminiImagePart(part))
+					} else if part.Text != "" {
+						parts = append(parts, geminiPart{Text: part.Text})
+					}
+				}
+			} else if msg.Content != "" {
+				parts = append(parts, geminiPart{Text: msg.Content})
+			}
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			continue
+		}
+		contents = append(contents, geminiContent{Role: role, Parts: parts})
+	}
+
+	return contents
+}
+
+// maxGeminiSignatures caps the thought signatures kept. The provider is shared
+// by the main conversation, sub-agents, debates and background queries, so a
+// request never drops signatures it does not mention; only the oldest go.
+const maxGeminiSignatures = 2000
+
+// signature returns the thought signature recorded for a tool call, if any
+func (p *GeminiProvider) signature(id string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.signatures[id]
+}
+
+// rememberSignature records a tool call's thought signature, evicting the
+// oldest ones past maxGeminiSignatures. Callers must hold p.mu.
+func (p *GeminiProvider) rememberSignature(id, signature string) {
+	if p.signatures == nil {
+		p.signatures = make(map[string]string)
+	}
+	if _, ok := p.signatures[id]; !ok {
+		p.signatureOrder = append(p.signatureOrder, id)
+	}
+	p.signatures[id] = signature
+	for len(p.signatureOrder) > maxGeminiSignatures {
+		delete(p.signatures, p.signatureOrder[0])
+		p.signatureOrder = p.signatureOrder[1:]
+	}
+}
+
+// geminiImagePart sends an image part as inline data
+func geminiImagePart(part ContentPart) geminiPart {
+	return geminiPart{InlineData: &geminiInlineData{MimeType: part.MediaType, Data: part.Data}}
+}
+
+// geminiToolResult wraps a tool result as the JSON object functionResponse requires
+func geminiToolResult(content string) map[string]any {
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(content), &obj); err == nil && obj != nil {
+		return obj
+	}
+	return map[string]any{"result": content}
+}
+
+// geminiSchema converts a JSON Schema to the subset Gemini accepts by
+// dropping unsupported keywords at every level.
+func geminiSchema(schema any) any {
+	if schema == nil {
+		return nil
+	}
+	if _, ok := schema.(map[string]any); !ok {
+		// Normalise structs and typed maps to generic JSON values
+		data, err := json.Marshal(schema)
+		if err != nil {
+			return schema
+		}
+		var generic any
+		if err := json.Unmarshal(data, &generic); err != nil {
+			return schema
+		}
+		schema = generic
+	}
+
+	switch v := schema.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[key] = geminiSchema(value)
+		}
+		for _, key := range geminiUnsupportedSchemaKeys {
+			delete(out, key)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			out[i] = geminiSchema(value)
+		}
+		return out
+	}
+	return schema
+}
+
+func (p *GeminiProvider) ParseResponseBody(body []byte) (*ChatResponse, error) {
+	resp, err := unmarshalGeminiResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("Gemini API error (%s): %s", resp.Error.Status, resp.Error.Message)
+	}
+	if len(resp.Candidates) == 0 && resp.PromptFeedback != nil && resp.PromptFeedback.BlockReason != "" {
+		return nil, fmt.Errorf("Gemini blocked the prompt: %s", resp.PromptFeedback.BlockReason)
+	}
+
+	chatResp := &ChatResponse{
+		ID:      resp.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   resp.ModelVersion,
+		Usage:   geminiUsage(resp.UsageMetadata),
+	}
+
+	var content strings.Builder
+	var toolCalls []ToolCall
+	var finishReason string
+	if len(resp.Candidates) > 0 {
+		candidate := resp.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			p.appendPart(part, &content, &toolCalls)
+		}
+		finishReason = candidate.FinishReason
+	}
+
+	chatResp.Choices = []Choice{{
+		Index: 0,
+		Message: Message{
+			Role:      "assistant",
+			Content:   content.String(),
+			ToolCalls: toolCalls,
+		},
+		FinishReason: mapGeminiFinishReason(finishReason, len(toolCalls) > 0),
+	}}
+	return chatResp, nil
+}
+
+// appendPart adds a response part to the assembled content or tool calls.
+// Thought summaries are skipped; function calls get generated IDs and their
+// thought signatures are kept so the next request can send them back.
+// It returns the text added, if any.
+func (p *GeminiProvider) appendPart(part geminiPart, content *strings.Builder, toolCalls *[]ToolCall) string {
+	if part.Thought {
+		return ""
+	}
+	if part.FunctionCall != nil {
+		args, err := json.Marshal(part.FunctionCall.Args)
+		if err != nil || part.FunctionCall.Args == nil {
+			args = []byte("{}")
+		}
+
+		p.mu.Lock()
+		p.callSeq++
+		id := fmt.Sprintf("%s%d_%d", geminiToolCallPrefix, time.Now().UnixNano(), p.callSeq)
+		if part.ThoughtSignature != "" {
+			p.rememberSignature(id, part.ThoughtSignature)
+		}
+		p.mu.Unlock()
+
+		*toolCalls = append(*toolCalls, ToolCall{
+			ID:       id,
+			Type:     "function",
+			Function: FunctionCall{Name: part.FunctionCall.Name, Arguments: string(args)},
+		})
+		return ""
+	}
+	content.WriteString(part.Text)
+	return part.Text
+}
+
+// unmarshalGeminiResponse decodes a response, unwrapping Code Assist envelopes
+func unmarshalGeminiResponse(data []byte) (*geminiResponse, error) {
+	var wrapped geminiCodeAssistResponse
+	if err := json.Unmarshal(data, &wrapped); err == nil && wrapped.Response != nil {
+		return wrapped.Response, nil
+	}
+	var resp geminiResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Gemini response: %w", err)
+	}
+	return &resp, nil
+}
+
+// geminiUsage converts usage metadata. Thinking tokens are billed as output.
+func geminiUsage(meta *geminiUsageMetadata) Usage {
+	if meta == nil {
+		return Usage{}
+	}
+	usage := Usage{
+		PromptTokens:     meta.PromptTokenCount,
+		CompletionTokens: meta.CandidatesTokenCount + meta.ThoughtsTokenCount,
+		TotalTokens:      meta.TotalTokenCount,
+		CachedTokens:     meta.CachedContentTokenCount,
+		ReasoningTokens:  meta.ThoughtsTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage
+}
+
+func mapGeminiFinishReason(reason string, hasToolCalls bool) string {
+	switch reason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// ParseRateLimits returns no limits; Gemini does not report them in headers.
+func (p *GeminiProvider) ParseRateLimits(h http.Header) RateLimits {
+	return RateLimits{}
+}
+
+func (p *GeminiProvider) ParseSSEStream(body io.Reader, callback StreamingCallback) (*ChatResponse, error) {
+	reader := bufio.NewReader(body)
+
+	var fullContent strings.Builder
+	var toolCalls []ToolCall
+	var usage Usage
+	var responseID, model, finishReason string
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		eof := err == io.EOF
+
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "data: ") {
+			data := strings.TrimPrefix(line, "data: ")
+			chunk, parseErr := unmarshalGeminiResponse([]byte(data))
+			if parseErr != nil {
+				log.Printf("[WARN] Skipping malformed Gemini chunk: %v (data: %s)", parseErr, data)
+			} else {
+				if chunk.Error != nil {
+					return nil, fmt.Errorf("Gemini stream error (%s): %s", chunk.Error.Status, chunk.Error.Message)
+				}
+				if len(chunk.Candidates) == 0 && chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+					return nil, fmt.Errorf("Gemini blocked the prompt: %s", chunk.PromptFeedback.BlockReason)
+				}
+				if chunk.ResponseID != "" {
+					responseID = chunk.ResponseID
+				}
+				if chunk.ModelVersion != "" {
+					model = chunk.ModelVersion
+				}
+				// Usage metadata is cumulative; the last chunk has the totals
+				if chunk.UsageMetadata != nil {
+					usage = geminiUsage(chunk.UsageMetadata)
+				}
+				if len(chunk.Candidates) > 0 {
+					candidate := chunk.Candidates[0]
+					for _, part := range candidate.Content.Parts {
+						if text := p.appendPart(part, &fullContent, &toolCalls); text != "" && callback != nil {
+							callback(text, false)
+						}
+					}
+					if candidate.FinishReason != "" {
+						finishReason = candidate.FinishReason
+					}
+				}
+			}
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	if callback != nil {
+		callback("", true)
+	}
+
+	return &ChatResponse{
+		ID:      responseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []Choice{
+			{
+				Index: 0,
+				Message: Message{
+					Role:      "assistant",
+					Content:   fullContent.String(),
+					ToolCalls: toolCalls,
+				},
+				FinishReason: mapGeminiFinishReason(finishReason, len(toolCalls) > 0),
+			},
+		},
+		Usage: usage,
+	}, nil
+}
+
+func (p *GeminiProvider) SupportsModelListing() bool { return false }
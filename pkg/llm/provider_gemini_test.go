@@ -0,0 +1,215 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectProvider_Gemini(t *testing.T) {
+	tests := []struct {
+		provider, model string
+		want            string
+	}{
+		{"", "gemini-2.5-pro", "gemini"},
+		{"gemini", "anything", "gemini"},
+		{"google", "", "gemini"},
+		{"openai", "gemini-2.5-pro", "openai"},
+	}
+	for _, tt := range tests {
+		if got := DetectProvider(tt.provider, tt.model, "").Name(); got != tt.want {
+			t.Errorf("DetectProvider(%q, %q): expected %s, got %s", tt.provider, tt.model, tt.want, got)
+		}
+	}
+}
+
+func TestGeminiProvider_ToolRoundTrip(t *testing.T) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-goog-api-key") != "test-key" {
+			t.Errorf("Expected API key header, got %v", r.Header)
+		}
+		if r.URL.Path != "/models/gemini-2.5-flash:generateContent" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		requests = append(requests, body)
+
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[
+				{"text":"pondering","thought":true},
+				{"functionCall":{"name":"read_file","args":{"path":"main.go"}},"thoughtSignature":"sig-1"}
+			]},"finishReason":"STOP"}],
+			"usageMetadata":{"promptTokenCount":100,"candidatesTokenCount":10,"thoughtsTokenCount":5,"cachedContentTokenCount":40,"totalTokenCount":115},
+			"modelVersion":"gemini-2.5-flash"}`)
+			return
+		}
+		fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"It is a Go file."}]},"finishReason":"STOP"}]}`)
+	}))
+	defer server.Close()
+
+	client := NewClientWithProvider(server.URL, "test-key", "gemini-2.5-flash", "")
+	client.SetReasoningEffort("low")
+	client.SetSafetyThreshold("block_only_high")
+
+	tools := []ToolDefinition{{Type: "function", Function: FunctionSchema{
+		Name:        "read_file",
+		Description: "Read a file",
+		Parameters: map[string]any{
+			"type":                 "object",
+			"additionalProperties": false,
+			"properties":           map[string]any{"path": map[string]any{"type": "string"}},
+		},
+	}}}
+	messages := []Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "What is main.go?"},
+	}
+
+	resp, err := client.ChatWithTools(messages, tools, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	calls := client.GetToolCalls(resp)
+	if len(calls) != 1 || calls[0].Function.Name != "read_file" || calls[0].Function.Arguments != `{"path":"main.go"}` {
+		t.Fatalf("Expected a read_file call, got %+v", calls)
+	}
+	if client.GetContent(resp) != "" {
+		t.Errorf("Expected thoughts to be skipped, got '%s'", client.GetContent(resp))
+	}
+	if client.GetFinishReason(resp) != "tool_calls" {
+		t.Errorf("Expected finish reason tool_calls, got %s", client.GetFinishReason(resp))
+	}
+	want := Usage{PromptTokens: 100, CompletionTokens: 15, TotalTokens: 115, CachedTokens: 40, ReasoningTokens: 5}
+	if resp.Usage != want {
+		t.Errorf("Expected usage %+v, got %+v", want, resp.Usage)
+	}
+
+	first := requests[0]
+	if sys := fmt.Sprint(first["systemInstruction"]); !strings.Contains(sys, "Be brief.") {
+		t.Errorf("Expected system instruction, got %s", sys)
+	}
+	if gen := fmt.Sprint(first["generationConfig"]); !strings.Contains(gen, "thinkingBudget:2048") {
+		t.Errorf("Expected thinking budget, got %s", gen)
+	}
+	if safety, _ := first["safetySettings"].([]any); len(safety) != len(geminiHarmCategories) || !strings.Contains(fmt.Sprint(safety[0]), "BLOCK_ONLY_HIGH") {
+		t.Errorf("Expected safety settings, got %v", first["safetySettings"])
+	}
+	if decls := fmt.Sprint(first["tools"]); strings.Contains(decls, "additionalProperties") || !strings.Contains(decls, "read_file") {
+		t.Errorf("Expected a cleaned function declaration, got %s", decls)
+	}
+
+	messages = append(messages,
+		Message{Role: "assistant", ToolCalls: calls},
+		Message{Role: "tool", ToolCallID: calls[0].ID, Content: "package main"},
+	)
+	resp, err = client.ChatWithTools(messages, tools, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Follow-up failed: %v", err)
+	}
+	if got := client.GetContent(resp); got != "It is a Go file." {
+		t.Errorf("Expected final answer, got '%s'", got)
+	}
+
+	contents, _ := requests[1]["contents"].([]any)
+	if len(contents) != 3 {
+		t.Fatalf("Expected user, model and function response turns, got %v", contents)
+	}
+	call := fmt.Sprint(contents[1])
+	if !strings.Contains(call, "role:model") || !strings.Contains(call, "thoughtSignature:sig-1") {
+		t.Errorf("Expected the model turn to carry the thought signature, got %s", call)
+	}
+	if result := fmt.Sprint(contents[2]); !strings.Contains(result, "functionResponse:map[name:read_file response:map[result:package main]]") {
+		t.Errorf("Expected a named function response, got %s", result)
+	}
+}
+
+func TestGeminiProvider_InterleavedSignatures(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if strings.Contains(string(body), "functionResponse") {
+			fmt.Fprint(w, `{"candidates":[{"content":{"role":"model","parts":[{"text":"done"}]},"finishReason":"STOP"}]}`)
+			return
+		}
+		// Each conversation's first turn gets its own signed call
+		sig := "sig-main"
+		if strings.Contains(string(body), "background") {
+			sig = "sig-background"
+		}
+		fmt.Fprintf(w, `{"candidates":[{"content":{"role":"model","parts":[{"functionCall":{"name":"read_file","args":{}},"thoughtSignature":%q}]},"finishReason":"STOP"}]}`, sig)
+	}))
+	defer server.Close()
+
+	client := NewClientWithProvider(server.URL, "test-key", "gemini-2.5-flash", "")
+	start := func(prompt string) []Message {
+		messages := []Message{{Role: "user", Content: prompt}}
+		resp, err := client.ChatWithTools(messages, nil, nil, nil, nil)
+		if err != nil {
+			t.Fatalf("Chat failed: %v", err)
+		}
+		calls := client.GetToolCalls(resp)
+		return append(messages, Message{Role: "assistant", ToolCalls: calls}, Message{Role: "tool", ToolCallID: calls[0].ID, Content: "ok"})
+	}
+
+	primary := start("main task")
+	background := start("background insight")
+	// A query without tool calls must not forget either conversation's signatures
+	if _, err := client.ChatWithTools([]Message{{Role: "user", Content: "summarize"}}, nil, nil, nil, nil); err != nil {
+		t.Fatalf("Plain query failed: %v", err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		messages []Message
+		sig      string
+	}{
+		{"main", primary, "sig-main"},
+		{"background", background, "sig-background"},
+	} {
+		if _, err := client.ChatWithTools(tt.messages, nil, nil, nil, nil); err != nil {
+			t.Fatalf("%s follow-up failed: %v", tt.name, err)
+		}
+		if last := bodies[len(bodies)-1]; !strings.Contains(last, `"thoughtSignature":"`+tt.sig+`"`) {
+			t.Errorf("Expected the %s follow-up to carry %s, got %s", tt.name, tt.sig, last)
+		}
+	}
+}
+
+func TestGeminiProvider_Streaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-2.5-pro:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+			t.Errorf("Unexpected stream URL %s", r.URL)
+		}
+		io.WriteString(w, `data: {"candidates":[{"content":{"role":"model","parts":[{"text":"Hello"}]}}]}`+"\r\n\r\n")
+		io.WriteString(w, `data: {"candidates":[{"content":{"role":"model","parts":[{"text":", world"}]},"finishReason":"MAX_TOKENS"}],"usageMetadata":{"promptTokenCount":7,"candidatesTokenCount":3,"totalTokenCount":10}}`+"\r\n\r\n")
+	}))
+	defer server.Close()
+
+	client := NewClientWithProvider(server.URL+"/openai", "test-key", "gemini-2.5-pro", "gemini")
+
+	var chunks []string
+	resp, err := client.ChatWithStreaming([]Message{{Role: "user", Content: "hi"}}, nil, nil, nil, nil, func(chunk string, done bool) {
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if got := client.GetContent(resp); got != "Hello, world" || len(chunks) != 2 {
+		t.Errorf("Expected 'Hello, world' in 2 chunks, got '%s' in %v", got, chunks)
+	}
+	if client.GetFinishReason(resp) != "length" {
+		t.Errorf("Expected finish reason length, got %s", client.GetFinishReason(resp))
+	}
+	if resp.Usage.TotalTokens != 10 {
+		t.Errorf("Expected 10 total tokens, got %d", resp.Usage.TotalTokens)
+	}
+}
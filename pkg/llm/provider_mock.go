@@ -0,0 +1,362 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mockEndpoint is the URL mock requests are addressed to; they never leave the process
+const mockEndpoint = "mock://scenario/chat/completions"
+
+// defaultMockChunkSize is how many characters each simulated stream chunk carries
+const defaultMockChunkSize = 16
+
+// MockScenario scripts the answers of the mock provider. Rules are tried in
+// order against the last user message; the first match answers.
+type MockScenario struct {
+	Rules        []MockRule    `json:"rules" yaml:"rules"`
+	Fallback     *MockResponse `json:"fallback,omitempty" yaml:"fallback,omitempty"`             // Answer when no rule matches (default: echo the message)
+	LatencyMs    int           `json:"latency_ms,omitempty" yaml:"latency_ms,omitempty"`         // Delay before every answer
+	ChunkSize    int           `json:"chunk_size,omitempty" yaml:"chunk_size,omitempty"`         // Characters per streamed chunk (default 16)
+	ChunkDelayMs int           `json:"chunk_delay_ms,omitempty" yaml:"chunk_delay_ms,omitempty"` // Delay between streamed chunks
+}
+
+// MockRule answers conversations whose last user message matches Match.
+// Responses are played in order across the turn: the first answers the user
+// message, the second answers the tool results of the first, and so on. The
+// last response is repeated once the list is exhausted.
+type MockRule struct {
+	Match     string         `json:"match,omitempty" yaml:"match,omitempty"` // Regular expression; empty matches any message
+	Responses []MockResponse `json:"responses" yaml:"responses"`
+
+	re *regexp.Regexp
+}
+
+// MockResponse is one scripted model reply. Text may use {{input}} for the
+// last user message and {{tool_result}} for the last tool result.
+type MockResponse struct {
+	Text         string         `json:"text,omitempty" yaml:"text,omitempty"`
+	ToolCalls    []MockToolCall `json:"tool_calls,omitempty" yaml:"tool_calls,omitempty"`
+	FinishReason string         `json:"finish_reason,omitempty" yaml:"finish_reason,omitempty"` // Defaults to "tool_calls" or "stop"; "length" simulates truncation
+	Error        string         `json:"error,omitempty" yaml:"error,omitempty"`                 // Fail the request with this API error instead
+	Status       int            `json:"status,omitempty" yaml:"status,omitempty"`               // HTTP status for Error (default 500)
+}
+
+// MockToolCall is a scripted tool call
+type MockToolCall struct {
+	Name      string         `json:"name" yaml:"name"`
+	Arguments map[string]any `json:"arguments,omitempty" yaml:"arguments,omitempty"`
+}
+
+// DefaultMockScenario echoes every message back
+func DefaultMockScenario() *MockScenario {
+	return &MockScenario{}
+}
+
+// LoadMockScenario reads and validates a scenario file, YAML when it ends in
+// .yaml or .yml and JSON otherwise
+func LoadMockScenario(path string) (*MockScenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock scenario: %w", err)
+	}
+	var scenario MockScenario
+	unmarshal := json.Unmarshal
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		unmarshal = yaml.Unmarshal
+	}
+	if err := unmarshal(data, &scenario); err != nil {
+		return nil, fmt.Errorf("failed to parse mock scenario %s: %w", path, err)
+	}
+	if err := scenario.compile(); err != nil {
+		return nil, fmt.Errorf("invalid mock scenario %s: %w", path, err)
+	}
+	return &scenario, nil
+}
+
+// compile checks the rules and compiles their patterns
+func (s *MockScenario) compile() error {
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if len(rule.Responses) == 0 {
+			return fmt.Errorf("rule %d (%q) has no responses", i+1, rule.Match)
+		}
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return fmt.Errorf("rule %d: bad pattern: %w", i+1, err)
+		}
+		rule.re = re
+	}
+	return nil
+}
+
+// MockProvider answers from a scripted scenario without network access or an
+// API key. It speaks the OpenAI wire format to itself: requests built by
+// BuildRequestBody are served by RoundTrip, which the client installs as its
+// HTTP transport, so cassettes, retries and streaming behave as with a real
+// provider.
+type MockProvider struct {
+	OpenAIProvider
+	scenario *MockScenario
+}
+
+// NewMockProvider creates a mock provider. A nil scenario echoes messages back.
+func NewMockProvider(scenario *MockScenario) *MockProvider {
+	if scenario == nil {
+		scenario = DefaultMockScenario()
+	}
+	return &MockProvider{scenario: scenario}
+}
+
+func (p *MockProvider) Name() string { return "mock" }
+
+// SetScenario replaces the scenario the provider answers from
+func (p *MockProvider) SetScenario(scenario *MockScenario) {
+	p.scenario = scenario
+}
+
+func (p *MockProvider) Endpoint(baseURL string) string { return mockEndpoint }
+
+func (p *MockProvider) SetHeaders(req *http.Request, apiKey string) {
+	req.Header.Set("Content-Type", "application/json")
+}
+
+func (p *MockProvider) SupportsModelListing() bool { return false }
+
+// BuildStructuredRequestBody overrides the OpenAI json_schema format, which
+// scenarios cannot honour: the schema is asked for in the prompt, as for
+// providers without structured output, and the scripted reply must match it.
+func (p *MockProvider) BuildStructuredRequestBody(model string, messages []Message, schema ResponseSchema, temperature *float64, maxTokens *int) ([]byte, error) {
+	return p.BuildRequestBody(model, withSchemaPrompt(messages, schema), nil, temperature, nil, maxTokens, false)
+}
+
+// RoundTrip implements http.RoundTripper by answering from the scenario
+func (p *MockProvider) RoundTrip(req *http.Request) (*http.Response, error) {
+	var chatReq ChatRequest
+	if err := json.NewDecoder(req.Body).Decode(&chatReq); err != nil {
+		return nil, fmt.Errorf("mock provider: invalid request: %w", err)
+	}
+	req.Body.Close()
+
+	if err := sleepContext(req.Context(), p.scenario.LatencyMs); err != nil {
+		return nil, err
+	}
+
+	reply := p.reply(chatReq.Messages)
+	if reply.Error != "" {
+		status := reply.Status
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		body, _ := json.Marshal(map[string]any{"error": map[string]string{"message": reply.Error, "type": "mock_error"}})
+		return mockHTTPResponse(req, status, "application/json", io.NopCloser(bytes.NewReader(body))), nil
+	}
+
+	message := Message{Role: "assistant", Content: reply.Text}
+	for i, tc := range reply.ToolCalls {
+		args, err := json.Marshal(tc.Arguments)
+		if err != nil {
+			return nil, fmt.Errorf("mock provider: bad arguments for %s: %w", tc.Name, err)
+		}
+		if tc.Arguments == nil {
+			args = []byte("{}")
+		}
+		message.ToolCalls = append(message.ToolCalls, ToolCall{
+			ID:       fmt.Sprintf("call_mock_%d_%d", time.Now().UnixNano(), i),
+			Type:     "function",
+			Function: FunctionCall{Name: tc.Name, Arguments: string(args)},
+		})
+	}
+	finishReason := reply.FinishReason
+	if finishReason == "" {
+		finishReason = "stop"
+		if len(message.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+	}
+
+	usage := mockUsage(chatReq.Messages, message)
+	if chatReq.Stream {
+		if chatReq.StreamOptions == nil || !chatReq.StreamOptions.IncludeUsage {
+			usage = Usage{}
+		}
+		return mockHTTPResponse(req, http.StatusOK, "text/event-stream", p.stream(req.Context(), chatReq.Model, message, finishReason, usage)), nil
+	}
+
+	body, err := json.Marshal(ChatResponse{
+		ID:      fmt.Sprintf("mock-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   chatReq.Model,
+		Choices: []Choice{{Message: message, FinishReason: finishReason}},
+		Usage:   usage,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mock provider: %w", err)
+	}
+	return mockHTTPResponse(req, http.StatusOK, "application/json", io.NopCloser(bytes.NewReader(body))), nil
+}
+
+// reply picks the scripted response for a conversation
+func (p *MockProvider) reply(messages []Message) MockResponse {
+	input, toolResult := "", ""
+	step := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		msg := messages[i]
+		if msg.Role == "user" {
+			input = msg.Content
+			break
+		}
+		if msg.Role == "assistant" {
+			step++
+		}
+		if msg.Role == "tool" && toolResult == "" {
+			toolResult = msg.Content
+		}
+	}
+
+	var response MockResponse
+	matched := false
+	for _, rule := range p.scenario.Rules {
+		if rule.re != nil && rule.re.MatchString(input) {
+			if step >= len(rule.Responses) {
+				step = len(rule.Responses) - 1
+			}
+			response = rule.Responses[step]
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		switch {
+		case p.scenario.Fallback != nil:
+			response = *p.scenario.Fallback
+		default:
+			response = MockResponse{Text: "🤖 Mock reply: {{input}}"}
+		}
+	}
+
+	response.Text = strings.NewReplacer("{{input}}", input, "{{tool_result}}", toolResult).Replace(response.Text)
+	return response
+}
+
+// mockUsage estimates the usage of a reply from the character counts
+func mockUsage(messages []Message, reply Message) Usage {
+	promptChars := 0
+	for _, msg := range messages {
+		promptChars += len(msg.Content)
+	}
+	completionChars := len(reply.Content)
+	for _, tc := range reply.ToolCalls {
+		completionChars += len(tc.Function.Name) + len(tc.Function.Arguments)
+	}
+	usage := Usage{
+		PromptTokens:     promptChars/defaultCharsPerToken + 1,
+		CompletionTokens: completionChars/defaultCharsPerToken + 1,
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	return usage
+}
+
+// stream simulates an SSE stream of the message in small chunks, ending with
+// a usage chunk unless usage is empty
+func (p *MockProvider) stream(ctx context.Context, model string, message Message, finishReason string, usage Usage) io.ReadCloser {
+	chunkSize := p.scenario.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultMockChunkSize
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		send := func(delta StreamingDelta, finish string) error {
+			chunk, _ := json.Marshal(StreamingResponse{
+				ID:      "mock-stream",
+				Object:  "chat.completion.chunk",
+				Created: time.Now().Unix(),
+				Model:   model,
+				Choices: []StreamingChoice{{Delta: delta, FinishReason: finish}},
+			})
+			if _, err := fmt.Fprintf(pw, "data: %s\n\n", chunk); err != nil {
+				return err
+			}
+			return sleepContext(ctx, p.scenario.ChunkDelayMs)
+		}
+
+		err := func() error {
+			text := []rune(message.Content)
+			for start := 0; start < len(text); start += chunkSize {
+				end := min(start+chunkSize, len(text))
+				if err := send(StreamingDelta{Content: string(text[start:end])}, ""); err != nil {
+					return err
+				}
+			}
+			// Tool calls stream as a header chunk followed by argument fragments
+			for _, tc := range message.ToolCalls {
+				args := tc.Function.Arguments
+				header := tc
+				header.Function.Arguments = ""
+				if err := send(StreamingDelta{ToolCalls: []ToolCall{header}}, ""); err != nil {
+					return err
+				}
+				for start := 0; start < len(args); start += chunkSize {
+					end := min(start+chunkSize, len(args))
+					fragment := ToolCall{Function: FunctionCall{Arguments: args[start:end]}}
+					if err := send(StreamingDelta{ToolCalls: []ToolCall{fragment}}, ""); err != nil {
+						return err
+					}
+				}
+			}
+			if err := send(StreamingDelta{}, finishReason); err != nil {
+				return err
+			}
+			if usage.TotalTokens > 0 {
+				chunk, _ := json.Marshal(StreamingResponse{ID: "mock-stream", Object: "chat.completion.chunk", Model: model, Choices: []StreamingChoice{}, Usage: &usage})
+				if _, err := fmt.Fprintf(pw, "data: %s\n\n", chunk); err != nil {
+					return err
+				}
+			}
+			_, err := io.WriteString(pw, "data: [DONE]\n\n")
+			return err
+		}()
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// mockHTTPResponse wraps a body as an HTTP response to req
+func mockHTTPResponse(req *http.Request, status int, contentType string, body io.ReadCloser) *http.Response {
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       body,
+		Request:    req,
+	}
+}
+
+// sleepContext waits for ms milliseconds or until ctx is cancelled
+func sleepContext(ctx context.Context, ms int) error {
+	if ms <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(time.Duration(ms) * time.Millisecond):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
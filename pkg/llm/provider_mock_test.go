@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testScenario = `{
+  "chunk_size": 4,
+  "rules": [
+    {
+      "match": "(?i)list",
+      "responses": [
+        {"tool_calls": [{"name": "list_files", "arguments": {"path": "src"}}]},
+        {"text": "Found: {{tool_result}}"}
+      ]
+    },
+    {"match": "^fail", "responses": [{"error": "overloaded", "status": 400}]}
+  ]
+}`
+
+func newMockClient(t *testing.T) *Client {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	if err := os.WriteFile(path, []byte(testScenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+	scenario, err := LoadMockScenario(path)
+	if err != nil {
+		t.Fatalf("Failed to load scenario: %v", err)
+	}
+	client := NewClientWithProvider("", "", "mock-model", "mock")
+	client.SetMockScenario(scenario)
+	return client
+}
+
+func TestMockProvider_ToolLoop(t *testing.T) {
+	client := newMockClient(t)
+
+	messages := []Message{{Role: "user", Content: "Please LIST the files"}}
+	resp, err := client.Chat(messages, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	calls := client.GetToolCalls(resp)
+	if len(calls) != 1 || calls[0].Function.Name != "list_files" || calls[0].Function.Arguments != `{"path":"src"}` {
+		t.Fatalf("Expected a list_files call, got %+v", calls)
+	}
+	if client.GetFinishReason(resp) != "tool_calls" || resp.Usage.TotalTokens == 0 {
+		t.Errorf("Expected finish reason tool_calls with usage, got %q / %+v", client.GetFinishReason(resp), resp.Usage)
+	}
+
+	messages = append(messages,
+		Message{Role: "assistant", ToolCalls: calls},
+		Message{Role: "tool", ToolCallID: calls[0].ID, Content: "main.go"},
+	)
+	resp, err = client.Chat(messages, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Follow-up failed: %v", err)
+	}
+	if got := client.GetContent(resp); got != "Found: main.go" {
+		t.Errorf("Expected 'Found: main.go', got '%s'", got)
+	}
+
+	if answer, _ := client.SimpleQuery("hello", nil, nil, nil); !strings.Contains(answer, "hello") {
+		t.Errorf("Expected unmatched messages to be echoed, got '%s'", answer)
+	}
+}
+
+func TestMockProvider_Streaming(t *testing.T) {
+	client := newMockClient(t)
+
+	var chunks []string
+	resp, err := client.ChatWithStreaming([]Message{{Role: "user", Content: "list"}}, nil, nil, nil, nil, func(chunk string, done bool) {
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	calls := client.GetToolCalls(resp)
+	if len(calls) != 1 || calls[0].Function.Arguments != `{"path":"src"}` {
+		t.Errorf("Expected streamed arguments to be reassembled, got %+v", calls)
+	}
+
+	content, err := client.SimpleQueryStreaming("echo this", nil, nil, nil, func(chunk string, done bool) {
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	})
+	if err != nil || !strings.Contains(content, "echo this") {
+		t.Errorf("Expected echoed stream, got '%s' (%v)", content, err)
+	}
+	if len(chunks) < 2 {
+		t.Errorf("Expected the reply in several chunks, got %v", chunks)
+	}
+}
+
+func TestMockProvider_Error(t *testing.T) {
+	client := newMockClient(t)
+	if _, err := client.SimpleQuery("fail please", nil, nil, nil); err == nil || !strings.Contains(err.Error(), "overloaded") {
+		t.Errorf("Expected scripted API error, got %v", err)
+	}
+}
+
+func TestLoadMockScenario_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	scenario := `chunk_size: 4
+rules:
+  - match: "(?i)list"
+    responses:
+      - tool_calls:
+          - name: list_files
+            arguments: {path: src, depth: 2}
+      - text: "Found: {{tool_result}}"
+fallback:
+  text: I only know how to list files.
+`
+	if err := os.WriteFile(path, []byte(scenario), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadMockScenario(path)
+	if err != nil {
+		t.Fatalf("Failed to load YAML scenario: %v", err)
+	}
+	if loaded.ChunkSize != 4 || len(loaded.Rules) != 1 || loaded.Fallback == nil {
+		t.Fatalf("Expected the YAML fields decoded, got %+v", loaded)
+	}
+
+	client := NewClientWithProvider("", "", "mock-model", "mock")
+	client.SetMockScenario(loaded)
+	resp, err := client.Chat([]Message{{Role: "user", Content: "list it"}}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	calls := client.GetToolCalls(resp)
+	if len(calls) != 1 || calls[0].Function.Arguments != `{"depth":2,"path":"src"}` {
+		t.Errorf("Expected the YAML tool call, got %+v", calls)
+	}
+	if answer, _ := client.SimpleQuery("hello", nil, nil, nil); answer != "I only know how to list files." {
+		t.Errorf("Expected the YAML fallback, got '%s'", answer)
+	}
+}
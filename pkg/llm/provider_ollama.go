@@ -0,0 +1,295 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OllamaProvider implements the Provider interface for Ollama's native
+// /api/chat endpoint. Unlike the OpenAI-compatible endpoint it can set the
+// context size the model is loaded with and how long it stays in memory.
+type OllamaProvider struct {
+	mu        sync.Mutex
+	keepAlive string // e.g. "10m", "-1" (forever), "0" (unload after each request)
+	numCtx    int    // Context size to load the model with; 0 keeps the server default
+	callSeq   int
+}
+
+func (p *OllamaProvider) Name() string { return "ollama" }
+
+// SetKeepAlive sets how long the server keeps the model loaded after a request.
+func (p *OllamaProvider) SetKeepAlive(keepAlive string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keepAlive = strings.TrimSpace(keepAlive)
+}
+
+// SetContextLength sets the context size (num_ctx) the model is loaded with.
+func (p *OllamaProvider) SetContextLength(numCtx int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.numCtx = numCtx
+}
+
+func (p *OllamaProvider) Endpoint(baseURL string) string {
+	return OllamaBaseURL(baseURL) + "/api/chat"
+}
+
+func (p *OllamaProvider) SetHeaders(req *http.Request, apiKey string) {
+	req.Header.Set("Content-Type", "application/json")
+	// Local servers need no key; one is only sent for authenticating proxies
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+}
+
+// --- Ollama request/response types ---
+
+type ollamaChatRequest struct {
+	Model     string           `json:"model"`
+	Messages  []ollamaMessage  `json:"messages"`
+	Tools     []ToolDefinition `json:"tools,omitempty"`
+	Stream    bool             `json:"stream"`
+	KeepAlive any              `json:"keep_alive,omitempty"` // Duration string or seconds
+	Options   map[string]any   `json:"options,omitempty"`
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	Images    []string         `json:"images,omitempty"` // Base64, for vision models
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaChatResponse struct {
+	Model           string        `json:"model"`
+	CreatedAt       time.Time     `json:"created_at"`
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count"`
+	EvalCount       int           `json:"eval_count"`
+	Error           string        `json:"error,omitempty"`
+}
+
+// --- Provider interface implementation ---
+
+func (p *OllamaProvider) BuildRequestBody(model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, stream bool) ([]byte, error) {
+	p.mu.Lock()
+	keepAlive, numCtx := p.keepAlive, p.numCtx
+	p.mu.Unlock()
+
+	req := ollamaChatRequest{
+		Model:    model,
+		Messages: convertToOllamaMessages(messages),
+		Tools:    tools,
+		Stream:   stream,
+	}
+
+	if keepAlive != "" {
+		// Bare numbers are seconds; anything else is a duration like "10m"
+		if seconds, err := strconv.Atoi(keepAlive); err == nil {
+			req.KeepAlive = seconds
+		} else {
+			req.KeepAlive = keepAlive
+		}
+	}
+
+	options := make(map[string]any)
+	if temperature != nil {
+		options["temperature"] = *temperature
+	}
+	if topP != nil {
+		options["top_p"] = *topP
+	}
+	if maxTokens != nil {
+		options["num_predict"] = *maxTokens
+	}
+	if numCtx > 0 {
+		options["num_ctx"] = numCtx
+	}
+	if len(options) > 0 {
+		req.Options = options
+	}
+
+	return json.Marshal(req)
+}
+
+// convertToOllamaMessages translates canonical messages: tool call arguments
+// become JSON objects, tool results are labelled with the tool's name, since
+// Ollama does not use call IDs, and images go in the images field.
+func convertToOllamaMessages(messages []Message) []ollamaMessage {
+	callNames := make(map[string]string)
+	result := make([]ollamaMessage, 0, len(messages))
+
+	for _, msg := range moveToolImages(messages) {
+		om := ollamaMessage{Role: msg.Role, Content: msg.Content}
+		for _, part := range msg.Parts {
+			if part.Type == "image" {
+				om.Images = append(om.Images, part.Data)
+			}
+		}
+		for _, tc := range msg.ToolCalls {
+			callNames[tc.ID] = tc.Function.Name
+			var call ollamaToolCall
+			call.Function.Name = tc.Function.Name
+			call.Function.Arguments = map[string]any{}
+			if tc.Function.Arguments != "" {
+				if err := json.Unmarshal([]byte(tc.Function.Arguments), &call.Function.Arguments); err != nil {
+					log.Printf("[WARN] Failed to parse tool call arguments for %s: %v", tc.Function.Name, err)
+				}
+			}
+			om.ToolCalls = append(om.ToolCalls, call)
+		}
+		if msg.Role == "tool" {
+			om.ToolName = callNames[msg.ToolCallID]
+		}
+		result = append(result, om)
+	}
+	return result
+}
+
+func (p *OllamaProvider) ParseResponseBody(body []byte) (*ChatResponse, error) {
+	var resp ollamaChatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Ollama response: %w", err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("Ollama error: %s", resp.Error)
+	}
+
+	var content strings.Builder
+	var toolCalls []ToolCall
+	p.appendMessage(resp.Message, &content, &toolCalls)
+	return p.chatResponse(&resp, content.String(), toolCalls), nil
+}
+
+// appendMessage adds a response message's text and tool calls, generating IDs
+// for the tool calls
+func (p *OllamaProvider) appendMessage(msg ollamaMessage, content *strings.Builder, toolCalls *[]ToolCall) {
+	content.WriteString(msg.Content)
+	for _, tc := range msg.ToolCalls {
+		args, err := json.Marshal(tc.Function.Arguments)
+		if err != nil || tc.Function.Arguments == nil {
+			args = []byte("{}")
+		}
+		p.mu.Lock()
+		p.callSeq++
+		id := fmt.Sprintf("call_ollama_%d_%d", time.Now().UnixNano(), p.callSeq)
+		p.mu.Unlock()
+
+		*toolCalls = append(*toolCalls, ToolCall{
+			ID:       id,
+			Type:     "function",
+			Function: FunctionCall{Name: tc.Function.Name, Arguments: string(args)},
+		})
+	}
+}
+
+// chatResponse builds the canonical response from the final (done) message
+func (p *OllamaProvider) chatResponse(final *ollamaChatResponse, content string, toolCalls []ToolCall) *ChatResponse {
+	finishReason := "stop"
+	if len(toolCalls) > 0 {
+		finishReason = "tool_calls"
+	} else if final.DoneReason == "length" {
+		finishReason = "length"
+	}
+
+	created := final.CreatedAt.Unix()
+	if final.CreatedAt.IsZero() {
+		created = time.Now().Unix()
+	}
+
+	return &ChatResponse{
+		ID:      fmt.Sprintf("ollama-%d", created),
+		Object:  "chat.completion",
+		Created: created,
+		Model:   final.Model,
+		Choices: []Choice{
+			{
+				Index: 0,
+				Message: Message{
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: toolCalls,
+				},
+				FinishReason: finishReason,
+			},
+		},
+		Usage: Usage{
+			PromptTokens:     final.PromptEvalCount,
+			CompletionTokens: final.EvalCount,
+			TotalTokens:      final.PromptEvalCount + final.EvalCount,
+		},
+	}
+}
+
+// ParseRateLimits returns no limits; local servers have none.
+func (p *OllamaProvider) ParseRateLimits(h http.Header) RateLimits {
+	return RateLimits{}
+}
+
+// ParseSSEStream parses Ollama's stream, which is newline-delimited JSON
+// rather than Server-Sent Events.
+func (p *OllamaProvider) ParseSSEStream(body io.Reader, callback StreamingCallback) (*ChatResponse, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var content strings.Builder
+	var toolCalls []ToolCall
+	var final ollamaChatResponse
+
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			log.Printf("[WARN] Skipping malformed Ollama chunk: %v (data: %s)", err, line)
+			continue
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("Ollama stream error: %s", chunk.Error)
+		}
+
+		if chunk.Message.Content != "" && callback != nil {
+			callback(chunk.Message.Content, false)
+		}
+		p.appendMessage(chunk.Message, &content, &toolCalls)
+
+		if chunk.Done {
+			final = chunk
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if callback != nil {
+		callback("", true)
+	}
+	return p.chatResponse(&final, content.String(), toolCalls), nil
+}
+
+func (p *OllamaProvider) SupportsModelListing() bool { return false }
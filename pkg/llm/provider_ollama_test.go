@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOllamaBaseURL(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"", "http://localhost:11434"},
+		{"https://api.openai.com/v1", "http://localhost:11434"},
+		{"http://gpu-box:11434/v1", "http://gpu-box:11434"},
+		{"http://localhost:11434/", "http://localhost:11434"},
+	}
+	for _, tt := range tests {
+		if got := OllamaBaseURL(tt.in); got != tt.want {
+			t.Errorf("OllamaBaseURL(%q): expected %s, got %s", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestOllamaProvider_Chat(t *testing.T) {
+	var requests []ollamaChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var req ollamaChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		if !req.Stream {
+			fmt.Fprint(w, `{"model":"qwen3","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"read_file","arguments":{"path":"go.mod"}}}]},"done":true,"done_reason":"stop","prompt_eval_count":50,"eval_count":8}`)
+			return
+		}
+		io.WriteString(w, `{"model":"qwen3","message":{"role":"assistant","content":"module "},"done":false}`+"\n")
+		io.WriteString(w, `{"model":"qwen3","message":{"role":"assistant","content":"example"},"done":false}`+"\n")
+		io.WriteString(w, `{"model":"qwen3","message":{"role":"assistant","content":""},"done":true,"done_reason":"length","prompt_eval_count":70,"eval_count":2}`+"\n")
+	}))
+	defer server.Close()
+
+	client := NewClientWithProvider(server.URL+"/v1", "", "qwen3", "ollama")
+	client.SetOllamaOptions("-1", 32768)
+
+	messages := []Message{{Role: "user", Content: "What module is this?"}}
+	resp, err := client.Chat(messages, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	calls := client.GetToolCalls(resp)
+	if len(calls) != 1 || calls[0].Function.Arguments != `{"path":"go.mod"}` || calls[0].ID == "" {
+		t.Fatalf("Expected a read_file call with an ID, got %+v", calls)
+	}
+	if client.GetFinishReason(resp) != "tool_calls" || resp.Usage.TotalTokens != 58 {
+		t.Errorf("Expected tool_calls with 58 tokens, got %s / %+v", client.GetFinishReason(resp), resp.Usage)
+	}
+	if requests[0].KeepAlive != float64(-1) || requests[0].Options["num_ctx"] != float64(32768) {
+		t.Errorf("Expected keep_alive and num_ctx, got %v / %v", requests[0].KeepAlive, requests[0].Options)
+	}
+
+	messages = append(messages,
+		Message{Role: "assistant", ToolCalls: calls},
+		Message{Role: "tool", ToolCallID: calls[0].ID, Content: "module example"},
+	)
+	var chunks []string
+	resp, err = client.ChatWithStreaming(messages, nil, nil, nil, nil, func(chunk string, done bool) {
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if got := client.GetContent(resp); got != "module example" || len(chunks) != 2 {
+		t.Errorf("Expected 'module example' in 2 chunks, got '%s' in %v", got, chunks)
+	}
+	if client.GetFinishReason(resp) != "length" || resp.Usage.PromptTokens != 70 {
+		t.Errorf("Expected length with 70 prompt tokens, got %s / %+v", client.GetFinishReason(resp), resp.Usage)
+	}
+
+	sent := requests[1].Messages
+	if len(sent) != 3 || sent[1].ToolCalls[0].Function.Arguments["path"] != "go.mod" || sent[2].ToolName != "read_file" {
+		t.Errorf("Expected the tool result to be named after its call, got %+v", sent)
+	}
+}
+
+func TestOllamaModelManagement(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			fmt.Fprint(w, `{"models":[{"name":"qwen3:8b","size":5200000000},{"name":"llama3.2:latest","size":2000000000}]}`)
+		case "/api/show":
+			var req map[string]string
+			json.NewDecoder(r.Body).Decode(&req)
+			if req["model"] != "qwen3:8b" {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprintf(w, `{"error":"model '%s' not found"}`, req["model"])
+				return
+			}
+			fmt.Fprint(w, `{"capabilities":["completion","tools"],"model_info":{"general.architecture":"qwen3","qwen3.context_length":40960}}`)
+		case "/api/pull":
+			io.WriteString(w, `{"status":"pulling manifest"}`+"\n")
+			io.WriteString(w, `{"status":"pulling abc","digest":"abc","total":100,"completed":50}`+"\n")
+			io.WriteString(w, `{"status":"success"}`+"\n")
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	models, err := ListOllamaModels(ctx, server.URL)
+	if err != nil || len(models) != 2 || models[0].Name != "llama3.2:latest" {
+		t.Fatalf("Expected 2 sorted models, got %+v (%v)", models, err)
+	}
+
+	info, err := ShowOllamaModel(ctx, server.URL, "qwen3:8b")
+	if err != nil {
+		t.Fatalf("Show failed: %v", err)
+	}
+	if info.ContextLength != 40960 || !info.Supports("tools") {
+		t.Errorf("Expected context 40960 with tools, got %+v", info)
+	}
+	RegisterModelProfile(info.Profile())
+	if profile, known := LookupModelProfile("qwen3:8b"); !known || profile.ContextWindow != 40960 || !profile.SupportsTools {
+		t.Errorf("Expected the discovered profile, got %+v", profile)
+	}
+
+	if _, err := ShowOllamaModel(ctx, server.URL, "missing"); !errors.Is(err, ErrOllamaModelNotFound) {
+		t.Errorf("Expected ErrOllamaModelNotFound, got %v", err)
+	}
+
+	var statuses []string
+	err = PullOllamaModel(ctx, server.URL, "qwen3:8b", func(p OllamaPullProgress) {
+		statuses = append(statuses, p.Status)
+	})
+	if err != nil || strings.Join(statuses, ",") != "pulling manifest,pulling abc,success" {
+		t.Errorf("Expected pull progress, got %v (%v)", statuses, err)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"ClosedWheeler/pkg/config"
+	"ClosedWheeler/pkg/traces"
 )
 
 // OpenAIProvider implements the Provider interface for OpenAI-compatible APIs.
@@ -48,6 +49,7 @@ func (p *OpenAIProvider) RefreshIfNeeded() {
 		return
 	}
 	p.oauth = newCreds
+	traces.AddSecrets(newCreds.AccessToken, newCreds.RefreshToken)
 	_ = config.SaveOAuth(newCreds)
 }
 
@@ -79,7 +81,7 @@ func (p *OpenAIProvider) SetHeaders(req *http.Request, apiKey string) {
 func (p *OpenAIProvider) BuildRequestBody(model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, stream bool) ([]byte, error) {
 	reqBody := ChatRequest{
 		Model:       model,
-		Messages:    messages,
+		Messages:    moveToolImages(messages),
 		Tools:       tools,
 		Temperature: temperature,
 		TopP:        topP,
@@ -95,9 +97,42 @@ func (p *OpenAIProvider) BuildRequestBody(model string, messages []Message, tool
 		reqBody.ToolChoice = "auto"
 	}
 
+	// Without this streamed responses carry no usage
+	if stream {
+		reqBody.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+
 	return json.Marshal(reqBody)
 }
 
+// ResponseFormat constrains a Chat Completions reply to a JSON schema
+type ResponseFormat struct {
+	Type       string            `json:"type"` // "json_schema"
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openAIJSONSchema struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Schema      interface{} `json:"schema"`
+	Strict      bool        `json:"strict,omitempty"`
+}
+
+// BuildStructuredRequestBody requests a reply constrained to schema with response_format
+func (p *OpenAIProvider) BuildStructuredRequestBody(model string, messages []Message, schema ResponseSchema, temperature *float64, maxTokens *int) ([]byte, error) {
+	return json.Marshal(ChatRequest{
+		Model:           model,
+		Messages:        moveToolImages(messages),
+		Temperature:     temperature,
+		MaxTokens:       maxTokens,
+		ReasoningEffort: p.reasoningEffort,
+		ResponseFormat: &ResponseFormat{
+			Type:       "json_schema",
+			JSONSchema: &openAIJSONSchema{Name: schema.Name, Description: schema.Description, Schema: schema.Schema, Strict: schema.Strict},
+		},
+	})
+}
+
 // SetReasoningEffort sets the reasoning effort level for reasoning models.
 func (p *OpenAIProvider) SetReasoningEffort(effort string) { p.reasoningEffort = effort }
 
@@ -114,6 +149,12 @@ func (p *OpenAIProvider) ParseResponseBody(body []byte) (*ChatResponse, error) {
 
 func (p *OpenAIProvider) ParseRateLimits(h http.Header) RateLimits {
 	rl := RateLimits{}
+	if v, err := strconv.Atoi(h.Get("x-ratelimit-limit-requests")); err == nil {
+		rl.LimitRequests = v
+	}
+	if v, err := strconv.Atoi(h.Get("x-ratelimit-limit-tokens")); err == nil {
+		rl.LimitTokens = v
+	}
 	if v := h.Get("x-ratelimit-remaining-requests"); v != "" {
 		val, err := strconv.Atoi(v)
 		if err != nil {
@@ -144,12 +185,19 @@ func (p *OpenAIProvider) ParseRateLimits(h http.Header) RateLimits {
 }
 
 func (p *OpenAIProvider) ParseSSEStream(body io.Reader, callback StreamingCallback) (*ChatResponse, error) {
+	return p.ParseSSEStreamWithToolCalls(body, callback, nil)
+}
+
+// ParseSSEStreamWithToolCalls is like ParseSSEStream and also reports each
+// tool call argument delta to onToolCall
+func (p *OpenAIProvider) ParseSSEStreamWithToolCalls(body io.Reader, callback StreamingCallback, onToolCall ToolCallCallback) (*ChatResponse, error) {
 	reader := bufio.NewReader(body)
 
 	var fullContent strings.Builder
 	var toolCalls []ToolCall
 	var lastResponse StreamingResponse
 	var finishReason string
+	var usage Usage
 
 	for {
 		line, err := reader.ReadString('\n')
@@ -186,6 +234,9 @@ func (p *OpenAIProvider) ParseSSEStream(body io.Reader, callback StreamingCallba
 		}
 
 		lastResponse = streamResp
+		if streamResp.Usage != nil {
+			usage = *streamResp.Usage
+		}
 
 		if len(streamResp.Choices) > 0 {
 			choice := streamResp.Choices[0]
@@ -209,6 +260,12 @@ func (p *OpenAIProvider) ParseSSEStream(body io.Reader, callback StreamingCallba
 					} else if len(toolCalls) > 0 {
 						last := &toolCalls[len(toolCalls)-1]
 						last.Function.Arguments += tc.Function.Arguments
+					} else {
+						continue
+					}
+					if onToolCall != nil && tc.Function.Arguments != "" {
+						last := toolCalls[len(toolCalls)-1]
+						onToolCall(ToolCallDelta{Index: len(toolCalls) - 1, ID: last.ID, Name: last.Function.Name, Arguments: last.Function.Arguments})
 					}
 				}
 			}
@@ -235,6 +292,7 @@ func (p *OpenAIProvider) ParseSSEStream(body io.Reader, callback StreamingCallba
 				FinishReason: finishReason,
 			},
 		},
+		Usage: usage,
 	}
 
 	return finalResponse, nil
@@ -0,0 +1,521 @@
+package llm
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResponsesProvider implements the Provider interface for OpenAI's Responses
+// API (/responses). Reasoning models keep their reasoning between tool calls:
+// statelessly by echoing encrypted reasoning items back, or, when storing is
+// enabled, by chaining requests with previous_response_id. Authentication,
+// reasoning effort and rate limits are shared with OpenAIProvider.
+type ResponsesProvider struct {
+	OpenAIProvider
+
+	mu        sync.Mutex
+	store     bool                         // Store responses server-side and chain with previous_response_id
+	reasoning map[string][]json.RawMessage // Reasoning items keyed by the first call ID of their response
+	pending   []Message                    // Messages of the request in flight
+	chain     responsesChain               // Conversation state of the last stored response
+}
+
+// responsesChain identifies the stored response a request can continue from
+type responsesChain struct {
+	id    string // Response ID
+	hash  string // Fingerprint of the messages up to and including its reply
+	count int    // Number of those messages
+}
+
+func (p *ResponsesProvider) Name() string { return "responses" }
+
+// SetStore enables server-side storage, so requests that extend the previous
+// exchange only send the new messages along with previous_response_id.
+func (p *ResponsesProvider) SetStore(store bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.store = store
+	p.chain = responsesChain{}
+}
+
+func (p *ResponsesProvider) Endpoint(baseURL string) string {
+	return baseURL + "/responses"
+}
+
+// --- Responses request/response types ---
+
+type responsesRequest struct {
+	Model              string               `json:"model"`
+	Instructions       string               `json:"instructions,omitempty"`
+	Input              []any                `json:"input"`
+	Tools              []responsesTool      `json:"tools,omitempty"`
+	ToolChoice         string               `json:"tool_choice,omitempty"`
+	Temperature        *float64             `json:"temperature,omitempty"`
+	TopP               *float64             `json:"top_p,omitempty"`
+	MaxOutputTokens    *int                 `json:"max_output_tokens,omitempty"`
+	Stream             bool                 `json:"stream,omitempty"`
+	Store              bool                 `json:"store"`
+	PreviousResponseID string               `json:"previous_response_id,omitempty"`
+	Reasoning          *responsesReasoning  `json:"reasoning,omitempty"`
+	Include            []string             `json:"include,omitempty"`
+	Text               *responsesTextConfig `json:"text,omitempty"`
+}
+
+type responsesTextConfig struct {
+	Format responsesFormat `json:"format"`
+}
+
+type responsesFormat struct {
+	Type        string      `json:"type"` // "json_schema"
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Schema      interface{} `json:"schema"`
+	Strict      bool        `json:"strict,omitempty"`
+}
+
+type responsesReasoning struct {
+	Effort  string `json:"effort,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type responsesTool struct {
+	Type        string      `json:"type"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters"`
+}
+
+type responsesMessage struct {
+	Type    string `json:"type"`
+	Role    string `json:"role"`
+	Content any    `json:"content"` // Text, or []responsesContentPart for images
+}
+
+type responsesContentPart struct {
+	Type     string `json:"type"` // "input_text" or "input_image"
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"` // Data URL
+}
+
+type responsesFunctionCall struct {
+	Type      string `json:"type"`
+	CallID    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type responsesFunctionOutput struct {
+	Type   string `json:"type"`
+	CallID string `json:"call_id"`
+	Output string `json:"output"`
+}
+
+// responsesOutputItem is one item of a response's output
+type responsesOutputItem struct {
+	Type      string          `json:"type"` // "message", "function_call", "reasoning"
+	ID        string          `json:"id"`
+	Content   []responsesText `json:"content,omitempty"`
+	Summary   []responsesText `json:"summary,omitempty"`
+	CallID    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+}
+
+type responsesText struct {
+	Type string `json:"type"` // "output_text", "refusal", "summary_text"
+	Text string `json:"text"`
+}
+
+type responsesResponse struct {
+	ID                string            `json:"id"`
+	CreatedAt         int64             `json:"created_at"`
+	Model             string            `json:"model"`
+	Status            string            `json:"status"` // "completed", "incomplete", "failed"
+	Output            []json.RawMessage `json:"output"`
+	IncompleteDetails *struct {
+		Reason string `json:"reason"`
+	} `json:"incomplete_details,omitempty"`
+	Error *responsesError `json:"error,omitempty"`
+	Usage struct {
+		InputTokens        int `json:"input_tokens"`
+		OutputTokens       int `json:"output_tokens"`
+		TotalTokens        int `json:"total_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+		OutputTokensDetails struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"output_tokens_details"`
+	} `json:"usage"`
+}
+
+type responsesError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// responsesEvent is one Server-Sent Event of a streamed response
+type responsesEvent struct {
+	Type        string             `json:"type"`
+	OutputIndex int                `json:"output_index"`
+	Delta       string             `json:"delta,omitempty"`
+	Item        json.RawMessage    `json:"item,omitempty"`
+	Response    *responsesResponse `json:"response,omitempty"`
+	Code        string             `json:"code,omitempty"`
+	Message     string             `json:"message,omitempty"`
+}
+
+// --- Provider interface implementation ---
+
+func (p *ResponsesProvider) BuildRequestBody(model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, stream bool) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req := responsesRequest{
+		Model:           model,
+		Temperature:     temperature,
+		TopP:            topP,
+		MaxOutputTokens: maxTokens,
+		Stream:          stream,
+		Store:           p.store,
+	}
+
+	if isResponsesReasoningModel(model) {
+		req.Reasoning = &responsesReasoning{Effort: p.reasoningEffort, Summary: "auto"}
+		if !p.store {
+			// Without storage the reasoning only survives as encrypted items we send back
+			req.Include = []string{"reasoning.encrypted_content"}
+		}
+	}
+
+	// Continue the stored response when this request extends its exchange
+	input := messages
+	if p.store && p.chain.id != "" && len(messages) > p.chain.count && fingerprintMessages(messages[:p.chain.count]) == p.chain.hash {
+		req.PreviousResponseID = p.chain.id
+		input = messages[p.chain.count:]
+	}
+	p.pending = append([]Message(nil), messages...)
+
+	// Instructions are not carried over by previous_response_id, so the
+	// system prompt is always sent in full
+	req.Instructions = responsesInstructions(messages)
+	req.Input = p.convertToResponsesInput(input, req.PreviousResponseID == "")
+
+	for _, tool := range tools {
+		req.Tools = append(req.Tools, responsesTool{
+			Type:        "function",
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  tool.Function.Parameters,
+		})
+	}
+	if len(req.Tools) > 0 {
+		req.ToolChoice = "auto"
+	}
+
+	return json.Marshal(req)
+}
+
+// BuildStructuredRequestBody requests a reply constrained to schema with a
+// json_schema text format. The query stands alone: it is neither stored nor
+// chained to the conversation.
+func (p *ResponsesProvider) BuildStructuredRequestBody(model string, messages []Message, schema ResponseSchema, temperature *float64, maxTokens *int) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	req := responsesRequest{
+		Model:           model,
+		Instructions:    responsesInstructions(messages),
+		Input:           p.convertToResponsesInput(messages, false),
+		Temperature:     temperature,
+		MaxOutputTokens: maxTokens,
+		Text: &responsesTextConfig{Format: responsesFormat{
+			Type:        "json_schema",
+			Name:        schema.Name,
+			Description: schema.Description,
+			Schema:      schema.Schema,
+			Strict:      schema.Strict,
+		}},
+	}
+	if isResponsesReasoningModel(model) {
+		req.Reasoning = &responsesReasoning{Effort: p.reasoningEffort}
+	}
+	p.pending = nil
+	return json.Marshal(req)
+}
+
+// responsesInstructions joins the system messages into instructions
+func responsesInstructions(messages []Message) string {
+	var instructions []string
+	for _, msg := range messages {
+		if msg.Role == "system" && msg.Content != "" {
+			instructions = append(instructions, msg.Content)
+		}
+	}
+	return strings.Join(instructions, "\n\n")
+}
+
+// convertToResponsesInput translates canonical messages into input items.
+// Tool calls become function_call items preceded by the reasoning that
+// produced them. When the full history is sent, reasoning for calls no
+// longer in it is dropped. Must be called with p.mu held.
+func (p *ResponsesProvider) convertToResponsesInput(messages []Message, full bool) []any {
+	input := make([]any, 0, len(messages))
+	present := make(map[string]bool)
+
+	// Function call outputs are text only, so tool images go in a user message
+	for _, msg := range moveToolImages(messages) {
+		switch {
+		case msg.Role == "system":
+			continue
+		case msg.Role == "tool":
+			input = append(input, responsesFunctionOutput{Type: "function_call_output", CallID: msg.ToolCallID, Output: msg.Content})
+		case len(msg.ToolCalls) > 0:
+			present[msg.ToolCalls[0].ID] = true
+			for _, item := range p.reasoning[msg.ToolCalls[0].ID] {
+				input = append(input, item)
+			}
+			if msg.Content != "" {
+				input = append(input, responsesMessage{Type: "message", Role: "assistant", Content: msg.Content})
+			}
+			for _, tc := range msg.ToolCalls {
+				args := tc.Function.Arguments
+				if args == "" {
+					args = "{}"
+				}
+				input = append(input, responsesFunctionCall{Type: "function_call", CallID: tc.ID, Name: tc.Function.Name, Arguments: args})
+			}
+		case len(msg.Parts) > 0:
+			input = append(input, responsesMessage{Type: "message", Role: msg.Role, Content: responsesContentParts(msg.Parts)})
+		default:
+			input = append(input, responsesMessage{Type: "message", Role: msg.Role, Content: msg.Content})
+		}
+	}
+
+	if full {
+		for id := range p.reasoning {
+			if !present[id] {
+				delete(p.reasoning, id)
+			}
+		}
+	}
+	return input
+}
+
+// responsesContentParts converts multimodal parts to input_text and input_image items
+func responsesContentParts(parts []ContentPart) []responsesContentPart {
+	result := make([]responsesContentPart, 0, len(parts))
+	for _, part := range parts {
+		if part.Type == "image" {
+			result = append(result, responsesContentPart{Type: "input_image", ImageURL: part.dataURL()})
+		} else if part.Text != "" {
+			result = append(result, responsesContentPart{Type: "input_text", Text: part.Text})
+		}
+	}
+	return result
+}
+
+func (p *ResponsesProvider) ParseResponseBody(body []byte) (*ChatResponse, error) {
+	var resp responsesResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal Responses API response: %w", err)
+	}
+	return p.chatResponse(&resp)
+}
+
+// chatResponse converts a finished response, remembering its reasoning items
+// and, when storing, the chain state for the next request
+func (p *ResponsesProvider) chatResponse(resp *responsesResponse) (*ChatResponse, error) {
+	if resp.Error != nil && resp.Error.Message != "" {
+		return nil, fmt.Errorf("Responses API error (%s): %s", resp.Error.Code, resp.Error.Message)
+	}
+
+	var content, summary strings.Builder
+	var toolCalls []ToolCall
+	var reasoning []json.RawMessage
+
+	for _, raw := range resp.Output {
+		var item responsesOutputItem
+		if err := json.Unmarshal(raw, &item); err != nil {
+			log.Printf("[WARN] Skipping malformed Responses output item: %v", err)
+			continue
+		}
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				content.WriteString(part.Text)
+			}
+		case "function_call":
+			toolCalls = append(toolCalls, ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			})
+		case "reasoning":
+			reasoning = append(reasoning, raw)
+			for _, part := range item.Summary {
+				if summary.Len() > 0 {
+					summary.WriteString("\n\n")
+				}
+				summary.WriteString(part.Text)
+			}
+		}
+	}
+
+	finishReason := "stop"
+	if len(toolCalls) > 0 {
+		finishReason = "tool_calls"
+	} else if resp.Status == "incomplete" && resp.IncompleteDetails != nil {
+		switch resp.IncompleteDetails.Reason {
+		case "max_output_tokens":
+			finishReason = "length"
+		case "content_filter":
+			finishReason = "content_filter"
+		}
+	}
+
+	created := resp.CreatedAt
+	if created == 0 {
+		created = time.Now().Unix()
+	}
+
+	reply := Message{Role: "assistant", Content: content.String(), ToolCalls: toolCalls}
+
+	p.mu.Lock()
+	if len(toolCalls) > 0 && len(reasoning) > 0 {
+		if p.reasoning == nil {
+			p.reasoning = make(map[string][]json.RawMessage)
+		}
+		p.reasoning[toolCalls[0].ID] = reasoning
+	}
+	if p.store && resp.ID != "" && p.pending != nil {
+		exchange := append(p.pending, reply)
+		p.chain = responsesChain{id: resp.ID, hash: fingerprintMessages(exchange), count: len(exchange)}
+	}
+	p.pending = nil
+	p.mu.Unlock()
+
+	return &ChatResponse{
+		ID:      resp.ID,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   resp.Model,
+		Choices: []Choice{
+			{
+				Index:        0,
+				Message:      reply,
+				FinishReason: finishReason,
+			},
+		},
+		Usage: Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.TotalTokens,
+			CachedTokens:     resp.Usage.InputTokensDetails.CachedTokens,
+			ReasoningTokens:  resp.Usage.OutputTokensDetails.ReasoningTokens,
+		},
+		Reasoning: summary.String(),
+	}, nil
+}
+
+// ParseSSEStream parses the typed event stream. Text deltas go to the
+// callback; the response is assembled from the final response event, or
+// from the finished output items if the final event carries none.
+func (p *ResponsesProvider) ParseSSEStream(body io.Reader, callback StreamingCallback) (*ChatResponse, error) {
+	return p.ParseSSEStreamWithToolCalls(body, callback, nil)
+}
+
+// ParseSSEStreamWithToolCalls is like ParseSSEStream and also reports the
+// argument deltas of function calls to onToolCall
+func (p *ResponsesProvider) ParseSSEStreamWithToolCalls(body io.Reader, callback StreamingCallback, onToolCall ToolCallCallback) (*ChatResponse, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var final *responsesResponse
+	var items []json.RawMessage
+	calls := make(map[int]*ToolCallDelta) // Function calls in progress by output index
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+
+		var event responsesEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			log.Printf("[WARN] Skipping malformed Responses event: %v (data: %s)", err, data)
+			continue
+		}
+
+		switch event.Type {
+		case "response.output_text.delta":
+			if event.Delta != "" && callback != nil {
+				callback(event.Delta, false)
+			}
+		case "response.output_item.added":
+			var item responsesOutputItem
+			if onToolCall != nil && json.Unmarshal(event.Item, &item) == nil && item.Type == "function_call" {
+				calls[event.OutputIndex] = &ToolCallDelta{Index: len(calls), ID: item.CallID, Name: item.Name}
+			}
+		case "response.function_call_arguments.delta":
+			if call, ok := calls[event.OutputIndex]; ok {
+				call.Arguments += event.Delta
+				onToolCall(*call)
+			}
+		case "response.output_item.done":
+			items = append(items, event.Item)
+		case "response.completed", "response.incomplete", "response.failed":
+			final = event.Response
+		case "error":
+			return nil, fmt.Errorf("Responses API stream error (%s): %s", event.Code, event.Message)
+		}
+		if final != nil {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if final == nil {
+		return nil, fmt.Errorf("Responses API stream ended without a final response")
+	}
+	if len(final.Output) == 0 {
+		final.Output = items
+	}
+
+	if callback != nil {
+		callback("", true)
+	}
+	return p.chatResponse(final)
+}
+
+// isResponsesReasoningModel reports whether model accepts reasoning settings
+func isResponsesReasoningModel(model string) bool {
+	lower := strings.ToLower(model)
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if strings.HasPrefix(lower, prefix) {
+			return true
+		}
+	}
+	return strings.Contains(lower, "codex")
+}
+
+// fingerprintMessages hashes a message history, so a later request can tell
+// whether it extends the exchange of a stored response
+func fingerprintMessages(messages []Message) string {
+	data, _ := json.Marshal(messages)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
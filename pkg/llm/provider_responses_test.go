@@ -0,0 +1,152 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponsesProvider_ToolRoundTrip(t *testing.T) {
+	var requests []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/responses" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		var req map[string]any
+		json.NewDecoder(r.Body).Decode(&req)
+		requests = append(requests, req)
+
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"id":"resp_1","created_at":1700000000,"model":"o3","status":"completed","output":[
+				{"type":"reasoning","id":"rs_1","summary":[{"type":"summary_text","text":"Need the file first."}],"encrypted_content":"ENC"},
+				{"type":"function_call","id":"fc_1","call_id":"call_1","name":"read_file","arguments":"{\"path\":\"go.mod\"}"}],
+				"usage":{"input_tokens":100,"output_tokens":20,"total_tokens":120,"input_tokens_details":{"cached_tokens":64}}}`)
+			return
+		}
+		io.WriteString(w, "event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_2\"}}\n\n")
+		io.WriteString(w, "data: {\"type\":\"response.reasoning_summary_text.delta\",\"delta\":\"Read it.\"}\n\n")
+		io.WriteString(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"module \"}\n\n")
+		io.WriteString(w, "data: {\"type\":\"response.output_text.delta\",\"delta\":\"example\"}\n\n")
+		io.WriteString(w, `data: {"type":"response.completed","response":{"id":"resp_2","model":"o3","status":"completed","output":[`+
+			`{"type":"reasoning","id":"rs_2","summary":[{"type":"summary_text","text":"Read it."}]},`+
+			`{"type":"message","role":"assistant","content":[{"type":"output_text","text":"module example"}]}],`+
+			`"usage":{"input_tokens":150,"output_tokens":5,"total_tokens":155}}}`+"\n\n")
+	}))
+	defer server.Close()
+
+	client := NewClientWithProvider(server.URL+"/v1", "sk-test", "o3", "responses")
+	client.SetReasoningEffort("high")
+
+	messages := []Message{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "user", Content: "What module is this?"},
+	}
+	tools := []ToolDefinition{{Type: "function", Function: FunctionSchema{Name: "read_file", Description: "Read a file", Parameters: map[string]any{"type": "object"}}}}
+	resp, err := client.ChatWithTools(messages, tools, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	calls := client.GetToolCalls(resp)
+	if len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Function.Arguments != `{"path":"go.mod"}` {
+		t.Fatalf("Expected a read_file call, got %+v", calls)
+	}
+	if client.GetFinishReason(resp) != "tool_calls" || resp.Usage.CachedTokens != 64 || resp.Usage.TotalTokens != 120 {
+		t.Errorf("Expected tool_calls with cached usage, got %s / %+v", client.GetFinishReason(resp), resp.Usage)
+	}
+	if resp.Reasoning != "Need the file first." {
+		t.Errorf("Expected the reasoning summary, got %q", resp.Reasoning)
+	}
+
+	first := requests[0]
+	if first["instructions"] != "You are helpful." || first["store"] != false {
+		t.Errorf("Expected instructions without storage, got %v / %v", first["instructions"], first["store"])
+	}
+	reasoning, _ := first["reasoning"].(map[string]any)
+	if reasoning["effort"] != "high" || reasoning["summary"] != "auto" {
+		t.Errorf("Expected high effort with summaries, got %v", first["reasoning"])
+	}
+	if include, _ := first["include"].([]any); len(include) != 1 || include[0] != "reasoning.encrypted_content" {
+		t.Errorf("Expected encrypted reasoning to be requested, got %v", first["include"])
+	}
+	if tool := first["tools"].([]any)[0].(map[string]any); tool["name"] != "read_file" || tool["type"] != "function" {
+		t.Errorf("Expected a flat function tool, got %v", tool)
+	}
+
+	messages = append(messages,
+		Message{Role: "assistant", ToolCalls: calls},
+		Message{Role: "tool", ToolCallID: "call_1", Content: "module example"},
+	)
+	var chunks []string
+	resp, err = client.ChatWithStreaming(messages, tools, nil, nil, nil, func(chunk string, done bool) {
+		if chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Stream failed: %v", err)
+	}
+	if got := client.GetContent(resp); got != "module example" || len(chunks) != 2 {
+		t.Errorf("Expected 'module example' in 2 chunks, got '%s' in %v", got, chunks)
+	}
+	if resp.Reasoning != "Read it." || resp.Usage.PromptTokens != 150 {
+		t.Errorf("Expected the streamed summary and usage, got %q / %+v", resp.Reasoning, resp.Usage)
+	}
+
+	// The reasoning item is echoed before its call, then the call and its output
+	var types []string
+	for _, item := range requests[1]["input"].([]any) {
+		entry := item.(map[string]any)
+		types = append(types, entry["type"].(string))
+		if entry["type"] == "reasoning" && entry["encrypted_content"] != "ENC" {
+			t.Errorf("Expected the encrypted reasoning to be echoed, got %v", entry)
+		}
+	}
+	if got := strings.Join(types, ","); got != "message,reasoning,function_call,function_call_output" {
+		t.Errorf("Unexpected input items: %s", got)
+	}
+}
+
+func TestResponsesProvider_PreviousResponseID(t *testing.T) {
+	p := &ResponsesProvider{}
+	p.SetStore(true)
+
+	messages := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "list files"},
+	}
+	if _, err := p.BuildRequestBody("gpt-5", messages, nil, nil, nil, nil, false); err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	resp, err := p.ParseResponseBody([]byte(`{"id":"resp_1","status":"completed","output":[{"type":"function_call","call_id":"call_1","name":"list_files","arguments":"{}"}]}`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		messages []Message
+		previous string
+		items    int
+	}{
+		{"extends the exchange", append(append([]Message{}, messages...), resp.Choices[0].Message, Message{Role: "tool", ToolCallID: "call_1", Content: "a.go"}), "resp_1", 1},
+		{"different history", []Message{{Role: "system", Content: "sys"}, {Role: "user", Content: "something else"}}, "", 1},
+	}
+	for _, tt := range tests {
+		body, err := p.BuildRequestBody("gpt-5", tt.messages, nil, nil, nil, nil, false)
+		if err != nil {
+			t.Fatalf("%s: build failed: %v", tt.name, err)
+		}
+		var req responsesRequest
+		json.Unmarshal(body, &req)
+		if req.PreviousResponseID != tt.previous || len(req.Input) != tt.items || !req.Store {
+			t.Errorf("%s: expected previous %q with %d items, got %q with %d", tt.name, tt.previous, tt.items, req.PreviousResponseID, len(req.Input))
+		}
+		if req.Instructions != "sys" || req.Include != nil {
+			t.Errorf("%s: expected instructions without encrypted reasoning, got %q / %v", tt.name, req.Instructions, req.Include)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Package llm provides proactive rate-limit scheduling per provider
+package llm
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket meters one per-minute limit. An empty bucket refills at
+// capacity per minute.
+type tokenBucket struct {
+	configured float64   // Limit set in configuration; 0 uses the provider-reported one
+	capacity   float64   // Effective limit per minute; 0 is unlimited
+	level      float64   // Units available now
+	updated    time.Time // Time of the last refill
+	blocked    time.Time // No capacity before this (the provider reported the limit exhausted)
+}
+
+// setCapacity changes the limit, starting a new bucket full
+func (b *tokenBucket) setCapacity(capacity float64) {
+	if b.capacity <= 0 || b.level > capacity {
+		b.level = capacity
+	}
+	b.capacity = capacity
+}
+
+// refill adds the units earned since the last refill
+func (b *tokenBucket) refill(now time.Time) {
+	if b.capacity > 0 && !b.updated.IsZero() {
+		b.level = math.Min(b.capacity, b.level+now.Sub(b.updated).Minutes()*b.capacity)
+	}
+	b.updated = now
+}
+
+// delay returns how long until n units are available. A request larger than
+// the whole bucket only waits for a full one.
+func (b *tokenBucket) delay(n float64, now time.Time) time.Duration {
+	if now.Before(b.blocked) {
+		return b.blocked.Sub(now)
+	}
+	if b.capacity <= 0 {
+		return 0
+	}
+	n = math.Min(n, b.capacity)
+	if b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.capacity * float64(time.Minute))
+}
+
+// observe adopts the limit and remaining budget a provider reported
+func (b *tokenBucket) observe(limit, remaining int, reset time.Time, now time.Time) {
+	if limit <= 0 {
+		return // The provider did not report this limit
+	}
+	b.refill(now)
+	if b.configured <= 0 {
+		b.setCapacity(float64(limit))
+	}
+	b.level = math.Min(float64(remaining), b.capacity)
+	if remaining <= 0 && reset.After(now) {
+		b.blocked = reset
+	}
+}
+
+// RateSchedulerStats reports how much a scheduler has throttled
+type RateSchedulerStats struct {
+	RequestsPerMinute int           // Effective request limit; 0 is unlimited
+	TokensPerMinute   int           // Effective token limit; 0 is unlimited
+	Throttled         int           // Calls that had to wait
+	Waited            time.Duration // Total time calls waited
+}
+
+// RateScheduler delays calls to one provider so they stay within its
+// requests- and tokens-per-minute limits instead of running into 429s. Limits
+// come from configuration and from the rate-limit headers of every response.
+// Providers meter each model separately, so there is one scheduler per base
+// URL and model, shared by all clients (see SchedulerFor): debates,
+// heartbeats and sub-agents queue behind each other.
+type RateScheduler struct {
+	mu        sync.Mutex
+	requests  tokenBucket
+	tokens    tokenBucket
+	throttled int
+	waited    time.Duration
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRateScheduler creates a scheduler without limits
+func NewRateScheduler() *RateScheduler {
+	return &RateScheduler{now: time.Now, sleep: sleepFor}
+}
+
+var (
+	schedulersMu sync.Mutex
+	schedulers   = make(map[string]*RateScheduler)
+)
+
+// SchedulerFor returns the scheduler shared by all clients of a model at an
+// API base URL
+func SchedulerFor(baseURL, model string) *RateScheduler {
+	key := strings.TrimRight(strings.ToLower(baseURL), "/") + " " + strings.ToLower(model)
+	schedulersMu.Lock()
+	defer schedulersMu.Unlock()
+	s, ok := schedulers[key]
+	if !ok {
+		s = NewRateScheduler()
+		schedulers[key] = s
+	}
+	return s
+}
+
+// SetLimits configures requests and tokens per minute; 0 leaves a limit to
+// what the provider reports
+func (s *RateScheduler) SetLimits(requestsPerMinute, tokensPerMinute int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for _, limit := range []struct {
+		bucket *tokenBucket
+		value  int
+	}{{&s.requests, requestsPerMinute}, {&s.tokens, tokensPerMinute}} {
+		limit.bucket.refill(now)
+		limit.bucket.configured = float64(limit.value)
+		if limit.value > 0 {
+			limit.bucket.setCapacity(float64(limit.value))
+		}
+	}
+}
+
+// Wait blocks until a request of about tokens tokens fits within the limits,
+// then reserves it. It returns how long the call waited.
+func (s *RateScheduler) Wait(ctx context.Context, tokens int) (time.Duration, error) {
+	var waited time.Duration
+	for {
+		s.mu.Lock()
+		now := s.now()
+		s.requests.refill(now)
+		s.tokens.refill(now)
+		wait := s.requests.delay(1, now)
+		if d := s.tokens.delay(float64(tokens), now); d > wait {
+			wait = d
+		}
+		if wait <= 0 {
+			s.requests.level--
+			s.tokens.level -= float64(tokens)
+			if waited > 0 {
+				s.throttled++
+				s.waited += waited
+			}
+			s.mu.Unlock()
+			return waited, nil
+		}
+		s.mu.Unlock()
+
+		if waited == 0 && wait >= time.Second {
+			log.Printf("[INFO] ⏳ Rate limit: delaying request %s", wait.Round(time.Second))
+		}
+		if err := s.sleep(ctx, wait); err != nil {
+			return waited, err
+		}
+		waited += wait
+	}
+}
+
+// Observe adopts the limits a provider reported in its response headers
+func (s *RateScheduler) Observe(limits RateLimits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.requests.observe(limits.LimitRequests, limits.RemainingRequests, limits.ResetRequests, now)
+	s.tokens.observe(limits.LimitTokens, limits.RemainingTokens, limits.ResetTokens, now)
+}
+
+// Settle accounts for a finished request. A provider that reports its token
+// budget has already counted the request in it, so the reservation is only
+// corrected with the tokens used when the provider reports no token limit.
+func (s *RateScheduler) Settle(limits RateLimits, reserved, used int) {
+	s.Observe(limits)
+	if limits.LimitTokens <= 0 {
+		s.Reconcile(reserved, used)
+	}
+}
+
+// Reconcile corrects the token reservation of a finished request with the
+// tokens it actually used
+func (s *RateScheduler) Reconcile(reserved, used int) {
+	if used <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens.level -= float64(used - reserved)
+}
+
+// Backoff holds all calls until the given time, after a 429
+func (s *RateScheduler) Backoff(until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until.After(s.requests.blocked) {
+		s.requests.blocked = until
+	}
+}
+
+// Stats returns the effective limits and how much calls were throttled
+func (s *RateScheduler) Stats() RateSchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return RateSchedulerStats{
+		RequestsPerMinute: int(s.requests.capacity),
+		TokensPerMinute:   int(s.tokens.capacity),
+		Throttled:         s.throttled,
+		Waited:            s.waited,
+	}
+}
+
+// base64Run matches the long base64 strings images are sent as
+var base64Run = regexp.MustCompile(`[A-Za-z0-9+/]{1000,}={0,2}`)
+
+// imageTokens is about what providers charge for one image, whatever its
+// size in bytes
+const imageTokens = 1000
+
+// estimateRequestTokens estimates the tokens a request body will consume.
+// Images count as imageTokens each rather than by their base64 length.
+func estimateRequestTokens(body []byte) int {
+	images := base64Run.FindAllIndex(body, -1)
+	chars := len(body)
+	for _, loc := range images {
+		chars -= loc[1] - loc[0]
+	}
+	return int(float64(chars)/defaultCharsPerToken) + len(images)*imageTokens
+}
+
+// retryAfter reads a Retry-After header (seconds or an HTTP date)
+func retryAfter(h http.Header, now time.Time) time.Time {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return time.Time{}
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return now.Add(time.Duration(seconds) * time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// sleepFor waits for d or until ctx is done
+func sleepFor(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
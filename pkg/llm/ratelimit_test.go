@@ -0,0 +1,129 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newTestScheduler returns a scheduler on a fake clock that sleeping advances
+func newTestScheduler() (*RateScheduler, *time.Time) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := NewRateScheduler()
+	s.now = func() time.Time { return now }
+	s.sleep = func(ctx context.Context, d time.Duration) error {
+		now = now.Add(d)
+		return nil
+	}
+	return s, &now
+}
+
+func TestRateScheduler_Wait(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(s *RateScheduler, now time.Time)
+		tokens   []int
+		expected []time.Duration
+	}{
+		{"requests per minute", func(s *RateScheduler, now time.Time) { s.SetLimits(2, 0) },
+			[]int{0, 0, 0}, []time.Duration{0, 0, 30 * time.Second}},
+		{"tokens per minute", func(s *RateScheduler, now time.Time) { s.SetLimits(0, 1000) },
+			[]int{600, 600}, []time.Duration{0, 12 * time.Second}},
+		{"exhausted by headers", func(s *RateScheduler, now time.Time) {
+			s.Observe(RateLimits{LimitRequests: 500, RemainingRequests: 0, ResetRequests: now.Add(10 * time.Second)})
+		}, []int{0, 0}, []time.Duration{10 * time.Second, 0}},
+		{"backoff after 429", func(s *RateScheduler, now time.Time) { s.Backoff(now.Add(5 * time.Second)) },
+			[]int{0}, []time.Duration{5 * time.Second}},
+		{"unreported limits", func(s *RateScheduler, now time.Time) { s.Observe(RateLimits{}) },
+			[]int{100000, 100000}, []time.Duration{0, 0}},
+	}
+
+	for _, tt := range tests {
+		s, now := newTestScheduler()
+		tt.setup(s, *now)
+		for i, tokens := range tt.tokens {
+			waited, err := s.Wait(context.Background(), tokens)
+			if err != nil || waited != tt.expected[i] {
+				t.Errorf("%s: call %d expected to wait %s, got %s (%v)", tt.name, i+1, tt.expected[i], waited, err)
+			}
+		}
+	}
+}
+
+func TestRateScheduler_ReconcileAndStats(t *testing.T) {
+	s, now := newTestScheduler()
+	s.SetLimits(0, 1000)
+	s.Wait(context.Background(), 100)
+	s.Reconcile(100, 900) // The request used far more than estimated
+
+	if waited, _ := s.Wait(context.Background(), 200); waited != 6*time.Second {
+		t.Errorf("Expected the true-up to delay the next call by 6s, got %s", waited)
+	}
+	if stats := s.Stats(); stats.TokensPerMinute != 1000 || stats.Throttled != 1 || stats.Waited != 6*time.Second {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.sleep = sleepFor
+	s.Backoff(now.Add(time.Hour))
+	if _, err := s.Wait(cancelled, 0); err == nil {
+		t.Error("Expected a cancelled wait to fail")
+	}
+}
+
+func TestRateScheduler_Settle(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   RateLimits
+		expected time.Duration // Wait of the next 500-token call
+	}{
+		// The reported remaining budget already includes the request
+		{"reported budget", RateLimits{LimitTokens: 1000, RemainingTokens: 400}, 6 * time.Second},
+		// Otherwise the 100-token reservation is trued up to the 900 used
+		{"unreported budget", RateLimits{}, 24 * time.Second},
+	}
+
+	for _, tt := range tests {
+		s, _ := newTestScheduler()
+		s.SetLimits(0, 1000)
+		s.Wait(context.Background(), 100)
+		s.Settle(tt.limits, 100, 900)
+
+		if waited, _ := s.Wait(context.Background(), 500); waited != tt.expected {
+			t.Errorf("%s: expected the next call to wait %s, got %s", tt.name, tt.expected, waited)
+		}
+	}
+}
+
+func TestEstimateRequestTokens_Images(t *testing.T) {
+	image := ImagePart("image/png", make([]byte, 300*1024))
+	body, _ := (&OpenAIProvider{}).BuildRequestBody("gpt-4o", []Message{NewImageMessage("user", "What is this?", image)}, nil, nil, nil, nil, false)
+
+	if got := estimateRequestTokens(body); got < imageTokens || got > imageTokens+100 {
+		t.Errorf("Expected about %d tokens for one image, got %d", imageTokens, got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Time
+	}{
+		{"30", now.Add(30 * time.Second)},
+		{"Wed, 01 Jan 2025 12:01:00 GMT", now.Add(time.Minute)},
+		{"", time.Time{}},
+		{"soon", time.Time{}},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.value != "" {
+			h.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(h, now); !got.Equal(tt.expected) {
+			t.Errorf("%q: expected %s, got %s", tt.value, tt.expected, got)
+		}
+	}
+}
@@ -3,14 +3,30 @@ package llm
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"time"
+
+	"ClosedWheeler/pkg/utils"
 )
 
 // StreamingCallback is called for each chunk of the response
 type StreamingCallback func(chunk string, done bool)
 
+// ToolCallDelta reports a tool call the model is still generating
+type ToolCallDelta struct {
+	Index     int    // Position of the call among the response's tool calls
+	ID        string // Call ID, if the provider sent it yet
+	Name      string // Tool name
+	Arguments string // Arguments received so far: a JSON prefix until the call is complete
+}
+
+// ToolCallCallback is called each time more of a tool call's arguments arrive
+type ToolCallCallback func(delta ToolCallDelta)
+
 // StreamingDelta represents a streaming response delta
 type StreamingDelta struct {
 	Content   string     `json:"content,omitempty"`
@@ -31,39 +47,194 @@ type StreamingResponse struct {
 	Created int64             `json:"created"`
 	Model   string            `json:"model"`
 	Choices []StreamingChoice `json:"choices"`
+	Usage   *Usage            `json:"usage,omitempty"` // Final chunk, when stream_options.include_usage is set
 }
 
 // ChatWithStreaming sends a chat request and streams the response
 func (c *Client) ChatWithStreaming(messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, callback StreamingCallback) (*ChatResponse, error) {
+	return c.ChatWithStreamingContext(context.Background(), messages, tools, temperature, topP, maxTokens, callback)
+}
+
+// ChatWithStreamingContext is like ChatWithStreaming but aborts the request and
+// the SSE parse when ctx is cancelled
+func (c *Client) ChatWithStreamingContext(ctx context.Context, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, callback StreamingCallback) (*ChatResponse, error) {
+	return c.ChatWithStreamingToolCallsContext(ctx, messages, tools, temperature, topP, maxTokens, callback, nil)
+}
+
+// ChatWithStreamingToolCallsContext is like ChatWithStreamingContext and also
+// reports tool call arguments as they stream in, for providers that stream
+// them (see ToolCallStreamer). onToolCall may be nil.
+func (c *Client) ChatWithStreamingToolCallsContext(ctx context.Context, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, callback StreamingCallback, onToolCall ToolCallCallback) (*ChatResponse, error) {
+	if len(c.fallbackModels) > 0 {
+		return c.streamWithFallback(ctx, messages, tools, temperature, topP, maxTokens, callback, onToolCall)
+	}
+	resp, _, err := c.streamWithModel(ctx, c.model, messages, tools, temperature, topP, maxTokens, 0, callback, onToolCall)
+	return resp, err
+}
+
+// streamWithFallback is chatWithFallback for streamed requests. A model that
+// fails after streaming part of its reply is not replaced, as the caller has
+// already shown that part.
+func (c *Client) streamWithFallback(ctx context.Context, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, callback StreamingCallback, onToolCall ToolCallCallback) (*ChatResponse, error) {
+	resp, streamed, err := c.streamWithModel(ctx, c.model, messages, tools, temperature, topP, maxTokens, c.fallbackTimeout, callback, onToolCall)
+	if err == nil || streamed {
+		return resp, err
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	log.Printf("[INFO] Primary model %s failed or timed out: %v. Trying fallback models...", c.model, err)
+
+	for i, fallbackModel := range c.fallbackModels {
+		log.Printf("[INFO] Attempting fallback model %d/%d: %s", i+1, len(c.fallbackModels), fallbackModel)
+
+		resp, streamed, fallbackErr := c.streamWithModel(ctx, fallbackModel, messages, tools, temperature, topP, maxTokens, c.fallbackTimeout, callback, onToolCall)
+		if fallbackErr == nil {
+			log.Printf("[INFO] Fallback model %s succeeded!", fallbackModel)
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if streamed {
+			return resp, fallbackErr
+		}
+
+		log.Printf("[WARN] Fallback model %s failed: %v", fallbackModel, fallbackErr)
+	}
+
+	return nil, fmt.Errorf("all models failed, primary error: %w", err)
+}
+
+// streamWithModel streams a reply from model. Like send, it retries transient
+// failures, but only until the response starts: a stream that breaks off is
+// not retried. timeout, if set, bounds the wait for the response to start.
+// streamed reports whether any chunk reached the callbacks.
+func (c *Client) streamWithModel(ctx context.Context, model string, messages []Message, tools []ToolDefinition, temperature *float64, topP *float64, maxTokens *int, timeout time.Duration, callback StreamingCallback, onToolCall ToolCallCallback) (parsed *ChatResponse, streamed bool, err error) {
 	// Refresh OAuth token before the request (no-op if not using OAuth)
 	c.RefreshOAuthIfNeeded()
 
-	jsonData, err := c.provider.BuildRequestBody(c.model, messages, tools, temperature, topP, maxTokens, true)
+	jsonData, err := c.provider.BuildRequestBody(model, messages, tools, temperature, topP, maxTokens, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return nil, false, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", c.provider.Endpoint(c.baseURL), bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	breaker := c.breaker(model)
+	if err := breaker.Allow(); err != nil {
+		return nil, false, err
 	}
 
-	c.provider.SetHeaders(req, c.apiKey)
-	req.Header.Set("Accept", "text/event-stream")
+	var resp *http.Response
+	scheduler := SchedulerFor(c.baseURL, model)
+	reserved := estimateRequestTokens(jsonData)
+	fault := false // The last attempt failed because the provider is unavailable
+	operation := func() error {
+		if _, err := scheduler.Wait(ctx, reserved); err != nil {
+			return err
+		}
+		reqCtx, cancel := context.WithCancel(ctx)
+		req, err := http.NewRequestWithContext(reqCtx, "POST", c.endpoint(model, true), bytes.NewBuffer(jsonData))
+		if err != nil {
+			cancel()
+			return fmt.Errorf("failed to create request: %w", err)
+		}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		c.provider.SetHeaders(req, c.apiKey)
+		req.Header.Set("Accept", "text/event-stream")
+
+		var timer *time.Timer
+		if timeout > 0 {
+			timer = time.AfterFunc(timeout, cancel)
+		}
+		r, err := c.httpClient.Do(req)
+		if timer != nil && !timer.Stop() && err == nil {
+			err = fmt.Errorf("no response within %v", timeout)
+			r.Body.Close()
+		}
+		if err != nil {
+			cancel()
+			fault = true
+			return fmt.Errorf("failed to send request: %w", err)
+		}
+
+		if r.StatusCode == http.StatusTooManyRequests {
+			scheduler.Backoff(retryAfter(r.Header, time.Now()))
+		}
+		if r.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(r.Body)
+			r.Body.Close()
+			cancel()
+			fault = providerFault(r.StatusCode)
+			return fmt.Errorf("API error (status %d): %s", r.StatusCode, string(body))
+		}
+		// The request context lives as long as the body
+		r.Body = cancelOnClose{r.Body, cancel}
+		resp = r
+		return nil
+	}
+
+	if err := utils.ExecuteWithRetryContext(ctx, operation, c.retryConfig()); err != nil {
+		switch {
+		case ctx.Err() != nil:
+			breaker.Abandoned()
+		case fault:
+			breaker.Failed(err)
+			return nil, false, unavailableError{err}
+		default:
+			breaker.Succeeded()
+		}
+		return nil, false, err
 	}
+	breaker.Succeeded()
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	// Note whether the caller has seen any of the reply
+	onChunk := func(chunk string, done bool) {
+		if chunk != "" {
+			streamed = true
+		}
+		if callback != nil {
+			callback(chunk, done)
+		}
 	}
 
 	// Delegate SSE parsing to the provider
-	return c.provider.ParseSSEStream(resp.Body, callback)
+	if streamer, ok := c.provider.(ToolCallStreamer); ok && onToolCall != nil {
+		parsed, err = streamer.ParseSSEStreamWithToolCalls(resp.Body, onChunk, func(delta ToolCallDelta) {
+			streamed = true
+			onToolCall(delta)
+		})
+	} else {
+		parsed, err = c.provider.ParseSSEStream(resp.Body, onChunk)
+	}
+	if ctx.Err() != nil {
+		// A cancelled stream may still parse cleanly up to the cut; don't return a partial response
+		return nil, streamed, ctx.Err()
+	}
+	if err != nil {
+		if !streamed {
+			// The stream broke before the caller saw any of it, so another provider may still answer
+			err = unavailableError{err}
+		}
+		return parsed, streamed, err
+	}
+	parsed.RateLimits = c.provider.ParseRateLimits(resp.Header)
+	scheduler.Settle(parsed.RateLimits, reserved, parsed.Usage.TotalTokens)
+	c.reportUsage(model, parsed)
+	return parsed, streamed, nil
+}
+
+// cancelOnClose releases a request's context once its body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
 }
 
 // SimpleQueryStreaming sends a simple query with streaming
@@ -0,0 +1,163 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSSEStreamWithToolCalls(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider ToolCallStreamer
+		stream   string
+	}{
+		{
+			name:     "OpenAI",
+			provider: &OpenAIProvider{},
+			stream: `data: {"choices":[{"delta":{"tool_calls":[{"id":"call_1","type":"function","function":{"name":"write_file","arguments":""}}]}}]}` + "\n\n" +
+				`data: {"choices":[{"delta":{"tool_calls":[{"function":{"arguments":"{\"path\":"}}]}}]}` + "\n\n" +
+				`data: {"choices":[{"delta":{"tool_calls":[{"function":{"arguments":"\"a.go\"}"}}]}}]}` + "\n\n" +
+				`data: {"choices":[{"delta":{},"finish_reason":"tool_calls"}]}` + "\n\n" +
+				"data: [DONE]\n\n",
+		},
+		{
+			name:     "Anthropic",
+			provider: &AnthropicProvider{},
+			stream: "event: content_block_start\n" +
+				`data: {"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"call_1","name":"write_file"}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"{\"path\":"}}` + "\n\n" +
+				"event: content_block_delta\n" +
+				`data: {"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":"\"a.go\"}"}}` + "\n\n" +
+				"event: message_stop\n" +
+				`data: {"type":"message_stop"}` + "\n\n",
+		},
+		{
+			name:     "Responses",
+			provider: &ResponsesProvider{},
+			stream: `data: {"type":"response.output_item.added","output_index":0,"item":{"type":"function_call","call_id":"call_1","name":"write_file","arguments":""}}` + "\n\n" +
+				`data: {"type":"response.function_call_arguments.delta","output_index":0,"delta":"{\"path\":"}` + "\n\n" +
+				`data: {"type":"response.function_call_arguments.delta","output_index":0,"delta":"\"a.go\"}"}` + "\n\n" +
+				`data: {"type":"response.completed","response":{"id":"resp_1","status":"completed","output":[{"type":"function_call","call_id":"call_1","name":"write_file","arguments":"{\"path\":\"a.go\"}"}]}}` + "\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var deltas []ToolCallDelta
+			resp, err := tt.provider.ParseSSEStreamWithToolCalls(strings.NewReader(tt.stream), nil, func(d ToolCallDelta) {
+				deltas = append(deltas, d)
+			})
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+
+			if len(deltas) != 2 {
+				t.Fatalf("Expected 2 deltas, got %d: %+v", len(deltas), deltas)
+			}
+			if deltas[0].Arguments != `{"path":` {
+				t.Errorf("Expected first delta to carry the arguments so far, got %q", deltas[0].Arguments)
+			}
+			last := deltas[1]
+			if last.Index != 0 || last.ID != "call_1" || last.Name != "write_file" || last.Arguments != `{"path":"a.go"}` {
+				t.Errorf("Unexpected last delta: %+v", last)
+			}
+
+			calls := resp.Choices[0].Message.ToolCalls
+			if len(calls) != 1 || calls[0].Function.Arguments != `{"path":"a.go"}` {
+				t.Errorf("Expected the assembled tool call, got %+v", calls)
+			}
+		})
+	}
+}
+
+func TestOpenAIProvider_StreamUsage(t *testing.T) {
+	body, err := (&OpenAIProvider{}).BuildRequestBody("gpt-4o", []Message{{Role: "user", Content: "hi"}}, nil, nil, nil, nil, true)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if !strings.Contains(string(body), `"stream_options":{"include_usage":true}`) {
+		t.Errorf("Expected streamed requests to ask for usage, got %s", body)
+	}
+
+	stream := `data: {"choices":[{"delta":{"content":"hi"},"finish_reason":"stop"}]}` + "\n\n" +
+		`data: {"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12,"prompt_tokens_details":{"cached_tokens":4}}}` + "\n\n" +
+		"data: [DONE]\n\n"
+	resp, err := (&OpenAIProvider{}).ParseSSEStream(strings.NewReader(stream), nil)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12, CachedTokens: 4}
+	if resp.Usage != want {
+		t.Errorf("Expected usage %+v, got %+v", want, resp.Usage)
+	}
+}
+
+func TestStreaming_FallbackModels(t *testing.T) {
+	defer skipRetryDelays()()
+
+	tests := []struct {
+		name     string
+		primary  string // "down" answers 503, "cut" breaks off mid-stream
+		expected string // Streamed text, "" when the request fails
+	}{
+		{"Primary down before streaming", "down", "from backup"},
+		{"Primary cut mid-stream", "cut", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var backupHits int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var req struct {
+					Model string `json:"model"`
+				}
+				json.NewDecoder(r.Body).Decode(&req)
+				w.Header().Set("Content-Type", "text/event-stream")
+				if req.Model == "backup" {
+					backupHits++
+					w.Write([]byte(`data: {"choices":[{"delta":{"content":"from backup"},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n"))
+					return
+				}
+				if tt.primary == "down" {
+					http.Error(w, "overloaded", http.StatusServiceUnavailable)
+					return
+				}
+				// Send the first chunk, then drop the connection
+				w.Write([]byte(`data: {"choices":[{"delta":{"content":"from primary"}}]}` + "\n\n"))
+				w.(http.Flusher).Flush()
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+			}))
+			defer server.Close()
+
+			client := NewClientWithProvider(server.URL, "key", "primary-"+tt.primary, "openai")
+			client.SetFallbackModels([]string{"backup"}, 5)
+
+			var streamed strings.Builder
+			_, err := client.ChatWithStreamingContext(context.Background(), []Message{{Role: "user", Content: "hi"}}, nil, nil, nil, nil, func(chunk string, done bool) {
+				streamed.WriteString(chunk)
+			})
+
+			if tt.expected == "" {
+				if err == nil {
+					t.Errorf("Expected the broken stream to fail")
+				}
+				if backupHits != 0 {
+					t.Errorf("Expected no fallback after streaming began, got %d backup requests", backupHits)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected the fallback model to answer, got %v", err)
+			}
+			if streamed.String() != tt.expected {
+				t.Errorf("Expected %q streamed, got %q", tt.expected, streamed.String())
+			}
+		})
+	}
+}
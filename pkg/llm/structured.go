@@ -0,0 +1,248 @@
+// Package llm provides structured (JSON schema) output
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"strings"
+)
+
+// structuredMaxAttempts is how many replies a structured query reads before giving up
+const structuredMaxAttempts = 3
+
+// ResponseSchema describes the JSON object a structured query must return
+type ResponseSchema struct {
+	Name        string                 // Identifier such as "model_config" (letters, digits, _ and -)
+	Description string                 // What the object is, shown to the model
+	Schema      map[string]interface{} // JSON Schema of the object
+	Strict      bool                   // Schema meets OpenAI's strict rules: every property required, no additional properties
+}
+
+// StructuredProvider is implemented by providers that can constrain a reply
+// to a JSON schema natively
+type StructuredProvider interface {
+	BuildStructuredRequestBody(model string, messages []Message, schema ResponseSchema, temperature *float64, maxTokens *int) ([]byte, error)
+}
+
+// QueryStructured asks prompt and decodes the reply, which must match schema, into out
+func (c *Client) QueryStructured(prompt string, schema ResponseSchema, out interface{}) error {
+	return c.QueryStructuredContext(context.Background(), []Message{{Role: "user", Content: prompt}}, schema, out, nil, nil)
+}
+
+// QueryStructuredContext is like QueryStructured for a whole conversation.
+// Providers with native support constrain the reply to the schema; for the
+// others the schema is put in the prompt. Replies that are not valid for the
+// schema are sent back with the error to be corrected.
+func (c *Client) QueryStructuredContext(ctx context.Context, messages []Message, schema ResponseSchema, out interface{}, temperature *float64, maxTokens *int) error {
+	native, _ := c.provider.(StructuredProvider)
+	conversation := messages
+	if native == nil {
+		conversation = withSchemaPrompt(messages, schema)
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= structuredMaxAttempts; attempt++ {
+		reply, err := c.structuredReply(ctx, native, conversation, schema, temperature, maxTokens)
+		if err != nil && native != nil && ctx.Err() == nil {
+			// Compatible servers often reject native structured output; ask in the prompt instead
+			log.Printf("[WARN] %s rejected structured output, prompting for JSON instead: %v", c.provider.Name(), err)
+			native = nil
+			conversation = withSchemaPrompt(messages, schema)
+			reply, err = c.structuredReply(ctx, nil, conversation, schema, temperature, maxTokens)
+		}
+		if err != nil {
+			return err
+		}
+
+		if lastErr = decodeStructured(reply, schema, out); lastErr == nil {
+			return nil
+		}
+		log.Printf("[WARN] Invalid %s reply (attempt %d/%d): %v", schema.Name, attempt, structuredMaxAttempts, lastErr)
+		conversation = append(append([]Message(nil), conversation...),
+			Message{Role: "assistant", Content: reply},
+			Message{Role: "user", Content: fmt.Sprintf("That reply is invalid: %v. Reply again with only the corrected JSON object.", lastErr)},
+		)
+	}
+	return fmt.Errorf("model returned invalid %s: %w", schema.Name, lastErr)
+}
+
+// structuredReply sends one structured request and returns the raw JSON reply
+func (c *Client) structuredReply(ctx context.Context, native StructuredProvider, messages []Message, schema ResponseSchema, temperature *float64, maxTokens *int) (string, error) {
+	var resp *ChatResponse
+	var err error
+	if native != nil {
+		c.RefreshOAuthIfNeeded()
+		body, buildErr := native.BuildStructuredRequestBody(c.model, messages, schema, temperature, maxTokens)
+		if buildErr != nil {
+			return "", fmt.Errorf("failed to marshal request: %w", buildErr)
+		}
+		resp, err = c.send(ctx, c.model, body, 0)
+	} else {
+		resp, err = c.chatWithModel(ctx, c.model, messages, nil, temperature, nil, maxTokens, 0)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Tool-forced providers return the object as the arguments of a call
+	if calls := c.GetToolCalls(resp); len(calls) > 0 {
+		return calls[0].Function.Arguments, nil
+	}
+	return c.GetContent(resp), nil
+}
+
+// withSchemaPrompt prepends an instruction to reply with JSON for schema
+func withSchemaPrompt(messages []Message, schema ResponseSchema) []Message {
+	schemaJSON, _ := json.MarshalIndent(schema.Schema, "", "  ")
+	instruction := fmt.Sprintf("Reply with only a JSON object (no markdown, no explanations) matching this JSON Schema:\n%s", schemaJSON)
+	if schema.Description != "" {
+		instruction = schema.Description + "\n\n" + instruction
+	}
+	return append([]Message{{Role: "system", Content: instruction}}, messages...)
+}
+
+// decodeStructured validates a reply against schema and decodes it into out
+func decodeStructured(reply string, schema ResponseSchema, out interface{}) error {
+	content := cleanJSONResponse(reply)
+	var value interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return fmt.Errorf("not valid JSON: %w", err)
+	}
+	if err := validateSchema(schema.Schema, value, "reply"); err != nil {
+		return err
+	}
+	if err := json.Unmarshal([]byte(content), out); err != nil {
+		return fmt.Errorf("does not fit %s: %w", schema.Name, err)
+	}
+	return nil
+}
+
+// cleanJSONResponse removes markdown code blocks and whitespace
+func cleanJSONResponse(content string) string {
+	// Remove markdown code blocks
+	content = strings.TrimSpace(content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+	content = strings.TrimSpace(content)
+
+	// Find JSON object boundaries
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+
+	if start != -1 && end != -1 && end > start {
+		content = content[start : end+1]
+	}
+
+	return content
+}
+
+// validateSchema checks value against the subset of JSON Schema that
+// structured queries use: type, enum, properties, required, items and minItems
+func validateSchema(schema map[string]interface{}, value interface{}, path string) error {
+	if types := stringList(schema["type"]); len(types) > 0 {
+		matched := false
+		for _, t := range types {
+			if matchesType(t, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("%s must be %s", path, strings.Join(types, " or "))
+		}
+	}
+
+	if enum, ok := schema["enum"]; ok {
+		allowed := reflect.ValueOf(enum)
+		found := false
+		for i := 0; allowed.Kind() == reflect.Slice && i < allowed.Len(); i++ {
+			if fmt.Sprint(allowed.Index(i).Interface()) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s must be one of %v", path, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, field := range v {
+			if fieldSchema, ok := properties[name].(map[string]interface{}); ok {
+				if err := validateSchema(fieldSchema, field, path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if minItems, ok := schema["minItems"].(int); ok && len(v) < minItems {
+			return fmt.Errorf("%s needs at least %d items", path, minItems)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchesType reports whether a decoded JSON value has the JSON Schema type t
+func matchesType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+// stringList reads a schema keyword holding a string or a list of strings
+func stringList(v interface{}) []string {
+	switch list := v.(type) {
+	case string:
+		return []string{list}
+	case []string:
+		return list
+	case []interface{}:
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testRatingSchema = ResponseSchema{
+	Name: "rating",
+	Schema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"score": map[string]interface{}{"type": "integer"},
+			"tags":  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+			"level": map[string]interface{}{"type": "string", "enum": []string{"low", "high"}},
+		},
+		"required": []string{"score", "tags"},
+	},
+}
+
+type testRating struct {
+	Score int      `json:"score"`
+	Tags  []string `json:"tags"`
+	Level string   `json:"level"`
+}
+
+func TestDecodeStructured(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply string
+		err   string
+	}{
+		{"valid in a code block", "```json\n{\"score\": 7, \"tags\": [\"go\"], \"level\": \"high\"}\n```", ""},
+		{"not JSON", "NONE", "not valid JSON"},
+		{"missing field", `{"score": 7}`, "reply.tags is required"},
+		{"wrong type", `{"score": 7.5, "tags": []}`, "reply.score must be integer"},
+		{"bad item", `{"score": 7, "tags": [1]}`, "reply.tags[0] must be string"},
+		{"bad enum", `{"score": 7, "tags": [], "level": "mid"}`, "reply.level must be one of"},
+	}
+
+	for _, tt := range tests {
+		var out testRating
+		err := decodeStructured(tt.reply, testRatingSchema, &out)
+		if tt.err == "" && (err != nil || out.Score != 7) {
+			t.Errorf("%s: expected a decoded rating, got %+v (%v)", tt.name, out, err)
+		}
+		if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestQueryStructured_Repair(t *testing.T) {
+	scenario := `{"rules": [
+		{"match": "^Rate", "responses": [{"text": "{\"score\": \"seven\", \"tags\": []}"}]},
+		{"match": "^That reply is invalid: reply.score must be integer", "responses": [{"text": "{\"score\": 7, \"tags\": [\"go\"]}"}]}
+	]}`
+	path := filepath.Join(t.TempDir(), "scenario.json")
+	os.WriteFile(path, []byte(scenario), 0644)
+	loaded, err := LoadMockScenario(path)
+	if err != nil {
+		t.Fatalf("Failed to load scenario: %v", err)
+	}
+	client := NewClientWithProvider("", "", "mock-model", "mock")
+	client.SetMockScenario(loaded)
+
+	var out testRating
+	if err := client.QueryStructured("Rate this repo", testRatingSchema, &out); err != nil {
+		t.Fatalf("Expected the corrected reply to decode, got %v", err)
+	}
+	if out.Score != 7 || len(out.Tags) != 1 {
+		t.Errorf("Expected the corrected rating, got %+v", out)
+	}
+
+	if err := client.QueryStructured("Something else", testRatingSchema, &out); err == nil || !strings.Contains(err.Error(), "invalid rating") {
+		t.Errorf("Expected an invalid rating error after the retries, got %v", err)
+	}
+}
+
+func TestAnthropicProvider_StructuredToolChoice(t *testing.T) {
+	var req map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&req)
+		fmt.Fprint(w, `{"id":"msg_1","type":"message","role":"assistant","stop_reason":"tool_use",
+			"content":[{"type":"tool_use","id":"tu_1","name":"rating","input":{"score":9,"tags":["fast"]}}],
+			"usage":{"input_tokens":10,"output_tokens":5}}`)
+	}))
+	defer server.Close()
+
+	client := NewClientWithProvider(server.URL, "sk-ant-test", "claude-sonnet-4", "anthropic")
+	client.SetReasoningEffort("high")
+	var out testRating
+	if err := client.QueryStructured("Rate this repo", testRatingSchema, &out); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if out.Score != 9 || out.Tags[0] != "fast" {
+		t.Errorf("Expected the tool input as the reply, got %+v", out)
+	}
+
+	choice, _ := req["tool_choice"].(map[string]any)
+	if choice["type"] != "tool" || choice["name"] != "rating" || req["thinking"] != nil {
+		t.Errorf("Expected a forced rating tool without thinking, got %v / %v", req["tool_choice"], req["thinking"])
+	}
+}
+
+func TestOpenAIProvider_StructuredResponseFormat(t *testing.T) {
+	body, err := (&OpenAIProvider{}).BuildStructuredRequestBody("gpt-4o", []Message{{Role: "user", Content: "Rate"}}, testRatingSchema, nil, nil)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	var req ChatRequest
+	json.Unmarshal(body, &req)
+	if req.ResponseFormat == nil || req.ResponseFormat.Type != "json_schema" || req.ResponseFormat.JSONSchema.Name != "rating" {
+		t.Errorf("Expected a json_schema response format, got %+v", req.ResponseFormat)
+	}
+}
+
+func TestMockProvider_StructuredPrompt(t *testing.T) {
+	body, err := NewMockProvider(nil).BuildStructuredRequestBody("mock-model", []Message{{Role: "user", Content: "Rate"}}, testRatingSchema, nil, nil)
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	var req ChatRequest
+	json.Unmarshal(body, &req)
+	if req.ResponseFormat != nil {
+		t.Errorf("Expected no json_schema format for the mock, got %+v", req.ResponseFormat)
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Role != "system" || !strings.Contains(req.Messages[0].Content, "JSON Schema") {
+		t.Errorf("Expected the schema asked for in the prompt, got %+v", req.Messages)
+	}
+}
@@ -0,0 +1,102 @@
+// Package llm provides local token estimation calibrated against provider usage
+package llm
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+const (
+	defaultCharsPerToken = 4.0 // Typical for English prose and code
+	messageOverhead      = 4   // Role and framing tokens per message
+	calibrationWeight    = 0.3 // Weight of a new observation in the running ratio
+)
+
+// TokenEstimator estimates token counts from text length. The chars-per-token
+// ratio starts at a typical value and is calibrated with the exact prompt token
+// counts providers report in their usage data.
+type TokenEstimator struct {
+	mu            sync.Mutex
+	charsPerToken float64
+	samples       int
+}
+
+// NewTokenEstimator creates an uncalibrated estimator
+func NewTokenEstimator() *TokenEstimator {
+	return &TokenEstimator{charsPerToken: defaultCharsPerToken}
+}
+
+// CharsPerToken returns the current calibrated ratio
+func (e *TokenEstimator) CharsPerToken() float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.charsPerToken
+}
+
+// Calibrated reports whether at least one provider count has been observed
+func (e *TokenEstimator) Calibrated() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.samples > 0
+}
+
+// EstimateText estimates the tokens in a string
+func (e *TokenEstimator) EstimateText(text string) int {
+	return e.tokensFor(len(text))
+}
+
+// EstimatePrompt estimates the prompt tokens of a request
+func (e *TokenEstimator) EstimatePrompt(messages []Message, tools []ToolDefinition) int {
+	return e.tokensFor(PromptChars(messages, tools)) + len(messages)*messageOverhead
+}
+
+// Observe calibrates the estimator with the exact prompt token count a provider
+// reported for a request of promptChars characters and messageCount messages
+func (e *TokenEstimator) Observe(promptChars, messageCount, promptTokens int) {
+	tokens := promptTokens - messageCount*messageOverhead
+	if promptChars <= 0 || tokens <= 0 {
+		return
+	}
+
+	ratio := float64(promptChars) / float64(tokens)
+	if ratio < 1 || ratio > 10 {
+		return // Outlier (e.g. cached or images); don't skew the estimate
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.samples == 0 {
+		e.charsPerToken = ratio
+	} else {
+		e.charsPerToken = e.charsPerToken*(1-calibrationWeight) + ratio*calibrationWeight
+	}
+	e.samples++
+}
+
+func (e *TokenEstimator) tokensFor(chars int) int {
+	if chars <= 0 {
+		return 0
+	}
+	e.mu.Lock()
+	ratio := e.charsPerToken
+	e.mu.Unlock()
+	return int(float64(chars)/ratio + 0.5)
+}
+
+// PromptChars counts the characters of a request that end up as prompt tokens:
+// message contents, tool calls and tool schemas
+func PromptChars(messages []Message, tools []ToolDefinition) int {
+	chars := 0
+	for _, msg := range messages {
+		chars += len(msg.Content)
+		for _, tc := range msg.ToolCalls {
+			chars += len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+	}
+	if len(tools) > 0 {
+		if data, err := json.Marshal(tools); err == nil {
+			chars += len(data)
+		}
+	}
+	return chars
+}
@@ -0,0 +1,51 @@
+package llm
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTokenEstimator_Calibration(t *testing.T) {
+	tests := []struct {
+		name     string
+		chars    int
+		messages int
+		tokens   int
+		expected float64 // chars per token after observing
+	}{
+		{"Default ratio", 0, 0, 0, defaultCharsPerToken},
+		{"Dense text", 3000, 0, 1000, 3.0},
+		{"Message overhead excluded", 3000, 10, 1040, 3.0},
+		{"Outlier ignored", 100, 0, 1000, defaultCharsPerToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := NewTokenEstimator()
+			e.Observe(tt.chars, tt.messages, tt.tokens)
+			if got := e.CharsPerToken(); math.Abs(got-tt.expected) > 0.001 {
+				t.Errorf("Expected %.3f chars/token, got %.3f", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTokenEstimator_EstimatePrompt(t *testing.T) {
+	e := NewTokenEstimator()
+	messages := []Message{
+		{Role: "user", Content: strings.Repeat("a", 400)},
+		{Role: "assistant", ToolCalls: []ToolCall{{Function: FunctionCall{Name: "read_file", Arguments: strings.Repeat("b", 91)}}}},
+	}
+
+	// 400 + 9 + 91 chars at 4 chars/token, plus overhead for two messages
+	if got, expected := e.EstimatePrompt(messages, nil), 125+2*messageOverhead; got != expected {
+		t.Errorf("Expected %d tokens, got %d", expected, got)
+	}
+
+	// A provider count calibrates later estimates
+	e.Observe(500, 2, 250+2*messageOverhead)
+	if got, expected := e.EstimatePrompt(messages, nil), 250+2*messageOverhead; got != expected {
+		t.Errorf("Expected %d tokens after calibration, got %d", expected, got)
+	}
+}
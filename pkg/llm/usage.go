@@ -0,0 +1,49 @@
+// Package llm provides token usage accounting
+package llm
+
+import "encoding/json"
+
+// Add accumulates other into u
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+	u.CachedTokens += other.CachedTokens
+	u.CacheCreationTokens += other.CacheCreationTokens
+	u.ReasoningTokens += other.ReasoningTokens
+}
+
+// CacheHitRatio returns the share of prompt tokens read from the provider's cache
+func (u Usage) CacheHitRatio() float64 {
+	if u.PromptTokens <= 0 {
+		return 0
+	}
+	return float64(u.CachedTokens) / float64(u.PromptTokens)
+}
+
+// UnmarshalJSON reads usage in its own format as well as OpenAI's, which
+// reports cached and reasoning tokens in prompt_tokens_details and
+// completion_tokens_details.
+func (u *Usage) UnmarshalJSON(data []byte) error {
+	type flatUsage Usage
+	var wire struct {
+		flatUsage
+		PromptTokensDetails *struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+		CompletionTokensDetails *struct {
+			ReasoningTokens int `json:"reasoning_tokens"`
+		} `json:"completion_tokens_details"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*u = Usage(wire.flatUsage)
+	if wire.PromptTokensDetails != nil && u.CachedTokens == 0 {
+		u.CachedTokens = wire.PromptTokensDetails.CachedTokens
+	}
+	if wire.CompletionTokensDetails != nil && u.ReasoningTokens == 0 {
+		u.ReasoningTokens = wire.CompletionTokensDetails.ReasoningTokens
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUsage_UnmarshalOpenAIDetails(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected Usage
+	}{
+		{"details", `{"prompt_tokens":2000,"completion_tokens":300,"total_tokens":2300,"prompt_tokens_details":{"cached_tokens":1536},"completion_tokens_details":{"reasoning_tokens":256}}`,
+			Usage{PromptTokens: 2000, CompletionTokens: 300, TotalTokens: 2300, CachedTokens: 1536, ReasoningTokens: 256}},
+		{"flat", `{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12,"cached_tokens":4,"cache_creation_tokens":6}`,
+			Usage{PromptTokens: 10, CompletionTokens: 2, TotalTokens: 12, CachedTokens: 4, CacheCreationTokens: 6}},
+	}
+
+	for _, tt := range tests {
+		var resp ChatResponse
+		if err := json.Unmarshal([]byte(`{"id":"x","choices":[],"usage":`+tt.body+`}`), &resp); err != nil {
+			t.Fatalf("%s: unmarshal failed: %v", tt.name, err)
+		}
+		if resp.Usage != tt.expected {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expected, resp.Usage)
+		}
+	}
+}
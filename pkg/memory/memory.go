@@ -57,21 +57,19 @@ type Manager struct {
 
 // Config holds memory configuration
 type Config struct {
-	MaxShortTermItems  int `json:"max_short_term_items"`
-	MaxWorkingItems    int `json:"max_working_items"`
-	MaxLongTermItems   int `json:"max_long_term_items"`
-	MaxContextTokens   int `json:"max_context_tokens"`
-	CompressionTrigger int `json:"compression_trigger"` // Compress when short-term exceeds this
+	MaxShortTermItems int `json:"max_short_term_items"`
+	MaxWorkingItems   int `json:"max_working_items"`
+	MaxLongTermItems  int `json:"max_long_term_items"`
+	MaxContextTokens  int `json:"max_context_tokens"`
 }
 
 // DefaultConfig returns sensible defaults
 func DefaultConfig() *Config {
 	return &Config{
-		MaxShortTermItems:  20,
-		MaxWorkingItems:    50,
-		MaxLongTermItems:   100,
-		MaxContextTokens:   8000,
-		CompressionTrigger: 15,
+		MaxShortTermItems: 20,
+		MaxWorkingItems:   50,
+		MaxLongTermItems:  100,
+		MaxContextTokens:  8000,
 	}
 }
 
@@ -108,11 +106,6 @@ func (m *Manager) AddMessage(role, content string) *MemoryItem {
 
 	m.shortTerm = append(m.shortTerm, item)
 
-	// Check if we need to compress
-	if len(m.shortTerm) > m.config.CompressionTrigger {
-		m.triggerCompression()
-	}
-
 	return item
 }
 
@@ -223,6 +216,27 @@ func (m *Manager) GetMessages() []map[string]string {
 	return messages
 }
 
+// ReplaceMessages replaces short-term memory with the given role/content messages
+// (used when resuming or switching conversation sessions)
+func (m *Manager) ReplaceMessages(messages []map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.shortTerm = make([]*MemoryItem, 0, len(messages))
+	for _, msg := range messages {
+		m.shortTerm = append(m.shortTerm, &MemoryItem{
+			ID:         generateID(),
+			Tier:       ShortTerm,
+			Type:       "message",
+			Content:    msg["content"],
+			Metadata:   Metadata{Role: msg["role"]},
+			Relevance:  1.0,
+			CreatedAt:  time.Now(),
+			AccessedAt: time.Now(),
+		})
+	}
+}
+
 // UpdateRelevance updates the relevance score of an item and refreshes its timestamp
 func (m *Manager) UpdateRelevance(id string, relevance float64) {
 	m.mu.Lock()
@@ -314,10 +328,6 @@ func (m *Manager) GetItemsToCompress() []*MemoryItem {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	if len(m.shortTerm) < m.config.CompressionTrigger {
-		return nil
-	}
-
 	// Return older items (leave the last 5 for immediate context)
 	keep := 5
 	if len(m.shortTerm) <= keep {
@@ -416,11 +426,6 @@ func (m *Manager) Stats() map[string]int {
 	}
 }
 
-// triggerCompression is now handled by the Agent periodically
-func (m *Manager) triggerCompression() {
-	// Signal-only for now, logic lives in Agent.Chat
-}
-
 // evictLeastRelevant removes the least relevant item from working memory
 func (m *Manager) evictLeastRelevant() {
 	var minKey string
@@ -0,0 +1,163 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+)
+
+// Route describes the client a request is sent to first. When it fails the
+// request goes down the manager's fallback chain.
+type Route struct {
+	Client  *llm.Client                      // The caller's own client
+	BaseURL string                           // API base URL of Client
+	Model   string                           // Model of Client
+	Setup   func(c *llm.Client)              // Prepares each new fallback client (e.g. its usage hook); may be nil
+	Switch  func(from, to string, err error) // Called before each fallback attempt; may be nil
+}
+
+// failoverTarget is one client of a failover chain
+type failoverTarget struct {
+	client   *llm.Client
+	provider *Provider // Manager provider the client talks to; nil for an unregistered primary
+}
+
+// name returns the display name of the target
+func (t failoverTarget) name() string {
+	if t.provider != nil {
+		return t.provider.Name
+	}
+	return t.client.ProviderName()
+}
+
+// Failover sends a request with send to the route's client and, while the
+// provider is unavailable (see llm.IsProviderFault), to the clients of the
+// fallback chain. Other errors, such as a bad request, bad credentials or a
+// stream that broke off after part of the reply was shown, are returned as
+// they are. Each client translates the messages into its own API format.
+// Every attempt's latency, tokens and failures are recorded in the stats of
+// the provider it went to.
+func (pm *ProviderManager) Failover(ctx context.Context, route Route, send func(c *llm.Client) (*llm.ChatResponse, error)) (*llm.ChatResponse, error) {
+	primary := pm.FindProvider(route.BaseURL, route.Model)
+	targets := []failoverTarget{{client: route.Client, provider: primary}}
+	for _, p := range pm.FailoverChain() {
+		if p == primary || !p.usable() {
+			continue
+		}
+		targets = append(targets, failoverTarget{client: pm.client(p, route.Setup), provider: p})
+	}
+
+	var firstErr, lastErr error
+	for i, target := range targets {
+		if i > 0 {
+			from := targets[i-1].name()
+			log.Printf("[WARN] %s failed: %v. Failing over to %s", from, lastErr, target.name())
+			if route.Switch != nil {
+				route.Switch(from, target.name(), lastErr)
+			}
+		}
+
+		start := time.Now()
+		resp, err := send(target.client)
+		if ctx.Err() != nil {
+			return nil, ctx.Err() // Cancelled, not the provider's fault
+		}
+		if err == nil {
+			if target.provider != nil {
+				tokens := int64(resp.Usage.TotalTokens)
+				target.provider.RecordSuccess(tokens, time.Since(start), float64(tokens)/1000*target.provider.CostPerToken)
+			}
+			return resp, nil
+		}
+
+		if !llm.IsProviderFault(err) {
+			return nil, err // Any provider would fail it, or it has already been shown
+		}
+		if target.provider != nil && !errors.Is(err, llm.ErrCircuitOpen) {
+			target.provider.RecordFailure() // An open breaker sent nothing
+		}
+		lastErr = err
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if len(targets) == 1 {
+		return nil, firstErr
+	}
+	return nil, fmt.Errorf("all %d providers failed, primary error: %w", len(targets), firstErr)
+}
+
+// FailoverChain returns the enabled providers in the order requests fail
+// over to them: healthy ones by priority, then the unhealthy ones as a last
+// resort (a success makes them healthy again)
+func (pm *ProviderManager) FailoverChain() []*Provider {
+	chain := pm.GetFallbackChain()
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	for _, p := range pm.providers {
+		if p.Enabled && !p.IsHealthy() {
+			chain = append(chain, p)
+		}
+	}
+	return chain
+}
+
+// FindProvider returns the enabled provider serving model at baseURL, or nil
+func (pm *ProviderManager) FindProvider(baseURL, model string) *Provider {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	for _, p := range pm.providers {
+		if p.Enabled && sameBaseURL(p.BaseURL, baseURL) && strings.EqualFold(p.Model, model) {
+			return p
+		}
+	}
+	return nil
+}
+
+// client returns the cached client of a fallback provider, creating it on first use
+func (pm *ProviderManager) client(p *Provider, setup func(c *llm.Client)) *llm.Client {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if c, ok := pm.clients[p.ID]; ok {
+		return c
+	}
+	c := llm.NewClientWithProvider(p.BaseURL, p.APIKey, p.Model, p.Type.clientProvider())
+	if setup != nil {
+		setup(c)
+	}
+	pm.clients[p.ID] = c
+	return c
+}
+
+// usable reports whether requests can be sent to the provider: it needs an
+// API key unless it runs locally
+func (p *Provider) usable() bool {
+	return p.APIKey != "" || p.Type == ProviderLocal
+}
+
+// clientProvider returns the llm provider name for a provider type; "" auto-detects
+func (t ProviderType) clientProvider() string {
+	switch t {
+	case ProviderOpenAI:
+		return "openai"
+	case ProviderAnthropic:
+		return "anthropic"
+	case ProviderGoogle:
+		return "gemini"
+	case ProviderLocal:
+		return "ollama"
+	}
+	return ""
+}
+
+// sameBaseURL compares API base URLs, ignoring case and trailing slashes
+func sameBaseURL(a, b string) bool {
+	return strings.EqualFold(strings.TrimRight(a, "/"), strings.TrimRight(b, "/"))
+}
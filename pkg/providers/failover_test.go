@@ -0,0 +1,161 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"ClosedWheeler/pkg/llm"
+)
+
+func TestFailover_SwitchesProvider(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	var backupRequest map[string]interface{}
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&backupRequest)
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message_start\n"+
+			`data: {"type":"message_start","message":{"id":"msg_1","model":"claude-sonnet-4","usage":{"input_tokens":90,"output_tokens":1}}}`+"\n\n"+
+			"event: content_block_delta\n"+
+			`data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"hello"}}`+"\n\n"+
+			"event: message_delta\n"+
+			`data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":10}}`+"\n\n"+
+			"event: message_stop\n"+
+			`data: {"type":"message_stop"}`+"\n\n")
+	}))
+	defer backup.Close()
+
+	pm := NewProviderManager()
+	pm.AddProvider(&Provider{ID: "primary", Name: "Primary", Type: ProviderOpenAI, BaseURL: down.URL, Model: "gpt-4o", APIKey: "k1", Priority: 1})
+	pm.AddProvider(&Provider{ID: "backup", Name: "Backup", Type: ProviderAnthropic, BaseURL: backup.URL, Model: "claude-sonnet-4", APIKey: "k2", Priority: 2})
+	pm.AddProvider(&Provider{ID: "keyless", Name: "Keyless", Type: ProviderOpenAI, BaseURL: down.URL, Model: "gpt-4o-mini", Priority: 3})
+
+	var switches []string
+	route := Route{
+		Client:  llm.NewClientWithProvider(down.URL, "k1", "gpt-4o", "openai"),
+		BaseURL: down.URL + "/",
+		Model:   "gpt-4o",
+		Switch:  func(from, to string, err error) { switches = append(switches, from+" -> "+to) },
+	}
+	messages := []llm.Message{{Role: "system", Content: "be brief"}, {Role: "user", Content: "hi"}}
+	resp, err := pm.Failover(context.Background(), route, func(c *llm.Client) (*llm.ChatResponse, error) {
+		return c.ChatWithStreamingContext(context.Background(), messages, nil, nil, nil, nil, nil)
+	})
+	if err != nil {
+		t.Fatalf("Failover failed: %v", err)
+	}
+
+	if got := resp.Choices[0].Message.Content; got != "hello" {
+		t.Errorf("Expected the backup's reply, got %q", got)
+	}
+	if len(switches) != 1 || switches[0] != "Primary -> Backup" {
+		t.Errorf("Expected one switch from Primary to Backup, got %v", switches)
+	}
+	if backupRequest["system"] == nil {
+		t.Errorf("Expected the system prompt translated to Anthropic's format, got %v", backupRequest)
+	}
+
+	primary, _ := pm.GetProvider("primary")
+	if stats := primary.GetStats(); stats["failed_requests"] != int64(1) || stats["success_rate"] != 0.0 {
+		t.Errorf("Expected the primary's failure recorded, got %v", stats)
+	}
+	used, _ := pm.GetProvider("backup")
+	if stats := used.GetStats(); stats["total_requests"] != int64(1) || stats["total_tokens"] != int64(100) {
+		t.Errorf("Expected the backup's request and tokens recorded, got %v", stats)
+	}
+	keyless, _ := pm.GetProvider("keyless")
+	if stats := keyless.GetStats(); stats["total_requests"] != int64(0) {
+		t.Errorf("Expected providers without an API key to be skipped, got %v", stats)
+	}
+}
+
+func TestFailover_OnlyProviderFaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		failover bool
+	}{
+		{"Bad request is returned", errors.New("API error (status 400): invalid model"), false},
+		{"Bad credentials are returned", errors.New("API error (status 401): invalid x-api-key"), false},
+		{"Open circuit fails over", fmt.Errorf("gpt-4o: %w", llm.ErrCircuitOpen), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := NewProviderManager()
+			pm.AddProvider(&Provider{ID: "primary", Name: "Primary", Type: ProviderOpenAI, BaseURL: "http://primary.test", Model: "gpt-4o", APIKey: "k1", Priority: 1})
+			pm.AddProvider(&Provider{ID: "backup", Name: "Backup", Type: ProviderOpenAI, BaseURL: "http://backup.test", Model: "gpt-4o", APIKey: "k2", Priority: 2})
+
+			primaryClient := llm.NewClientWithProvider("http://primary.test", "k1", "gpt-4o", "openai")
+			route := Route{Client: primaryClient, BaseURL: "http://primary.test", Model: "gpt-4o"}
+			var sent int
+			_, err := pm.Failover(context.Background(), route, func(c *llm.Client) (*llm.ChatResponse, error) {
+				sent++
+				if c == primaryClient {
+					return nil, tt.err
+				}
+				return &llm.ChatResponse{Choices: []llm.Choice{{Message: llm.Message{Content: "backup"}}}}, nil
+			})
+
+			if tt.failover {
+				if err != nil || sent != 2 {
+					t.Errorf("Expected the backup to answer, got %d requests and %v", sent, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) || sent != 1 {
+				t.Errorf("Expected the primary's error without failover, got %d requests and %v", sent, err)
+			}
+			primary, _ := pm.GetProvider("primary")
+			if stats := primary.GetStats(); stats["failed_requests"] != int64(0) {
+				t.Errorf("Expected no provider failure recorded for a client error, got %v", stats)
+			}
+		})
+	}
+}
+
+func TestFailover_KeepsPartialStream(t *testing.T) {
+	cut := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"Hel"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer cut.Close()
+
+	var backupHits int
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		backupHits++
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices":[{"delta":{"content":"Hello"},"finish_reason":"stop"}]}`+"\n\ndata: [DONE]\n\n")
+	}))
+	defer backup.Close()
+
+	pm := NewProviderManager()
+	pm.AddProvider(&Provider{ID: "primary", Name: "Primary", Type: ProviderOpenAI, BaseURL: cut.URL, Model: "gpt-4o", APIKey: "k1", Priority: 1})
+	pm.AddProvider(&Provider{ID: "backup", Name: "Backup", Type: ProviderOpenAI, BaseURL: backup.URL, Model: "gpt-4o", APIKey: "k2", Priority: 2})
+
+	route := Route{Client: llm.NewClientWithProvider(cut.URL, "k1", "gpt-4o", "openai"), BaseURL: cut.URL, Model: "gpt-4o"}
+	var streamed string
+	_, err := pm.Failover(context.Background(), route, func(c *llm.Client) (*llm.ChatResponse, error) {
+		return c.ChatWithStreamingContext(context.Background(), []llm.Message{{Role: "user", Content: "hi"}}, nil, nil, nil, nil, func(chunk string, done bool) {
+			streamed += chunk
+		})
+	})
+
+	if err == nil {
+		t.Fatal("Expected the broken stream's error")
+	}
+	if backupHits != 0 || streamed != "Hel" {
+		t.Errorf("Expected no failover after text was streamed, got %d backup requests and %q streamed", backupHits, streamed)
+	}
+}
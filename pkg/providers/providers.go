@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"ClosedWheeler/pkg/llm"
+	"ClosedWheeler/pkg/traces"
 )
 
 // ProviderType represents different LLM provider types
@@ -50,6 +53,7 @@ type Provider struct {
 // ProviderManager manages multiple providers
 type ProviderManager struct {
 	providers map[string]*Provider
+	clients   map[string]*llm.Client // Failover clients by provider ID
 	mu        sync.RWMutex
 	primary   string // Primary provider ID
 }
@@ -58,6 +62,7 @@ type ProviderManager struct {
 func NewProviderManager() *ProviderManager {
 	return &ProviderManager{
 		providers: make(map[string]*Provider),
+		clients:   make(map[string]*llm.Client),
 	}
 }
 
@@ -90,8 +95,16 @@ func (pm *ProviderManager) AddProvider(p *Provider) error {
 	p.healthy = true
 	p.Enabled = true
 
+	// Seed the shared scheduler so requests stay under the configured RPM
+	if p.RateLimit > 0 {
+		llm.SchedulerFor(p.BaseURL, p.Model).SetLimits(p.RateLimit, 0)
+	}
+
 	pm.providers[p.ID] = p
 
+	// Keep the key out of HTTP traces of failover requests
+	traces.AddSecrets(p.APIKey)
+
 	// Set as primary if first provider
 	if pm.primary == "" {
 		pm.primary = p.ID
@@ -110,6 +123,7 @@ func (pm *ProviderManager) RemoveProvider(id string) error {
 	}
 
 	delete(pm.providers, id)
+	delete(pm.clients, id)
 
 	// Update primary if needed
 	if pm.primary == id {
@@ -229,7 +243,9 @@ func (p *Provider) RecordFailure() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	p.totalRequests++
 	p.failedRequests++
+	p.lastUsed = time.Now()
 
 	// Mark unhealthy if failure rate > 50%
 	if p.totalRequests > 0 {
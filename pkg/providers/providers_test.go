@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ClosedWheeler/pkg/traces"
+)
+
+func TestAddProvider_RedactsKeyInTraces(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	traces.Configure(t.TempDir(), true)
+	defer traces.Configure("", false)
+
+	pm := NewProviderManager()
+	pm.AddProvider(&Provider{ID: "backup", Name: "Backup", Type: ProviderCustom, BaseURL: server.URL, Model: "m", APIKey: "fallback-key-123"})
+
+	client := &http.Client{Transport: traces.Transport("llm", nil)}
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("key=fallback-key-123"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	recent, err := traces.Recent(1)
+	if err != nil || len(recent) != 1 {
+		t.Fatalf("Expected 1 trace, got %d (%v)", len(recent), err)
+	}
+	if body := recent[0].RequestBody; body != "key=[REDACTED]" {
+		t.Errorf("Expected the fallback key redacted, got %q", body)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"time"
 
+	"ClosedWheeler/pkg/traces"
 	"ClosedWheeler/pkg/utils"
 )
 
@@ -25,7 +26,7 @@ func NewBot(token string, chatID int64) *Bot {
 	return &Bot{
 		token:   token,
 		chatID:  chatID,
-		client:  &http.Client{Timeout: 45 * time.Second}, // Increased for long polling
+		client:  &http.Client{Timeout: 45 * time.Second, Transport: traces.Transport("telegram", nil)}, // Increased for long polling
 		baseURL: fmt.Sprintf("https://api.telegram.org/bot%s", token),
 	}
 }
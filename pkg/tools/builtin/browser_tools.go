@@ -199,7 +199,7 @@ func RegisterBrowserTools(registry *tools.Registry, projectRoot string) error {
 	// Take screenshot
 	registry.Register(&tools.Tool{
 		Name:        "browser_screenshot",
-		Description: "Take a screenshot of the current page. Use 'optimized=true' for AI-readable lower resolution (800x600, compressed). Default is full quality.",
+		Description: "Take a screenshot of the current page. Use 'optimized=true' for AI-readable lower resolution (800x600, compressed). Default is full quality. Use 'return_image=true' to look at the screenshot yourself.",
 		Parameters: &tools.JSONSchema{
 			Type: "object",
 			Properties: map[string]tools.Property{
@@ -215,6 +215,10 @@ func RegisterBrowserTools(registry *tools.Registry, projectRoot string) error {
 					Type:        "boolean",
 					Description: "If true, creates AI-optimized screenshot (800x600, compressed). Default: false",
 				},
+				"return_image": {
+					Type:        "boolean",
+					Description: "If true, the screenshot is returned to you as an image (vision models only; prefer optimized=true). Default: false",
+				},
 			},
 			Required: []string{"task_id", "path"},
 		},
@@ -222,6 +226,7 @@ func RegisterBrowserTools(registry *tools.Registry, projectRoot string) error {
 			taskID, _ := args["task_id"].(string)
 			path, _ := args["path"].(string)
 			optimized, _ := args["optimized"].(bool)
+			returnImage, _ := args["return_image"].(bool)
 
 			var err error
 			if optimized {
@@ -242,10 +247,17 @@ func RegisterBrowserTools(registry *tools.Registry, projectRoot string) error {
 				mode = "AI-optimized (800x600, compressed)"
 			}
 
-			return tools.ToolResult{
+			result := tools.ToolResult{
 				Success: true,
 				Output:  fmt.Sprintf("Screenshot saved to: %s (%s)", path, mode),
-			}, nil
+			}
+			if returnImage {
+				if abs, err := filepath.Abs(path); err == nil {
+					path = abs
+				}
+				result.Images = []string{path}
+			}
+			return result, nil
 		},
 	})
 
@@ -2,6 +2,7 @@ package builtin
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"runtime"
@@ -31,77 +32,91 @@ func ExecCommandTool(projectRoot string, timeout time.Duration, auditor *securit
 			Required: []string{"command"},
 		},
 		Handler: func(args map[string]any) (tools.ToolResult, error) {
-			fullCmd, ok := args["command"].(string)
-			if !ok {
-				return tools.ToolResult{
-					Success: false,
-					Error:   "invalid command parameter: must be a string",
-				}, fmt.Errorf("command parameter must be a string, got %T", args["command"])
-			}
-			if cmdArgs, ok := args["args"].(string); ok {
-				fullCmd += " " + cmdArgs
-			}
+			return runShellCommand(context.Background(), projectRoot, timeout, auditor, args)
+		},
+		ContextHandler: func(ctx context.Context, args map[string]any) (tools.ToolResult, error) {
+			return runShellCommand(ctx, projectRoot, timeout, auditor, args)
+		},
+	}
+}
 
-			// Security: Use centralized auditor
-			if err := auditor.AuditCommand(fullCmd); err != nil {
-				return tools.ToolResult{
-					Success: false,
-					Error:   fmt.Sprintf("security block: %v", err),
-				}, nil
-			}
+// runShellCommand executes exec_command arguments, killing the process on timeout or cancellation
+func runShellCommand(ctx context.Context, projectRoot string, timeout time.Duration, auditor *security.Auditor, args map[string]any) (tools.ToolResult, error) {
+	fullCmd, ok := args["command"].(string)
+	if !ok {
+		return tools.ToolResult{
+			Success: false,
+			Error:   "invalid command parameter: must be a string",
+		}, fmt.Errorf("command parameter must be a string, got %T", args["command"])
+	}
+	if cmdArgs, ok := args["args"].(string); ok {
+		fullCmd += " " + cmdArgs
+	}
 
-			// Build command
-			var cmd *exec.Cmd
-			if runtime.GOOS == "windows" {
-				cmd = exec.Command("cmd", "/c", fullCmd)
-			} else {
-				cmd = exec.Command("sh", "-c", fullCmd)
-			}
+	// Security: Use centralized auditor
+	if err := auditor.AuditCommand(fullCmd); err != nil {
+		return tools.ToolResult{
+			Success: false,
+			Error:   fmt.Sprintf("security block: %v", err),
+		}, nil
+	}
 
-			cmd.Dir = projectRoot
+	// Build command
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/c", fullCmd)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", fullCmd)
+	}
 
-			// Capture output
-			var stdout, stderr bytes.Buffer
-			cmd.Stdout = &stdout
-			cmd.Stderr = &stderr
+	cmd.Dir = projectRoot
 
-			// Run with timeout
-			// Use buffered channel to prevent goroutine leak on timeout
-			done := make(chan error, 1)
-			go func() {
-				done <- cmd.Run()
-			}()
-
-			select {
-			case err := <-done:
-				if err != nil {
-					return tools.ToolResult{
-						Success: false,
-						Output:  stdout.String(),
-						Error:   fmt.Sprintf("%v\n%s", err, stderr.String()),
-					}, nil
-				}
-			case <-time.After(timeout):
-				if cmd.Process != nil {
-					cmd.Process.Kill()
-				}
-				return tools.ToolResult{
-					Success: false,
-					Error:   "command timed out",
-				}, nil
-			}
+	// Capture output
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
-			output := stdout.String()
-			if stderr.Len() > 0 {
-				output += "\n[stderr]:\n" + stderr.String()
-			}
+	// Run with timeout
+	// Use buffered channel to prevent goroutine leak on timeout
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Run()
+	}()
 
+	select {
+	case err := <-done:
+		if err != nil {
 			return tools.ToolResult{
-				Success: true,
-				Output:  output,
+				Success: false,
+				Output:  stdout.String(),
+				Error:   fmt.Sprintf("%v\n%s", err, stderr.String()),
 			}, nil
-		},
+		}
+	case <-time.After(timeout):
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+		return tools.ToolResult{
+			Success: false,
+			Error:   "command timed out",
+		}, nil
+	case <-ctx.Done():
+		// CommandContext kills the process; don't wait on pipes held by grandchildren
+		return tools.ToolResult{
+			Success: false,
+			Error:   "command cancelled",
+		}, ctx.Err()
+	}
+
+	output := stdout.String()
+	if stderr.Len() > 0 {
+		output += "\n[stderr]:\n" + stderr.String()
 	}
+
+	return tools.ToolResult{
+		Success: true,
+		Output:  output,
+	}, nil
 }
 
 // RunTestsTool creates a tool for running tests
@@ -306,8 +306,13 @@ func ListFilesTool(projectRoot string, auditor *security.Auditor) *tools.Tool {
 	}
 }
 
-// SearchCodeTool creates a tool for searching code
-func SearchCodeTool(projectRoot string, auditor *security.Auditor) *tools.Tool {
+// SearchResultLimit is the number of matches search_code returns when its
+// output is not spilled to disk
+const SearchResultLimit = 50
+
+// SearchCodeTool creates a tool for searching code that returns at most
+// maxResults matches (0 returns them all)
+func SearchCodeTool(projectRoot string, auditor *security.Auditor, maxResults int) *tools.Tool {
 	return &tools.Tool{
 		Name:        "search_code",
 		Description: "Search for text or patterns in code files",
@@ -406,17 +411,19 @@ func SearchCodeTool(projectRoot string, auditor *security.Auditor) *tools.Tool {
 				}, nil
 			}
 
+			count := len(results)
+
 			// Limit results
-			if len(results) > 50 {
-				results = results[:50]
-				results = append(results, "... and more (showing first 50)")
+			if maxResults > 0 && count > maxResults {
+				results = results[:maxResults]
+				results = append(results, fmt.Sprintf("... and more (showing first %d of %d)", maxResults, count))
 			}
 
 			return tools.ToolResult{
 				Success: true,
 				Output:  strings.Join(results, "\n"),
 				Data: map[string]any{
-					"count": len(results),
+					"count": count,
 				},
 			}, nil
 		},
@@ -428,7 +435,7 @@ func RegisterBuiltinTools(registry *tools.Registry, projectRoot string, appPath
 	registry.Register(ReadFileTool(projectRoot, auditor))
 	registry.Register(WriteFileTool(projectRoot, auditor))
 	registry.Register(ListFilesTool(projectRoot, auditor))
-	registry.Register(SearchCodeTool(projectRoot, auditor))
+	registry.Register(SearchCodeTool(projectRoot, auditor, SearchResultLimit))
 
 	// Register Git tools
 	RegisterGitTools(registry, projectRoot, auditor)
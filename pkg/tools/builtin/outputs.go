@@ -0,0 +1,145 @@
+// Package builtin provides retrieval of tool outputs stored by the executor.
+package builtin
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"ClosedWheeler/pkg/tools"
+)
+
+const (
+	outputPageLines  = 200  // Lines returned when no range is given
+	outputMaxMatches = 100  // Pattern matches returned per call
+	outputLineBytes  = 2000 // Longer lines are cut so a page stays readable
+)
+
+// ReadOutputTool creates a tool for paging through tool outputs that were too
+// large to include in the conversation
+func ReadOutputTool(store *tools.OutputStore) *tools.Tool {
+	return &tools.Tool{
+		Name: "read_output",
+		Description: "Read a large tool output that was stored with a handle instead of shown in full. " +
+			"Page through it by line range or search it with a pattern.",
+		Parameters: &tools.JSONSchema{
+			Type: "object",
+			Properties: map[string]tools.Property{
+				"handle": {
+					Type:        "string",
+					Description: "Handle of the stored output",
+				},
+				"start_line": {
+					Type:        "integer",
+					Description: "Start line (1-indexed, optional)",
+				},
+				"end_line": {
+					Type:        "integer",
+					Description: fmt.Sprintf("End line (1-indexed, optional; defaults to %d lines after start_line)", outputPageLines),
+				},
+				"pattern": {
+					Type:        "string",
+					Description: "Regular expression; returns matching lines with line numbers instead of a range (optional)",
+				},
+			},
+			Required: []string{"handle"},
+		},
+		Handler: func(args map[string]any) (tools.ToolResult, error) {
+			handle, _ := args["handle"].(string)
+			content, err := store.Load(strings.TrimSpace(handle))
+			if err != nil {
+				return tools.ToolResult{Success: false, Error: err.Error()}, nil
+			}
+			lines := strings.Split(content, "\n")
+
+			if pattern, _ := args["pattern"].(string); pattern != "" {
+				return grepOutput(lines, pattern)
+			}
+
+			startLine := 1
+			if sl, ok := args["start_line"].(float64); ok {
+				startLine = int(sl)
+			}
+			endLine := startLine + outputPageLines - 1
+			if el, ok := args["end_line"].(float64); ok {
+				endLine = int(el)
+			}
+
+			// Validate bounds
+			if startLine < 1 {
+				startLine = 1
+			}
+			if endLine > len(lines) {
+				endLine = len(lines)
+			}
+			if startLine > endLine {
+				return tools.ToolResult{
+					Success: false,
+					Error:   fmt.Sprintf("start_line is past the end of the output (%d lines)", len(lines)),
+				}, nil
+			}
+			if endLine-startLine+1 > outputPageLines {
+				endLine = startLine + outputPageLines - 1
+			}
+
+			var out strings.Builder
+			for i := startLine; i <= endLine; i++ {
+				out.WriteString(fmt.Sprintf("%d: %s\n", i, clipLine(lines[i-1])))
+			}
+			if endLine < len(lines) {
+				out.WriteString(fmt.Sprintf("... (%d more lines; continue with start_line %d)", len(lines)-endLine, endLine+1))
+			}
+
+			return tools.ToolResult{
+				Success: true,
+				Output:  strings.TrimRight(out.String(), "\n"),
+				Data: map[string]any{
+					"total_lines": len(lines),
+					"start_line":  startLine,
+					"end_line":    endLine,
+				},
+			}, nil
+		},
+	}
+}
+
+// grepOutput returns the lines of a stored output matching pattern
+func grepOutput(lines []string, pattern string) (tools.ToolResult, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return tools.ToolResult{Success: false, Error: fmt.Sprintf("invalid pattern: %v", err)}, nil
+	}
+
+	var matches []string
+	count := 0
+	for i, line := range lines {
+		if !re.MatchString(line) {
+			continue
+		}
+		count++
+		if len(matches) < outputMaxMatches {
+			matches = append(matches, fmt.Sprintf("%d: %s", i+1, clipLine(line)))
+		}
+	}
+
+	if count == 0 {
+		return tools.ToolResult{Success: true, Output: "No matches found"}, nil
+	}
+	if count > len(matches) {
+		matches = append(matches, fmt.Sprintf("... and %d more matches (showing first %d; narrow the pattern or read by line range)", count-len(matches), outputMaxMatches))
+	}
+
+	return tools.ToolResult{
+		Success: true,
+		Output:  strings.Join(matches, "\n"),
+		Data:    map[string]any{"count": count, "total_lines": len(lines)},
+	}, nil
+}
+
+// clipLine shortens very long lines such as minified code
+func clipLine(line string) string {
+	if len(line) <= outputLineBytes {
+		return line
+	}
+	return fmt.Sprintf("%s ...[%d more bytes]", strings.ToValidUTF8(line[:outputLineBytes], ""), len(line)-outputLineBytes)
+}
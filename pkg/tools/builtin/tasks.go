@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"ClosedWheeler/pkg/security"
@@ -20,8 +21,8 @@ func TaskManagerTool(projectRoot string, auditor *security.Auditor) *tools.Tool
 			Properties: map[string]tools.Property{
 				"action": {
 					Type:        "string",
-					Enum:        []string{"add", "update", "list", "sync"},
-					Description: "Action to perform",
+					Enum:        []string{"add", "update", "list", "sync", "plan"},
+					Description: "Action to perform. 'plan' replaces the numbered plan section with the given goal and steps",
 				},
 				"task": {
 					Type:        "string",
@@ -29,9 +30,22 @@ func TaskManagerTool(projectRoot string, auditor *security.Auditor) *tools.Tool
 				},
 				"status": {
 					Type:        "string",
-					Enum:        []string{"todo", "in_progress", "done"},
+					Enum:        []string{"todo", "in_progress", "done", "skipped"},
 					Description: "Status of the task",
 				},
+				"step": {
+					Type:        "integer",
+					Description: "Plan step number to update (for update, instead of task)",
+				},
+				"goal": {
+					Type:        "string",
+					Description: "Goal the plan achieves (for plan)",
+				},
+				"steps": {
+					Type:        "array",
+					Description: "Ordered plan steps, one unit of work each (for plan)",
+					Items:       &tools.Property{Type: "string"},
+				},
 			},
 			Required: []string{"action"},
 		},
@@ -84,8 +98,30 @@ func TaskManagerTool(projectRoot string, auditor *security.Auditor) *tools.Tool
 				}
 				return tools.ToolResult{Success: true, Output: "Task added successfully."}, nil
 
+			case "plan":
+				goal, _ := args["goal"].(string)
+				rawSteps, _ := args["steps"].([]any)
+				var steps []string
+				for _, raw := range rawSteps {
+					if step, ok := raw.(string); ok && strings.TrimSpace(step) != "" {
+						steps = append(steps, strings.TrimSpace(step))
+					}
+				}
+				if len(steps) == 0 {
+					return tools.ToolResult{Success: false, Error: "plan requires at least one step"}, nil
+				}
+
+				content, err := os.ReadFile(taskPath)
+				if err != nil && !os.IsNotExist(err) {
+					return tools.ToolResult{Success: false, Error: err.Error()}, nil
+				}
+				updated := replacePlanSection(string(content), formatPlanSection(goal, steps))
+				if err := os.WriteFile(taskPath, []byte(updated), 0644); err != nil {
+					return tools.ToolResult{Success: false, Error: err.Error()}, nil
+				}
+				return tools.ToolResult{Success: true, Output: fmt.Sprintf("Plan with %d steps written to task.md.", len(steps))}, nil
+
 			case "update":
-				task := args["task"].(string)
 				status := args["status"].(string)
 
 				content, err := os.ReadFile(taskPath)
@@ -93,16 +129,23 @@ func TaskManagerTool(projectRoot string, auditor *security.Auditor) *tools.Tool
 					return tools.ToolResult{Success: false, Error: err.Error()}, nil
 				}
 
+				if step, ok := args["step"].(float64); ok {
+					updated, found := setPlanMark(string(content), int(step), statusMark(status))
+					if !found {
+						return tools.ToolResult{Success: false, Error: fmt.Sprintf("Plan step %d not found.", int(step))}, nil
+					}
+					if err := os.WriteFile(taskPath, []byte(updated), 0644); err != nil {
+						return tools.ToolResult{Success: false, Error: err.Error()}, nil
+					}
+					return tools.ToolResult{Success: true, Output: "Task updated successfully."}, nil
+				}
+				task := args["task"].(string)
+
 				lines := strings.Split(string(content), "\n")
 				found := false
 				for i, line := range lines {
 					if strings.Contains(line, task) {
-						char := " "
-						if status == "in_progress" {
-							char = "/"
-						} else if status == "done" {
-							char = "x"
-						}
+						char := statusMark(status)
 
 						// Replace early part of line (e.g. - [ ] or - [/])
 						idx := strings.Index(line, "[")
@@ -128,3 +171,135 @@ func TaskManagerTool(projectRoot string, auditor *security.Auditor) *tools.Tool
 		},
 	}
 }
+
+// PlanHeader starts the numbered plan section that manage_tasks writes to task.md
+const PlanHeader = "## Plan: "
+
+// PlanItem is one numbered step of the plan section in task.md
+type PlanItem struct {
+	Number int
+	Text   string
+	Mark   string // " " todo, "/" in progress, "x" done, "-" skipped
+}
+
+// Done reports whether the step needs no further work
+func (p PlanItem) Done() bool {
+	return p.Mark == "x" || p.Mark == "-"
+}
+
+// ParsePlan extracts the goal and steps of the plan section in task.md content
+func ParsePlan(content string) (string, []PlanItem) {
+	lines := strings.Split(content, "\n")
+	start, end := planSectionBounds(lines)
+	if start < 0 {
+		return "", nil
+	}
+
+	goal := strings.TrimSpace(strings.TrimPrefix(lines[start], PlanHeader))
+	var items []PlanItem
+	for _, line := range lines[start+1 : end] {
+		if item, ok := parsePlanLine(line); ok {
+			items = append(items, item)
+		}
+	}
+	return goal, items
+}
+
+// statusMark maps a task status to its checkbox character
+func statusMark(status string) string {
+	switch status {
+	case "in_progress":
+		return "/"
+	case "done":
+		return "x"
+	case "skipped":
+		return "-"
+	}
+	return " "
+}
+
+func formatPlanSection(goal string, steps []string) string {
+	var sb strings.Builder
+	sb.WriteString(PlanHeader + goal + "\n\n")
+	for i, step := range steps {
+		sb.WriteString(fmt.Sprintf("- [ ] %d. %s\n", i+1, strings.Join(strings.Fields(step), " ")))
+	}
+	return sb.String()
+}
+
+// replacePlanSection swaps the existing plan section for section, or appends it
+func replacePlanSection(content, section string) string {
+	if strings.TrimSpace(content) == "" {
+		return "# 📋 Project Tasks\n\n" + section
+	}
+
+	lines := strings.Split(content, "\n")
+	start, end := planSectionBounds(lines)
+	if start < 0 {
+		return strings.TrimRight(content, "\n") + "\n\n" + section
+	}
+
+	rest := strings.Join(lines[end:], "\n")
+	result := strings.Join(lines[:start], "\n") + "\n" + section
+	if strings.TrimSpace(rest) != "" {
+		result += "\n" + rest
+	}
+	return strings.TrimLeft(result, "\n")
+}
+
+// setPlanMark sets the checkbox of plan step number to mark
+func setPlanMark(content string, number int, mark string) (string, bool) {
+	lines := strings.Split(content, "\n")
+	start, end := planSectionBounds(lines)
+	if start < 0 {
+		return content, false
+	}
+
+	for i := start + 1; i < end; i++ {
+		item, ok := parsePlanLine(lines[i])
+		if !ok || item.Number != number {
+			continue
+		}
+		idx := strings.Index(lines[i], "[")
+		lines[i] = lines[i][:idx+1] + mark + lines[i][idx+2:]
+		return strings.Join(lines, "\n"), true
+	}
+	return content, false
+}
+
+// planSectionBounds returns the header line of the plan section and the line
+// after its last, or -1 if there is no plan
+func planSectionBounds(lines []string) (int, int) {
+	start := -1
+	for i, line := range lines {
+		if start < 0 {
+			if strings.HasPrefix(line, PlanHeader) {
+				start = i
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			return start, i
+		}
+	}
+	return start, len(lines)
+}
+
+// parsePlanLine parses a "- [x] 3. Step text" line
+func parsePlanLine(line string) (PlanItem, bool) {
+	line = strings.TrimSpace(line)
+	if len(line) < 6 || !strings.HasPrefix(line, "- [") || line[4] != ']' {
+		return PlanItem{}, false
+	}
+
+	rest := strings.TrimSpace(line[5:])
+	dot := strings.Index(rest, ". ")
+	if dot < 1 {
+		return PlanItem{}, false
+	}
+	number, err := strconv.Atoi(rest[:dot])
+	if err != nil {
+		return PlanItem{}, false
+	}
+	return PlanItem{Number: number, Text: rest[dot+2:], Mark: line[3:4]}, true
+}
@@ -0,0 +1,65 @@
+package builtin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplacePlanSection(t *testing.T) {
+	existing := "# 📋 Project Tasks\n\n- [ ] Initial project audit\n\n## Plan: old goal\n\n- [x] 1. Old step\n\n## Notes\nkeep me\n"
+
+	updated := replacePlanSection(existing, formatPlanSection("new goal", []string{"Read the parser", "Add  a test"}))
+
+	if !strings.Contains(updated, "- [ ] Initial project audit") {
+		t.Errorf("Expected existing tasks to be kept, got:\n%s", updated)
+	}
+	if !strings.Contains(updated, "## Notes\nkeep me") {
+		t.Errorf("Expected following sections to be kept, got:\n%s", updated)
+	}
+	if strings.Contains(updated, "old goal") || strings.Contains(updated, "Old step") {
+		t.Errorf("Expected old plan to be replaced, got:\n%s", updated)
+	}
+
+	goal, items := ParsePlan(updated)
+	if goal != "new goal" {
+		t.Errorf("Expected goal 'new goal', got '%s'", goal)
+	}
+	if len(items) != 2 || items[1].Number != 2 || items[1].Text != "Add a test" {
+		t.Errorf("Expected 2 parsed steps, got %+v", items)
+	}
+}
+
+func TestSetPlanMark(t *testing.T) {
+	content := formatPlanSection("goal", []string{"one", "two", "three"})
+
+	tests := []struct {
+		number int
+		mark   string
+		found  bool
+	}{
+		{1, "x", true},
+		{2, "/", true},
+		{3, "-", true},
+		{4, "x", false},
+	}
+	for _, tt := range tests {
+		updated, found := setPlanMark(content, tt.number, tt.mark)
+		if found != tt.found {
+			t.Errorf("Step %d: expected found %v, got %v", tt.number, tt.found, found)
+			continue
+		}
+		content = updated
+	}
+
+	_, items := ParsePlan(content)
+	marks := ""
+	for _, item := range items {
+		marks += item.Mark
+	}
+	if marks != "x/-" {
+		t.Errorf("Expected marks 'x/-', got '%s'", marks)
+	}
+	if !items[0].Done() || items[1].Done() || !items[2].Done() {
+		t.Errorf("Unexpected Done() results for %+v", items)
+	}
+}
@@ -0,0 +1,262 @@
+// Package tools provides user-configured shell hooks around tool execution
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Hook events
+const (
+	PreToolUse  = "pre_tool_use"
+	PostToolUse = "post_tool_use"
+)
+
+const (
+	defaultHookTimeout = 30 * time.Second
+	hookBlockExitCode  = 2 // A pre hook exiting with this code vetoes the call
+)
+
+// Hook is a shell command run before or after matching tool calls
+type Hook struct {
+	Tool    string            // Tool name or glob such as "git_*"; empty matches every tool
+	Args    map[string]string // Regular expressions that the named arguments must all match
+	Command string            // Run with sh -c (cmd /c on Windows) in the hook directory
+	Timeout time.Duration     // Zero uses a 30 second default
+	OnError string            // Pre hooks: "allow" runs the call when the hook fails; by default it is blocked
+
+	args map[string]*regexp.Regexp
+}
+
+// Hooks are the pre and post hooks an Executor runs around tool calls
+type Hooks struct {
+	pre  []*Hook
+	post []*Hook
+	dir  string
+}
+
+// HookInput is the JSON a hook receives on stdin
+type HookInput struct {
+	Event     string         `json:"event"`
+	Tool      string         `json:"tool"`
+	Arguments map[string]any `json:"arguments"`
+	Result    *ToolResult    `json:"result,omitempty"` // Post hooks only
+}
+
+// HookOutput is the optional JSON a hook prints on stdout. Post hooks may also
+// print plain text, which is appended to the result.
+type HookOutput struct {
+	Decision  string         `json:"decision,omitempty"`  // "block" vetoes the call (pre hooks)
+	Reason    string         `json:"reason,omitempty"`    // Shown to the model when blocking
+	Arguments map[string]any `json:"arguments,omitempty"` // Replacement arguments (pre hooks)
+	Append    string         `json:"append,omitempty"`    // Text appended to the result output
+}
+
+// NewHooks compiles hooks whose commands run in dir
+func NewHooks(pre, post []Hook, dir string) (*Hooks, error) {
+	h := &Hooks{dir: dir}
+	var err error
+	if h.pre, err = compileHooks(pre); err != nil {
+		return nil, fmt.Errorf("invalid pre_tool_use hook: %w", err)
+	}
+	if h.post, err = compileHooks(post); err != nil {
+		return nil, fmt.Errorf("invalid post_tool_use hook: %w", err)
+	}
+	return h, nil
+}
+
+func compileHooks(hooks []Hook) ([]*Hook, error) {
+	compiled := make([]*Hook, 0, len(hooks))
+	for _, hook := range hooks {
+		if strings.TrimSpace(hook.Command) == "" {
+			return nil, fmt.Errorf("hook for tool %q has no command", hook.Tool)
+		}
+		if hook.OnError != "" && hook.OnError != "block" && hook.OnError != "allow" {
+			return nil, fmt.Errorf("hook for tool %q has on_error %q, expected \"block\" or \"allow\"", hook.Tool, hook.OnError)
+		}
+		if _, err := path.Match(hook.Tool, ""); err != nil {
+			return nil, fmt.Errorf("bad tool pattern %q: %w", hook.Tool, err)
+		}
+		hook.args = make(map[string]*regexp.Regexp, len(hook.Args))
+		for name, pattern := range hook.Args {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern for argument %q: %w", name, err)
+			}
+			hook.args[name] = re
+		}
+		h := hook
+		compiled = append(compiled, &h)
+	}
+	return compiled, nil
+}
+
+// matches reports whether the hook applies to a call
+func (h *Hook) matches(call ToolCall) bool {
+	if h.Tool != "" && h.Tool != "*" {
+		if ok, _ := path.Match(h.Tool, call.Name); !ok {
+			return false
+		}
+	}
+	for name, re := range h.args {
+		value, ok := call.Arguments[name]
+		if !ok || !re.MatchString(argString(value)) {
+			return false
+		}
+	}
+	return true
+}
+
+// argString renders an argument value for pattern matching
+func argString(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// runPre runs the pre hooks for a call. It returns the (possibly rewritten)
+// call, or a blocked result when a hook vetoes it. A hook that errors or times
+// out blocks the call too, unless it is marked on_error "allow"; notes from
+// such hooks are returned to be appended to the result.
+func (h *Hooks) runPre(ctx context.Context, call ToolCall) (ToolCall, *ToolResult, []string) {
+	var notes []string
+	for _, hook := range h.pre {
+		if !hook.matches(call) {
+			continue
+		}
+
+		out, blocked, err := h.run(ctx, hook, HookInput{Event: PreToolUse, Tool: call.Name, Arguments: call.Arguments})
+		if err != nil && hook.OnError == "allow" {
+			notes = append(notes, fmt.Sprintf("⚠️ pre_tool_use hook %q failed: %v", hook.Command, err))
+			continue
+		}
+		if err != nil {
+			return call, &ToolResult{
+				Success: false,
+				Output:  fmt.Sprintf("Error: %s was blocked because pre_tool_use hook %q failed: %v", call.Name, hook.Command, err),
+				Error:   fmt.Sprintf("pre_tool_use hook failed: %v", err),
+			}, notes
+		}
+		if blocked || out.Decision == "block" {
+			reason := out.Reason
+			if reason == "" {
+				reason = "no reason given"
+			}
+			return call, &ToolResult{
+				Success: false,
+				Output:  fmt.Sprintf("Error: %s was blocked by a hook: %s", call.Name, reason),
+				Error:   "blocked by hook: " + reason,
+			}, notes
+		}
+		if out.Arguments != nil {
+			call.Arguments = out.Arguments
+		}
+		if out.Append != "" {
+			notes = append(notes, out.Append)
+		}
+	}
+	return call, nil, notes
+}
+
+// runPost runs the post hooks for a call and appends their output to result
+func (h *Hooks) runPost(ctx context.Context, call ToolCall, result ToolResult) ToolResult {
+	for _, hook := range h.post {
+		if !hook.matches(call) {
+			continue
+		}
+
+		current := result
+		out, _, err := h.run(ctx, hook, HookInput{Event: PostToolUse, Tool: call.Name, Arguments: call.Arguments, Result: &current})
+		if err != nil {
+			result.Output = appendNote(result.Output, fmt.Sprintf("⚠️ post_tool_use hook %q failed: %v", hook.Command, err))
+			continue
+		}
+		if out.Append != "" {
+			result.Output = appendNote(result.Output, out.Append)
+		}
+	}
+	return result
+}
+
+// run executes one hook. blocked is set when the hook exits with the block code,
+// in which case its stderr (or stdout) is the reason.
+func (h *Hooks) run(ctx context.Context, hook *Hook, input HookInput) (out HookOutput, blocked bool, err error) {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return out, false, fmt.Errorf("failed to encode hook input: %w", err)
+	}
+
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/c", hook.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	}
+	cmd.Dir = h.dir
+	cmd.Env = append(os.Environ(), "HOOK_EVENT="+input.Event, "TOOL_NAME="+input.Tool)
+	cmd.Stdin = bytes.NewReader(payload)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	runErr := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return out, false, fmt.Errorf("timed out after %s", timeout)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) && exitErr.ExitCode() == hookBlockExitCode && input.Event == PreToolUse {
+		out.Reason = strings.TrimSpace(stderr.String())
+		if out.Reason == "" {
+			out.Reason = strings.TrimSpace(stdout.String())
+		}
+		return out, true, nil
+	}
+	if runErr != nil {
+		return out, false, fmt.Errorf("%v: %s", runErr, strings.TrimSpace(stderr.String()))
+	}
+
+	text := strings.TrimSpace(stdout.String())
+	if strings.HasPrefix(text, "{") && json.Unmarshal([]byte(text), &out) == nil {
+		return out, false, nil
+	}
+	if input.Event == PostToolUse {
+		out.Append = text
+	}
+	return out, false, nil
+}
+
+// sameArguments reports whether two argument maps encode to the same JSON
+func sameArguments(a, b map[string]any) bool {
+	left, _ := json.Marshal(a)
+	right, _ := json.Marshal(b)
+	return bytes.Equal(left, right)
+}
+
+// appendNote adds hook text to a tool output on its own paragraph
+func appendNote(output, note string) string {
+	if output == "" {
+		return note
+	}
+	return output + "\n\n" + note
+}
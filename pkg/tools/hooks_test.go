@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutor_Hooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test use sh")
+	}
+
+	registry := NewRegistry()
+	registry.Register(&Tool{
+		Name: "echo",
+		Handler: func(args map[string]any) (ToolResult, error) {
+			text, _ := args["text"].(string)
+			return ToolResult{Success: true, Output: text}, nil
+		},
+	})
+
+	hooks, err := NewHooks(
+		[]Hook{
+			{Tool: "echo", Args: map[string]string{"text": "^rm "}, Command: "echo 'no deletes' >&2; exit 2"},
+			{Tool: "ech*", Args: map[string]string{"text": "^secret"}, Command: `echo '{"decision":"block","reason":"secrets stay local"}'`},
+			{Tool: "echo", Args: map[string]string{"text": "^draft"}, Command: `echo '{"arguments":{"text":"final"}}'`},
+		},
+		[]Hook{
+			{Tool: "*", Command: `grep -q '"event":"post_tool_use"' && echo "checked by hook"`},
+		},
+		t.TempDir(),
+	)
+	if err != nil {
+		t.Fatalf("Failed to compile hooks: %v", err)
+	}
+
+	executor := NewExecutor(registry)
+	executor.SetHooks(hooks)
+
+	tests := []struct {
+		name     string
+		text     string
+		success  bool
+		expected string // substring of the output
+	}{
+		{"Blocked by exit code", "rm -rf /", false, "no deletes"},
+		{"Blocked by decision", "secret token", false, "secrets stay local"},
+		{"Arguments rewritten", "draft", true, "final"},
+		{"Post hook appends", "hello", true, "hello\n\nchecked by hook"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, _ := executor.Execute(ToolCall{Name: "echo", Arguments: map[string]any{"text": tt.text}})
+			if result.Success != tt.success {
+				t.Errorf("Expected success %v, got %v (%s)", tt.success, result.Success, result.Output)
+			}
+			if !strings.Contains(result.Output, tt.expected) {
+				t.Errorf("Expected output to contain %q, got '%s'", tt.expected, result.Output)
+			}
+		})
+	}
+}
+
+func TestExecutor_FailingPreHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test use sh")
+	}
+
+	tests := []struct {
+		name     string
+		hook     Hook
+		ran      bool
+		expected string // substring of the output
+	}{
+		{"Error blocks", Hook{Tool: "echo", Command: "echo 'policy crashed' >&2; exit 1"}, false, "policy crashed"},
+		{"Timeout blocks", Hook{Tool: "echo", Command: "exec sleep 5", Timeout: 100 * time.Millisecond}, false, "timed out"},
+		{"Error allowed", Hook{Tool: "echo", Command: "exit 1", OnError: "allow"}, true, "hook \"exit 1\" failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran := false
+			registry := NewRegistry()
+			registry.Register(&Tool{
+				Name: "echo",
+				Handler: func(args map[string]any) (ToolResult, error) {
+					ran = true
+					return ToolResult{Success: true, Output: "ran"}, nil
+				},
+			})
+			hooks, err := NewHooks([]Hook{tt.hook}, nil, t.TempDir())
+			if err != nil {
+				t.Fatalf("Failed to compile hooks: %v", err)
+			}
+			executor := NewExecutor(registry)
+			executor.SetHooks(hooks)
+
+			result, _ := executor.Execute(ToolCall{Name: "echo", Arguments: map[string]any{}})
+			if ran != tt.ran || result.Success != tt.ran {
+				t.Errorf("Expected the tool to run: %v, got ran %v and success %v (%s)", tt.ran, ran, result.Success, result.Output)
+			}
+			if !strings.Contains(result.Output, tt.expected) {
+				t.Errorf("Expected output to contain %q, got '%s'", tt.expected, result.Output)
+			}
+		})
+	}
+}
+
+func TestNewHooks_InvalidOnError(t *testing.T) {
+	_, err := NewHooks([]Hook{{Tool: "exec_command", Command: "true", OnError: "ignore"}}, nil, "")
+	if err == nil {
+		t.Error("Expected error for an unknown on_error value")
+	}
+}
+
+func TestNewHooks_InvalidPattern(t *testing.T) {
+	_, err := NewHooks([]Hook{{Tool: "exec_command", Args: map[string]string{"command": "("}, Command: "true"}}, nil, "")
+	if err == nil {
+		t.Error("Expected error for invalid argument pattern")
+	}
+}
@@ -2,6 +2,7 @@
 package tools
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sync"
@@ -13,6 +14,10 @@ type Tool struct {
 	Description string      `json:"description"`
 	Parameters  *JSONSchema `json:"parameters"`
 	Handler     ToolHandler `json:"-"` // Function that executes the tool
+
+	// ContextHandler, when set, is preferred over Handler by ExecuteContext so
+	// long-running tools can stop when the caller is cancelled
+	ContextHandler ContextToolHandler `json:"-"`
 }
 
 // JSONSchema represents a JSON Schema for tool parameters
@@ -24,21 +29,26 @@ type JSONSchema struct {
 
 // Property represents a schema property
 type Property struct {
-	Type        string   `json:"type"`
-	Description string   `json:"description"`
-	Enum        []string `json:"enum,omitempty"`
-	Default     any      `json:"default,omitempty"`
+	Type        string    `json:"type"`
+	Description string    `json:"description"`
+	Enum        []string  `json:"enum,omitempty"`
+	Default     any       `json:"default,omitempty"`
+	Items       *Property `json:"items,omitempty"` // Element schema for array properties
 }
 
 // ToolHandler is the function signature for tool execution
 type ToolHandler func(args map[string]any) (ToolResult, error)
 
+// ContextToolHandler is a ToolHandler that honours cancellation
+type ContextToolHandler func(ctx context.Context, args map[string]any) (ToolResult, error)
+
 // ToolResult represents the result of a tool execution
 type ToolResult struct {
-	Success bool   `json:"success"`
-	Output  string `json:"output"`
-	Error   string `json:"error,omitempty"`
-	Data    any    `json:"data,omitempty"`
+	Success bool     `json:"success"`
+	Output  string   `json:"output"`
+	Error   string   `json:"error,omitempty"`
+	Data    any      `json:"data,omitempty"`
+	Images  []string `json:"images,omitempty"` // Image files shown to vision models with the output
 }
 
 // ToolCall represents a request to execute a tool
@@ -124,6 +134,8 @@ func (r *Registry) GetOpenAIFormat() []map[string]any {
 type Executor struct {
 	registry    *Registry
 	debugLogger *DebugLogger
+	spill       *SpillPolicy
+	hooks       *Hooks
 }
 
 // NewExecutor creates a new tool executor
@@ -139,8 +151,63 @@ func (e *Executor) SetDebugLevel(level DebugLevel) {
 	e.debugLogger.Level = level
 }
 
+// SetSpillPolicy stores oversized outputs of every tool according to policy
+// (nil disables spilling)
+func (e *Executor) SetSpillPolicy(policy *SpillPolicy) {
+	e.spill = policy
+}
+
+// SetHooks runs the given pre and post hooks around every tool call (nil disables hooks)
+func (e *Executor) SetHooks(hooks *Hooks) {
+	e.hooks = hooks
+}
+
 // Execute runs a tool call with comprehensive error handling and debug logging
 func (e *Executor) Execute(call ToolCall) (ToolResult, error) {
+	return e.ExecuteContext(context.Background(), call)
+}
+
+// ExecuteContext runs a tool call, passing ctx to tools that support cancellation
+func (e *Executor) ExecuteContext(ctx context.Context, call ToolCall) (ToolResult, error) {
+	return e.ExecutePrepared(ctx, e.Prepare(ctx, call))
+}
+
+// PreparedCall is a tool call after the pre hooks: its arguments are the ones
+// the tool will run with, and Blocked is set when a hook vetoed it
+type PreparedCall struct {
+	ToolCall
+	Blocked   *ToolResult
+	Rewritten bool // A hook replaced the arguments
+
+	notes []string
+}
+
+// Prepare runs the pre hooks for a call so callers can ask for approval, take
+// snapshots and record the call with the arguments that will actually run
+func (e *Executor) Prepare(ctx context.Context, call ToolCall) PreparedCall {
+	prepared := PreparedCall{ToolCall: call}
+	if e.hooks == nil || ctx.Err() != nil {
+		return prepared
+	}
+	var blocked *ToolResult
+	prepared.ToolCall, blocked, prepared.notes = e.hooks.runPre(ctx, call)
+	prepared.Blocked = blocked
+	prepared.Rewritten = blocked == nil && !sameArguments(call.Arguments, prepared.Arguments)
+	return prepared
+}
+
+// ExecutePrepared runs a call returned by Prepare without running the pre hooks again
+func (e *Executor) ExecutePrepared(ctx context.Context, prepared PreparedCall) (ToolResult, error) {
+	call := prepared.ToolCall
+
+	// Don't start new work for a cancelled turn
+	if err := ctx.Err(); err != nil {
+		return ToolResult{
+			Success: false,
+			Error:   fmt.Sprintf("cancelled: %v", err),
+		}, err
+	}
+
 	// Start execution trace
 	trace := e.debugLogger.StartTrace(call.Name, call.Arguments)
 
@@ -176,8 +243,36 @@ func (e *Executor) Execute(call ToolCall) (ToolResult, error) {
 	// Add metadata
 	e.debugLogger.AddMetadata(trace, "tool_description", tool.Description)
 
+	// Pre hooks may have vetoed the call
+	if blocked := prepared.Blocked; blocked != nil {
+		result := *blocked
+		for _, note := range prepared.notes {
+			result.Output = appendNote(result.Output, note)
+		}
+		e.debugLogger.AddMetadata(trace, "blocked_by", "pre_tool_use hook")
+		e.debugLogger.EndTrace(trace, result, nil)
+		return result, nil
+	}
+
 	// Execute tool
-	result, err := tool.Handler(call.Arguments)
+	var result ToolResult
+	var err error
+	if tool.ContextHandler != nil {
+		result, err = tool.ContextHandler(ctx, call.Arguments)
+	} else {
+		result, err = tool.Handler(call.Arguments)
+	}
+
+	// Post hooks see the full output and may append to it
+	if e.hooks != nil {
+		for _, note := range prepared.notes {
+			result.Output = appendNote(result.Output, note)
+		}
+		result = e.hooks.runPost(ctx, call, result)
+	}
+
+	// Keep oversized outputs out of the conversation
+	result = e.spill.apply(call.Name, result)
 
 	// Capture error details if failed
 	if err != nil {
@@ -0,0 +1,168 @@
+// Package tools provides spill-to-file storage for large tool outputs
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultSpillBytes   = 16 * 1024 // Outputs larger than this are stored on disk
+	DefaultPreviewLines = 40        // Lines kept from each end in the preview
+	outputRetention     = 7 * 24 * time.Hour
+)
+
+// validHandle guards against handles that escape the output directory
+var validHandle = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// OutputStore keeps full tool outputs on disk so the model only sees a preview
+// and can page through the rest by handle
+type OutputStore struct {
+	dir string
+	mu  sync.Mutex
+	seq int
+}
+
+// NewOutputStore creates a store in dir, removing outputs older than a week
+func NewOutputStore(dir string) *OutputStore {
+	s := &OutputStore{dir: dir}
+	s.prune(outputRetention)
+	return s
+}
+
+// Save stores output and returns its handle
+func (s *OutputStore) Save(toolName, output string) (string, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	s.mu.Lock()
+	s.seq++
+	handle := fmt.Sprintf("%s-%s%d", sanitizeHandle(toolName), strconv.FormatInt(time.Now().Unix(), 36), s.seq)
+	s.mu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(s.dir, handle), []byte(output), 0644); err != nil {
+		return "", fmt.Errorf("failed to store output: %w", err)
+	}
+	return handle, nil
+}
+
+// Load returns a stored output by handle
+func (s *OutputStore) Load(handle string) (string, error) {
+	if !validHandle.MatchString(handle) {
+		return "", fmt.Errorf("invalid output handle: %q", handle)
+	}
+	data, err := os.ReadFile(filepath.Join(s.dir, handle))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("no stored output with handle %q (outputs expire after 7 days)", handle)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read output: %w", err)
+	}
+	return string(data), nil
+}
+
+// prune removes outputs older than maxAge
+func (s *OutputStore) prune(maxAge time.Duration) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && !entry.IsDir() && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(s.dir, entry.Name()))
+		}
+	}
+}
+
+// sanitizeHandle keeps tool names usable as handle prefixes
+func sanitizeHandle(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if r == '-' || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "output"
+	}
+	return b.String()
+}
+
+// SpillPolicy decides when tool outputs are moved to an OutputStore
+type SpillPolicy struct {
+	Store        *OutputStore
+	MaxBytes     int             // Spill outputs larger than this
+	PreviewLines int             // Lines kept from the head and from the tail
+	Exempt       map[string]bool // Tools whose output is never spilled
+}
+
+// apply replaces an oversized output with a head/tail preview and a handle
+func (p *SpillPolicy) apply(toolName string, result ToolResult) ToolResult {
+	if p == nil || p.Store == nil || p.Exempt[toolName] || len(result.Output) <= p.MaxBytes {
+		return result
+	}
+
+	handle, err := p.Store.Save(toolName, result.Output)
+	if err != nil {
+		// Keep the model going with a plain truncation
+		result.Output = capBytes(result.Output, p.MaxBytes) + fmt.Sprintf("\n... [output could not be stored: %v]", err)
+		return result
+	}
+
+	result.Output = PreviewOutput(result.Output, p.PreviewLines, p.MaxBytes/2) +
+		fmt.Sprintf("\n\n[Full output stored with handle %q. Use read_output with this handle and start_line/end_line or pattern to see the rest.]", handle)
+	return result
+}
+
+// PreviewOutput returns the first and last lines of output with a marker for
+// what was left out. Each end is capped at maxBytes so long lines stay bounded.
+func PreviewOutput(output string, lines, maxBytes int) string {
+	all := strings.Split(output, "\n")
+	total := len(all)
+	if lines <= 0 {
+		lines = DefaultPreviewLines
+	}
+
+	if total <= 2*lines {
+		head := capBytes(output, 2*maxBytes)
+		return head + fmt.Sprintf("\n... [output truncated: %d lines, %s total]", total, FormatBytes(len(output)))
+	}
+
+	head := capBytes(strings.Join(all[:lines], "\n"), maxBytes)
+	tail := capBytes(strings.Join(all[total-lines:], "\n"), maxBytes)
+	return fmt.Sprintf("%s\n... [%d lines omitted: %d lines, %s total] ...\n%s",
+		head, total-2*lines, total, FormatBytes(len(output)), tail)
+}
+
+// capBytes truncates s to at most maxBytes bytes without splitting a rune
+func capBytes(s string, maxBytes int) string {
+	if maxBytes <= 0 || len(s) <= maxBytes {
+		return s
+	}
+	for maxBytes > 0 && !utf8.RuneStart(s[maxBytes]) {
+		maxBytes--
+	}
+	return s[:maxBytes] + " ...[line truncated]"
+}
+
+// FormatBytes renders a byte count for humans
+func FormatBytes(n int) string {
+	if n >= 1024*1024 {
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	}
+	if n >= 1024 {
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,73 @@
+package tools
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSpillPolicy_Apply(t *testing.T) {
+	policy := &SpillPolicy{
+		Store:        NewOutputStore(t.TempDir()),
+		MaxBytes:     100,
+		PreviewLines: 2,
+		Exempt:       map[string]bool{"read_output": true},
+	}
+
+	var lines []string
+	for i := 1; i <= 50; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	large := strings.Join(lines, "\n")
+
+	tests := []struct {
+		name    string
+		tool    string
+		output  string
+		spilled bool
+	}{
+		{"Small output", "read_file", "hello", false},
+		{"Large output", "exec_command", large, true},
+		{"Exempt tool", "read_output", large, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := policy.apply(tt.tool, ToolResult{Success: true, Output: tt.output})
+			if !tt.spilled {
+				if result.Output != tt.output {
+					t.Errorf("Expected output unchanged, got '%s'", result.Output)
+				}
+				return
+			}
+
+			for _, want := range []string{"line 1\nline 2\n", "46 lines omitted", "line 49\nline 50"} {
+				if !strings.Contains(result.Output, want) {
+					t.Errorf("Expected preview to contain %q, got '%s'", want, result.Output)
+				}
+			}
+
+			handle := regexp.MustCompile(`handle "([^"]+)"`).FindStringSubmatch(result.Output)
+			if handle == nil {
+				t.Fatalf("Expected a handle in '%s'", result.Output)
+			}
+			stored, err := policy.Store.Load(handle[1])
+			if err != nil {
+				t.Fatalf("Failed to load stored output: %v", err)
+			}
+			if stored != tt.output {
+				t.Errorf("Expected stored output to match the original")
+			}
+		})
+	}
+}
+
+func TestOutputStore_LoadRejectsPaths(t *testing.T) {
+	store := NewOutputStore(t.TempDir())
+	for _, handle := range []string{"../config.json", "a/b", ""} {
+		if _, err := store.Load(handle); err == nil {
+			t.Errorf("Expected error for handle %q", handle)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+// Package traces records redacted HTTP exchanges to JSONL files for debugging
+// provider, OAuth and Telegram errors.
+package traces
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ClosedWheeler/pkg/utils"
+)
+
+// maxBodyBytes caps each recorded body; longer bodies are cut and marked truncated
+const maxBodyBytes = 256 * 1024
+
+// Trace is one recorded request and its response, with secrets redacted
+type Trace struct {
+	ID              string            `json:"id"`
+	Time            time.Time         `json:"time"`
+	Source          string            `json:"source"` // Component that sent the request: "llm", "oauth", "telegram", ...
+	Method          string            `json:"method"`
+	URL             string            `json:"url"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	RequestBody     string            `json:"request_body,omitempty"`
+	Status          int               `json:"status,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+	ResponseBody    string            `json:"response_body,omitempty"`
+	Truncated       bool              `json:"truncated,omitempty"` // A body was longer than maxBodyBytes
+	Error           string            `json:"error,omitempty"`     // Transport or body read error
+	Timing          Timing            `json:"timing"`
+}
+
+// Timing breaks down where the time of an exchange went, in milliseconds
+type Timing struct {
+	DNSMs      float64 `json:"dns_ms,omitempty"`
+	ConnectMs  float64 `json:"connect_ms,omitempty"`
+	TLSMs      float64 `json:"tls_ms,omitempty"`
+	WaitMs     float64 `json:"wait_ms"`     // Request written until the first response byte
+	TransferMs float64 `json:"transfer_ms"` // First response byte until the body was read
+	TotalMs    float64 `json:"total_ms"`
+	ReusedConn bool    `json:"reused_conn,omitempty"`
+}
+
+var (
+	mu      sync.Mutex
+	dir     string
+	enabled bool
+	secrets []string
+)
+
+// Configure sets the directory traces are written to, whether tracing is on
+// and literal secrets (API keys, tokens) to redact in addition to the
+// well-known credential formats
+func Configure(traceDir string, on bool, redact ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	dir = traceDir
+	enabled = on
+	secrets = redact
+}
+
+// AddSecrets adds literal secrets to redact, such as refreshed OAuth tokens
+func AddSecrets(redact ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range redact {
+		if s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+}
+
+// SetEnabled turns tracing on or off without changing the other settings
+func SetEnabled(on bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	enabled = on
+}
+
+// Enabled reports whether exchanges are being recorded
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled && dir != ""
+}
+
+// Dir returns the directory traces are written to
+func Dir() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return dir
+}
+
+// settings returns the trace directory and secrets if tracing is on
+func settings() (string, []string, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	return dir, secrets, enabled && dir != ""
+}
+
+// transport records the exchanges of next while tracing is enabled
+type transport struct {
+	source string
+	next   http.RoundTripper
+}
+
+// Transport wraps next (nil for http.DefaultTransport) so that its exchanges
+// are recorded while tracing is enabled. source names the component in the
+// traces. Tracing can be toggled at any time; a disabled transport only
+// forwards requests.
+func Transport(source string, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &transport{source: source, next: next}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, redact, ok := settings()
+	if !ok {
+		return t.next.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+	}
+
+	rec := &recorder{
+		start:   time.Now(),
+		secrets: redact,
+		trace: Trace{
+			ID:             newID(),
+			Source:         t.source,
+			Method:         req.Method,
+			URL:            utils.RedactURL(req.URL.String(), redact...),
+			RequestHeaders: redactHeaders(req.Header, redact),
+		},
+	}
+	rec.trace.Time = rec.start
+	rec.trace.RequestBody, rec.trace.Truncated = redactBody(body, req.Header.Get("Content-Type"), redact)
+
+	traced := req.WithContext(httptrace.WithClientTrace(req.Context(), rec.clientTrace()))
+	if req.Body != nil {
+		traced.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := t.next.RoundTrip(traced)
+	if err != nil {
+		rec.finish(nil, nil, false, err)
+		return nil, err
+	}
+	resp.Body = &tracingBody{ReadCloser: resp.Body, done: func(data []byte, truncated bool, err error) {
+		rec.finish(resp, data, truncated, err)
+	}}
+	return resp, nil
+}
+
+// recorder collects the timing of one exchange
+type recorder struct {
+	mu        sync.Mutex
+	trace     Trace
+	secrets   []string
+	start     time.Time
+	dnsStart  time.Time
+	dnsDone   time.Time
+	connStart time.Time
+	connDone  time.Time
+	tlsStart  time.Time
+	tlsDone   time.Time
+	wrote     time.Time
+	firstByte time.Time
+}
+
+// clientTrace returns the hooks that timestamp the phases of the exchange
+func (r *recorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { r.mark(&r.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { r.mark(&r.dnsDone) },
+		ConnectStart:      func(string, string) { r.mark(&r.connStart) },
+		ConnectDone:       func(string, string, error) { r.mark(&r.connDone) },
+		TLSHandshakeStart: func() { r.mark(&r.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { r.mark(&r.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			r.mu.Lock()
+			r.trace.Timing.ReusedConn = info.Reused
+			r.mu.Unlock()
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { r.mark(&r.wrote) },
+		GotFirstResponseByte: func() { r.mark(&r.firstByte) },
+	}
+}
+
+// mark records the first time a phase was reached
+func (r *recorder) mark(at *time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+// finish completes the trace with the response (nil if the request failed) and writes it
+func (r *recorder) finish(resp *http.Response, body []byte, truncated bool, err error) {
+	end := time.Now()
+	r.mu.Lock()
+	t := r.trace
+	t.Timing.DNSMs = span(r.dnsStart, r.dnsDone)
+	t.Timing.ConnectMs = span(r.connStart, r.connDone)
+	t.Timing.TLSMs = span(r.tlsStart, r.tlsDone)
+	t.Timing.WaitMs = span(r.wrote, r.firstByte)
+	t.Timing.TransferMs = span(r.firstByte, end)
+	t.Timing.TotalMs = span(r.start, end)
+	r.mu.Unlock()
+
+	if resp != nil {
+		t.Status = resp.StatusCode
+		t.ResponseHeaders = redactHeaders(resp.Header, r.secrets)
+		t.ResponseBody, _ = redactBody(body, resp.Header.Get("Content-Type"), r.secrets)
+		t.Truncated = t.Truncated || truncated
+	}
+	if err != nil {
+		t.Error = utils.RedactSecrets(err.Error(), r.secrets...)
+	}
+	if err := write(t); err != nil {
+		log.Printf("[WARN] Failed to write HTTP trace: %v", err)
+	}
+}
+
+// span returns the milliseconds between two phase timestamps, or 0 if either is missing
+func span(from, to time.Time) float64 {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
+		return 0
+	}
+	return float64(to.Sub(from).Microseconds()) / 1000
+}
+
+// redactHeaders copies headers, hiding the values of credential headers
+func redactHeaders(h http.Header, secrets []string) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		value := strings.Join(values, ", ")
+		if utils.IsSensitiveHeader(name) {
+			value = utils.Redacted
+		}
+		out[http.CanonicalHeaderKey(name)] = utils.RedactSecrets(value, secrets...)
+	}
+	return out
+}
+
+// redactBody redacts a body by its content type and cuts it to maxBodyBytes
+func redactBody(body []byte, contentType string, secrets []string) (string, bool) {
+	truncated := len(body) > maxBodyBytes
+	if truncated {
+		body = body[:maxBodyBytes]
+	}
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		return utils.RedactForm(string(body), secrets...), truncated
+	}
+	return utils.RedactSecrets(string(body), secrets...), truncated
+}
+
+// write appends a trace to the file of its day
+func write(t Trace) error {
+	traceDir, _, ok := settings()
+	if !ok {
+		return nil // Turned off while the exchange was in flight
+	}
+	data, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trace: %w", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := os.MkdirAll(traceDir, 0755); err != nil {
+		return fmt.Errorf("failed to create trace directory: %w", err)
+	}
+	f, err := os.OpenFile(filepath.Join(traceDir, t.Time.Format("2006-01-02")+".jsonl"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open trace file: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Recent returns up to n of the newest traces, newest first
+func Recent(n int) ([]Trace, error) {
+	var found []Trace
+	err := scan(func(t Trace) bool {
+		found = append(found, t)
+		return len(found) < n
+	})
+	return found, err
+}
+
+// Find returns the trace whose ID starts with id
+func Find(id string) (*Trace, error) {
+	var found *Trace
+	err := scan(func(t Trace) bool {
+		if strings.HasPrefix(t.ID, id) {
+			found = &t
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if found == nil {
+		return nil, fmt.Errorf("trace %s not found", id)
+	}
+	return found, nil
+}
+
+// scan passes the recorded traces to fn, newest first, until fn returns false
+func scan(fn func(Trace) bool) error {
+	traceDir := Dir()
+	if traceDir == "" {
+		return errors.New("tracing is not configured")
+	}
+	files, err := filepath.Glob(filepath.Join(traceDir, "*.jsonl"))
+	if err != nil {
+		return err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	for _, file := range files {
+		traces, err := readFile(file)
+		if err != nil {
+			return err
+		}
+		for i := len(traces) - 1; i >= 0; i-- {
+			if !fn(traces[i]) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// readFile reads the traces of one file in recording order, skipping damaged lines
+func readFile(path string) ([]Trace, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open traces: %w", err)
+	}
+	defer f.Close()
+
+	var traces []Trace
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var t Trace
+			if json.Unmarshal(line, &t) == nil {
+				traces = append(traces, t)
+			}
+		}
+		if err == io.EOF {
+			return traces, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read traces: %w", err)
+		}
+	}
+}
+
+// newID returns a short random trace ID
+func newID() string {
+	buf := make([]byte, 4)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// tracingBody keeps up to maxBodyBytes of a response body and hands it to
+// done once the body has been read to EOF, failed or been closed, so streams
+// are traced as the caller consumes them
+type tracingBody struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool // Bytes beyond maxBodyBytes were dropped
+	once      sync.Once
+	done      func(data []byte, truncated bool, err error)
+}
+
+func (b *tracingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	room := maxBodyBytes - b.buf.Len()
+	if n > room {
+		b.truncated = true
+	}
+	b.buf.Write(p[:min(n, room)])
+	if err == io.EOF {
+		b.finish(nil)
+	} else if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *tracingBody) Close() error {
+	b.finish(nil)
+	return b.ReadCloser.Close()
+}
+
+func (b *tracingBody) finish(err error) {
+	b.once.Do(func() { b.done(b.buf.Bytes(), b.truncated, err) })
+}
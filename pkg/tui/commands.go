@@ -61,6 +61,36 @@ func GetAllCommands() []CommandCategory {
 					Usage:       "/continue",
 					Handler:     cmdContinue,
 				},
+				{
+					Name:        "plan",
+					Category:    "Conversation",
+					Description: "Draft a plan with read-only tools, then approve and run it step by step",
+					Usage:       "/plan [<goal>|approve|edit <n> <text>|add <text>|remove <n>|retry|skip|cancel]",
+					Handler:     cmdPlan,
+				},
+				{
+					Name:        "fork",
+					Aliases:     []string{"branch"},
+					Category:    "Conversation",
+					Description: "Branch the conversation at an earlier message",
+					Usage:       "/fork [message-index [name]]",
+					Handler:     cmdFork,
+				},
+				{
+					Name:        "branches",
+					Category:    "Conversation",
+					Description: "List branches of this conversation",
+					Usage:       "/branches",
+					Handler:     cmdBranches,
+				},
+				{
+					Name:        "switch",
+					Aliases:     []string{"checkout"},
+					Category:    "Conversation",
+					Description: "Switch to another branch, restoring its files",
+					Usage:       "/switch <branch-id>",
+					Handler:     cmdSwitch,
+				},
 			},
 		},
 		{
@@ -83,6 +113,14 @@ func GetAllCommands() []CommandCategory {
 					Usage:       "/stats",
 					Handler:     cmdStats,
 				},
+				{
+					Name:        "budget",
+					Aliases:     []string{"spend"},
+					Category:    "Information",
+					Description: "Show or set daily and session spending budgets",
+					Usage:       "/budget [daily|session] [usd|off]",
+					Handler:     cmdBudget,
+				},
 				{
 					Name:        "memory",
 					Aliases:     []string{"mem"},
@@ -164,9 +202,16 @@ func GetAllCommands() []CommandCategory {
 					Aliases:     []string{"d"},
 					Category:    "Features",
 					Description: "Toggle debug mode for tools",
-					Usage:       "/debug [on|off|level]",
+					Usage:       "/debug [on|off|level|http]",
 					Handler:     cmdDebug,
 				},
+				{
+					Name:        "traces",
+					Category:    "Features",
+					Description: "List recorded HTTP traces or show one",
+					Usage:       "/traces [id]",
+					Handler:     cmdTraces,
+				},
 				{
 					Name:        "timestamps",
 					Aliases:     []string{"time"},
@@ -273,6 +318,21 @@ func GetAllCommands() []CommandCategory {
 					Usage:       "/pairings",
 					Handler:     cmdPairings,
 				},
+				{
+					Name:        "local",
+					Aliases:     []string{"ollama"},
+					Category:    "Providers",
+					Description: "List local Ollama models and the active model's context and tool support",
+					Usage:       "/local",
+					Handler:     cmdLocal,
+				},
+				{
+					Name:        "pull",
+					Category:    "Providers",
+					Description: "Download a model to the local Ollama server",
+					Usage:       "/pull [model]",
+					Handler:     cmdPull,
+				},
 			},
 		},
 		{
@@ -283,8 +343,8 @@ func GetAllCommands() []CommandCategory {
 					Name:        "session",
 					Aliases:     []string{"dual"},
 					Category:    "Dual Session",
-					Description: "Enable/disable dual session mode",
-					Usage:       "/session [on|off|status]",
+					Description: "Dual session mode, or list/resume/delete saved sessions",
+					Usage:       "/session [on|off|status|list|resume <id>|delete <id>]",
 					Handler:     cmdSession,
 				},
 				{
@@ -307,7 +367,7 @@ func GetAllCommands() []CommandCategory {
 					Name:        "stop",
 					Aliases:     []string{"end"},
 					Category:    "Dual Session",
-					Description: "Stop the current debate/conversation",
+					Description: "Stop the running request or debate/conversation",
 					Usage:       "/stop",
 					Handler:     cmdStop,
 				},
@@ -488,8 +548,9 @@ func cmdRetry(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	m.status = "Retrying..."
 	m.updateViewport()
 
+	chatCmd := m.startChat(lastUserMsg)
 	return *m, tea.Batch(
-		m.sendMessage(lastUserMsg),
+		chatCmd,
 		m.spinner.Tick,
 	)
 }
@@ -515,8 +576,9 @@ func cmdContinue(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	m.status = "Continuing..."
 	m.updateViewport()
 
+	chatCmd := m.startChat("Continue from where you left off.")
 	return *m, tea.Batch(
-		m.sendMessage("Continue from where you left off."),
+		chatCmd,
 		m.spinner.Tick,
 	)
 }
@@ -575,10 +637,28 @@ func cmdStats(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	content.WriteString(fmt.Sprintf("- Total: %v\n", usage["total_tokens"]))
 	content.WriteString(fmt.Sprintf("- Prompt: %v\n", usage["prompt_tokens"]))
 	content.WriteString(fmt.Sprintf("- Completion: %v\n", usage["completion_tokens"]))
+	if reasoning, ok := usage["reasoning_tokens"].(int); ok && reasoning > 0 {
+		content.WriteString(fmt.Sprintf("- Reasoning: %d\n", reasoning))
+	}
+	if sub, ok := usage["subagent_tokens"].(int); ok && sub > 0 {
+		content.WriteString(fmt.Sprintf("- Sub-agents: %d\n", sub))
+	}
+	writePromptCache(&content, usage)
 
 	content.WriteString(fmt.Sprintf("\n**Rate Limits:**\n"))
 	content.WriteString(fmt.Sprintf("- Remaining Tokens: %v\n", usage["remaining_tokens"]))
 	content.WriteString(fmt.Sprintf("- Remaining Requests: %v\n", usage["remaining_requests"]))
+	if rpm, ok := usage["limit_requests"].(int); ok && rpm > 0 {
+		content.WriteString(fmt.Sprintf("- Paced at: %d requests/min", rpm))
+		if tpm, ok := usage["limit_tokens"].(int); ok && tpm > 0 {
+			content.WriteString(fmt.Sprintf(", %s tokens/min", formatTokenCount(tpm)))
+		}
+		content.WriteString("\n")
+	}
+	if throttled, ok := usage["throttled_calls"].(int); ok && throttled > 0 {
+		waited, _ := usage["throttled_time"].(time.Duration)
+		content.WriteString(fmt.Sprintf("- Delayed: %d calls (%s total) to stay under the limits\n", throttled, waited.Round(time.Second)))
+	}
 
 	content.WriteString(fmt.Sprintf("\n**Session:**\n"))
 	content.WriteString(fmt.Sprintf("- Messages: %d\n", contextStats.MessageCount))
@@ -593,6 +673,8 @@ func cmdStats(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	}
 	content.WriteString(fmt.Sprintf("- Avg Tokens/Message: %d\n", avgTokensPerMsg))
 
+	writeCostBreakdown(&content, m)
+
 	m.messageQueue.Add(QueuedMessage{
 		Role:      "system",
 		Content:   content.String(),
@@ -603,6 +685,23 @@ func cmdStats(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	return *m, nil
 }
 
+// writePromptCache appends the provider prompt cache reads, writes and hit
+// ratio reported in usage
+func writePromptCache(content *strings.Builder, usage map[string]any) {
+	read, _ := usage["cached_tokens"].(int)
+	written, _ := usage["cache_creation_tokens"].(int)
+	if read == 0 && written == 0 {
+		return
+	}
+	ratio, _ := usage["cache_hit_ratio"].(float64)
+	content.WriteString("\n**Prompt Cache:**\n")
+	content.WriteString(fmt.Sprintf("- Hit Ratio: %.1f%% of prompt tokens\n", ratio*100))
+	content.WriteString(fmt.Sprintf("- Read: %d\n", read))
+	if written > 0 {
+		content.WriteString(fmt.Sprintf("- Written: %d\n", written))
+	}
+}
+
 func cmdMemory(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	if len(args) > 0 && args[0] == "clear" {
 		// Clear specific tier or all
@@ -669,8 +768,29 @@ func cmdContext(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	content.WriteString(fmt.Sprintf("\n**Messages:** %d\n", contextStats.MessageCount))
 	content.WriteString(fmt.Sprintf("**API Calls:** %d\n", contextStats.CompletionCount))
 
-	if contextStats.MessageCount > 15 {
-		content.WriteString("\n⚠️ **Warning:** High message count. Context may be compressed soon.\n")
+	usage := m.agent.GetContextUsage()
+	if usage.Window > 0 {
+		content.WriteString(fmt.Sprintf("\n**Context Window:** %s tokens\n", formatTokenCount(usage.Window)))
+		content.WriteString(fmt.Sprintf("**Next Prompt:** ~%s tokens (%.0f%%)\n", formatTokenCount(usage.Projected), usage.Fraction()*100))
+	}
+	if usage.PromptTokens > 0 {
+		source := "estimated"
+		if usage.Exact {
+			source = "reported by provider"
+		}
+		content.WriteString(fmt.Sprintf("**Last Prompt:** %s tokens (%s)\n", formatTokenCount(usage.PromptTokens), source))
+		if usage.CachedTokens > 0 {
+			content.WriteString(fmt.Sprintf("**Last Prompt Cached:** %s tokens (%.0f%%)\n", formatTokenCount(usage.CachedTokens), float64(usage.CachedTokens)/float64(usage.PromptTokens)*100))
+		}
+	}
+	if ratio, ok := m.agent.GetUsageStats()["cache_hit_ratio"].(float64); ok && ratio > 0 {
+		content.WriteString(fmt.Sprintf("**Session Cache Hit Ratio:** %.0f%%\n", ratio*100))
+	}
+	content.WriteString(fmt.Sprintf("**Estimator:** %.2f chars/token\n", usage.CharsPerToken))
+
+	threshold := m.agent.Config().Memory.CompressionThreshold
+	if threshold > 0 && usage.Fraction() >= threshold*0.8 {
+		content.WriteString(fmt.Sprintf("\n⚠️ **Warning:** Context is nearly full. History is compressed at %.0f%%.\n", threshold*100))
 	}
 
 	m.messageQueue.Add(QueuedMessage{
@@ -688,7 +808,7 @@ func cmdTools(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	content.WriteString("🔧 **Available Tools**\n\n")
 
 	categories := map[string][]string{
-		"File Operations":   {"read_file", "write_file", "edit_file", "list_files"},
+		"File Operations":   {"read_file", "write_file", "edit_file", "list_files", "read_output"},
 		"Browser":           {"browser_navigate", "browser_click", "browser_type", "browser_screenshot"},
 		"Git":               {"git_status", "git_diff", "git_commit", "git_push"},
 		"Analysis":          {"analyze_code", "security_scan", "run_diagnostics"},
@@ -810,8 +930,9 @@ func cmdGit(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	m.status = "Running git command..."
 	m.updateViewport()
 
+	chatCmd := m.startChat(prompt)
 	return *m, tea.Batch(
-		m.sendMessage(prompt),
+		chatCmd,
 		m.spinner.Tick,
 	)
 }
@@ -877,6 +998,9 @@ func cmdVerbose(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 }
 
 func cmdDebug(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	if len(args) > 0 && strings.ToLower(args[0]) == "http" {
+		return cmdDebugHTTP(m, args[1:])
+	}
 	if len(args) == 0 {
 		// Toggle
 		m.agent.Config().DebugTools = !m.agent.Config().DebugTools
@@ -914,7 +1038,7 @@ func cmdDebug(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 
 	m.messageQueue.Add(QueuedMessage{
 		Role:      "system",
-		Content:   fmt.Sprintf("🐛 Debug mode: %s\n\nLevels: basic, verbose, trace", state),
+		Content:   fmt.Sprintf("🐛 Debug mode: %s\n\nLevels: basic, verbose, trace\nHTTP tracing: /debug http [on|off]", state),
 		Timestamp: time.Now(),
 		Complete:  true,
 	})
@@ -1413,6 +1537,18 @@ func cmdExit(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 // Dual Session Commands
 
 func cmdSession(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	// Persistent conversation sessions
+	if len(args) > 0 {
+		switch args[0] {
+		case "list", "ls":
+			return cmdSessionList(m, args[1:])
+		case "resume":
+			return cmdSessionResume(m, args[1:])
+		case "delete", "rm":
+			return cmdSessionDelete(m, args[1:])
+		}
+	}
+
 	if len(args) == 0 || args[0] == "status" {
 		// Show status
 		var content strings.Builder
@@ -1468,7 +1604,7 @@ func cmdSession(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	} else {
 		m.messageQueue.Add(QueuedMessage{
 			Role:      "error",
-			Content:   fmt.Sprintf("❌ Unknown action: %s\n\nUse: /session [on|off|status]", args[0]),
+			Content:   fmt.Sprintf("❌ Unknown action: %s\n\nUse: /session [on|off|status|list|resume <id>|delete <id>]", args[0]),
 			Timestamp: time.Now(),
 			Complete:  true,
 		})
@@ -1696,10 +1832,16 @@ func cmdConversation(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 }
 
 func cmdStop(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	// An in-flight agent turn takes priority over a debate
+	if m.processing && m.cancelChat() {
+		m.updateViewport()
+		return *m, nil
+	}
+
 	if !m.dualSession.IsRunning() {
 		m.messageQueue.Add(QueuedMessage{
 			Role:      "error",
-			Content:   "❌ No active conversation to stop.",
+			Content:   "❌ No active request or conversation to stop.",
 			Timestamp: time.Now(),
 			Complete:  true,
 		})
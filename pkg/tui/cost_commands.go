@@ -0,0 +1,124 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/agent"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Spending commands (/budget) and the cost section of /stats
+
+func cmdBudget(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	costs := &m.agent.Config().Costs
+
+	if len(args) == 2 {
+		var limit *float64
+		switch strings.ToLower(args[0]) {
+		case "daily", "day":
+			limit = &costs.DailyBudgetUSD
+		case "session":
+			limit = &costs.SessionBudgetUSD
+		}
+
+		value := strings.TrimPrefix(strings.ToLower(args[1]), "$")
+		amount, err := strconv.ParseFloat(value, 64)
+		if value == "off" {
+			amount, err = 0, nil
+		}
+		if limit == nil || err != nil || amount < 0 {
+			return budgetInfo(m, "❌ Usage: /budget [daily|session] [usd|off]")
+		}
+
+		*limit = amount
+		if err := m.agent.SaveConfig(); err != nil {
+			return budgetInfo(m, fmt.Sprintf("⚠️ Budget updated but not saved: %v", err))
+		}
+	} else if len(args) != 0 {
+		return budgetInfo(m, "❌ Usage: /budget [daily|session] [usd|off]")
+	}
+
+	today, session := m.agent.GetCosts()
+
+	var content strings.Builder
+	content.WriteString("💸 **Spending Budgets**\n\n")
+	content.WriteString(fmt.Sprintf("- Today: %s\n", formatBudget(today.CostUSD, costs.DailyBudgetUSD)))
+	content.WriteString(fmt.Sprintf("- Session: %s\n", formatBudget(session.CostUSD, costs.SessionBudgetUSD)))
+	if reason := m.agent.SpendingPaused(); reason != "" {
+		content.WriteString(fmt.Sprintf("\n⏸️ Agent paused: %s. Raise the budget to continue.\n", reason))
+	}
+	return budgetInfo(m, content.String())
+}
+
+func budgetInfo(m *EnhancedModel, content string) (tea.Model, tea.Cmd) {
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   content,
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+	return *m, nil
+}
+
+// formatBudget renders spend against a limit, e.g. "$1.2345 of $5.00 (25%)"
+func formatBudget(spent, limit float64) string {
+	if limit <= 0 {
+		return fmt.Sprintf("$%.4f (no limit)", spent)
+	}
+	return fmt.Sprintf("$%.4f of $%.2f (%.0f%%)", spent, limit, spent/limit*100)
+}
+
+// writeCostBreakdown appends the spend of the session, today and recent days to content
+func writeCostBreakdown(content *strings.Builder, m *EnhancedModel) {
+	costs := m.agent.Config().Costs
+	today, session := m.agent.GetCosts()
+
+	content.WriteString("\n**Cost:**\n")
+	content.WriteString(fmt.Sprintf("- Session: %s\n", formatBudget(session.CostUSD, costs.SessionBudgetUSD)))
+	writeModelCosts(content, session)
+	content.WriteString(fmt.Sprintf("- Today: %s\n", formatBudget(today.CostUSD, costs.DailyBudgetUSD)))
+	writeModelCosts(content, today)
+
+	if days := m.agent.GetRecentCosts(7); len(days) > 1 {
+		content.WriteString("- Recent days:\n")
+		for _, day := range days {
+			content.WriteString(fmt.Sprintf("  - %s: $%.4f (%d calls)\n", day.Date, day.CostUSD, day.Calls))
+		}
+	}
+	if reason := m.agent.SpendingPaused(); reason != "" {
+		content.WriteString(fmt.Sprintf("- ⏸️ Paused: %s (see /budget)\n", reason))
+	}
+}
+
+// writeModelCosts lists the per-model spend of a summary, most expensive first
+func writeModelCosts(content *strings.Builder, summary agent.CostSummary) {
+	names := make([]string, 0, len(summary.Models))
+	for name := range summary.Models {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return summary.Models[names[i]].CostUSD > summary.Models[names[j]].CostUSD
+	})
+
+	for _, name := range names {
+		mc := summary.Models[name]
+		line := fmt.Sprintf("  - %s: $%.4f (%d calls, %d in / %d out", name, mc.CostUSD, mc.Calls, mc.PromptTokens, mc.CompletionTokens)
+		if mc.CachedTokens > 0 {
+			line += fmt.Sprintf(", %d cached", mc.CachedTokens)
+		}
+		if mc.CacheWriteTokens > 0 {
+			line += fmt.Sprintf(", %d cache writes", mc.CacheWriteTokens)
+		}
+		line += ")"
+		if mc.Unpriced {
+			line += " — no pricing, set costs.pricing"
+		}
+		content.WriteString(line + "\n")
+	}
+}
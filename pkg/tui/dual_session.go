@@ -2,6 +2,7 @@
 package tui
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -184,10 +185,12 @@ func (ds *DualSession) runConversation(initialPrompt string) {
 			}
 			resultChan := make(chan chatResult, 1)
 
+			// Cancelling chatCtx aborts the agent's in-flight request and tools
+			chatCtx, chatCancel := context.WithCancel(context.Background())
 			go func() {
-				// We call Chat. This is synchronous and will block until done.
+				// ChatContext is synchronous and will block until done.
 				// It updates Agent.lastActivity internally during tool calls.
-				resp, e := currentAgent.Chat(currentMessage)
+				resp, e := currentAgent.ChatContext(chatCtx, currentMessage)
 				resultChan <- chatResult{resp, e}
 			}()
 
@@ -199,6 +202,8 @@ func (ds *DualSession) runConversation(initialPrompt string) {
 			for activeWaiting {
 				select {
 				case <-ds.stopChan:
+					chatCancel()
+					ticker.Stop()
 					return
 				case res := <-resultChan:
 					response = res.resp
@@ -219,6 +224,7 @@ func (ds *DualSession) runConversation(initialPrompt string) {
 					}
 				}
 			}
+			chatCancel()
 
 			if err == nil && response != "" {
 				break
@@ -206,7 +206,7 @@ func promptAPI(reader *bufio.Reader) (string, string, string) {
 	fmt.Println(setupInfoStyle.Render("  1. OpenAI     - https://api.openai.com/v1"))
 	fmt.Println(setupInfoStyle.Render("  2. NVIDIA     - https://integrate.api.nvidia.com/v1"))
 	fmt.Println(setupInfoStyle.Render("  3. Anthropic  - https://api.anthropic.com/v1"))
-	fmt.Println(setupInfoStyle.Render("  4. Local      - http://localhost:11434/v1"))
+	fmt.Println(setupInfoStyle.Render("  4. Ollama     - http://localhost:11434"))
 	fmt.Println()
 
 	baseURL := promptString(reader, "API Base URL", "https://api.openai.com/v1")
@@ -220,6 +220,9 @@ func promptAPI(reader *bufio.Reader) (string, string, string) {
 	} else if strings.Contains(baseURL, "openai.com") {
 		provider = "openai"
 		fmt.Println(setupSuccessStyle.Render("  Detected provider: OpenAI"))
+	} else if strings.Contains(baseURL, ":11434") {
+		provider = "ollama"
+		fmt.Println(setupSuccessStyle.Render("  Detected provider: Ollama (local)"))
 	} else if strings.HasPrefix(apiKey, "sk-ant-") {
 		provider = "anthropic"
 		fmt.Println(setupSuccessStyle.Render("  Detected provider: Anthropic (from API key)"))
@@ -506,11 +509,10 @@ MODEL=%s
 func buildConfig(agentName, primaryModel, provider string, fallbackModels []string, permPreset, memPreset string, telegramEnabled bool, primaryConfig *llm.ModelSelfConfig) map[string]interface{} {
 	// Memory configuration
 	memConfig := map[string]interface{}{
-		"max_short_term_items":  20,
-		"max_working_items":     50,
-		"max_long_term_items":   100,
-		"compression_trigger":   15,
-		"storage_path":          ".agi/memory.json",
+		"max_short_term_items": 20,
+		"max_working_items":    50,
+		"max_long_term_items":  100,
+		"storage_path":         ".agi/memory.json",
 	}
 
 	if memPreset == "minimal" {
@@ -536,10 +538,10 @@ func buildConfig(agentName, primaryModel, provider string, fallbackModels []stri
 	}
 
 	if permPreset == "restricted" {
-		permConfig["allowed_tools"] = []string{"read_file", "list_files", "search_files", "edit_file", "write_file"}
+		permConfig["allowed_tools"] = []string{"read_file", "list_files", "search_files", "read_output", "edit_file", "write_file"}
 		permConfig["require_approval_for_all"] = true
 	} else if permPreset == "read-only" {
-		permConfig["allowed_tools"] = []string{"read_file", "list_files", "search_files"}
+		permConfig["allowed_tools"] = []string{"read_file", "list_files", "search_files", "read_output"}
 		permConfig["allowed_commands"] = []string{"/status", "/logs", "/help"}
 	}
 
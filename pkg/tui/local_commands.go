@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Local model commands (/local, /pull) for the Ollama provider
+
+// pullCompleteMsg is sent when a model pull finishes
+type pullCompleteMsg struct {
+	model string
+	err   error
+}
+
+func cmdLocal(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	if !m.agent.UsesLocalModels() {
+		return localInfo(m, "🏠 Local models need the Ollama provider.\n\nSet `\"provider\": \"ollama\"` and `\"api_base_url\": \"http://localhost:11434\"`, or pick Local (Ollama) in /model.")
+	}
+
+	models, err := m.agent.ListLocalModels(context.Background())
+	if err != nil {
+		return localInfo(m, fmt.Sprintf("❌ Could not list local models: %v", err))
+	}
+
+	current := m.agent.Config().Model
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf("🏠 **Local Models** (%d installed)\n\n", len(models)))
+	installed := false
+	for _, model := range models {
+		marker := "  "
+		if model.Name == current || strings.TrimSuffix(model.Name, ":latest") == current {
+			marker, installed = "▶ ", true
+		}
+		details := []string{fmt.Sprintf("%.1f GB", float64(model.Size)/(1024*1024*1024))}
+		if model.Details.ParameterSize != "" {
+			details = append(details, model.Details.ParameterSize)
+		}
+		if model.Details.QuantizationLevel != "" {
+			details = append(details, model.Details.QuantizationLevel)
+		}
+		content.WriteString(fmt.Sprintf("%s`%s` — %s\n", marker, model.Name, strings.Join(details, ", ")))
+	}
+
+	if profile, known := llm.LookupModelProfile(current); known {
+		tools := "yes"
+		if !profile.SupportsTools {
+			tools = "no (tools are disabled)"
+		}
+		content.WriteString(fmt.Sprintf("\n**Active:** `%s` — context %d tokens, tool calling: %s\n", current, profile.ContextWindow, tools))
+	}
+	if !installed {
+		content.WriteString(fmt.Sprintf("\n⚠️ Active model `%s` is not installed. Run /pull to download it.\n", current))
+	}
+	content.WriteString("\nUse /model <name> to switch, /pull <name> to download.")
+	return localInfo(m, content.String())
+}
+
+func cmdPull(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	if !m.agent.UsesLocalModels() {
+		return localInfo(m, "❌ /pull needs the Ollama provider (see /local)")
+	}
+	if len(args) > 1 {
+		return localInfo(m, "❌ Usage: /pull [model]")
+	}
+	model := m.agent.Config().Model
+	if len(args) == 1 {
+		model = args[0]
+	}
+
+	m.status = fmt.Sprintf("⬇️ Pulling %s...", model)
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   fmt.Sprintf("⬇️ Pulling `%s` — progress is shown in the status bar.", model),
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+
+	pullCmd := func() tea.Msg {
+		return pullCompleteMsg{model: model, err: m.agent.PullModel(context.Background(), model)}
+	}
+	return *m, pullCmd
+}
+
+// handlePullComplete reports the result of a model pull
+func (m EnhancedModel) handlePullComplete(msg pullCompleteMsg) (tea.Model, tea.Cmd) {
+	m.status = ""
+	content := fmt.Sprintf("✅ Pulled `%s`.", msg.model)
+	if msg.err != nil {
+		content = fmt.Sprintf("❌ %v", msg.err)
+	} else if msg.model != m.agent.Config().Model {
+		content += fmt.Sprintf(" Switch to it with /model %s", msg.model)
+	}
+	return localInfo(&m, content)
+}
+
+func localInfo(m *EnhancedModel, content string) (tea.Model, tea.Cmd) {
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   content,
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+	return *m, nil
+}
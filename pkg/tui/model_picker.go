@@ -39,8 +39,8 @@ var pickerProviders = []ProviderOption{
 	{Label: "OpenAI", Provider: "openai", BaseURL: "https://api.openai.com/v1", NeedsKey: true},
 	{Label: "DeepSeek", Provider: "openai", BaseURL: "https://api.deepseek.com", NeedsKey: true},
 	{Label: "Moonshot", Provider: "openai", BaseURL: "https://api.moonshot.ai/v1", NeedsKey: true},
-	{Label: "Google Gemini", Provider: "openai", BaseURL: "https://generativelanguage.googleapis.com/v1beta", NeedsKey: true},
-	{Label: "Local (Ollama)", Provider: "openai", BaseURL: "http://localhost:11434/v1", NeedsKey: false},
+	{Label: "Google Gemini", Provider: "gemini", BaseURL: "https://generativelanguage.googleapis.com/v1beta", NeedsKey: true},
+	{Label: "Local (Ollama)", Provider: "ollama", BaseURL: "http://localhost:11434", NeedsKey: false},
 	{Label: "Custom URL", Provider: "openai", BaseURL: "", NeedsKey: true},
 }
 
@@ -268,8 +268,8 @@ func (m Model) pickerUpdateProvider(msg tea.KeyMsg) (Model, tea.Cmd) {
 		m.pickerNewURL = selected.BaseURL
 
 		// If OAuth is active for this specific provider+endpoint, skip API key step
-		// Only skip for the actual OAuth provider (Anthropic API, OpenAI API), not for
-		// other providers that share the "openai" protocol (DeepSeek, Gemini, Ollama).
+		// Only skip for the actual OAuth provider (Anthropic, OpenAI, Gemini APIs), not for
+		// other providers that share the "openai" protocol (DeepSeek, Moonshot).
 		oauthSkip := false
 		if selected.Label == "Anthropic" && m.agent.HasOAuthFor("anthropic") {
 			oauthSkip = true
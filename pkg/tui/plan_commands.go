@@ -0,0 +1,181 @@
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/agent"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Plan-then-execute commands (/plan)
+
+// planCompleteMsg is sent when planning or plan execution finishes
+type planCompleteMsg struct {
+	plan *agent.Plan
+	err  error
+}
+
+func cmdPlan(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		plan := m.agent.GetPlan()
+		if plan == nil {
+			return planInfo(m, "🧭 No active plan.\n\nUsage: /plan <goal> to draft one, then /plan approve to run it.")
+		}
+		return planInfo(m, agent.FormatPlan(plan)+planHint(plan))
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "approve", "run", "resume", "retry":
+		return startPlanRun(m, "▶️ Executing plan...", func(ctx context.Context) (*agent.Plan, error) {
+			return m.agent.ExecutePlan(ctx)
+		})
+
+	case "skip":
+		if _, err := m.agent.SkipPlanStep(); err != nil {
+			return sessionError(m, fmt.Sprintf("❌ %v", err))
+		}
+		return startPlanRun(m, "⏭️ Skipped failed step, continuing plan...", func(ctx context.Context) (*agent.Plan, error) {
+			return m.agent.ExecutePlan(ctx)
+		})
+
+	case "cancel":
+		if err := m.agent.CancelPlan(); err != nil {
+			return sessionError(m, fmt.Sprintf("❌ %v", err))
+		}
+		return planInfo(m, "🗑️ Plan cancelled. task.md was left unchanged.")
+
+	case "edit":
+		if len(args) < 3 {
+			return sessionError(m, "❌ Usage: /plan edit <step> <new text>")
+		}
+		step, err := strconv.Atoi(args[1])
+		if err != nil {
+			return sessionError(m, "❌ Usage: /plan edit <step> <new text>")
+		}
+		return planEdited(m)(m.agent.EditPlanStep(step, strings.Join(args[2:], " ")))
+
+	case "add":
+		if len(args) < 2 {
+			return sessionError(m, "❌ Usage: /plan add <step text>")
+		}
+		return planEdited(m)(m.agent.AddPlanStep(strings.Join(args[1:], " ")))
+
+	case "remove", "rm":
+		if len(args) < 2 {
+			return sessionError(m, "❌ Usage: /plan remove <step>")
+		}
+		step, err := strconv.Atoi(args[1])
+		if err != nil {
+			return sessionError(m, "❌ Usage: /plan remove <step>")
+		}
+		return planEdited(m)(m.agent.RemovePlanStep(step))
+	}
+
+	goal := strings.Join(args, " ")
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "user",
+		Content:   "/plan " + goal,
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	return startPlanRun(m, "🧭 Planning (read-only tools)...", func(ctx context.Context) (*agent.Plan, error) {
+		return m.agent.CreatePlan(ctx, goal)
+	})
+}
+
+// startPlanRun runs a planning or execution call in the background like a chat turn
+func startPlanRun(m *EnhancedModel, status string, run func(ctx context.Context) (*agent.Plan, error)) (tea.Model, tea.Cmd) {
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "assistant",
+		Content:   "",
+		Streaming: true,
+		Timestamp: time.Now(),
+		Complete:  false,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.chatCancel = cancel
+	m.processing = true
+	m.status = status
+	m.updateViewport()
+
+	planCmd := func() tea.Msg {
+		plan, err := run(ctx)
+		return planCompleteMsg{plan: plan, err: err}
+	}
+	return *m, tea.Batch(planCmd, m.spinner.Tick)
+}
+
+// handlePlanComplete finishes the placeholder message and shows the plan
+func (m EnhancedModel) handlePlanComplete(msg planCompleteMsg) (tea.Model, tea.Cmd) {
+	m.processing = false
+	m.status = ""
+	m.chatCancel = nil
+	m.messageQueue.UpdateLast(func(qm *QueuedMessage) {
+		qm.Complete = true
+		qm.Streaming = false
+		if qm.StreamChunk == "" {
+			qm.Role = "system"
+			qm.Content = "🧭 Plan update"
+		}
+	})
+
+	switch {
+	case msg.err != nil && errors.Is(msg.err, context.Canceled):
+		m.messageQueue.Add(QueuedMessage{Role: "system", Content: "🛑 Request cancelled.", Timestamp: time.Now(), Complete: true})
+	case msg.err != nil:
+		m.messageQueue.Add(QueuedMessage{Role: "error", Content: "❌ " + msg.err.Error(), Timestamp: time.Now(), Complete: true})
+	}
+	if msg.plan != nil {
+		m.messageQueue.Add(QueuedMessage{
+			Role:      "system",
+			Content:   agent.FormatPlan(msg.plan) + planHint(msg.plan),
+			Timestamp: time.Now(),
+			Complete:  true,
+		})
+	}
+
+	m.updateViewport()
+	m.textarea.Focus()
+	return m, nil
+}
+
+// planEdited reports the result of a draft edit
+func planEdited(m *EnhancedModel) func(*agent.Plan, error) (tea.Model, tea.Cmd) {
+	return func(plan *agent.Plan, err error) (tea.Model, tea.Cmd) {
+		if err != nil {
+			return sessionError(m, fmt.Sprintf("❌ Failed to edit plan: %v", err))
+		}
+		return planInfo(m, "✏️ Plan updated.\n\n"+agent.FormatPlan(plan)+planHint(plan))
+	}
+}
+
+// planHint tells the user what they can do next with a plan
+func planHint(plan *agent.Plan) string {
+	switch plan.Status {
+	case agent.PlanDraft:
+		return "\n\nApprove with `/plan approve`. Change it with `/plan edit <n> <text>`, `/plan add <text>`, " +
+			"`/plan remove <n>` or by editing task.md. Discard with `/plan cancel`."
+	case agent.PlanPaused:
+		return "\n\nDecide how to continue: `/plan retry`, `/plan skip` or `/plan cancel`. " +
+			"Edits to task.md are picked up on retry."
+	}
+	return ""
+}
+
+func planInfo(m *EnhancedModel, content string) (tea.Model, tea.Cmd) {
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   content,
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+	return *m, nil
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"ClosedWheeler/pkg/llm"
 	"ClosedWheeler/pkg/providers"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -101,6 +102,7 @@ func cmdListProviders(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 				stats["total_requests"],
 				stats["success_rate"],
 				stats["avg_latency_ms"]))
+			content.WriteString(fmt.Sprintf("  Circuit: %s\n", formatBreakerState(llm.BreakerFor(p.BaseURL, p.Model).Stats())))
 			content.WriteString("\n")
 		}
 
@@ -290,6 +292,7 @@ func cmdProviderStats(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 		content.WriteString(fmt.Sprintf("Total Requests: %v\n", stats["total_requests"]))
 		content.WriteString(fmt.Sprintf("Total Tokens: %v\n", stats["total_tokens"]))
 		content.WriteString(fmt.Sprintf("Total Cost: $%.4f\n", stats["total_cost"]))
+		content.WriteString(formatBreakers(llm.AllBreakerStats()))
 
 		m.messageQueue.Add(QueuedMessage{
 			Role:      "system",
@@ -333,6 +336,15 @@ func cmdProviderStats(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 			}
 			content.WriteString(fmt.Sprintf("- Health: %v\n", stats["healthy"]))
 
+			breaker := llm.BreakerFor(provider.BaseURL, provider.Model).Stats()
+			content.WriteString("\n**Circuit Breaker:**\n")
+			content.WriteString(fmt.Sprintf("- State: %s\n", formatBreakerState(breaker)))
+			content.WriteString(fmt.Sprintf("- Consecutive Failures: %d\n", breaker.Failures))
+			content.WriteString(fmt.Sprintf("- Trips: %d\n", breaker.Trips))
+			if breaker.LastError != "" {
+				content.WriteString(fmt.Sprintf("- Last Error: %s\n", breaker.LastError))
+			}
+
 			m.messageQueue.Add(QueuedMessage{
 				Role:      "system",
 				Content:   content.String(),
@@ -465,3 +477,35 @@ func cmdPairings(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	m.updateViewport()
 	return *m, nil
 }
+
+// formatBreakerState renders a circuit breaker's state with an indicator
+func formatBreakerState(s llm.BreakerStats) string {
+	switch s.State {
+	case llm.CircuitOpen:
+		wait := time.Until(s.RetryAt).Round(time.Second)
+		if wait < 0 {
+			wait = 0
+		}
+		return fmt.Sprintf("🔴 open (probing in %s)", wait)
+	case llm.CircuitHalfOpen:
+		return "🟡 half-open (probing)"
+	}
+	return "🟢 closed"
+}
+
+// formatBreakers lists the circuit breakers that have seen failures
+func formatBreakers(stats []llm.BreakerStats) string {
+	var b strings.Builder
+	b.WriteString("\n**Circuit Breakers:**\n")
+	if len(stats) == 0 {
+		b.WriteString("- All providers answering ✅\n")
+		return b.String()
+	}
+	for _, s := range stats {
+		b.WriteString(fmt.Sprintf("- %s: %s | %d failures | %d trips\n", s.Name, formatBreakerState(s), s.Failures, s.Trips))
+		if s.LastError != "" {
+			b.WriteString(fmt.Sprintf("  Last error: %s\n", s.LastError))
+		}
+	}
+	return b.String()
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 	"time"
 
+	"ClosedWheeler/pkg/llm"
 	"ClosedWheeler/pkg/recovery"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -99,6 +100,7 @@ func cmdResilience(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	content.WriteString("- API timeouts → Retry with exponential backoff\n")
 	content.WriteString("- Rate limits → Wait and retry\n")
 	content.WriteString("- Network errors → Retry up to 3 times\n")
+	content.WriteString("- Failing providers → Circuit breaker pauses requests and probes until they answer\n")
 	content.WriteString("- Permission errors → Graceful fallback\n")
 	content.WriteString("- Panics → Recover and log\n\n")
 
@@ -125,6 +127,7 @@ func cmdResilience(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
 	} else {
 		content.WriteString("- No errors yet ✅\n")
 	}
+	content.WriteString(formatBreakers(llm.AllBreakerStats()))
 
 	content.WriteString("\n**Commands:**\n")
 	content.WriteString("- `/errors` - View recent errors\n")
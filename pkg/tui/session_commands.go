@@ -0,0 +1,265 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/llm"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// Persistent conversation session commands (/session list|resume|delete)
+
+func cmdSessionList(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	sessions, err := m.agent.ListSessions()
+	if err != nil {
+		return sessionError(m, fmt.Sprintf("❌ Failed to list sessions: %v", err))
+	}
+
+	var content strings.Builder
+	content.WriteString("💾 **Saved Sessions**\n\n")
+
+	if len(sessions) == 0 {
+		content.WriteString("No saved sessions yet. Sessions are saved after every message.")
+	} else {
+		current := m.agent.SessionID()
+		for _, s := range sessions {
+			marker := "  "
+			if s.ID == current {
+				marker = "▶ "
+			}
+			content.WriteString(fmt.Sprintf("%s`%s` %s\n", marker, s.ID, s.Title))
+			content.WriteString(fmt.Sprintf("   %d messages · %s · %s\n",
+				s.MessageCount, s.Model, s.UpdatedAt.Format("2006-01-02 15:04")))
+		}
+		content.WriteString("\nResume with `/session resume <id>` (a unique prefix is enough).")
+	}
+
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   content.String(),
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+	return *m, nil
+}
+
+func cmdSessionResume(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		return sessionError(m, "❌ Usage: /session resume <id>")
+	}
+
+	rec, err := m.agent.ResumeSession(args[0])
+	if err != nil {
+		return sessionError(m, fmt.Sprintf("❌ Failed to resume session: %v", err))
+	}
+
+	m.messageQueue.Clear()
+	header := fmt.Sprintf("📂 Resumed session `%s`: %s (%d messages)", rec.ID, rec.Title, len(rec.Messages))
+	if rec.Model != "" && rec.Model != m.agent.Config().Model {
+		header += fmt.Sprintf("\n⚠️ Recorded with model %s, continuing with %s.", rec.Model, m.agent.Config().Model)
+	}
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   header,
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	addTranscript(m.messageQueue, rec.Messages)
+
+	m.updateViewport()
+	return *m, nil
+}
+
+func cmdSessionDelete(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		return sessionError(m, "❌ Usage: /session delete <id>")
+	}
+
+	id, err := m.agent.DeleteSession(args[0])
+	if err != nil {
+		return sessionError(m, fmt.Sprintf("❌ Failed to delete session: %v", err))
+	}
+
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   fmt.Sprintf("🗑️ Deleted session `%s`.", id),
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+	return *m, nil
+}
+
+// Conversation branch commands (/fork, /branches, /switch)
+
+func cmdFork(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	messages := m.agent.GetSessionMessages()
+	if len(args) == 0 {
+		var content strings.Builder
+		content.WriteString("🌿 **Fork Points**\n\n")
+		if len(messages) == 0 {
+			content.WriteString("No messages yet.")
+		}
+		for i, msg := range messages {
+			preview := []rune(strings.Join(strings.Fields(msg.Content), " "))
+			if len(preview) > 70 {
+				preview = append(preview[:67], []rune("...")...)
+			}
+			content.WriteString(fmt.Sprintf("%3d. [%s] %s\n", i+1, msg.Role, string(preview)))
+		}
+		if len(messages) > 0 {
+			content.WriteString("\nFork with `/fork <n> [name]`. Forking at a user message branches just before it.")
+		}
+		m.messageQueue.Add(QueuedMessage{
+			Role:      "system",
+			Content:   content.String(),
+			Timestamp: time.Now(),
+			Complete:  true,
+		})
+		m.updateViewport()
+		return *m, nil
+	}
+
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return sessionError(m, "❌ Usage: /fork <message-index> [name]")
+	}
+	name := strings.Join(args[1:], " ")
+
+	rec, restored, err := m.agent.ForkSession(index, name)
+	if err != nil {
+		return sessionError(m, fmt.Sprintf("❌ Failed to fork: %v", err))
+	}
+
+	m.messageQueue.Clear()
+	header := fmt.Sprintf("🌿 Forked branch `%s` from `%s` at message %d.", rec.ID, rec.ParentID, rec.ForkIndex)
+	if len(restored) > 0 {
+		header += fmt.Sprintf("\n↩️ Restored %d file(s) to their state at the fork point.", len(restored))
+	}
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   header,
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	addTranscript(m.messageQueue, rec.Messages)
+
+	m.updateViewport()
+	return *m, nil
+}
+
+func cmdBranches(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	branches, err := m.agent.ListBranches()
+	if err != nil {
+		return sessionError(m, fmt.Sprintf("❌ Failed to list branches: %v", err))
+	}
+
+	var content strings.Builder
+	content.WriteString("🌿 **Branches**\n\n")
+	if len(branches) == 0 {
+		content.WriteString("No saved branches yet. Use `/fork` to create one.")
+	} else {
+		current := m.agent.SessionID()
+		for _, b := range branches {
+			marker := "  "
+			if b.ID == current {
+				marker = "▶ "
+			}
+			label := b.Branch
+			if label == "" {
+				label = b.Title
+			}
+			content.WriteString(fmt.Sprintf("%s`%s` %s\n", marker, b.ID, label))
+			origin := "root"
+			if b.ParentID != "" {
+				origin = fmt.Sprintf("forked from `%s` at message %d", b.ParentID, b.ForkIndex)
+			}
+			content.WriteString(fmt.Sprintf("   %d messages · %s · %s\n",
+				b.MessageCount, origin, b.UpdatedAt.Format("2006-01-02 15:04")))
+		}
+		content.WriteString("\nSwitch with `/switch <id>` (a unique prefix is enough).")
+	}
+
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   content.String(),
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+	return *m, nil
+}
+
+func cmdSwitch(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	if len(args) == 0 {
+		return sessionError(m, "❌ Usage: /switch <branch-id>")
+	}
+	rec, restored, err := m.agent.SwitchBranch(args[0])
+	if err != nil {
+		return sessionError(m, fmt.Sprintf("❌ Failed to switch branch: %v", err))
+	}
+
+	m.messageQueue.Clear()
+	header := fmt.Sprintf("🌿 Switched to branch `%s`", rec.ID)
+	if rec.Branch != "" {
+		header += fmt.Sprintf(" (%s)", rec.Branch)
+	}
+	header += fmt.Sprintf(": %d messages", len(rec.Messages))
+	if len(restored) > 0 {
+		header += fmt.Sprintf("\n↩️ Restored %d file(s): %s", len(restored), strings.Join(relativePaths(m, restored), ", "))
+	}
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   header,
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	addTranscript(m.messageQueue, rec.Messages)
+
+	m.updateViewport()
+	return *m, nil
+}
+
+// relativePaths shortens absolute paths to be relative to the workplace
+func relativePaths(m *EnhancedModel, paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		if rel, err := filepath.Rel(m.agent.GetProjectPath(), p); err == nil {
+			p = rel
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// addTranscript appends a session transcript to the message queue
+func addTranscript(mq *MessageQueue, messages []llm.Message) {
+	for _, msg := range messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			continue
+		}
+		mq.Add(QueuedMessage{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			Timestamp: time.Now(),
+			Complete:  true,
+		})
+	}
+}
+
+func sessionError(m *EnhancedModel, content string) (tea.Model, tea.Cmd) {
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "error",
+		Content:   content,
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+	return *m, nil
+}
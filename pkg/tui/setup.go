@@ -179,9 +179,9 @@ func (m *SetupModel) configureProviderDefaults(provider string) {
 		m.config.Model = "deepseek-coder"
 		m.config.Provider = "openai"
 	case "Local (Ollama)":
-		m.config.APIBaseURL = "http://localhost:11434/v1"
+		m.config.APIBaseURL = "http://localhost:11434"
 		m.config.Model = "llama3"
-		m.config.Provider = "openai"
+		m.config.Provider = "ollama"
 	}
 }
 
@@ -0,0 +1,199 @@
+package tui
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"ClosedWheeler/pkg/traces"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// HTTP trace commands
+
+// maxTraceBodyDisplay caps each body shown by /traces; the trace file has the rest
+const maxTraceBodyDisplay = 4000
+
+func cmdDebugHTTP(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	cfg := m.agent.Config()
+	if len(args) == 0 {
+		cfg.DebugHTTP = !cfg.DebugHTTP
+	} else {
+		arg := strings.ToLower(args[0])
+		cfg.DebugHTTP = arg == "on" || arg == "true" || arg == "1"
+	}
+	traces.SetEnabled(cfg.DebugHTTP)
+	m.agent.SaveConfig()
+
+	state := lipgloss.NewStyle().Foreground(errorColor).Render("OFF")
+	if cfg.DebugHTTP {
+		state = lipgloss.NewStyle().Foreground(successColor).Render("ON")
+	}
+
+	m.messageQueue.Add(QueuedMessage{
+		Role:      "system",
+		Content:   fmt.Sprintf("🔍 HTTP tracing: %s\n\nRequests and responses (LLM, OAuth, Telegram) are written to `%s` with credentials redacted. Browse them with `/traces`.", state, traces.Dir()),
+		Timestamp: time.Now(),
+		Complete:  true,
+	})
+	m.updateViewport()
+	return *m, nil
+}
+
+func cmdTraces(m *EnhancedModel, args []string) (tea.Model, tea.Cmd) {
+	var content string
+	var err error
+	if len(args) == 0 {
+		content, err = listTraces(20)
+	} else {
+		content, err = showTrace(args[0])
+	}
+	if err != nil {
+		m.messageQueue.Add(QueuedMessage{
+			Role:      "error",
+			Content:   fmt.Sprintf("❌ %v", err),
+			Timestamp: time.Now(),
+			Complete:  true,
+		})
+	} else {
+		m.messageQueue.Add(QueuedMessage{
+			Role:      "system",
+			Content:   content,
+			Timestamp: time.Now(),
+			Complete:  true,
+		})
+	}
+	m.updateViewport()
+	return *m, nil
+}
+
+// listTraces renders the n newest traces, one per line
+func listTraces(n int) (string, error) {
+	recent, err := traces.Recent(n)
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	state := "OFF"
+	if traces.Enabled() {
+		state = "ON"
+	}
+	content.WriteString(fmt.Sprintf("🔍 **HTTP Traces** (tracing %s, toggle with `/debug http`)\n\n", state))
+	if len(recent) == 0 {
+		content.WriteString("No traces recorded yet.\n")
+		return content.String(), nil
+	}
+	for _, t := range recent {
+		outcome := fmt.Sprintf("%d", t.Status)
+		if t.Error != "" {
+			outcome = "❌ error"
+		} else if t.Status >= 400 {
+			outcome = fmt.Sprintf("⚠️ %d", t.Status)
+		}
+		content.WriteString(fmt.Sprintf("`%s` %s %s %s %s → %s (%s)\n",
+			t.ID, t.Time.Format("15:04:05"), t.Source, t.Method, traceTarget(t.URL), outcome, formatTraceMs(t.Timing.TotalMs)))
+	}
+	content.WriteString("\nShow one with `/traces <id>`")
+	return content.String(), nil
+}
+
+// showTrace renders one trace with its timing breakdown, headers and bodies
+func showTrace(id string) (string, error) {
+	t, err := traces.Find(id)
+	if err != nil {
+		return "", err
+	}
+
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf("🔍 **Trace %s**\n\n", t.ID))
+	content.WriteString(fmt.Sprintf("- Time: %s\n", t.Time.Format("2006-01-02 15:04:05")))
+	content.WriteString(fmt.Sprintf("- Source: %s\n", t.Source))
+	content.WriteString(fmt.Sprintf("- Request: %s %s\n", t.Method, t.URL))
+	if t.Status != 0 {
+		content.WriteString(fmt.Sprintf("- Status: %d %s\n", t.Status, http.StatusText(t.Status)))
+	}
+	if t.Error != "" {
+		content.WriteString(fmt.Sprintf("- Error: %s\n", t.Error))
+	}
+	if t.Truncated {
+		content.WriteString("- Bodies over 256 KB were cut when recording\n")
+	}
+
+	timing := t.Timing
+	content.WriteString("\n**Timing:**\n")
+	if timing.ReusedConn {
+		content.WriteString("- Connection: reused\n")
+	} else {
+		content.WriteString(fmt.Sprintf("- DNS: %s\n", formatTraceMs(timing.DNSMs)))
+		content.WriteString(fmt.Sprintf("- Connect: %s\n", formatTraceMs(timing.ConnectMs)))
+		content.WriteString(fmt.Sprintf("- TLS: %s\n", formatTraceMs(timing.TLSMs)))
+	}
+	content.WriteString(fmt.Sprintf("- Waiting for response: %s\n", formatTraceMs(timing.WaitMs)))
+	content.WriteString(fmt.Sprintf("- Transfer: %s\n", formatTraceMs(timing.TransferMs)))
+	content.WriteString(fmt.Sprintf("- Total: %s\n", formatTraceMs(timing.TotalMs)))
+
+	writeTraceHeaders(&content, "Request Headers", t.RequestHeaders)
+	writeTraceBody(&content, "Request Body", t.RequestBody)
+	writeTraceHeaders(&content, "Response Headers", t.ResponseHeaders)
+	writeTraceBody(&content, "Response Body", t.ResponseBody)
+
+	content.WriteString(fmt.Sprintf("\nFull trace in `%s/%s.jsonl`", traces.Dir(), t.Time.Format("2006-01-02")))
+	return content.String(), nil
+}
+
+// writeTraceHeaders lists headers sorted by name
+func writeTraceHeaders(content *strings.Builder, title string, headers map[string]string) {
+	if len(headers) == 0 {
+		return
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	content.WriteString(fmt.Sprintf("\n**%s:**\n", title))
+	for _, name := range names {
+		content.WriteString(fmt.Sprintf("- %s: %s\n", name, headers[name]))
+	}
+}
+
+// writeTraceBody shows a body, indenting JSON and cutting long bodies
+func writeTraceBody(content *strings.Builder, title, body string) {
+	if body == "" {
+		return
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, []byte(body), "", "  ") == nil {
+		body = pretty.String()
+	}
+	if len(body) > maxTraceBodyDisplay {
+		body = body[:maxTraceBodyDisplay] + fmt.Sprintf("\n... (%d more bytes)", len(body)-maxTraceBodyDisplay)
+	}
+	content.WriteString(fmt.Sprintf("\n**%s:**\n```\n%s\n```\n", title, body))
+}
+
+// traceTarget shortens a URL to its host and path for listings
+func traceTarget(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host + u.Path
+}
+
+// formatTraceMs renders a duration given in milliseconds
+func formatTraceMs(ms float64) string {
+	if ms >= 1000 {
+		return fmt.Sprintf("%.2fs", ms/1000)
+	}
+	return fmt.Sprintf("%.1fms", ms)
+}
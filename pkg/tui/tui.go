@@ -904,7 +904,8 @@ type responseMsg struct {
 }
 
 type streamChunkMsg struct {
-	chunk string
+	chunk    string
+	separate bool // First chunk of another request in the same turn
 }
 
 type statusUpdateMsg struct {
@@ -968,15 +969,17 @@ func Run(ag *agent.Agent, ctx ...context.Context) error {
 
 	p := tea.NewProgram(NewModel(ag), opts...)
 
-	// Set status callback
-	ag.SetStatusCallback(func(s string) {
-		p.Send(statusUpdateMsg{status: s})
+	// Show agent status lines
+	unsubscribe := ag.Subscribe(func(e agent.Event) {
+		if summary := e.Summary(); summary != "" {
+			p.Send(statusUpdateMsg{status: summary})
+		}
 	})
 
 	_, err := p.Run()
 
-	// Clear status callback to prevent sends after program exits
-	ag.SetStatusCallback(nil)
+	// Unsubscribe to prevent sends after program exits
+	unsubscribe()
 
 	return err
 }
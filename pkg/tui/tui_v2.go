@@ -3,6 +3,7 @@ package tui
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -40,6 +41,7 @@ type QueuedMessage struct {
 
 // ToolExecution represents a tool being executed
 type ToolExecution struct {
+	ID        string // Tool call ID, matches start and finish events
 	Name      string
 	Status    string // "pending", "running", "success", "failed"
 	StartTime time.Time
@@ -105,6 +107,7 @@ type EnhancedModel struct {
 	status            string
 	thinkingAnimation int
 	contextStats      agent.ContextStats
+	contextUsage      agent.ContextUsage
 	dualSession       *DualSession       // Dual session for agent-to-agent conversations
 	providerManager   *providers.ProviderManager // Multi-provider support
 	toolRetryWrapper  *tools.IntelligentRetryWrapper // Intelligent tool retry system
@@ -131,6 +134,10 @@ type EnhancedModel struct {
 	loginClipboard bool
 	loginInput    textinput.Model
 	loginCancel   context.CancelFunc
+
+	chatCancel context.CancelFunc // Cancels the in-flight agent turn (Ctrl+C, /stop)
+	progress   *agent.ProgressEvent    // Latest tool loop progress for the running turn
+	subAgents  []agent.SubAgentProgress // Sub-agents delegated during the running turn
 }
 
 // NewEnhancedModel creates a new enhanced TUI model
@@ -163,16 +170,20 @@ func NewEnhancedModel(ag *agent.Agent) EnhancedModel {
 		Complete:  true,
 	})
 
-	// Initialize provider manager
-	providerConfig, _ := providers.LoadProvidersConfig("")
-	var pm *providers.ProviderManager
-	if providerConfig != nil {
-		pm, _ = providers.InitializeFromConfig(providerConfig)
-	}
-	if pm == nil {
-		pm = providers.NewProviderManager()
+	// Show the transcript when starting with a resumed session (--resume)
+	if transcript := ag.GetSessionMessages(); len(transcript) > 0 {
+		mq.Add(QueuedMessage{
+			Role:      "system",
+			Content:   fmt.Sprintf("📂 Resumed session `%s` (%d messages)", ag.SessionID(), len(transcript)),
+			Timestamp: time.Now(),
+			Complete:  true,
+		})
+		addTranscript(mq, transcript)
 	}
 
+	// Share the agent's provider manager, so /providers shows the stats of real requests
+	pm := ag.ProviderManager()
+
 	// Initialize intelligent retry wrapper
 	// Note: The wrapper will be used by TUI commands to show stats
 	// The agent will use the original executor
@@ -251,12 +262,21 @@ func (m EnhancedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		switch msg.Type {
 		case tea.KeyCtrlC:
+			// First Ctrl+C aborts the running turn, a second one quits
+			if m.processing && m.chatCancel != nil {
+				m.cancelChat()
+				return m, nil
+			}
 			return m, tea.Quit
 
 		case tea.KeyEnter:
 			if !m.processing {
 				return m.sendCurrentMessage()
 			}
+			// Only /stop is accepted while the agent is busy
+			if isStopCommand(m.textarea.Value()) {
+				return m.handleCommand(strings.TrimSpace(m.textarea.Value()))
+			}
 			return m, nil
 		}
 
@@ -270,10 +290,17 @@ func (m EnhancedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case responseCompleteMsg:
 		m.processing = false
 		m.status = ""
+		m.chatCancel = nil
 		m.messageQueue.UpdateLast(func(qm *QueuedMessage) {
 			qm.Complete = true
 			qm.Streaming = false
-			if msg.err != nil {
+			if errors.Is(msg.err, context.Canceled) {
+				qm.Role = "system"
+				qm.Content = "🛑 Request cancelled."
+				if qm.StreamChunk != "" {
+					qm.Content = qm.StreamChunk + "\n\n🛑 Request cancelled."
+				}
+			} else if msg.err != nil {
 				qm.Role = "error"
 				qm.Content = "❌ " + msg.err.Error()
 			} else {
@@ -284,9 +311,18 @@ func (m EnhancedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Re-focus textarea for new input
 		m.textarea.Focus()
 
+	case planCompleteMsg:
+		return m.handlePlanComplete(msg)
+
+	case pullCompleteMsg:
+		return m.handlePullComplete(msg)
+
 	case streamChunkMsg:
 		if msg.chunk != "" {
 			m.messageQueue.UpdateLast(func(qm *QueuedMessage) {
+				if msg.separate && qm.StreamChunk != "" {
+					qm.StreamChunk += "\n\n"
+				}
 				qm.StreamChunk += msg.chunk
 				qm.Content = qm.StreamChunk
 			})
@@ -297,12 +333,13 @@ func (m EnhancedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case toolStartMsg:
 		wasEmpty := len(m.activeTools) == 0
 		tool := ToolExecution{
+			ID:        msg.id,
 			Name:      msg.toolName,
 			Status:    "running",
 			StartTime: time.Now(),
 		}
-		m.currentTool = &tool
 		m.activeTools = append(m.activeTools, tool)
+		m.currentTool = &m.activeTools[len(m.activeTools)-1]
 		m.status = fmt.Sprintf("🔧 %s", msg.toolName)
 		// Tools section just appeared — recalculate layout to shrink viewport
 		if wasEmpty && m.ready {
@@ -311,48 +348,43 @@ func (m EnhancedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m, nil
 
 	case toolCompleteMsg:
-		if m.currentTool != nil {
-			m.currentTool.Status = "success"
-			m.currentTool.EndTime = time.Now()
-			m.currentTool.Result = msg.result
-
-			// Update in activeTools
-			for i := range m.activeTools {
-				if m.activeTools[i].Name == m.currentTool.Name &&
-				   m.activeTools[i].StartTime == m.currentTool.StartTime {
-					m.activeTools[i] = *m.currentTool
-					break
-				}
-			}
-		}
-		m.currentTool = nil
+		m.finishTool(msg.id, "success", msg.duration, func(t *ToolExecution) { t.Result = msg.result })
 		return m, nil
 
 	case toolErrorMsg:
-		if m.currentTool != nil {
-			m.currentTool.Status = "failed"
-			m.currentTool.EndTime = time.Now()
-			m.currentTool.Error = msg.err.Error()
-
-			// Update in activeTools
-			for i := range m.activeTools {
-				if m.activeTools[i].Name == m.currentTool.Name &&
-				   m.activeTools[i].StartTime == m.currentTool.StartTime {
-					m.activeTools[i] = *m.currentTool
-					break
-				}
-			}
-		}
-		m.currentTool = nil
+		m.finishTool(msg.id, "failed", msg.duration, func(t *ToolExecution) { t.Error = msg.err.Error() })
 		return m, nil
 
 	case statusUpdateMsg:
 		m.status = msg.status
 		return m, nil
 
+	case progressMsg:
+		event := msg.event
+		if event.Type == agent.ProgressSubAgent {
+			m.updateSubAgent(*event.SubAgent)
+			return m, nil
+		}
+		if event.Type == agent.ProgressPull {
+			m.status = event.Status
+			return m, nil
+		}
+		m.progress = &event
+		if event.Type == agent.ProgressBudgetExhausted {
+			m.status = "⏸️ " + event.Reason
+		}
+		return m, nil
+
 	case thinkingMsg:
+		// Each model call of a turn may report its own reasoning
 		m.messageQueue.UpdateLast(func(qm *QueuedMessage) {
-			qm.Thinking = msg.content
+			if qm.Role != "assistant" {
+				return
+			}
+			if qm.Thinking != "" {
+				qm.Thinking += "\n\n"
+			}
+			qm.Thinking += msg.content
 		})
 		m.updateViewport()
 		return m, nil
@@ -376,6 +408,7 @@ func (m EnhancedModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	// Update context stats
 	m.contextStats = m.agent.GetContextStats()
+	m.contextUsage = m.agent.GetContextUsage()
 
 	// Update textarea
 	if !m.processing {
@@ -471,6 +504,11 @@ func (m EnhancedModel) renderHeader() string {
 
 	right := modelStyle.Render("🧠 " + modelInfo)
 
+	// Context gauge, dropped first when the terminal is narrow
+	if gauge := m.renderContextGauge(); m.width-lipgloss.Width(left)-lipgloss.Width(right)-lipgloss.Width(gauge) >= 4 {
+		right = lipgloss.JoinHorizontal(lipgloss.Center, gauge, right)
+	}
+
 	gap := m.width - lipgloss.Width(left) - lipgloss.Width(right) - 4
 	if gap < 0 {
 		// Not enough space - truncate model info
@@ -497,6 +535,37 @@ func (m EnhancedModel) renderHeader() string {
 	return header
 }
 
+// renderContextGauge renders how full the model's context window is
+func (m EnhancedModel) renderContextGauge() string {
+	usage := m.contextUsage
+	if usage.Window <= 0 {
+		return ""
+	}
+
+	fraction := usage.Fraction()
+	color := successColor
+	threshold := m.agent.Config().Memory.CompressionThreshold
+	if threshold > 0 && fraction >= threshold {
+		color = errorColor
+	} else if fraction >= 0.5 {
+		color = accentColor
+	}
+
+	const width = 10
+	filled := int(fraction*width + 0.5)
+	if filled > width {
+		filled = width
+	}
+
+	style := lipgloss.NewStyle().Background(bgDark).Padding(0, 1)
+	bar := lipgloss.NewStyle().Foreground(color).Background(bgDark).Render(strings.Repeat("▰", filled)) +
+		lipgloss.NewStyle().Foreground(mutedColor).Background(bgDark).Render(strings.Repeat("▱", width-filled))
+	label := lipgloss.NewStyle().Foreground(textSecondary).Background(bgDark).
+		Render(fmt.Sprintf(" %d%% %s/%s", int(fraction*100+0.5), formatTokenCount(usage.Projected), formatTokenCount(usage.Window)))
+
+	return style.Render(bar + label)
+}
+
 // renderStatusBar renders an enhanced status bar
 func (m EnhancedModel) renderStatusBar() string {
 	// Status badge
@@ -532,19 +601,8 @@ func (m EnhancedModel) renderStatusBar() string {
 		stats["working"],
 		stats["long_term"])
 
-	// Context info with percentage
-	contextInfo := fmt.Sprintf("CTX:%d", m.contextStats.MessageCount)
-	var contextPercent string
-	if m.contextStats.MessageCount > 15 {
-		percent := int((float64(m.contextStats.MessageCount) / 50.0) * 100)
-		if percent > 100 {
-			percent = 100
-		}
-		contextPercent = fmt.Sprintf("(%d%%)", percent)
-		contextInfo = lipgloss.NewStyle().Foreground(accentColor).Render(contextInfo + contextPercent)
-	} else {
-		contextInfo = lipgloss.NewStyle().Foreground(textSecondary).Render(contextInfo)
-	}
+	// Context message count (window usage is shown in the header gauge)
+	contextInfo := lipgloss.NewStyle().Foreground(textSecondary).Render(fmt.Sprintf("CTX:%d", m.contextStats.MessageCount))
 
 	// Usage stats with prompt/completion breakdown
 	usage := m.agent.GetUsageStats()
@@ -707,8 +765,13 @@ func (m EnhancedModel) renderProcessingArea() string {
 		}
 	}
 
-	// Line 3: always empty — keeps fixed height at 3 inner lines
+	// Line 3: tool loop progress — keeps fixed height at 3 inner lines
 	line3 := ""
+	if len(m.subAgents) > 0 {
+		line3 = formatSubAgents(m.subAgents)
+	} else if m.progress != nil {
+		line3 = formatProgress(*m.progress)
+	}
 
 	inner := line1 + "\n" + line2 + "\n" + line3
 
@@ -722,6 +785,103 @@ func (m EnhancedModel) renderProcessingArea() string {
 	return processingStyle.Render(inner)
 }
 
+// finishTool marks the running tool with the given call ID as finished. Tools
+// run in parallel, so the current tool becomes the latest one still running.
+func (m *EnhancedModel) finishTool(id, status string, duration time.Duration, update func(t *ToolExecution)) {
+	for i := range m.activeTools {
+		tool := &m.activeTools[i]
+		if tool.Status != "running" || (id != "" && tool.ID != id) {
+			continue
+		}
+		tool.Status = status
+		tool.EndTime = time.Now()
+		if duration > 0 {
+			tool.EndTime = tool.StartTime.Add(duration)
+		}
+		update(tool)
+		break
+	}
+
+	m.currentTool = nil
+	for i := len(m.activeTools) - 1; i >= 0; i-- {
+		if m.activeTools[i].Status == "running" {
+			m.currentTool = &m.activeTools[i]
+			break
+		}
+	}
+}
+
+// updateSubAgent records the latest state of a delegated sub-agent
+func (m *EnhancedModel) updateSubAgent(p agent.SubAgentProgress) {
+	for i := range m.subAgents {
+		if m.subAgents[i].ID == p.ID {
+			m.subAgents[i] = p
+			return
+		}
+	}
+	m.subAgents = append(m.subAgents, p)
+}
+
+// formatSubAgents renders a one-line summary of delegated sub-agents
+func formatSubAgents(agents []agent.SubAgentProgress) string {
+	parts := make([]string, 0, len(agents))
+	for _, a := range agents {
+		switch a.State {
+		case "done":
+			parts = append(parts, fmt.Sprintf("#%d ✅ %s tok", a.ID, formatTokenCount(a.Tokens)))
+		case "failed":
+			parts = append(parts, fmt.Sprintf("#%d ❌", a.ID))
+		default:
+			parts = append(parts, fmt.Sprintf("#%d 🔄 step %d · %s tok", a.ID, a.Step, formatTokenCount(a.Tokens)))
+		}
+	}
+	return "🤖 Sub-agents: " + strings.Join(parts, " | ")
+}
+
+// formatProgress renders a one-line summary of tool loop progress against its budget
+func formatProgress(e agent.ProgressEvent) string {
+	parts := []string{}
+	if e.Budget.MaxSteps > 0 {
+		parts = append(parts, fmt.Sprintf("Step %d/%d", e.Step, e.Budget.MaxSteps))
+	} else {
+		parts = append(parts, fmt.Sprintf("Step %d", e.Step))
+	}
+	if e.Budget.MaxTokens > 0 {
+		parts = append(parts, fmt.Sprintf("%s/%s tok", formatTokenCount(e.Tokens), formatTokenCount(e.Budget.MaxTokens)))
+	} else {
+		parts = append(parts, fmt.Sprintf("%s tok", formatTokenCount(e.Tokens)))
+	}
+	if e.Spend > 0 || e.Budget.MaxSpend > 0 {
+		if e.Budget.MaxSpend > 0 {
+			parts = append(parts, fmt.Sprintf("$%.3f/$%.2f", e.Spend, e.Budget.MaxSpend))
+		} else {
+			parts = append(parts, fmt.Sprintf("$%.3f", e.Spend))
+		}
+	}
+	elapsed := e.Elapsed.Round(time.Second).String()
+	if e.Budget.MaxDuration > 0 {
+		elapsed += "/" + e.Budget.MaxDuration.String()
+	}
+	parts = append(parts, elapsed)
+
+	line := strings.Join(parts, " · ")
+	switch e.Type {
+	case agent.ProgressDeepExecution:
+		line += " · deep task"
+	case agent.ProgressBudgetExhausted:
+		line += " · ⏸️ " + e.Reason
+	}
+	return line
+}
+
+// formatTokenCount abbreviates token counts (e.g. 12.3k)
+func formatTokenCount(n int) string {
+	if n >= 1000 {
+		return fmt.Sprintf("%.1fk", float64(n)/1000)
+	}
+	return fmt.Sprintf("%d", n)
+}
+
 // renderHelpBar renders the help bar
 func (m EnhancedModel) renderHelpBar() string {
 	helpText := "↵ Send │ /help Commands │ ^C Quit"
@@ -920,6 +1080,19 @@ func (m EnhancedModel) sendCurrentMessage() (tea.Model, tea.Cmd) {
 		return m.handleCommand(input)
 	}
 
+	// Images referenced with @image: need a model that can see them
+	images := agent.ImageRefs(input)
+	if len(images) > 0 && !m.agent.SupportsVision() {
+		m.messageQueue.Add(QueuedMessage{
+			Role:      "error",
+			Content:   fmt.Sprintf("❌ %s does not accept images. Switch to a vision model with /model, or set \"vision\": true for it in model_parameters.", m.agent.Config().Model),
+			Timestamp: time.Now(),
+			Complete:  true,
+		})
+		m.updateViewport()
+		return m, nil
+	}
+
 	// Add user message
 	m.messageQueue.Add(QueuedMessage{
 		Role:      "user",
@@ -940,14 +1113,20 @@ func (m EnhancedModel) sendCurrentMessage() (tea.Model, tea.Cmd) {
 	m.textarea.Reset()
 	m.processing = true
 	m.status = "Processing request..."
+	if len(images) > 0 {
+		m.status = fmt.Sprintf("📎 Sending request with %d image(s)...", len(images))
+	}
+	m.progress = nil
+	m.subAgents = nil
 	m.activeTools = []ToolExecution{} // Clear old tools
 	if m.ready {
 		m.recalculateLayout()
 	}
 	m.updateViewport()
 
+	chatCmd := m.startChat(input)
 	return m, tea.Batch(
-		m.sendMessage(input),
+		chatCmd,
 		m.spinner.Tick,
 	)
 }
@@ -995,13 +1174,41 @@ func (m *EnhancedModel) renderContent(content string) string {
 }
 
 // sendMessage sends a message to the agent
-func (m EnhancedModel) sendMessage(input string) tea.Cmd {
+func (m EnhancedModel) sendMessage(ctx context.Context, input string) tea.Cmd {
 	return func() tea.Msg {
-		response, err := m.agent.Chat(input)
+		response, err := m.agent.ChatContext(ctx, input)
 		return responseCompleteMsg{content: response, err: err}
 	}
 }
 
+// startChat sends input to the agent under a fresh cancellable context
+func (m *EnhancedModel) startChat(input string) tea.Cmd {
+	ctx, cancel := context.WithCancel(context.Background())
+	m.chatCancel = cancel
+	return m.sendMessage(ctx, input)
+}
+
+// cancelChat aborts the in-flight agent turn, if any
+func (m *EnhancedModel) cancelChat() bool {
+	if m.chatCancel == nil {
+		return false
+	}
+	m.chatCancel()
+	m.chatCancel = nil
+	m.status = "Cancelling..."
+	return true
+}
+
+// isStopCommand reports whether input is /stop (or its alias)
+func isStopCommand(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+	name := strings.ToLower(fields[0])
+	return name == "/stop" || name == "/end"
+}
+
 // handleCommand handles slash commands (reuse from original)
 func (m EnhancedModel) handleCommand(input string) (tea.Model, tea.Cmd) {
 	parts := strings.Fields(input)
@@ -1039,23 +1246,57 @@ type responseCompleteMsg struct {
 }
 
 type toolStartMsg struct {
+	id       string
 	toolName string
 }
 
 type toolCompleteMsg struct {
-	result string
+	id       string
+	result   string
+	duration time.Duration
 }
 
 type toolErrorMsg struct {
-	err error
+	id       string
+	err      error
+	duration time.Duration
 }
 
 type thinkingMsg struct {
 	content string
 }
 
+type progressMsg struct {
+	event agent.ProgressEvent
+}
+
 type animationTickMsg struct{}
 
+// eventMsg converts an agent event into the TUI message that handles it, or nil.
+// Stream deltas arrive through the stream callback instead.
+func eventMsg(e agent.Event) tea.Msg {
+	switch e.Type {
+	case agent.EventToolStarted:
+		return toolStartMsg{id: e.Tool.ID, toolName: e.Tool.Name}
+	case agent.EventToolFinished:
+		duration := time.Duration(e.Tool.DurationMs) * time.Millisecond
+		if !e.Tool.Success {
+			return toolErrorMsg{id: e.Tool.ID, err: errors.New(e.Tool.Error), duration: duration}
+		}
+		return toolCompleteMsg{id: e.Tool.ID, result: e.Tool.Output, duration: duration}
+	case agent.EventProgress:
+		return progressMsg{event: *e.Progress}
+	case agent.EventReasoning:
+		return thinkingMsg{content: e.Message}
+	case agent.EventToolCallDelta:
+		return statusUpdateMsg{status: e.Message}
+	}
+	if summary := e.Summary(); summary != "" {
+		return statusUpdateMsg{status: summary}
+	}
+	return nil
+}
+
 // Helper commands
 func waitForStream() tea.Cmd {
 	return tea.Tick(50*time.Millisecond, func(t time.Time) tea.Msg {
@@ -1082,25 +1323,31 @@ func RunEnhanced(ag *agent.Agent, ctx ...context.Context) error {
 
 	p := tea.NewProgram(NewEnhancedModel(ag), opts...)
 
-	// Set status callback
-	ag.SetStatusCallback(func(s string) {
-		p.Send(statusUpdateMsg{status: s})
+	// Subscribe to agent events — status, tool activity and step/budget progress
+	unsubscribe := ag.Subscribe(func(e agent.Event) {
+		if msg := eventMsg(e); msg != nil {
+			p.Send(msg)
+		}
 	})
 
-	// Set streaming callback — sends each chunk to the TUI for live display
+	// Set streaming callback — sends each chunk to the TUI for live display.
+	// Every request of a tool loop streams its own reply; each starts a new paragraph.
+	separate := false
 	ag.SetStreamCallback(func(chunk string, done bool) {
 		if done {
+			separate = true
 			return // responseCompleteMsg will handle the final state
 		}
 		if chunk != "" {
-			p.Send(streamChunkMsg{chunk: chunk})
+			p.Send(streamChunkMsg{chunk: chunk, separate: separate})
+			separate = false
 		}
 	})
 
 	_, err := p.Run()
 
 	// Clear callbacks to prevent sends after program exits
-	ag.SetStatusCallback(nil)
+	unsubscribe()
 	ag.SetStreamCallback(nil)
 
 	return err
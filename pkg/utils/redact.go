@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secrets in recorded traffic and logs
+const Redacted = "[REDACTED]"
+
+// sensitiveHeaders carry credentials and are never recorded
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"x-api-key":           true,
+	"api-key":             true,
+	"x-goog-api-key":      true,
+	"cookie":              true,
+	"set-cookie":          true,
+}
+
+// sensitiveParams are query parameters that carry credentials
+var sensitiveParams = []string{"key", "api_key", "access_token", "token"}
+
+// sensitiveFormFields are form fields that carry credentials, as in OAuth token exchanges
+var sensitiveFormFields = []string{"code", "code_verifier", "refresh_token", "client_secret", "password"}
+
+// secretPatterns match credentials that may appear in bodies and URLs
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-[A-Za-z0-9_\-]{16,}`),                // OpenAI and Anthropic keys
+	regexp.MustCompile(`AIza[0-9A-Za-z_\-]{35}`),                // Google API keys
+	regexp.MustCompile(`(\bbot|\b)\d{8,10}:[A-Za-z0-9_\-]{35}`), // Telegram bot tokens, also in /bot<token>/ URLs
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._\-~+/]+=*`),  // Bearer tokens
+	regexp.MustCompile(`(?i)("(?:access_token|refresh_token|id_token|api_key|client_secret|code_verifier|code|state)"\s*:\s*")[^"]*(")`),
+}
+
+// IsSensitiveHeader reports whether an HTTP header carries credentials
+func IsSensitiveHeader(name string) bool {
+	return sensitiveHeaders[strings.ToLower(name)]
+}
+
+// RedactSecrets replaces known credential formats and the given literal
+// secrets (such as the configured API key) in s
+func RedactSecrets(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if len(secret) >= 8 {
+			s = strings.ReplaceAll(s, secret, Redacted)
+		}
+	}
+	for _, re := range secretPatterns {
+		if re.NumSubexp() == 0 {
+			s = re.ReplaceAllString(s, Redacted)
+		} else if re.NumSubexp() == 1 {
+			s = re.ReplaceAllString(s, "${1}"+Redacted)
+		} else {
+			s = re.ReplaceAllString(s, "${1}"+Redacted+"${2}")
+		}
+	}
+	return s
+}
+
+// RedactURL removes credentials from a URL's query string and path
+func RedactURL(rawURL string, secrets ...string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return RedactSecrets(rawURL, secrets...)
+	}
+	query := u.Query()
+	for _, param := range sensitiveParams {
+		if query.Has(param) {
+			query.Set(param, Redacted)
+		}
+	}
+	u.RawQuery = query.Encode()
+	return RedactSecrets(u.String(), secrets...)
+}
+
+// RedactForm replaces credential fields and the given literal secrets in a
+// URL-encoded form body
+func RedactForm(body string, secrets ...string) string {
+	form, err := url.ParseQuery(body)
+	if err != nil {
+		return RedactSecrets(body, secrets...)
+	}
+	for _, fields := range [][]string{sensitiveParams, sensitiveFormFields} {
+		for _, field := range fields {
+			if form.Has(field) {
+				form.Set(field, Redacted)
+			}
+		}
+	}
+	// Keep the marker readable rather than percent-encoded
+	encoded := strings.ReplaceAll(form.Encode(), url.QueryEscape(Redacted), Redacted)
+	return RedactSecrets(encoded, secrets...)
+}
@@ -2,6 +2,7 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -28,16 +29,28 @@ func DefaultRetryConfig() RetryConfig {
 
 // ExecuteWithRetry executes a function with exponential backoff and jitter
 func ExecuteWithRetry(operation func() error, config RetryConfig) error {
+	return ExecuteWithRetryContext(context.Background(), operation, config)
+}
+
+// ExecuteWithRetryContext is like ExecuteWithRetry but stops retrying as soon as ctx is done
+func ExecuteWithRetryContext(ctx context.Context, operation func() error, config RetryConfig) error {
 	var lastErr error
 	delay := config.InitialDelay
 
 	for i := 0; i <= config.MaxRetries; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		err := operation()
 		if err == nil {
 			return nil
 		}
 
 		lastErr = err
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		if i == config.MaxRetries {
 			break
 		}
@@ -46,7 +59,11 @@ func ExecuteWithRetry(operation func() error, config RetryConfig) error {
 		jitter := float64(delay) * config.JitterFactor
 		actualDelay := delay + time.Duration((rand.Float64()*2-1)*jitter)
 
-		time.Sleep(actualDelay)
+		select {
+		case <-time.After(actualDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 
 		// Exponential backoff
 		delay *= 2